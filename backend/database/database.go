@@ -6,6 +6,8 @@ import (
     "os"
     "time"
 
+    "coded/config"
+
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
@@ -16,16 +18,79 @@ var (
     DB     *mongo.Database
 )
 
+// Collection handles, set by ConnectDB. Every collection the app uses is
+// listed here and in collectionNames so the names live in one place;
+// handlers and $lookup stages go through these rather than spelling names
+// out.
+var (
+    Users         *mongo.Collection
+    Chats         *mongo.Collection
+    ChatSettings  *mongo.Collection
+    Messages      *mongo.Collection
+    Favorites     *mongo.Collection
+    Blocks        *mongo.Collection
+    Reports       *mongo.Collection
+    Matches       *mongo.Collection
+    Posts         *mongo.Collection
+    PostLikes     *mongo.Collection
+    RefreshTokens *mongo.Collection
+    Subscriptions *mongo.Collection // web push subscriptions
+)
+
+// Connection pool and timeout defaults; override with MONGO_MAX_POOL_SIZE,
+// MONGO_MIN_POOL_SIZE, MONGO_CONNECT_TIMEOUT and MONGO_SERVER_SELECTION_TIMEOUT
+const (
+    defaultMaxPoolSize            = 100
+    defaultMinPoolSize            = 5
+    defaultConnectTimeout         = 10 * time.Second
+    defaultServerSelectionTimeout = 5 * time.Second
+)
+
+// defaultDatabaseName is used when MONGODB_DATABASE is unset
+const defaultDatabaseName = "coded"
+
+// collectionNames maps each handle to its collection
+var collectionNames = map[**mongo.Collection]string{
+    &Users:         "users",
+    &Chats:         "chats",
+    &ChatSettings:  "chat_settings",
+    &Messages:      "messages",
+    &Favorites:     "favorites",
+    &Blocks:        "blocks",
+    &Reports:       "reports",
+    &Matches:       "matches",
+    &Posts:         "posts",
+    &PostLikes:     "post_likes",
+    &RefreshTokens: "refresh_tokens",
+    &Subscriptions: "subscriptions",
+}
+
+// initCollections points the collection handles at db
+func initCollections(db *mongo.Database) {
+    for handle, name := range collectionNames {
+        *handle = db.Collection(name)
+    }
+}
+
+// ConnectDB connects to MONGODB_URI and sets Client, DB and the collection
+// handles. Call EnsureIndexes afterwards.
 func ConnectDB() error {
     mongoURI := os.Getenv("MONGODB_URI")
     if mongoURI == "" {
         mongoURI = "mongodb://localhost:27017"
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    connectTimeout := config.Duration("MONGO_CONNECT_TIMEOUT", defaultConnectTimeout)
+
+    ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
     defer cancel()
 
-    clientOptions := options.Client().ApplyURI(mongoURI)
+    clientOptions := options.Client().
+        ApplyURI(mongoURI).
+        SetMaxPoolSize(uint64(config.Int("MONGO_MAX_POOL_SIZE", defaultMaxPoolSize))).
+        SetMinPoolSize(uint64(config.Int("MONGO_MIN_POOL_SIZE", defaultMinPoolSize))).
+        SetConnectTimeout(connectTimeout).
+        SetServerSelectionTimeout(config.Duration("MONGO_SERVER_SELECTION_TIMEOUT", defaultServerSelectionTimeout))
     client, err := mongo.Connect(ctx, clientOptions)
     if err != nil {
         return err
@@ -38,13 +103,12 @@ func ConnectDB() error {
     }
 
     Client = client
-    DB = client.Database("coded")
+    DB = client.Database(config.String("MONGODB_DATABASE", defaultDatabaseName))
+    initCollections(DB)
+    available.Store(true)
     
     log.Println("Connected to MongoDB successfully")
     
-    // Create indexes
-    CreateIndexes()
-    
     return nil
 }
 
@@ -52,101 +116,113 @@ func GetCollection(collectionName string) *mongo.Collection {
     return DB.Collection(collectionName)
 }
 
-func CreateIndexes() {
-    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-    defer cancel()
-
-    // Users collection indexes
-    usersColl := DB.Collection("users")
-    usersIndexes := []mongo.IndexModel{
-        {
-            Keys:    bson.D{{Key: "email", Value: 1}},
-            Options: options.Index().SetUnique(true),
-        },
-        {
-            Keys:    bson.D{{Key: "username", Value: 1}},
-            Options: options.Index().SetUnique(true).SetSparse(true),
-        },
-        {
-            Keys: bson.D{{Key: "location", Value: "2dsphere"}},
-        },
-        {
-            Keys: bson.D{{Key: "lastSeen", Value: -1}},
-        },
+// backfillUserLocations sets location from latitude/longitude on users that
+// don't have it yet. The (0,0) "no location" default and out of range pairs,
+// which the 2dsphere index would refuse, are left alone. Safe to run on every
+// start; once everyone is migrated the filter matches nothing.
+func backfillUserLocations(ctx context.Context, coll *mongo.Collection) {
+    filter := bson.M{
+        "location":  bson.M{"$exists": false},
+        "latitude":  bson.M{"$gte": -90, "$lte": 90},
+        "longitude": bson.M{"$gte": -180, "$lte": 180},
+        "$nor":      bson.A{bson.M{"latitude": 0, "longitude": 0}},
     }
-
-    // Chats collection indexes
-    chatsColl := DB.Collection("chats")
-    chatsIndexes := []mongo.IndexModel{
-        {
-            Keys:    bson.D{{Key: "participants", Value: 1}},
-            Options: options.Index().SetUnique(true),
-        },
-        {
-            Keys: bson.D{{Key: "lastMessageAt", Value: -1}},
-        },
+    update := mongo.Pipeline{
+        {{Key: "$set", Value: bson.M{
+            "location": bson.M{
+                "type":        "Point",
+                "coordinates": bson.A{"$longitude", "$latitude"},
+            },
+        }}},
     }
 
-    // Messages collection indexes
-    messagesColl := DB.Collection("messages")
-    messagesIndexes := []mongo.IndexModel{
-        {
-            Keys: bson.D{{Key: "chatId", Value: 1}, {Key: "createdAt", Value: -1}},
-        },
-        {
-            Keys: bson.D{{Key: "senderId", Value: 1}},
-        },
-        {
-            Keys: bson.D{{Key: "createdAt", Value: -1}},
-        },
+    result, err := coll.UpdateMany(ctx, filter, update)
+    if err != nil {
+        log.Printf("Error backfilling user locations: %v", err)
+        return
     }
-
-    // Favorites collection indexes
-    favoritesColl := DB.Collection("favorites")
-    favoritesIndexes := []mongo.IndexModel{
-        {
-            Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "targetUserId", Value: 1}},
-            Options: options.Index().SetUnique(true),
-        },
-        {
-            Keys: bson.D{{Key: "createdAt", Value: -1}},
-        },
+    if result.ModifiedCount > 0 {
+        log.Printf("Backfilled location for %d users", result.ModifiedCount)
     }
+}
 
-    // Posts collection indexes
-    postsColl := DB.Collection("posts")
-    postsIndexes := []mongo.IndexModel{
-        {
-            Keys: bson.D{{Key: "userId", Value: 1}},
-        },
-        {
-            Keys: bson.D{{Key: "createdAt", Value: -1}},
-        },
-        {
-            Keys: bson.D{{Key: "category", Value: 1}},
-        },
+// backfillMatches records a match for every pair of users who favorited each
+// other before the matches collection existed, dated by the later of the two
+// favorites. Pairs that already have a match keep it, so it is safe to run
+// on every start. It relies on the unique pairKey index.
+func backfillMatches(ctx context.Context, favorites, matches *mongo.Collection) {
+    before, err := matches.EstimatedDocumentCount(ctx)
+    if err != nil {
+        log.Printf("Error counting matches: %v", err)
+        return
     }
 
-    // Create all indexes
-    if _, err := usersColl.Indexes().CreateMany(ctx, usersIndexes); err != nil {
-        log.Printf("Error creating users indexes: %v", err)
+    // Take each pair once, from the side with the lower id, so the pair key
+    // comes out sorted like the one AddFavorite writes
+    pipeline := mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{"$expr": bson.M{"$lt": bson.A{"$userId", "$targetUserId"}}}}},
+        {{Key: "$lookup", Value: bson.M{
+            "from": favorites.Name(),
+            "let":  bson.M{"user": "$userId", "target": "$targetUserId"},
+            "pipeline": bson.A{
+                bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+                    bson.M{"$eq": bson.A{"$userId", "$$target"}},
+                    bson.M{"$eq": bson.A{"$targetUserId", "$$user"}},
+                }}}},
+                bson.M{"$project": bson.M{"createdAt": 1}},
+            },
+            "as": "reverse",
+        }}},
+        {{Key: "$unwind", Value: "$reverse"}},
+        {{Key: "$project", Value: bson.M{
+            "_id":       0,
+            "users":     bson.A{"$userId", "$targetUserId"},
+            "pairKey":   bson.M{"$concat": bson.A{bson.M{"$toString": "$userId"}, ":", bson.M{"$toString": "$targetUserId"}}},
+            "createdAt": bson.M{"$max": bson.A{"$createdAt", "$reverse.createdAt"}},
+        }}},
+        {{Key: "$merge", Value: bson.M{
+            "into":           matches.Name(),
+            "on":             "pairKey",
+            "whenMatched":    "keepExisting",
+            "whenNotMatched": "insert",
+        }}},
     }
 
-    if _, err := chatsColl.Indexes().CreateMany(ctx, chatsIndexes); err != nil {
-        log.Printf("Error creating chats indexes: %v", err)
+    cursor, err := favorites.Aggregate(ctx, pipeline)
+    if err != nil {
+        log.Printf("Error backfilling matches: %v", err)
+        return
     }
+    cursor.Close(ctx)
 
-    if _, err := messagesColl.Indexes().CreateMany(ctx, messagesIndexes); err != nil {
-        log.Printf("Error creating messages indexes: %v", err)
+    after, err := matches.EstimatedDocumentCount(ctx)
+    if err == nil && after > before {
+        log.Printf("Backfilled %d matches from mutual favorites", after-before)
     }
+}
 
-    if _, err := favoritesColl.Indexes().CreateMany(ctx, favoritesIndexes); err != nil {
-        log.Printf("Error creating favorites indexes: %v", err)
+// dropUniqueIndex drops the named index if it exists with a unique constraint
+func dropUniqueIndex(ctx context.Context, coll *mongo.Collection, name string) {
+    cursor, err := coll.Indexes().List(ctx)
+    if err != nil {
+        log.Printf("Error listing %s indexes: %v", coll.Name(), err)
+        return
     }
-
-    if _, err := postsColl.Indexes().CreateMany(ctx, postsIndexes); err != nil {
-        log.Printf("Error creating posts indexes: %v", err)
+    defer cursor.Close(ctx)
+
+    for cursor.Next(ctx) {
+        var index struct {
+            Name   string `bson:"name"`
+            Unique bool   `bson:"unique"`
+        }
+        if err := cursor.Decode(&index); err != nil || index.Name != name || !index.Unique {
+            continue
+        }
+        if _, err := coll.Indexes().DropOne(ctx, name); err != nil {
+            log.Printf("Error dropping %s.%s index: %v", coll.Name(), name, err)
+            return
+        }
+        log.Printf("Dropped unique index %s.%s", coll.Name(), name)
+        return
     }
-
-    log.Println("Database indexes created successfully")
 }
\ No newline at end of file
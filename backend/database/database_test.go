@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// handles lists every exported collection handle; keep it in step with the
+// var block in database.go
+func handles() map[string]**mongo.Collection {
+	return map[string]**mongo.Collection{
+		"users":          &Users,
+		"chats":          &Chats,
+		"chat_settings":  &ChatSettings,
+		"messages":       &Messages,
+		"favorites":      &Favorites,
+		"blocks":         &Blocks,
+		"reports":        &Reports,
+		"matches":        &Matches,
+		"posts":          &Posts,
+		"post_likes":     &PostLikes,
+		"refresh_tokens": &RefreshTokens,
+		"subscriptions":  &Subscriptions,
+	}
+}
+
+func checkHandles(t *testing.T, dbName string) {
+	t.Helper()
+	if len(collectionNames) != len(handles()) {
+		t.Fatalf("collectionNames has %d entries, want %d", len(collectionNames), len(handles()))
+	}
+	for name, handle := range handles() {
+		coll := *handle
+		if coll == nil {
+			t.Errorf("%s handle not set", name)
+			continue
+		}
+		if coll.Name() != name {
+			t.Errorf("%s handle points at %q", name, coll.Name())
+		}
+		if coll.Database().Name() != dbName {
+			t.Errorf("%s handle is in database %q, want %q", name, coll.Database().Name(), dbName)
+		}
+	}
+}
+
+func TestInitCollectionsSetsEveryHandle(t *testing.T) {
+	// Connect doesn't reach the server, so no MongoDB is needed
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	initCollections(client.Database("handles_test"))
+	checkHandles(t, "handles_test")
+
+	for _, spec := range indexSpecs() {
+		if spec.coll == nil {
+			t.Errorf("indexSpecs has a collection with no handle")
+		}
+	}
+}
+
+// TestConnectDBPopulatesHandles needs a server; set CODED_TEST_MONGODB_URI
+// to run it
+func TestConnectDBPopulatesHandles(t *testing.T) {
+	uri := os.Getenv("CODED_TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("CODED_TEST_MONGODB_URI not set")
+	}
+	t.Setenv("MONGODB_URI", uri)
+	t.Setenv("MONGODB_DATABASE", "coded_handles_test")
+
+	if err := ConnectDB(); err != nil {
+		t.Fatalf("ConnectDB: %v", err)
+	}
+	defer Client.Disconnect(context.Background())
+
+	if DB.Name() != "coded_handles_test" {
+		t.Errorf("DB = %q, want coded_handles_test", DB.Name())
+	}
+	checkHandles(t, "coded_handles_test")
+}
+
+// freshTestDB connects to an emptied dbName on CODED_TEST_MONGODB_URI, or
+// skips the test when no server is configured
+func freshTestDB(t *testing.T, dbName string) context.Context {
+	t.Helper()
+	uri := os.Getenv("CODED_TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("CODED_TEST_MONGODB_URI not set")
+	}
+	t.Setenv("MONGODB_URI", uri)
+	t.Setenv("MONGODB_DATABASE", dbName)
+
+	if err := ConnectDB(); err != nil {
+		t.Fatalf("ConnectDB: %v", err)
+	}
+	t.Cleanup(func() { Client.Disconnect(context.Background()) })
+
+	ctx := context.Background()
+	if err := DB.Drop(ctx); err != nil {
+		t.Fatalf("dropping database: %v", err)
+	}
+	return ctx
+}
+
+func TestEnsureIndexesCreatesHotPathIndexes(t *testing.T) {
+	ctx := freshTestDB(t, "coded_indexes_test")
+
+	// Twice: the second run must find everything in place
+	for i := 0; i < 2; i++ {
+		if err := EnsureIndexes(ctx); err != nil {
+			t.Fatalf("EnsureIndexes run %d: %v", i+1, err)
+		}
+	}
+
+	want := []struct {
+		coll   *mongo.Collection
+		keys   bson.D
+		unique bool
+	}{
+		{Users, bson.D{{Key: "email", Value: 1}}, true},
+		{Favorites, bson.D{{Key: "userId", Value: 1}, {Key: "targetUserId", Value: 1}}, true},
+		{Messages, bson.D{{Key: "chatId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		{Chats, bson.D{{Key: "participants", Value: 1}}, false},
+		{Subscriptions, bson.D{{Key: "userId", Value: 1}}, false},
+	}
+	for _, w := range want {
+		cursor, err := w.coll.Indexes().List(ctx)
+		if err != nil {
+			t.Fatalf("listing %s indexes: %v", w.coll.Name(), err)
+		}
+		var indexes []struct {
+			Key    bson.D `bson:"key"`
+			Unique bool   `bson:"unique"`
+		}
+		if err := cursor.All(ctx, &indexes); err != nil {
+			t.Fatalf("decoding %s indexes: %v", w.coll.Name(), err)
+		}
+
+		found := false
+		for _, index := range indexes {
+			// The server may hand the directions back as any numeric type
+			if fmt.Sprint(index.Key) == fmt.Sprint(w.keys) {
+				found = true
+				if index.Unique != w.unique {
+					t.Errorf("%s index %v unique = %v, want %v", w.coll.Name(), w.keys, index.Unique, w.unique)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s has no index on %v", w.coll.Name(), w.keys)
+		}
+	}
+}
+
+func TestEnsureIndexesRelaxesUniqueParticipants(t *testing.T) {
+	ctx := freshTestDB(t, "coded_indexes_test")
+
+	// What older deployments created
+	_, err := Chats.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "participants", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		t.Fatalf("creating legacy index: %v", err)
+	}
+	if err := EnsureIndexes(ctx); err != nil {
+		t.Fatalf("EnsureIndexes: %v", err)
+	}
+
+	alice := primitive.NewObjectID()
+	for i := 0; i < 2; i++ {
+		chat := bson.M{"participants": bson.A{alice, primitive.NewObjectID()}}
+		if _, err := Chats.InsertOne(ctx, chat); err != nil {
+			t.Fatalf("second chat for the same user rejected: %v", err)
+		}
+	}
+}
+
+func TestBackfillMatches(t *testing.T) {
+	ctx := freshTestDB(t, "coded_backfill_test")
+	if err := EnsureIndexes(ctx); err != nil {
+		t.Fatalf("EnsureIndexes: %v", err)
+	}
+
+	alice, bob, carol := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	favorites := []interface{}{
+		bson.M{"userId": alice, "targetUserId": bob, "createdAt": int64(100)},
+		bson.M{"userId": bob, "targetUserId": alice, "createdAt": int64(200)},
+		bson.M{"userId": alice, "targetUserId": carol, "createdAt": int64(300)}, // one-sided
+	}
+	if _, err := Favorites.InsertMany(ctx, favorites); err != nil {
+		t.Fatalf("inserting favorites: %v", err)
+	}
+
+	// Run twice: the second pass must not duplicate anything
+	backfillMatches(ctx, Favorites, Matches)
+	backfillMatches(ctx, Favorites, Matches)
+
+	var matches []struct {
+		Users     []primitive.ObjectID `bson:"users"`
+		PairKey   string               `bson:"pairKey"`
+		CreatedAt int64                `bson:"createdAt"`
+	}
+	cursor, err := Matches.Find(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("finding matches: %v", err)
+	}
+	if err := cursor.All(ctx, &matches); err != nil {
+		t.Fatalf("decoding matches: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("backfill created %d matches, want 1", len(matches))
+	}
+
+	ids := []string{alice.Hex(), bob.Hex()}
+	sort.Strings(ids)
+	if want := strings.Join(ids, ":"); matches[0].PairKey != want {
+		t.Errorf("pairKey = %q, want %q", matches[0].PairKey, want)
+	}
+	if matches[0].CreatedAt != 200 {
+		t.Errorf("createdAt = %d, want the later favorite's 200", matches[0].CreatedAt)
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// available tracks whether the last ping to MongoDB succeeded. It is set by
+// ConnectDB and kept current by MonitorConnection.
+var available atomic.Bool
+
+// Available reports whether MongoDB is connected and answering pings
+func Available() bool {
+	return Client != nil && available.Load()
+}
+
+// MonitorConnection pings MongoDB every interval and updates Available,
+// logging when the connection drops or recovers. It blocks, so run it in a
+// goroutine.
+func MonitorConnection(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if Client == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := Client.Ping(ctx, nil)
+		cancel()
+
+		up := err == nil
+		if was := available.Swap(up); was != up {
+			if up {
+				log.Println("✅ MongoDB connection restored")
+			} else {
+				log.Printf("❌ MongoDB unavailable: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collectionIndexes lists the indexes one collection needs
+type collectionIndexes struct {
+	coll    *mongo.Collection
+	indexes []mongo.IndexModel
+}
+
+// indexSpecs returns every index the app relies on, per collection. The
+// handles must be set, so call it after ConnectDB.
+func indexSpecs() []collectionIndexes {
+	return []collectionIndexes{
+		{Users, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "username", Value: 1}},
+				Options: options.Index().SetUnique(true).SetSparse(true),
+			},
+			{
+				Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+			},
+			{
+				Keys: bson.D{{Key: "lastSeen", Value: -1}},
+			},
+			{
+				Keys:    bson.D{{Key: "verificationTokenHash", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			},
+		}},
+		{Chats, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "participants", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "participantsKey", Value: 1}},
+				Options: options.Index().SetUnique(true).SetSparse(true),
+			},
+			{
+				Keys: bson.D{{Key: "lastMessageAt", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "createdBy", Value: 1}, {Key: "createdAt", Value: -1}},
+			},
+		}},
+		{Messages, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "chatId", Value: 1}, {Key: "createdAt", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "senderId", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "createdAt", Value: -1}},
+			},
+		}},
+		{Favorites, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "targetUserId", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "createdAt", Value: -1}},
+			},
+		}},
+		// targetUserId serves the reverse lookup
+		{Blocks, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "targetUserId", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "targetUserId", Value: 1}},
+			},
+		}},
+		{Reports, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "reporterId", Value: 1}, {Key: "targetUserId", Value: 1}, {Key: "createdAt", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "createdAt", Value: -1}},
+			},
+		}},
+		{Matches, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "pairKey", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "users", Value: 1}, {Key: "createdAt", Value: -1}},
+			},
+		}},
+		{Posts, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "createdAt", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "category", Value: 1}},
+			},
+		}},
+		{PostLikes, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "postId", Value: 1}, {Key: "userId", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}},
+			},
+		}},
+		{RefreshTokens, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastUsedAt", Value: -1}},
+			},
+		}},
+		{ChatSettings, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "chatId", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "chatId", Value: 1}, {Key: "muted", Value: 1}},
+			},
+		}},
+		// Looked up by user on every push notification
+		{Subscriptions, []mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}},
+			},
+		}},
+	}
+}
+
+// EnsureIndexes creates any missing indexes and runs the startup data
+// migrations they depend on. It is idempotent: indexes that already exist
+// are left alone, and only newly created ones are logged. Every collection
+// is attempted; the returned error lists the ones that failed.
+func EnsureIndexes(ctx context.Context) error {
+	// Older deployments created participants_1 as unique, which on an array
+	// field stops a user from being in more than one chat. Drop it so it can
+	// be recreated as a plain index.
+	dropUniqueIndex(ctx, Chats, "participants_1")
+
+	// Users saved before the GeoJSON field existed only have latitude and
+	// longitude; fill it in so $geoNear finds them
+	backfillUserLocations(ctx, Users)
+
+	var failed []string
+	for _, spec := range indexSpecs() {
+		created, err := ensureCollectionIndexes(ctx, spec.coll, spec.indexes)
+		if err != nil {
+			log.Printf("Error creating %s indexes: %v", spec.coll.Name(), err)
+			failed = append(failed, spec.coll.Name())
+			continue
+		}
+		for _, name := range created {
+			log.Printf("Created index %s.%s", spec.coll.Name(), name)
+		}
+	}
+
+	// Mutual favorites from before matches were recorded; needs the pairKey
+	// index, so it runs once indexes are in place
+	if !slices.Contains(failed, Matches.Name()) {
+		backfillMatches(ctx, Favorites, Matches)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to create indexes for %v", failed)
+	}
+	log.Println("Database indexes are up to date")
+	return nil
+}
+
+// ensureCollectionIndexes creates indexes on coll and returns the names of
+// the ones that didn't exist before
+func ensureCollectionIndexes(ctx context.Context, coll *mongo.Collection, indexes []mongo.IndexModel) ([]string, error) {
+	existing, err := indexNames(ctx, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := coll.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, name := range names {
+		if !existing[name] {
+			created = append(created, name)
+		}
+	}
+	return created, nil
+}
+
+// indexNames returns the names of coll's current indexes. A collection that
+// doesn't exist yet simply has none.
+func indexNames(ctx context.Context, coll *mongo.Collection) (map[string]bool, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	names := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var index struct {
+			Name string `bson:"name"`
+		}
+		if err := cursor.Decode(&index); err != nil {
+			return nil, err
+		}
+		names[index.Name] = true
+	}
+	return names, cursor.Err()
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// transactionsUnsupported reports whether err means the deployment is a
+// standalone server, which can't run multi-document transactions
+func transactionsUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 20 { // IllegalOperation
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "Transaction numbers are only allowed")
+}
+
+// accountCleanup deletes one user's data and counts what was removed per
+// collection. In best-effort mode a failed step is logged and the rest
+// still run; otherwise the first failure stops it (and aborts the
+// surrounding transaction).
+type accountCleanup struct {
+	userID     primitive.ObjectID
+	bestEffort bool
+	removed    map[string]int64
+	failed     []string
+}
+
+// step records the result of one cleanup operation
+func (a *accountCleanup) step(name string, n int64, err error) error {
+	if err != nil {
+		if !a.bestEffort {
+			return err
+		}
+		log.Printf("[DeleteAccount] %s cleanup failed for %s: %v", name, a.userID.Hex(), err)
+		a.failed = append(a.failed, name)
+		return nil
+	}
+	a.removed[name] += n
+	return nil
+}
+
+// run performs the cleanup. Direct chats go entirely (with their messages)
+// since the other side can't talk to a deleted account; groups just lose
+// the member, are deleted once empty, and get a new admin if needed.
+func (a *accountCleanup) run(ctx context.Context) error {
+	chatsColl := database.Chats
+	userID := a.userID
+
+	deleteMany := func(coll *mongo.Collection, filter interface{}) error {
+		var n int64
+		result, err := coll.DeleteMany(ctx, filter)
+		if err == nil {
+			n = result.DeletedCount
+		}
+		return a.step(coll.Name(), n, err)
+	}
+
+	// Direct chats
+	directIDs, err := aggregateIDs(ctx, chatsColl, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"participants": userID, "type": bson.M{"$ne": models.ChatTypeGroup}}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	})
+	if err := a.step("chats", 0, err); err != nil {
+		return err
+	}
+	if len(directIDs) > 0 {
+		if err := deleteMany(database.Messages, bson.M{"chatId": bson.M{"$in": directIDs}}); err != nil {
+			return err
+		}
+		if err := deleteMany(database.Chats, bson.M{"_id": bson.M{"$in": directIDs}}); err != nil {
+			return err
+		}
+	}
+
+	// Group memberships
+	groupIDs, err := aggregateIDs(ctx, chatsColl, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"participants": userID, "type": models.ChatTypeGroup}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	})
+	if err := a.step("chatMemberships", 0, err); err != nil {
+		return err
+	}
+	if len(groupIDs) > 0 {
+		result, err := chatsColl.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": groupIDs}},
+			bson.M{"$pull": bson.M{"participants": userID, "admins": userID}},
+		)
+		var pulled int64
+		if err == nil {
+			pulled = result.ModifiedCount
+		}
+		if err := a.step("chatMemberships", pulled, err); err != nil {
+			return err
+		}
+
+		emptyIDs, err := aggregateIDs(ctx, chatsColl, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"_id": bson.M{"$in": groupIDs}, "participants": bson.M{"$size": 0}}}},
+			{{Key: "$project", Value: bson.M{"_id": 1}}},
+		})
+		if err := a.step("chats", 0, err); err != nil {
+			return err
+		}
+		if len(emptyIDs) > 0 {
+			if err := deleteMany(database.Messages, bson.M{"chatId": bson.M{"$in": emptyIDs}}); err != nil {
+				return err
+			}
+			if err := deleteMany(database.Chats, bson.M{"_id": bson.M{"$in": emptyIDs}}); err != nil {
+				return err
+			}
+		}
+
+		// Groups left without an admin promote their longest-standing member
+		_, err = chatsColl.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": groupIDs}, "admins": bson.M{"$size": 0}, "participants.0": bson.M{"$exists": true}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.D{
+				{Key: "admins", Value: bson.A{bson.D{{Key: "$arrayElemAt", Value: bson.A{"$participants", 0}}}}},
+			}}}},
+		)
+		if err := a.step("chatMemberships", 0, err); err != nil {
+			return err
+		}
+	}
+
+	// Messages the user sent in groups that live on
+	if err := deleteMany(database.Messages, bson.M{"senderId": userID}); err != nil {
+		return err
+	}
+
+	// Likes on the user's posts, before the posts themselves go
+	postIDs, err := aggregateIDs(ctx, database.Posts, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userID}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	})
+	if err := a.step("post_likes", 0, err); err != nil {
+		return err
+	}
+	if len(postIDs) > 0 {
+		if err := deleteMany(database.PostLikes, bson.M{"postId": bson.M{"$in": postIDs}}); err != nil {
+			return err
+		}
+	}
+
+	either := func(field, other string) bson.M {
+		return bson.M{"$or": bson.A{bson.M{field: userID}, bson.M{other: userID}}}
+	}
+	for _, cleanup := range []struct {
+		coll   *mongo.Collection
+		filter interface{}
+	}{
+		{database.Posts, bson.M{"userId": userID}},
+		{database.PostLikes, bson.M{"userId": userID}},
+		{database.Favorites, either("userId", "targetUserId")},
+		{database.Matches, bson.M{"users": userID}},
+		{database.Blocks, either("userId", "targetUserId")},
+		{database.Subscriptions, bson.M{"userId": userID}},
+		{database.RefreshTokens, bson.M{"userId": userID}},
+		{database.ChatSettings, bson.M{"userId": userID}},
+		{database.Users, bson.M{"_id": userID}},
+	} {
+		if err := deleteMany(cleanup.coll, cleanup.filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAccount permanently deletes the caller's account and everything
+// tied to it, returning how many documents were removed per collection.
+// On a replica set it runs in one transaction; a standalone server gets a
+// best-effort pass where failed steps are logged and reported.
+func DeleteAccount(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	cleanup := &accountCleanup{userID: userID}
+	transactional := true
+
+	session, err := database.Client.StartSession()
+	if err == nil {
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			// Transactions can be retried; start the counts over each time
+			cleanup.removed = map[string]int64{}
+			return nil, cleanup.run(sc)
+		})
+		session.EndSession(ctx)
+	}
+	if transactionsUnsupported(err) {
+		transactional = false
+		cleanup.bestEffort = true
+		cleanup.removed = map[string]int64{}
+		err = cleanup.run(ctx)
+	}
+	if err != nil {
+		log.Printf("[DeleteAccount] Failed to delete %s: %v", userID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	log.Printf("[DeleteAccount] Deleted %s (transactional=%v): %v", userID.Hex(), transactional, cleanup.removed)
+
+	response := gin.H{
+		"message":       "Account deleted",
+		"deleted":       cleanup.removed,
+		"transactional": transactional,
+	}
+	if len(cleanup.failed) > 0 {
+		response["failed"] = cleanup.failed
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTransactionsUnsupported(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{mongo.CommandError{Code: 20, Message: "Transaction numbers are only allowed on a replica set member or mongos"}, true},
+		{errors.New("(IllegalOperation) Transaction numbers are only allowed on a replica set member or mongos"), true},
+		{mongo.CommandError{Code: 11000, Message: "duplicate key"}, false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := transactionsUnsupported(tt.err); got != tt.want {
+			t.Errorf("transactionsUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func insertDocs(t *testing.T, ctx context.Context, coll *mongo.Collection, docs ...interface{}) {
+	t.Helper()
+	result, err := coll.InsertMany(ctx, docs)
+	if err != nil {
+		t.Fatalf("inserting into %s: %v", coll.Name(), err)
+	}
+	t.Cleanup(func() {
+		coll.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": result.InsertedIDs}})
+	})
+}
+
+func TestDeleteAccountRemovesEverythingOfTheUser(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	now := time.Now().Unix()
+
+	// Chats: a direct chat, a group alice runs alone, a group only she is in
+	direct := insertDirectChat(t, ctx, alice, bob)
+	group, solo := primitive.NewObjectID(), primitive.NewObjectID()
+	insertDocs(t, ctx, database.Chats,
+		models.Chat{ID: group, Type: models.ChatTypeGroup, Name: "g", Participants: []primitive.ObjectID{alice, bob, carol}, Admins: []primitive.ObjectID{alice}},
+		models.Chat{ID: solo, Type: models.ChatTypeGroup, Name: "solo", Participants: []primitive.ObjectID{alice}, Admins: []primitive.ObjectID{alice}},
+	)
+	insertUnread(t, ctx, direct, bob, 2)
+	insertUnread(t, ctx, group, alice, 2)
+	bobInGroup := insertUnread(t, ctx, group, bob, 1)
+	insertUnread(t, ctx, solo, alice, 1)
+
+	// Posts and likes, hers and on hers
+	alicePost := insertPosts(t, ctx, alice, now)[0]
+	bobPost := insertPosts(t, ctx, bob, now)[0]
+	insertDocs(t, ctx, database.PostLikes,
+		models.PostLike{ID: primitive.NewObjectID(), PostID: alicePost, UserID: bob, CreatedAt: now},
+		models.PostLike{ID: primitive.NewObjectID(), PostID: bobPost, UserID: alice, CreatedAt: now},
+		models.PostLike{ID: primitive.NewObjectID(), PostID: bobPost, UserID: carol, CreatedAt: now},
+	)
+
+	// Relationships in both directions
+	insertDocs(t, ctx, database.Favorites,
+		models.Favorite{ID: primitive.NewObjectID(), UserID: alice, TargetUserID: bob, CreatedAt: now},
+		models.Favorite{ID: primitive.NewObjectID(), UserID: bob, TargetUserID: alice, CreatedAt: now},
+		models.Favorite{ID: primitive.NewObjectID(), UserID: bob, TargetUserID: carol, CreatedAt: now},
+	)
+	insertDocs(t, ctx, database.Matches,
+		models.Match{ID: primitive.NewObjectID(), Users: []primitive.ObjectID{alice, bob}, PairKey: participantsKey([]primitive.ObjectID{alice, bob}), CreatedAt: now},
+	)
+	insertDocs(t, ctx, database.Blocks,
+		models.Block{ID: primitive.NewObjectID(), UserID: alice, TargetUserID: carol, CreatedAt: now},
+		models.Block{ID: primitive.NewObjectID(), UserID: carol, TargetUserID: alice, CreatedAt: now},
+	)
+
+	// Per-user records
+	insertDocs(t, ctx, database.Subscriptions, bson.M{"_id": primitive.NewObjectID(), "userId": alice})
+	insertDocs(t, ctx, database.RefreshTokens,
+		models.RefreshToken{ID: primitive.NewObjectID(), UserID: alice, TokenHash: primitive.NewObjectID().Hex(), CreatedAt: now, ExpiresAt: now + 3600},
+	)
+	insertDocs(t, ctx, database.ChatSettings,
+		models.ChatSettings{ID: primitive.NewObjectID(), ChatID: group, UserID: alice, Pinned: true, UpdatedAt: now},
+	)
+
+	w := testRequest(t, DeleteAccount, http.MethodDelete, "/api/me", nil, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	if failed := decodeBody(t, w)["failed"]; failed != nil {
+		t.Errorf("cleanup steps failed: %v", failed)
+	}
+
+	for _, check := range []struct {
+		coll   *mongo.Collection
+		filter bson.M
+	}{
+		{database.Users, bson.M{"_id": alice}},
+		{database.Chats, bson.M{"participants": alice}},
+		{database.Chats, bson.M{"_id": bson.M{"$in": bson.A{direct, solo}}}},
+		{database.Messages, bson.M{"senderId": alice}},
+		{database.Messages, bson.M{"chatId": bson.M{"$in": bson.A{direct, solo}}}},
+		{database.Posts, bson.M{"userId": alice}},
+		{database.PostLikes, bson.M{"$or": bson.A{bson.M{"userId": alice}, bson.M{"postId": alicePost}}}},
+		{database.Favorites, bson.M{"$or": bson.A{bson.M{"userId": alice}, bson.M{"targetUserId": alice}}}},
+		{database.Matches, bson.M{"users": alice}},
+		{database.Blocks, bson.M{"$or": bson.A{bson.M{"userId": alice}, bson.M{"targetUserId": alice}}}},
+		{database.Subscriptions, bson.M{"userId": alice}},
+		{database.RefreshTokens, bson.M{"userId": alice}},
+		{database.ChatSettings, bson.M{"userId": alice}},
+	} {
+		if n, err := check.coll.CountDocuments(ctx, check.filter); err != nil || n != 0 {
+			t.Errorf("%s still has %d documents matching %v (err %v)", check.coll.Name(), n, check.filter, err)
+		}
+	}
+
+	// Everyone else's data stays, and the group gets a new admin
+	var remaining models.Chat
+	if err := database.Chats.FindOne(ctx, bson.M{"_id": group}).Decode(&remaining); err != nil {
+		t.Fatalf("group with other members was deleted: %v", err)
+	}
+	if len(remaining.Participants) != 2 || len(remaining.Admins) != 1 || remaining.Admins[0] == alice {
+		t.Errorf("group left with participants %v and admins %v", remaining.Participants, remaining.Admins)
+	}
+	for _, check := range []struct {
+		coll   *mongo.Collection
+		filter bson.M
+	}{
+		{database.Messages, bson.M{"_id": bobInGroup[0]}},
+		{database.Posts, bson.M{"_id": bobPost}},
+		{database.PostLikes, bson.M{"postId": bobPost, "userId": carol}},
+		{database.Favorites, bson.M{"userId": bob, "targetUserId": carol}},
+		{database.Users, bson.M{"_id": bob}},
+	} {
+		if n, _ := check.coll.CountDocuments(ctx, check.filter); n != 1 {
+			t.Errorf("%s lost a document matching %v that wasn't the deleted user's", check.coll.Name(), check.filter)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetWebSocketStats returns per-connection heartbeat and traffic stats keyed
+// by userID, for diagnosing dropped connections
+func GetWebSocketStats(c *gin.Context) {
+	if wsManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket manager not running"})
+		return
+	}
+
+	stats := wsManager.ClientStats()
+	connections := 0
+	for _, clients := range stats {
+		connections += len(clients)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":       len(stats),
+		"connections": connections,
+		"clients":     stats,
+		"time":        time.Now().Unix(),
+	})
+}
+
+// CleanupOrphans drops deleted users from the chats that still list them
+// and removes chats left with fewer than two members, along with messages
+// whose chat no longer exists (including chats removed in the same run).
+// Group chats that keep two or more members survive with the missing users
+// pulled out. With ?dryRun=true it only reports what would change.
+func CleanupOrphans(c *gin.Context) {
+	dryRun := c.Query("dryRun") == "true"
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	chatsColl := database.Chats
+	messagesColl := database.Messages
+
+	// Chats where fewer participants resolve to users than are listed
+	cursor, err := chatsColl.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: database.Users.Name()},
+			{Key: "localField", Value: "participants"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "users"},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "$expr", Value: bson.D{
+			{Key: "$lt", Value: bson.A{bson.D{{Key: "$size", Value: "$users"}}, bson.D{{Key: "$size", Value: "$participants"}}}},
+		}}}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "missing", Value: bson.D{{Key: "$setDifference", Value: bson.A{"$participants", "$users._id"}}}},
+			{Key: "remaining", Value: bson.D{{Key: "$size", Value: "$users"}}},
+		}}},
+	})
+	if err != nil {
+		log.Printf("[CleanupOrphans] Chat scan failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan chats"})
+		return
+	}
+	var brokenChats []orphanedChat
+	if err := cursor.All(ctx, &brokenChats); err != nil {
+		log.Printf("[CleanupOrphans] Chat scan failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan chats"})
+		return
+	}
+	orphanChatIDs, prunedChats := planOrphanChats(brokenChats)
+	removedParticipants := 0
+	for _, chat := range prunedChats {
+		removedParticipants += len(chat.Missing)
+	}
+
+	// Messages whose chat is missing or about to be removed
+	orphanMessageIDs, err := aggregateIDs(ctx, messagesColl, mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: database.Chats.Name()},
+			{Key: "localField", Value: "chatId"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "chat"},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "chat", Value: bson.D{{Key: "$size", Value: 0}}}},
+			bson.D{{Key: "chatId", Value: bson.D{{Key: "$in", Value: orphanChatIDs}}}},
+		}}}}},
+		{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		log.Printf("[CleanupOrphans] Message scan failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan messages"})
+		return
+	}
+
+	response := gin.H{
+		"dryRun":              dryRun,
+		"orphanChats":         len(orphanChatIDs),
+		"orphanMessages":      len(orphanMessageIDs),
+		"prunedChats":         len(prunedChats),
+		"removedParticipants": removedParticipants,
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	for _, chat := range prunedChats {
+		_, err := chatsColl.UpdateByID(ctx, chat.ID, bson.M{"$pull": bson.M{
+			"participants": bson.M{"$in": chat.Missing},
+			"admins":       bson.M{"$in": chat.Missing},
+		}})
+		if err != nil {
+			log.Printf("[CleanupOrphans] Pruning chat %s failed: %v", chat.ID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prune chats"})
+			return
+		}
+	}
+
+	var deletedChats, deletedMessages int64
+	if len(orphanChatIDs) > 0 {
+		result, err := chatsColl.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": orphanChatIDs}})
+		if err != nil {
+			log.Printf("[CleanupOrphans] Chat delete failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete chats"})
+			return
+		}
+		deletedChats = result.DeletedCount
+	}
+	if len(orphanMessageIDs) > 0 {
+		result, err := messagesColl.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": orphanMessageIDs}})
+		if err != nil {
+			log.Printf("[CleanupOrphans] Message delete failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete messages"})
+			return
+		}
+		deletedMessages = result.DeletedCount
+	}
+
+	log.Printf("🧹 Orphan cleanup removed %d chats and %d messages, pruned %d chats", deletedChats, deletedMessages, len(prunedChats))
+
+	response["deletedChats"] = deletedChats
+	response["deletedMessages"] = deletedMessages
+	c.JSON(http.StatusOK, response)
+}
+
+// orphanedChat is a chat with participants that no longer resolve to users
+type orphanedChat struct {
+	ID        primitive.ObjectID   `bson:"_id"`
+	Missing   []primitive.ObjectID `bson:"missing"`
+	Remaining int                  `bson:"remaining"`
+}
+
+// planOrphanChats splits chats with missing participants into those to
+// delete, left with fewer than two members, and those to prune in place
+func planOrphanChats(chats []orphanedChat) (deleteIDs []primitive.ObjectID, prune []orphanedChat) {
+	deleteIDs = []primitive.ObjectID{}
+	for _, chat := range chats {
+		if chat.Remaining < 2 {
+			deleteIDs = append(deleteIDs, chat.ID)
+		} else {
+			prune = append(prune, chat)
+		}
+	}
+	return deleteIDs, prune
+}
+
+// aggregateIDs runs a pipeline that projects _id and collects the ids
+func aggregateIDs(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline) ([]primitive.ObjectID, error) {
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
\ No newline at end of file
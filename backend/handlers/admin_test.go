@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"coded/database"
+	"coded/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlanOrphanChats(t *testing.T) {
+	direct := orphanedChat{ID: primitive.NewObjectID(), Missing: []primitive.ObjectID{primitive.NewObjectID()}, Remaining: 1}
+	group := orphanedChat{ID: primitive.NewObjectID(), Missing: []primitive.ObjectID{primitive.NewObjectID()}, Remaining: 2}
+	emptied := orphanedChat{ID: primitive.NewObjectID(), Missing: []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}, Remaining: 0}
+
+	deleteIDs, prune := planOrphanChats([]orphanedChat{direct, group, emptied})
+	if len(deleteIDs) != 2 || deleteIDs[0] != direct.ID || deleteIDs[1] != emptied.ID {
+		t.Errorf("deleteIDs = %v, want [%s %s]", deleteIDs, direct.ID.Hex(), emptied.ID.Hex())
+	}
+	if len(prune) != 1 || prune[0].ID != group.ID {
+		t.Errorf("prune = %v, want only %s", prune, group.ID.Hex())
+	}
+
+	if deleteIDs, _ := planOrphanChats(nil); deleteIDs == nil {
+		t.Error("deleteIDs is nil for no chats; $in needs an empty array")
+	}
+}
+
+// orphanFixture holds a direct chat and a group chat that each list one
+// deleted user, plus a message in each
+type orphanFixture struct {
+	direct, group           primitive.ObjectID
+	directMsg, groupMsg     primitive.ObjectID
+	alice, bob, carol, gone primitive.ObjectID
+}
+
+func insertOrphanFixture(t *testing.T, ctx context.Context) orphanFixture {
+	t.Helper()
+	f := orphanFixture{
+		direct: primitive.NewObjectID(), group: primitive.NewObjectID(),
+		directMsg: primitive.NewObjectID(), groupMsg: primitive.NewObjectID(),
+		alice: insertTestUser(t, ctx, nil), bob: insertTestUser(t, ctx, nil),
+		carol: insertTestUser(t, ctx, nil), gone: primitive.NewObjectID(),
+	}
+	chats := []interface{}{
+		models.Chat{ID: f.direct, Type: models.ChatTypeDirect, Participants: []primitive.ObjectID{f.alice, f.gone}},
+		models.Chat{ID: f.group, Type: models.ChatTypeGroup, Name: "survivors",
+			Participants: []primitive.ObjectID{f.alice, f.bob, f.carol, f.gone},
+			Admins:       []primitive.ObjectID{f.gone, f.alice}},
+	}
+	if _, err := database.Chats.InsertMany(ctx, chats); err != nil {
+		t.Fatalf("inserting chats: %v", err)
+	}
+	messages := []interface{}{
+		bson.M{"_id": f.directMsg, "chatId": f.direct, "senderId": f.alice, "content": "hi"},
+		bson.M{"_id": f.groupMsg, "chatId": f.group, "senderId": f.bob, "content": "hey"},
+	}
+	if _, err := database.Messages.InsertMany(ctx, messages); err != nil {
+		t.Fatalf("inserting messages: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		database.Chats.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": bson.A{f.direct, f.group}}})
+		database.Messages.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": bson.A{f.directMsg, f.groupMsg}}})
+	})
+	return f
+}
+
+func countIDs(t *testing.T, ctx context.Context, coll string, ids ...primitive.ObjectID) int64 {
+	t.Helper()
+	n, err := database.DB.Collection(coll).CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		t.Fatalf("counting %s: %v", coll, err)
+	}
+	return n
+}
+
+func TestCleanupOrphansDryRun(t *testing.T) {
+	ctx := requireDB(t)
+	f := insertOrphanFixture(t, ctx)
+
+	w := testRequest(t, CleanupOrphans, http.MethodPost, "/api/admin/cleanup-orphans?dryRun=true", nil, "", nil)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeBody(t, w)
+	if body["orphanChats"] != 1.0 || body["orphanMessages"] != 1.0 || body["prunedChats"] != 1.0 || body["removedParticipants"] != 1.0 {
+		t.Errorf("dry run reported %v, want 1 orphan chat, 1 orphan message, 1 pruned chat, 1 removed participant", body)
+	}
+
+	if n := countIDs(t, ctx, database.Chats.Name(), f.direct, f.group); n != 2 {
+		t.Errorf("dry run left %d of 2 chats", n)
+	}
+	if n := countIDs(t, ctx, database.Messages.Name(), f.directMsg, f.groupMsg); n != 2 {
+		t.Errorf("dry run left %d of 2 messages", n)
+	}
+	var group models.Chat
+	if err := database.Chats.FindOne(ctx, bson.M{"_id": f.group}).Decode(&group); err != nil {
+		t.Fatalf("loading group: %v", err)
+	}
+	if len(group.Participants) != 4 {
+		t.Errorf("dry run changed group participants to %v", group.Participants)
+	}
+}
+
+func TestCleanupOrphansPrunesGroupsAndRemovesDeadChats(t *testing.T) {
+	ctx := requireDB(t)
+	f := insertOrphanFixture(t, ctx)
+
+	w := testRequest(t, CleanupOrphans, http.MethodPost, "/api/admin/cleanup-orphans", nil, "", nil)
+	expectStatus(t, w, http.StatusOK)
+
+	if n := countIDs(t, ctx, database.Chats.Name(), f.direct); n != 0 {
+		t.Error("direct chat with a deleted participant survived")
+	}
+	if n := countIDs(t, ctx, database.Messages.Name(), f.directMsg); n != 0 {
+		t.Error("message in the removed direct chat survived")
+	}
+	if n := countIDs(t, ctx, database.Messages.Name(), f.groupMsg); n != 1 {
+		t.Error("message in the pruned group chat was deleted")
+	}
+
+	var group models.Chat
+	if err := database.Chats.FindOne(ctx, bson.M{"_id": f.group}).Decode(&group); err != nil {
+		t.Fatalf("group chat was deleted: %v", err)
+	}
+	want := []primitive.ObjectID{f.alice, f.bob, f.carol}
+	if len(group.Participants) != len(want) {
+		t.Fatalf("group participants = %v, want %v", group.Participants, want)
+	}
+	for i, id := range want {
+		if group.Participants[i] != id {
+			t.Errorf("group participants = %v, want %v", group.Participants, want)
+			break
+		}
+	}
+	if len(group.Admins) != 1 || group.Admins[0] != f.alice {
+		t.Errorf("group admins = %v, want only %s", group.Admins, f.alice.Hex())
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/middleware"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Admin user list page sizes; override with ADMIN_USERS_DEFAULT_LIMIT and
+// ADMIN_USERS_MAX_LIMIT
+const (
+	defaultAdminUsersLimit = 50
+	maxAdminUsersLimit     = 200
+)
+
+// adminUserFields are the user fields returned by GetAdminUsers
+var adminUserFields = bson.D{
+	{Key: "email", Value: 1},
+	{Key: "name", Value: 1},
+	{Key: "username", Value: 1},
+	{Key: "authProvider", Value: 1},
+	{Key: "createdAt", Value: 1},
+	{Key: "lastSeen", Value: 1},
+	{Key: "status", Value: 1},
+	{Key: "emailVerified", Value: 1},
+	{Key: "disabled", Value: 1},
+}
+
+// accountDisabledError is the response for sign-ins to a disabled account;
+// it matches what JWTAuthMiddleware returns for their existing tokens
+var accountDisabledError = gin.H{
+	"error":   "Account disabled",
+	"code":    "ACCOUNT_DISABLED",
+	"message": "This account has been disabled",
+}
+
+// GetAdminUsers lists users newest first for admins. ?q= searches email and
+// name (case-insensitive substring); ?disabled= and ?verified= take true or
+// false; ?skip= and ?limit= page the results.
+func GetAdminUsers(c *gin.Context) {
+	filter := bson.M{}
+
+	if q := c.Query("q"); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"email": pattern},
+			bson.M{"name": pattern},
+		}
+	}
+
+	for param, field := range map[string]string{"disabled": "disabled", "verified": "emailVerified"} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be true or false"})
+			return
+		}
+		// Older documents may lack the field, which counts as false
+		if value {
+			filter[field] = true
+		} else {
+			filter[field] = bson.M{"$ne": true}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+
+	skip, limit := pageParams(c,
+		config.Int("ADMIN_USERS_DEFAULT_LIMIT", defaultAdminUsersLimit),
+		config.Int("ADMIN_USERS_MAX_LIMIT", maxAdminUsersLimit),
+	)
+
+	total, err := usersColl.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Printf("GetAdminUsers count error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count users"})
+		return
+	}
+
+	cursor, err := usersColl.Find(ctx, filter, options.Find().
+		SetProjection(adminUserFields).
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit),
+	)
+	if err != nil {
+		log.Printf("GetAdminUsers find error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users"})
+		return
+	}
+
+	response := make([]map[string]interface{}, len(users))
+	for i, u := range users {
+		response[i] = map[string]interface{}{
+			"id":            u.ID.Hex(),
+			"email":         u.Email,
+			"name":          u.Name,
+			"username":      u.Username,
+			"authProvider":  u.AuthProvider,
+			"createdAt":     u.CreatedAt,
+			"lastSeen":      u.LastSeen,
+			"status":        u.Status,
+			"emailVerified": u.EmailVerified,
+			"disabled":      u.Disabled,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": response,
+		"total": total,
+		"skip":  skip,
+		"limit": limit,
+	})
+}
+
+// SetUserDisabled disables or re-enables a user (admins only). Disabling
+// also revokes every refresh token, so the user is signed out everywhere
+// once their current access token is rejected.
+func SetUserDisabled(c *gin.Context) {
+	targetID, err := parseObjectID(c, c.Param("id"), "user ID")
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Disabled *bool `json:"disabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+	if *req.Disabled && userID == targetID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot disable your own account"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+
+	result, err := usersColl.UpdateOne(ctx, bson.M{"_id": targetID}, bson.M{"$set": bson.M{"disabled": *req.Disabled}})
+	if err != nil {
+		log.Printf("SetUserDisabled update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	middleware.ForgetAccountStatus(targetID.Hex())
+
+	if *req.Disabled {
+		tokensColl := database.RefreshTokens
+		if _, err := tokensColl.DeleteMany(ctx, bson.M{"userId": targetID}); err != nil {
+			log.Printf("SetUserDisabled session revoke error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+
+	log.Printf("🛡️ Admin %s set disabled=%t on user %s", userID.Hex(), *req.Disabled, targetID.Hex())
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       targetID.Hex(),
+		"disabled": *req.Disabled,
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func adminUserIDs(t *testing.T, query string) map[string]bool {
+	t.Helper()
+	w := testRequest(t, GetAdminUsers, http.MethodGet, "/api/admin/users?limit=200&"+query, nil, "", nil)
+	expectStatus(t, w, http.StatusOK)
+	users, _ := decodeBody(t, w)["users"].([]interface{})
+	ids := make(map[string]bool, len(users))
+	for _, u := range users {
+		ids[u.(map[string]interface{})["id"].(string)] = true
+	}
+	return ids
+}
+
+func TestGetAdminUsersSearchAndStatusFilters(t *testing.T) {
+	ctx := requireDB(t)
+	tag := primitive.NewObjectID().Hex()
+	verified := insertTestUser(t, ctx, bson.M{"name": "Verified " + tag, "emailVerified": true})
+	disabled := insertTestUser(t, ctx, bson.M{"name": "Disabled " + tag, "disabled": true})
+	plain := insertTestUser(t, ctx, bson.M{"name": "Plain " + tag})
+
+	ids := adminUserIDs(t, "q="+tag)
+	if len(ids) != 3 {
+		t.Errorf("search found %d users, want 3", len(ids))
+	}
+	if ids := adminUserIDs(t, "q=verified+"+tag); len(ids) != 1 || !ids[verified.Hex()] {
+		t.Errorf("name search = %v, want only %s", ids, verified.Hex())
+	}
+
+	if ids := adminUserIDs(t, "q="+tag+"&disabled=true"); len(ids) != 1 || !ids[disabled.Hex()] {
+		t.Errorf("disabled=true = %v, want only %s", ids, disabled.Hex())
+	}
+	if ids := adminUserIDs(t, "q="+tag+"&disabled=false"); len(ids) != 2 || ids[disabled.Hex()] {
+		t.Errorf("disabled=false = %v, want everyone but %s", ids, disabled.Hex())
+	}
+	if ids := adminUserIDs(t, "q="+tag+"&verified=false"); len(ids) != 2 || !ids[plain.Hex()] || ids[verified.Hex()] {
+		t.Errorf("verified=false = %v, want %s and %s", ids, plain.Hex(), disabled.Hex())
+	}
+
+	w := testRequest(t, GetAdminUsers, http.MethodGet, "/api/admin/users?disabled=maybe", nil, "", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestSetUserDisabledBlocksLogin(t *testing.T) {
+	ctx := requireDB(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hashing password: %v", err)
+	}
+	admin := insertTestUser(t, ctx, nil)
+	user := insertTestUser(t, ctx, bson.M{"passwordHash": string(hash)})
+	session := newSessionFor(t, user)
+
+	var stored struct {
+		Email string `bson:"email"`
+	}
+	if err := database.Users.FindOne(ctx, bson.M{"_id": user}).Decode(&stored); err != nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	login := func() int {
+		return testRequest(t, Login, http.MethodPost, "/api/login", gin.H{"email": stored.Email, "password": "correct horse"}, "", nil).Code
+	}
+	if code := login(); code != http.StatusOK {
+		t.Fatalf("login before disabling = %d, want 200", code)
+	}
+
+	setDisabled := func(disabled bool) {
+		t.Helper()
+		params := gin.Params{{Key: "id", Value: user.Hex()}}
+		w := testRequest(t, SetUserDisabled, http.MethodPut, "/api/admin/users/"+user.Hex()+"/disabled", gin.H{"disabled": disabled}, admin.Hex(), params)
+		expectStatus(t, w, http.StatusOK)
+	}
+
+	setDisabled(true)
+	if code := login(); code != http.StatusForbidden {
+		t.Errorf("login while disabled = %d, want 403", code)
+	}
+	expectStatus(t, refresh(t, session), http.StatusUnauthorized)
+
+	setDisabled(false)
+	if code := login(); code != http.StatusOK {
+		t.Errorf("login after re-enabling = %d, want 200", code)
+	}
+}
+
+func TestSetUserDisabledValidation(t *testing.T) {
+	self := primitive.NewObjectID()
+	params := gin.Params{{Key: "id", Value: self.Hex()}}
+
+	w := testRequest(t, SetUserDisabled, http.MethodPut, "/api/admin/users/"+self.Hex()+"/disabled", gin.H{}, self.Hex(), params)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = testRequest(t, SetUserDisabled, http.MethodPut, "/api/admin/users/"+self.Hex()+"/disabled", gin.H{"disabled": true}, self.Hex(), params)
+	expectStatus(t, w, http.StatusBadRequest)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"coded/config"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultMinUserAge is the youngest a user may be when MIN_USER_AGE is unset
+const defaultMinUserAge = 18
+
+// maxUserAge rejects birthdates that are obviously mistyped
+const maxUserAge = 120
+
+// validateBirthDate checks a birthDate from a profile update, writing a 400
+// and returning false if it is in the future, implausibly old, or makes the
+// user younger than MIN_USER_AGE
+func validateBirthDate(c *gin.Context, birthDate int64) bool {
+	now := time.Now()
+	if birthDate > now.Unix() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "birthDate cannot be in the future"})
+		return false
+	}
+
+	age := ageAt(birthDate, now)
+	if age > maxUserAge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "birthDate is not valid"})
+		return false
+	}
+	if minAge := config.Int("MIN_USER_AGE", defaultMinUserAge); age < minAge {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "You must be at least " + strconv.Itoa(minAge) + " years old",
+			"code":   "UNDERAGE",
+			"minAge": minAge,
+		})
+		return false
+	}
+	return true
+}
+
+// ageAt returns the age in whole years on now of someone born at the Unix
+// time birthDate
+func ageAt(birthDate int64, now time.Time) int {
+	born := time.Unix(birthDate, 0).UTC()
+	now = now.UTC()
+	age := now.Year() - born.Year()
+	if now.Month() < born.Month() || (now.Month() == born.Month() && now.Day() < born.Day()) {
+		age--
+	}
+	return age
+}
+
+// displayAge is the age shown in discovery responses in place of the
+// birthdate; 0 when the user hasn't set one
+func displayAge(birthDate int64) int {
+	if birthDate == 0 {
+		return 0
+	}
+	return ageAt(birthDate, time.Now())
+}
+
+// ageRangeFilter turns ?minAge= and ?maxAge= into a birthDate condition.
+// It returns nil when neither is given, and writes a 400 and returns false
+// when they are invalid. Users without a birthdate never match a range.
+func ageRangeFilter(c *gin.Context) (bson.M, bool) {
+	minAge, maxAge := 0, 0
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{{"minAge", &minAge}, {"maxAge", &maxAge}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > maxUserAge {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param.name + " must be a whole number between 0 and " + strconv.Itoa(maxUserAge)})
+			return nil, false
+		}
+		*param.dst = n
+	}
+	if minAge == 0 && maxAge == 0 {
+		return nil, true
+	}
+	if maxAge != 0 && maxAge < minAge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "maxAge must not be less than minAge"})
+		return nil, false
+	}
+
+	// Someone is minAge or older if born on or before now minus minAge
+	// years, and at most maxAge if born after now minus maxAge+1 years
+	now := time.Now().UTC()
+	filter := bson.M{
+		"$ne":  0,
+		"$lte": now.AddDate(-minAge, 0, 0).Unix(),
+	}
+	if maxAge != 0 {
+		filter["$gt"] = now.AddDate(-(maxAge + 1), 0, 0).Unix()
+	}
+	return filter, true
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAgeAt(t *testing.T) {
+	now := time.Date(2026, time.June, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		born time.Time
+		want int
+	}{
+		{time.Date(2008, time.June, 15, 0, 0, 0, 0, time.UTC), 18}, // birthday today
+		{time.Date(2008, time.June, 16, 0, 0, 0, 0, time.UTC), 17}, // tomorrow
+		{time.Date(2008, time.July, 1, 0, 0, 0, 0, time.UTC), 17},  // next month
+		{time.Date(2008, time.May, 31, 0, 0, 0, 0, time.UTC), 18},
+		{time.Date(2008, time.February, 29, 0, 0, 0, 0, time.UTC), 18},
+	}
+	for _, tt := range tests {
+		if got := ageAt(tt.born.Unix(), now); got != tt.want {
+			t.Errorf("ageAt(%s) = %d, want %d", tt.born.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+// bornYearsAgo is a birthdate years ago today, shifted by days
+func bornYearsAgo(years, days int) int64 {
+	return time.Now().UTC().AddDate(-years, 0, days).Unix()
+}
+
+func TestValidateBirthDate(t *testing.T) {
+	tests := map[string]struct {
+		birthDate int64
+		ok        bool
+	}{
+		"turns 18 today":    {bornYearsAgo(18, 0), true},
+		"turns 18 tomorrow": {bornYearsAgo(18, 1), false},
+		"adult":             {bornYearsAgo(40, 0), true},
+		"in the future":     {time.Now().Add(time.Hour).Unix(), false},
+		"implausibly old":   {bornYearsAgo(maxUserAge+1, 0), false},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		if got := validateBirthDate(c, tt.birthDate); got != tt.ok {
+			t.Errorf("%s: validateBirthDate = %v, want %v (%s)", name, got, tt.ok, w.Body.String())
+		}
+	}
+}
+
+func TestProfileUpdateRejectsUnderage(t *testing.T) {
+	w := testRequest(t, UpdateMyProfile, http.MethodPut, "/api/me",
+		gin.H{"birthDate": bornYearsAgo(17, 0)}, "64b000000000000000000001", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	if body := decodeBody(t, w); body["code"] != "UNDERAGE" {
+		t.Errorf("body = %v, want code UNDERAGE", body)
+	}
+}
+
+// ageFilterFor runs ageRangeFilter on the given query string
+func ageFilterFor(t *testing.T, query url.Values) (bson.M, bool, *httptest.ResponseRecorder) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil)
+	filter, ok := ageRangeFilter(c)
+	return filter, ok, w
+}
+
+// matchesBirthDate applies an ageRangeFilter condition to one birthdate
+func matchesBirthDate(filter bson.M, birthDate int64) bool {
+	if v, ok := filter["$ne"]; ok && birthDate == int64(v.(int)) {
+		return false
+	}
+	if v, ok := filter["$lte"]; ok && birthDate > v.(int64) {
+		return false
+	}
+	if v, ok := filter["$gt"]; ok && birthDate <= v.(int64) {
+		return false
+	}
+	return true
+}
+
+func TestAgeRangeFilterBoundaries(t *testing.T) {
+	ages := map[string]struct {
+		birthDate int64
+		want      bool
+	}{
+		"17, turning 18 tomorrow": {bornYearsAgo(18, 1), false},
+		"18 today":                {bornYearsAgo(18, 0), true},
+		"30, turning 31 tomorrow": {bornYearsAgo(31, 1), true},
+		"31 today":                {bornYearsAgo(31, 0), false},
+		"no birthdate":            {0, false},
+	}
+	filter, ok, w := ageFilterFor(t, url.Values{"minAge": {"18"}, "maxAge": {"30"}})
+	if !ok {
+		t.Fatalf("valid range rejected: %s", w.Body.String())
+	}
+	for name, tt := range ages {
+		if got := matchesBirthDate(filter, tt.birthDate); got != tt.want {
+			t.Errorf("%s: in 18-30 = %v, want %v", name, got, tt.want)
+		}
+	}
+
+	// Either end alone
+	if filter, _, _ := ageFilterFor(t, url.Values{"minAge": {"18"}}); !matchesBirthDate(filter, bornYearsAgo(90, 0)) {
+		t.Error("minAge alone capped the upper age")
+	}
+	if filter, _, _ := ageFilterFor(t, url.Values{"maxAge": {"30"}}); !matchesBirthDate(filter, bornYearsAgo(18, 0)) || matchesBirthDate(filter, bornYearsAgo(31, 0)) {
+		t.Error("maxAge alone filtered the wrong ages")
+	}
+	if filter, ok, _ := ageFilterFor(t, url.Values{}); filter != nil || !ok {
+		t.Errorf("no params gave filter %v, ok %v; want none", filter, ok)
+	}
+}
+
+func TestAgeRangeFilterRejectsBadParams(t *testing.T) {
+	for _, query := range []url.Values{
+		{"minAge": {"eighteen"}},
+		{"minAge": {"-1"}},
+		{"maxAge": {"200"}},
+		{"minAge": {"30"}, "maxAge": {"18"}},
+	} {
+		if _, ok, w := ageFilterFor(t, query); ok || w.Code != http.StatusBadRequest {
+			t.Errorf("%v: ok = %v, status %d; want a 400", query, ok, w.Code)
+		}
+	}
+}
+
+func TestGetFeedFiltersByAge(t *testing.T) {
+	ctx := requireDB(t)
+	viewer := insertTestUser(t, ctx, nil)
+	posts := map[string]int{}
+	for _, author := range []struct {
+		years, days int
+		age         int
+	}{{18, 1, 17}, {18, 0, 18}, {31, 1, 30}, {31, 0, 31}} {
+		id := insertTestUser(t, ctx, bson.M{"birthDate": bornYearsAgo(author.years, author.days)})
+		posts[insertPosts(t, ctx, id, 100)[0].Hex()] = author.age
+	}
+
+	w := testRequest(t, GetFeed, http.MethodGet, "/api/posts/feed?minAge=18&maxAge=30", nil, viewer.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+
+	var ages []int
+	for _, p := range decodeBody(t, w)["posts"].([]interface{}) {
+		post := p.(map[string]interface{})
+		if age, ok := posts[post["id"].(string)]; ok {
+			ages = append(ages, age)
+			if post["age"] != float64(age) {
+				t.Errorf("post by a %d year old reports age %v", age, post["age"])
+			}
+			if _, leaked := post["user"].(map[string]interface{})["birthDate"]; leaked {
+				t.Error("feed exposes the author's birthDate")
+			}
+		}
+	}
+	if len(ages) != 2 {
+		t.Errorf("feed has posts by authors aged %v, want just 18 and 30", ages)
+	}
+}
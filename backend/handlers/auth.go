@@ -4,15 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"coded/database"
-	"coded/middleware"
 	"coded/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -45,10 +42,20 @@ func Signup(c *gin.Context) {
 
 	fmt.Printf("📝 Signup attempt for email: %s\n", req.Email)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if isDisposableEmail(req.Email) {
+		fmt.Printf("⚠️  Disposable email rejected: %s\n", req.Email)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Disposable email addresses are not allowed",
+			"code":    "DISPOSABLE_EMAIL",
+			"message": "Please sign up with a permanent email address",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	usersColl := database.Client.Database("coded").Collection("users")
+	usersColl := database.Users
 
 	// Check if user already exists
 	var existingUser models.User
@@ -96,6 +103,7 @@ func Signup(c *gin.Context) {
 		Bio:          "",
 		Gender:       "",
 		InterestedIn: []string{},
+		Interests:    []string{},
 		Photos:       []string{},
 		Status:       "offline",
 		BirthDate:    0,
@@ -114,24 +122,14 @@ func Signup(c *gin.Context) {
 
 	fmt.Printf("✅ User created: %s (ID: %s)\n", req.Email, user.ID.Hex())
 
-	// Generate JWT token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &middleware.Claims{
-		UserID: user.ID.Hex(),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	// The account works without verification, so a mail failure shouldn't
+	// fail signup; the user can resend from the app
+	if err := rotateVerificationToken(ctx, user.ID, 0); err != nil {
+		fmt.Printf("⚠️  Failed to send verification email: %v\n", err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key-change-this-in-production"
-		fmt.Println("⚠️  Using default JWT secret. Set JWT_SECRET environment variable!")
-	}
-	
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	// Generate JWT token
+	tokenString, expirationTime, err := issueAccessToken(user.ID)
 	if err != nil {
 		fmt.Printf("❌ Failed to generate token: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -141,14 +139,26 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	refreshToken, err := issueRefreshToken(ctx, c, user.ID)
+	if err != nil {
+		fmt.Printf("❌ Failed to create session: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Server error",
+			"message": "Failed to create session",
+		})
+		return
+	}
+
 	fmt.Printf("✅ Signup completed successfully for: %s\n", req.Email)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":  "User created successfully",
-		"token":    tokenString,
-		"userId":   user.ID.Hex(),
-		"email":    user.Email,
-		"username": user.Username,
+		"token":        tokenString,
+		"refreshToken": refreshToken,
+		"userId":       user.ID.Hex(),
+		"email":        user.Email,
+		"username":     user.Username,
+		"expires":      expirationTime.Unix(),
 	})
 }
 
@@ -168,10 +178,10 @@ func Login(c *gin.Context) {
 
 	fmt.Printf("📝 Login attempt for email: %s\n", req.Email)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	usersColl := database.Client.Database("coded").Collection("users")
+	usersColl := database.Users
 
 	// Find user by email
 	var user models.User
@@ -196,9 +206,18 @@ func Login(c *gin.Context) {
 
 	fmt.Printf("✅ User found: %s (ID: %s)\n", req.Email, user.ID.Hex())
 
-	// Check password
+	// Check password. Accounts created through Google have no password hash,
+	// so point those users at Google sign-in instead of a generic failure.
 	if user.PasswordHash == nil {
 		fmt.Printf("❌ No password hash for user: %s\n", req.Email)
+		if user.AuthProvider == "google" || user.GoogleID != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Authentication failed",
+				"code":    "USE_GOOGLE_SIGN_IN",
+				"message": "This account uses Google sign-in. Please continue with Google.",
+			})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error":   "Authentication failed",
 			"message": "Invalid email or password",
@@ -218,29 +237,18 @@ func Login(c *gin.Context) {
 
 	fmt.Printf("✅ Password correct for: %s\n", req.Email)
 
+	if user.Disabled {
+		c.JSON(http.StatusForbidden, accountDisabledError)
+		return
+	}
+
 	// Update last seen time
 	usersColl.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
 		"$set": bson.M{"lastSeen": time.Now().Unix()},
 	})
 
 	// Generate JWT token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &middleware.Claims{
-		UserID: user.ID.Hex(),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key-change-this-in-production"
-		fmt.Println("⚠️  Using default JWT secret. Set JWT_SECRET environment variable!")
-	}
-	
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, expirationTime, err := issueAccessToken(user.ID)
 	if err != nil {
 		fmt.Printf("❌ Failed to generate token: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -250,16 +258,27 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	refreshToken, err := issueRefreshToken(ctx, c, user.ID)
+	if err != nil {
+		fmt.Printf("❌ Failed to create session: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Server error",
+			"message": "Failed to create session",
+		})
+		return
+	}
+
 	fmt.Printf("✅ Login successful for: %s, token generated\n", req.Email)
 
 	c.JSON(http.StatusOK, gin.H{
-		"token":    tokenString,
-		"userId":   user.ID.Hex(),
-		"email":    user.Email,
-		"username": user.Username,
-		"avatar":   user.Avatar,
-		"message":  "Login successful",
-		"expires":  expirationTime.Unix(),
+		"token":        tokenString,
+		"refreshToken": refreshToken,
+		"userId":       user.ID.Hex(),
+		"email":        user.Email,
+		"username":     user.Username,
+		"avatar":       user.Avatar,
+		"message":      "Login successful",
+		"expires":      expirationTime.Unix(),
 	})
 }
 
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLoginWithoutPasswordHash(t *testing.T) {
+	ctx := requireDB(t)
+
+	cases := []struct {
+		name     string
+		fields   bson.M
+		wantCode string
+	}{
+		{"google provider", bson.M{"authProvider": "google"}, "USE_GOOGLE_SIGN_IN"},
+		{"linked google id", bson.M{"authProvider": "email", "googleId": "g-123"}, "USE_GOOGLE_SIGN_IN"},
+		{"no provider", bson.M{"authProvider": "email"}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id := insertTestUser(t, ctx, tc.fields)
+			w := testRequest(t, Login, http.MethodPost, "/api/login",
+				gin.H{"email": id.Hex() + "@example.com", "password": "anything"}, "", nil)
+			expectStatus(t, w, http.StatusUnauthorized)
+
+			body := decodeBody(t, w)
+			if code, _ := body["code"].(string); code != tc.wantCode {
+				t.Errorf("code = %q, want %q", code, tc.wantCode)
+			}
+			if _, ok := body["token"]; ok {
+				t.Error("login without a password hash returned a token")
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// blockedUserIDs returns everyone userID has blocked or been blocked by
+func blockedUserIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	blocksColl := database.Blocks
+
+	cursor, err := blocksColl.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"userId": userID},
+		bson.M{"targetUserId": userID},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	var blocks []models.Block
+	if err := cursor.All(ctx, &blocks); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(blocks))
+	for _, b := range blocks {
+		if b.UserID == userID {
+			ids = append(ids, b.TargetUserID)
+		} else {
+			ids = append(ids, b.UserID)
+		}
+	}
+	return ids, nil
+}
+
+// rejectUnknownUsers writes 404 and returns false unless every id belongs to
+// an existing user
+func rejectUnknownUsers(c *gin.Context, ctx context.Context, ids []primitive.ObjectID) bool {
+	usersColl := database.Users
+
+	count, err := usersColl.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if count < int64(len(ids)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	return true
+}
+
+// rejectIfBlocked writes 403 and returns false if userID and any of others
+// have blocked each other, in either direction
+func rejectIfBlocked(c *gin.Context, ctx context.Context, userID primitive.ObjectID, others []primitive.ObjectID) bool {
+	blocksColl := database.Blocks
+
+	count, err := blocksColl.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"userId": userID, "targetUserId": bson.M{"$in": others}},
+		bson.M{"userId": bson.M{"$in": others}, "targetUserId": userID},
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You can't interact with this user",
+			"code":  "USER_BLOCKED",
+		})
+		return false
+	}
+	return true
+}
+
+func BlockUser(c *gin.Context) {
+	var req struct {
+		TargetUserID string `json:"targetUserId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	targetID, err := parseObjectID(c, req.TargetUserID, "target user ID")
+	if err != nil {
+		return
+	}
+
+	if userID == targetID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot block yourself"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	blocksColl := database.Blocks
+
+	// The unique {userId, targetUserId} index rejects duplicates
+	block := models.Block{
+		ID:           primitive.NewObjectID(),
+		UserID:       userID,
+		TargetUserID: targetID,
+		CreatedAt:    time.Now().Unix(),
+	}
+
+	_, err = blocksColl.InsertOne(ctx, block)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already blocked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	// Favorites between the two would otherwise keep surfacing each other
+	favColl := database.Favorites
+	_, err = favColl.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"userId": userID, "targetUserId": targetID},
+		bson.M{"userId": targetID, "targetUserId": userID},
+	}})
+	if err != nil {
+		log.Printf("BlockUser favorite cleanup error: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "User blocked"})
+}
+
+func UnblockUser(c *gin.Context) {
+	var req struct {
+		TargetUserID string `json:"targetUserId" binding:"required"`
+	}
+
+	// Accept the target as a query parameter too, like RemoveFavorite
+	targetUserId := c.Query("targetUserId")
+	if targetUserId == "" {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "targetUserId is required"})
+			return
+		}
+		targetUserId = req.TargetUserID
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	targetID, err := parseObjectID(c, targetUserId, "target user ID")
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	blocksColl := database.Blocks
+
+	result, err := blocksColl.DeleteOne(ctx, bson.M{
+		"userId":       userID,
+		"targetUserId": targetID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Block not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
+
+// GetBlocks lists the users the caller has blocked, newest first. Users who
+// blocked the caller aren't revealed.
+func GetBlocks(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	blocksColl := database.Blocks
+
+	cursor, err := blocksColl.Find(ctx,
+		bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocks"})
+		return
+	}
+
+	var blocks []models.Block
+	if err := cursor.All(ctx, &blocks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode blocks"})
+		return
+	}
+
+	targetIDs := make([]primitive.ObjectID, len(blocks))
+	for i, b := range blocks {
+		targetIDs[i] = b.TargetUserID
+	}
+	users, err := loadPublicProfiles(ctx, targetIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	response := make([]map[string]interface{}, len(blocks))
+	for i, b := range blocks {
+		response[i] = map[string]interface{}{
+			"id":           b.ID.Hex(),
+			"targetUserId": b.TargetUserID.Hex(),
+			"createdAt":    b.CreatedAt,
+			"user":         publicProfile(b.TargetUserID, users[b.TargetUserID]),
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func blockUser(t *testing.T, userID, targetID primitive.ObjectID) {
+	t.Helper()
+	w := testRequest(t, BlockUser, http.MethodPost, "/api/block", gin.H{"targetUserId": targetID.Hex()}, userID.Hex(), nil)
+	expectStatus(t, w, http.StatusCreated)
+	t.Cleanup(func() {
+		database.Blocks.DeleteMany(context.Background(), bson.M{"userId": userID})
+	})
+}
+
+// expectBlocked fails unless the response is the 403 rejectIfBlocked writes
+func expectBlocked(t *testing.T, action string, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != http.StatusForbidden || decodeBody(t, w)["code"] != "USER_BLOCKED" {
+		t.Errorf("%s answered %d %s, want 403 USER_BLOCKED", action, w.Code, w.Body.String())
+	}
+}
+
+func TestBlockStopsContactBothWays(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+
+	blockUser(t, alice, bob)
+
+	for _, dir := range []struct {
+		name     string
+		from, to primitive.ObjectID
+	}{{"alice", alice, bob}, {"bob", bob, alice}} {
+		from, to, name := dir.from, dir.to, dir.name
+		expectBlocked(t, name+" creating a chat", postChat(t, from, "", to))
+		expectBlocked(t, name+" messaging", testRequest(t, SendMessage, http.MethodPost, "/api/messages",
+			gin.H{"chatId": chatID.Hex(), "content": "hello?"}, from.Hex(), nil))
+		expectBlocked(t, name+" favoriting", testRequest(t, AddFavorite, http.MethodPost, "/api/favorite",
+			gin.H{"targetUserId": to.Hex()}, from.Hex(), nil))
+	}
+
+	if n, _ := database.Messages.CountDocuments(ctx, bson.M{"chatId": chatID}); n != 0 {
+		t.Errorf("%d messages stored in the blocked chat", n)
+	}
+}
+
+func TestBlockHidesPostsFromFeedBothWays(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	alicePost := insertPosts(t, ctx, alice, 100)[0].Hex()
+	bobPost := insertPosts(t, ctx, bob, 100)[0].Hex()
+
+	blockUser(t, alice, bob)
+
+	if ids, _, _ := getFeed(t, alice, url.Values{}); slices.Contains(ids, bobPost) {
+		t.Error("alice still sees the post of someone she blocked")
+	}
+	if ids, _, _ := getFeed(t, bob, url.Values{}); slices.Contains(ids, alicePost) {
+		t.Error("bob still sees the post of someone who blocked him")
+	}
+	if ids, _, _ := getFeed(t, carol, url.Values{}); !slices.Contains(ids, alicePost) || !slices.Contains(ids, bobPost) {
+		t.Errorf("carol's feed %v lost posts over a block she isn't part of", ids)
+	}
+}
+
+func TestUnblockRestoresContact(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+
+	blockUser(t, alice, bob)
+	w := testRequest(t, UnblockUser, http.MethodDelete, "/api/block?targetUserId="+bob.Hex(), nil, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+
+	if w := postChat(t, bob, "", alice); w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		t.Errorf("creating a chat after unblocking answered %d", w.Code)
+	}
+}
@@ -2,9 +2,13 @@ package handlers
 
 import (
     "context"
+    "log"
     "net/http"
+    "sort"
+    "strings"
     "time"
 
+    "coded/config"
     "coded/database"
     "coded/models"
 
@@ -15,51 +19,53 @@ import (
 )
 
 func GetChatList(c *gin.Context) {
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    chatsColl := database.Client.Database("coded").Collection("chats")
-
-    pipeline := mongo.Pipeline{
-        {{"$match", bson.D{{"participants", userID}}}},
-        {{"$sort", bson.D{{"lastMessageAt", -1}}}},
-        {{"$lookup", bson.D{
-            {"from", "users"},
-            {"localField", "participants"},
-            {"foreignField", "_id"},
-            {"as", "participantsProfiles"},
-        }}},
-        {{"$addFields", bson.D{
-            {"partner", bson.D{
-                {"$arrayElemAt", bson.A{
-                    bson.D{{"$filter", bson.D{
-                        {"input", "$participantsProfiles"},
-                        {"as", "p"},
-                        {"cond", bson.D{{"$ne", bson.A{"$$p._id", userID}}}},
-                    }}},
-                    0,
-                }},
+    chatsColl := database.Chats
+
+    // The partner is the first participant other than the caller
+    pipeline := pagedPipeline(
+        bson.D{{Key: "participants", Value: userID}},
+        bson.D{{Key: "lastMessageAt", Value: -1}},
+        0, 0,
+    )
+    pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+        {Key: "partnerId", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{
+            bson.D{{Key: "$filter", Value: bson.D{
+                {Key: "input", Value: "$participants"},
+                {Key: "as", Value: "p"},
+                {Key: "cond", Value: bson.D{{Key: "$ne", Value: bson.A{"$$p", userID}}}},
+            }}},
+            0,
+        }}}},
+    }}})
+    pipeline = withUserJoin(pipeline, "partnerId", "partner", publicUserFields)
+
+    // Unread badge: messages from others in this chat the caller hasn't read
+    unreadMatch := append(bson.D{
+        {Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$chatId", "$$chatId"}}}},
+    }, unreadMessagesFilter(userID)...)
+    pipeline = append(pipeline,
+        bson.D{{Key: "$lookup", Value: bson.D{
+            {Key: "from", Value: database.Messages.Name()},
+            {Key: "let", Value: bson.D{{Key: "chatId", Value: "$_id"}}},
+            {Key: "pipeline", Value: bson.A{
+                bson.D{{Key: "$match", Value: unreadMatch}},
+                bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}},
             }},
+            {Key: "as", Value: "unread"},
         }}},
-        {{"$project", bson.D{
-            {"id", "$_id"},
-            {"lastMessage", 1},
-            {"lastMessageAt", 1},
-            {"partner", bson.D{
-                {"id", "$partner._id"},
-                {"name", "$partner.name"},
-                {"avatar", "$partner.avatar"},
-                {"status", "$partner.status"},
-            }},
+        bson.D{{Key: "$addFields", Value: bson.D{
+            {Key: "unreadCount", Value: bson.D{{Key: "$size", Value: "$unread"}}},
         }}},
-    }
+        bson.D{{Key: "$project", Value: bson.D{{Key: "unread", Value: 0}}}},
+    )
 
     cursor, err := chatsColl.Aggregate(ctx, pipeline)
     if err != nil {
@@ -68,52 +74,148 @@ func GetChatList(c *gin.Context) {
     }
     defer cursor.Close(ctx)
 
-    var results []bson.M
+    var results []struct {
+        ID            primitive.ObjectID   `bson:"_id"`
+        LastMessage   string               `bson:"lastMessage"`
+        LastMessageAt int64                `bson:"lastMessageAt"`
+        PartnerID     primitive.ObjectID   `bson:"partnerId"`
+        Partner       *models.User         `bson:"partner"`
+        UnreadCount   int                  `bson:"unreadCount"`
+        Type          string               `bson:"type"`
+        Name          string               `bson:"name"`
+        Participants  []primitive.ObjectID `bson:"participants"`
+    }
     if err := cursor.All(ctx, &results); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode chats"})
         return
     }
 
+    // Groups list all members instead of a partner; fetch them in one go
+    var memberIDs []primitive.ObjectID
+    for _, r := range results {
+        if r.Type == models.ChatTypeGroup {
+            memberIDs = append(memberIDs, r.Participants...)
+        }
+    }
+    members, err := loadPublicProfiles(ctx, memberIDs)
+    if err != nil {
+        log.Printf("GetChatList member lookup error: %v", err)
+    }
+
+    chatIDs := make([]primitive.ObjectID, len(results))
+    for i, r := range results {
+        chatIDs[i] = r.ID
+    }
+    settings, err := chatSettingsFor(ctx, userID, chatIDs)
+    if err != nil {
+        log.Printf("GetChatList settings lookup error: %v", err)
+    }
+
     // Ensure partner is always a valid object with fallback values
     response := make([]map[string]interface{}, len(results))
     for i, r := range results {
-        partnerRaw := r["partner"]
-        partnerMap := map[string]interface{}{
-            "id":     "",
-            "name":   "Unknown",
-            "avatar": fallbackAvatar,
-            "status": "offline",
+        response[i] = map[string]interface{}{
+            "id":            r.ID,
+            "type":          models.ChatTypeDirect,
+            "lastMessage":   r.LastMessage,
+            "lastMessageAt": r.LastMessageAt,
+            "unreadCount":   r.UnreadCount,
+            "archived":      settings[r.ID].Archived,
+            "muted":         settings[r.ID].Muted,
+            "pinned":        settings[r.ID].Pinned,
         }
-
-        if p, ok := partnerRaw.(bson.M); ok && p != nil {
-            if id, _ := p["_id"].(primitive.ObjectID); id != primitive.NilObjectID {
-                partnerMap["id"] = id.Hex()
-            }
-            if name, _ := p["name"].(string); name != "" {
-                partnerMap["name"] = name
-            }
-            if avatar, _ := p["avatar"].(string); avatar != "" {
-                partnerMap["avatar"] = avatar
-            }
-            if status, _ := p["status"].(string); status != "" {
-                partnerMap["status"] = status
-            }
+        // A cleared chat shouldn't preview a message the user cleared
+        if r.LastMessageAt <= settings[r.ID].ClearedAt {
+            response[i]["lastMessage"] = ""
         }
-
-        response[i] = map[string]interface{}{
-            "id":            r["id"],
-            "lastMessage":   r["lastMessage"],
-            "lastMessageAt": r["lastMessageAt"],
-            "partner":       partnerMap,
+        if r.Type == models.ChatTypeGroup {
+            response[i]["type"] = models.ChatTypeGroup
+            response[i]["name"] = r.Name
+            response[i]["participants"] = memberProfiles(r.Participants, members)
+        } else {
+            response[i]["partner"] = publicProfile(r.PartnerID, r.Partner)
         }
     }
 
     c.JSON(http.StatusOK, response)
 }
 
+// unreadMessagesFilter matches messages userID hasn't read yet: sent by
+// someone else, not marked read and not deleted. MarkAsRead clears exactly
+// these.
+func unreadMessagesFilter(userID primitive.ObjectID) bson.D {
+    return bson.D{
+        {Key: "senderId", Value: bson.D{{Key: "$ne", Value: userID}}},
+        {Key: "isRead", Value: false},
+        {Key: "deleted", Value: bson.D{{Key: "$ne", Value: true}}},
+    }
+}
+
+// GetUnreadCounts returns chatId -> unread message count for every chat the
+// caller is in, including chats with nothing unread
+func GetUnreadCounts(c *gin.Context) {
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    chatsColl := database.Chats
+    messagesColl := database.Messages
+
+    chatIDs, err := chatsColl.Distinct(ctx, "_id", bson.M{"participants": userID})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chats"})
+        return
+    }
+
+    counts := make(map[string]int, len(chatIDs))
+    for _, id := range chatIDs {
+        if oid, ok := id.(primitive.ObjectID); ok {
+            counts[oid.Hex()] = 0
+        }
+    }
+    if len(counts) == 0 {
+        c.JSON(http.StatusOK, counts)
+        return
+    }
+
+    match := append(bson.D{
+        {Key: "chatId", Value: bson.D{{Key: "$in", Value: chatIDs}}},
+    }, unreadMessagesFilter(userID)...)
+    cursor, err := messagesColl.Aggregate(ctx, mongo.Pipeline{
+        {{Key: "$match", Value: match}},
+        {{Key: "$group", Value: bson.D{
+            {Key: "_id", Value: "$chatId"},
+            {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+        }}},
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count unread messages"})
+        return
+    }
+
+    var groups []struct {
+        ChatID primitive.ObjectID `bson:"_id"`
+        Count  int                `bson:"count"`
+    }
+    if err := cursor.All(ctx, &groups); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count unread messages"})
+        return
+    }
+    for _, g := range groups {
+        counts[g.ChatID.Hex()] = g.Count
+    }
+
+    c.JSON(http.StatusOK, counts)
+}
+
 func CreateChat(c *gin.Context) {
     var req struct {
         Participants []string `json:"participants" binding:"required,min=1"`
+        Name         string   `json:"name"` // required for group chats
     }
 
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -121,23 +223,22 @@ func CreateChat(c *gin.Context) {
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
     var participantIDs []primitive.ObjectID
     participantIDs = append(participantIDs, userID)
+    seen := map[primitive.ObjectID]bool{userID: true}
 
     for _, p := range req.Participants {
-        pID, err := primitive.ObjectIDFromHex(p)
+        pID, err := parseObjectID(c, p, "participant ID")
         if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid participant ID"})
             return
         }
-        if pID != userID {
+        if !seen[pID] {
+            seen[pID] = true
             participantIDs = append(participantIDs, pID)
         }
     }
@@ -147,46 +248,56 @@ func CreateChat(c *gin.Context) {
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    chatsColl := database.Client.Database("coded").Collection("chats")
+    if !rejectUnknownUsers(c, ctx, participantIDs[1:]) {
+        return
+    }
+    if !rejectIfBlocked(c, ctx, userID, participantIDs[1:]) {
+        return
+    }
 
-    filter := bson.M{
-        "participants": bson.M{
-            "$all":  participantIDs,
-            "$size": len(participantIDs),
-        },
+    chatsColl := database.Chats
+
+    // More than two people makes a named group; only direct chats are
+    // deduplicated
+    if len(participantIDs) > 2 {
+        createGroupChat(c, ctx, chatsColl, userID, participantIDs, req.Name)
+        return
     }
 
-    var existingChat models.Chat
-    err = chatsColl.FindOne(ctx, filter).Decode(&existingChat)
-    if err == nil {
+    existingChat, err := findChat(ctx, chatsColl, participantIDs)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+        return
+    }
+    if existingChat != nil {
         c.JSON(http.StatusOK, gin.H{
             "id": existingChat.ID.Hex(),
         })
         return
     }
-    if err != mongo.ErrNoDocuments {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-        return
-    }
 
-    newChat := models.Chat{
-        ID:            primitive.NewObjectID(),
-        Participants:  participantIDs,
-        LastMessageAt: time.Now().Unix(),
-        CreatedAt:     time.Now().Unix(),
+    if !checkChatLimits(c, ctx, chatsColl, userID) {
+        return
     }
 
-    _, err = chatsColl.InsertOne(ctx, newChat)
+    newChat, created, err := createChat(ctx, chatsColl, userID, participantIDs)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat"})
         return
     }
+    if !created {
+        // A concurrent request created the same chat first
+        c.JSON(http.StatusOK, gin.H{
+            "id": newChat.ID.Hex(),
+        })
+        return
+    }
 
     // Get partner info for WebSocket broadcast
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
     var partner models.User
     for _, participantID := range participantIDs {
         if participantID != userID {
@@ -198,6 +309,7 @@ func CreateChat(c *gin.Context) {
     // Prepare chat data for WebSocket broadcast
     chatData := map[string]interface{}{
         "id":            newChat.ID.Hex(),
+        "type":          models.ChatTypeDirect,
         "lastMessageAt": newChat.LastMessageAt,
         "partner": map[string]interface{}{
             "id":     partner.ID.Hex(),
@@ -218,25 +330,181 @@ func CreateChat(c *gin.Context) {
     })
 }
 
+// FindChat returns the id of the caller's existing 1:1 chat with ?userId=,
+// or 404 if there is none. Unlike CreateChat it never creates one.
+func FindChat(c *gin.Context) {
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    otherID, err := parseObjectID(c, c.Query("userId"), "user ID")
+    if err != nil {
+        return
+    }
+    if otherID == userID {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot chat with yourself"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    chatsColl := database.Chats
+
+    chat, err := findChat(ctx, chatsColl, []primitive.ObjectID{userID, otherID})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+        return
+    }
+    if chat == nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "id": chat.ID.Hex(),
+    })
+}
+
+// findChat returns the direct chat with exactly these participants, or nil
+// if there is none. Groups never match, even if they shrink to two members.
+func findChat(ctx context.Context, chatsColl *mongo.Collection, participantIDs []primitive.ObjectID) (*models.Chat, error) {
+    filter := bson.M{
+        "participants": bson.M{
+            "$all":  participantIDs,
+            "$size": len(participantIDs),
+        },
+        "type": bson.M{"$ne": models.ChatTypeGroup},
+    }
+
+    var chat models.Chat
+    err := chatsColl.FindOne(ctx, filter).Decode(&chat)
+    if err == mongo.ErrNoDocuments {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &chat, nil
+}
+
+// createChat inserts a chat between participantIDs. If the unique
+// participantsKey index shows a concurrent request won the race, the existing
+// chat is returned with created=false.
+func createChat(ctx context.Context, chatsColl *mongo.Collection, createdBy primitive.ObjectID, participantIDs []primitive.ObjectID) (models.Chat, bool, error) {
+    chat := models.Chat{
+        ID:              primitive.NewObjectID(),
+        Type:            models.ChatTypeDirect,
+        CreatedBy:       createdBy,
+        Participants:    participantIDs,
+        ParticipantsKey: participantsKey(participantIDs),
+        LastMessageAt:   time.Now().Unix(),
+        CreatedAt:       time.Now().Unix(),
+    }
+
+    _, err := chatsColl.InsertOne(ctx, chat)
+    if err == nil && wsManager != nil {
+        // Route the new chat's events to participants already connected
+        wsManager.SubscribeUsers(chat.ID.Hex(), hexIDs(participantIDs))
+    }
+    if mongo.IsDuplicateKeyError(err) {
+        var existing models.Chat
+        if err := chatsColl.FindOne(ctx, bson.M{"participantsKey": chat.ParticipantsKey}).Decode(&existing); err != nil {
+            return models.Chat{}, false, err
+        }
+        return existing, false, nil
+    }
+    if err != nil {
+        return models.Chat{}, false, err
+    }
+    return chat, true, nil
+}
+
+// Defaults for the per-user chat limits; override with MAX_ACTIVE_CHATS and
+// MAX_CHATS_PER_DAY
+const (
+    defaultMaxActiveChats = 500
+    defaultMaxChatsPerDay = 50
+)
+
+// checkChatLimits enforces the per-user caps on active chats (403) and chats
+// created in the last 24 hours (429), writing the error response when a
+// limit is hit. Chats the user archived don't count as active.
+func checkChatLimits(c *gin.Context, ctx context.Context, chatsColl *mongo.Collection, userID primitive.ObjectID) bool {
+    archived, err := chatsArchivedBy(ctx, userID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+        return false
+    }
+
+    maxActive := config.Int("MAX_ACTIVE_CHATS", defaultMaxActiveChats)
+    activeFilter := bson.M{"participants": userID}
+    if len(archived) > 0 {
+        activeFilter["_id"] = bson.M{"$nin": archived}
+    }
+    active, err := chatsColl.CountDocuments(ctx, activeFilter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+        return false
+    }
+    if active >= int64(maxActive) {
+        c.JSON(http.StatusForbidden, gin.H{
+            "error":   "Chat limit reached",
+            "limit":   maxActive,
+            "message": "Leave or archive some conversations before starting new ones",
+        })
+        return false
+    }
+
+    maxPerDay := config.Int("MAX_CHATS_PER_DAY", defaultMaxChatsPerDay)
+    since := time.Now().Add(-24 * time.Hour).Unix()
+    createdToday, err := chatsColl.CountDocuments(ctx, bson.M{
+        "createdBy": userID,
+        "createdAt": bson.M{"$gte": since},
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+        return false
+    }
+    if createdToday >= int64(maxPerDay) {
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error":   "Daily chat limit reached",
+            "limit":   maxPerDay,
+            "message": "You've started too many chats today, try again tomorrow",
+        })
+        return false
+    }
+
+    return true
+}
+
+// participantsKey builds the order-independent dedup key for a participant set
+func participantsKey(ids []primitive.ObjectID) string {
+    hexIDs := make([]string, len(ids))
+    for i, id := range ids {
+        hexIDs[i] = id.Hex()
+    }
+    sort.Strings(hexIDs)
+    return strings.Join(hexIDs, ":")
+}
+
 func GetChat(c *gin.Context) {
     chatIDStr := c.Param("id")
-    chatID, err := primitive.ObjectIDFromHex(chatIDStr)
+    chatID, err := parseObjectID(c, chatIDStr, "chat ID")
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    chatsColl := database.Client.Database("coded").Collection("chats")
+    chatsColl := database.Chats
 
     pipeline := mongo.Pipeline{
         {{"$match", bson.D{
@@ -244,7 +512,7 @@ func GetChat(c *gin.Context) {
             {"participants", userID},
         }}},
         {{"$lookup", bson.D{
-            {"from", "users"},
+            {"from", database.Users.Name()},
             {"localField", "participants"},
             {"foreignField", "_id"},
             {"as", "participantsProfiles"},
@@ -263,6 +531,10 @@ func GetChat(c *gin.Context) {
         }}},
         {{"$project", bson.D{
             {"id", "$_id"},
+            {Key: "type", Value: 1},
+            {Key: "name", Value: 1},
+            {Key: "admins", Value: 1},
+            {Key: "participants", Value: 1},
             {"lastMessage", 1},
             {"lastMessageAt", 1},
             {"partner", bson.D{
@@ -292,6 +564,28 @@ func GetChat(c *gin.Context) {
         return
     }
 
+    // Groups return every member instead of a single partner
+    if chatType, _ := result["type"].(string); chatType == models.ChatTypeGroup {
+        var memberIDs []primitive.ObjectID
+        if ids, ok := result["participants"].(bson.A); ok {
+            for _, id := range ids {
+                if oid, ok := id.(primitive.ObjectID); ok {
+                    memberIDs = append(memberIDs, oid)
+                }
+            }
+        }
+        members, err := loadPublicProfiles(ctx, memberIDs)
+        if err != nil {
+            log.Printf("GetChat member lookup error: %v", err)
+        }
+        result["participants"] = memberProfiles(memberIDs, members)
+        delete(result, "partner")
+        c.JSON(http.StatusOK, result)
+        return
+    }
+    result["type"] = models.ChatTypeDirect
+    delete(result, "participants")
+
     // Apply fallback for partner
     partnerRaw := result["partner"]
     partnerMap := map[string]interface{}{
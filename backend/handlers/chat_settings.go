@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chatSettingsFor loads userID's settings for the given chats, keyed by chat
+// id. Chats the user never changed are absent and use the zero defaults.
+func chatSettingsFor(ctx context.Context, userID primitive.ObjectID, chatIDs []primitive.ObjectID) (map[primitive.ObjectID]models.ChatSettings, error) {
+	settings := make(map[primitive.ObjectID]models.ChatSettings, len(chatIDs))
+	if len(chatIDs) == 0 {
+		return settings, nil
+	}
+
+	settingsColl := database.ChatSettings
+	cursor, err := settingsColl.Find(ctx, bson.M{"userId": userID, "chatId": bson.M{"$in": chatIDs}})
+	if err != nil {
+		return settings, err
+	}
+	var list []models.ChatSettings
+	if err := cursor.All(ctx, &list); err != nil {
+		return settings, err
+	}
+	for _, s := range list {
+		settings[s.ChatID] = s
+	}
+	return settings, nil
+}
+
+// chatClearedAt returns when userID last cleared chatID, or 0
+func chatClearedAt(ctx context.Context, chatID, userID primitive.ObjectID) (int64, error) {
+	settings, err := chatSettingsFor(ctx, userID, []primitive.ObjectID{chatID})
+	return settings[chatID].ClearedAt, err
+}
+
+// chatsArchivedBy returns the ids of the chats userID has archived
+func chatsArchivedBy(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	settingsColl := database.ChatSettings
+	cursor, err := settingsColl.Find(ctx,
+		bson.M{"userId": userID, "archived": true},
+		options.Find().SetProjection(bson.M{"chatId": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var list []models.ChatSettings
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	chatIDs := make([]primitive.ObjectID, len(list))
+	for i, s := range list {
+		chatIDs[i] = s.ChatID
+	}
+	return chatIDs, nil
+}
+
+// chatMutedBy returns the participants of chatID who muted it
+func chatMutedBy(ctx context.Context, chatID primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	settingsColl := database.ChatSettings
+	cursor, err := settingsColl.Find(ctx,
+		bson.M{"chatId": chatID, "muted": true},
+		options.Find().SetProjection(bson.M{"userId": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var list []models.ChatSettings
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	muted := make(map[primitive.ObjectID]bool, len(list))
+	for _, s := range list {
+		muted[s.UserID] = true
+	}
+	return muted, nil
+}
+
+// saveChatSettings applies set to the caller's settings for the chat in the
+// URL, creating them if needed, and sends the result to all of the caller's
+// devices as chat_settings_updated. It writes the response.
+func saveChatSettings(c *gin.Context, set bson.M) {
+	chatID, err := parseObjectID(c, c.Param("id"), "chat ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	chatsColl := database.Chats
+	count, err := chatsColl.CountDocuments(ctx, bson.M{"_id": chatID, "participants": userID})
+	if err != nil {
+		log.Printf("saveChatSettings membership check error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat settings"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found or access denied"})
+		return
+	}
+
+	set["updatedAt"] = time.Now().Unix()
+
+	settingsColl := database.ChatSettings
+	var settings models.ChatSettings
+	err = settingsColl.FindOneAndUpdate(ctx,
+		bson.M{"chatId": chatID, "userId": userID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&settings)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("saveChatSettings update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat settings"})
+		return
+	}
+
+	// Keep the user's other sessions in step; the calling device gets the
+	// same event, which is harmless and saves it special-casing
+	if wsManager != nil {
+		wsManager.BroadcastChatSettingsUpdated(userID.Hex(), map[string]interface{}{
+			"chatId":    chatID.Hex(),
+			"archived":  settings.Archived,
+			"muted":     settings.Muted,
+			"pinned":    settings.Pinned,
+			"clearedAt": settings.ClearedAt,
+			"timestamp": settings.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": settings})
+}
+
+// UpdateChatSettings archives, mutes or pins a chat for the caller. Fields
+// left out of the body keep their current value.
+func UpdateChatSettings(c *gin.Context) {
+	var req struct {
+		Archived *bool `json:"archived"`
+		Muted    *bool `json:"muted"`
+		Pinned   *bool `json:"pinned"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	set := bson.M{}
+	if req.Archived != nil {
+		set["archived"] = *req.Archived
+	}
+	if req.Muted != nil {
+		set["muted"] = *req.Muted
+	}
+	if req.Pinned != nil {
+		set["pinned"] = *req.Pinned
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	saveChatSettings(c, set)
+}
+
+// ClearChat hides the chat's current history from the caller. Nothing is
+// deleted; the other participants still see every message.
+func ClearChat(c *gin.Context) {
+	saveChatSettings(c, bson.M{"clearedAt": time.Now().Unix()})
+}
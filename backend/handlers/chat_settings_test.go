@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+)
+
+func TestChatSettingsReachEveryDeviceOfTheUser(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+
+	m, server := startWebSocketManager(t)
+	devices := map[string]*gorillaws.Conn{
+		"phone":  dialAs(t, m, server, alice),
+		"laptop": dialAs(t, m, server, alice),
+	}
+	partner := dialAs(t, m, server, bob)
+	for deadline := time.Now().Add(2 * time.Second); len(m.ClientStats()[alice.Hex()]) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("second session never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	target := "/api/chats/" + chatID.Hex() + "/settings"
+	params := gin.Params{{Key: "id", Value: chatID.Hex()}}
+	w := testRequest(t, UpdateChatSettings, http.MethodPut, target, gin.H{"pinned": true}, alice.Hex(), params)
+	expectStatus(t, w, http.StatusOK)
+
+	for name, conn := range devices {
+		event := readEvent(t, conn, "chat_settings_updated", 2*time.Second)
+		if event == nil || event["chatId"] != chatID.Hex() || event["pinned"] != true {
+			t.Errorf("%s got %v, want the chat pinned", name, event)
+		}
+	}
+
+	w = testRequest(t, ClearChat, http.MethodPost, "/api/chats/"+chatID.Hex()+"/clear", nil, alice.Hex(), params)
+	expectStatus(t, w, http.StatusOK)
+
+	for name, conn := range devices {
+		event := readEvent(t, conn, "chat_settings_updated", 2*time.Second)
+		if cleared, _ := event["clearedAt"].(float64); cleared == 0 || event["pinned"] != true {
+			t.Errorf("%s got %v, want the chat cleared and still pinned", name, event)
+		}
+	}
+
+	// Settings are per user; the other participant hears nothing
+	if event := readEvent(t, partner, "chat_settings_updated", 200*time.Millisecond); event != nil {
+		t.Errorf("chat partner received %v", event)
+	}
+}
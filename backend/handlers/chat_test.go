@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParticipantsKeyIgnoresOrder(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	if participantsKey([]primitive.ObjectID{a, b}) != participantsKey([]primitive.ObjectID{b, a}) {
+		t.Error("participantsKey depends on participant order")
+	}
+	if participantsKey([]primitive.ObjectID{a, b}) == participantsKey([]primitive.ObjectID{a, primitive.NewObjectID()}) {
+		t.Error("different participant sets share a key")
+	}
+}
+
+func TestConcurrentDirectChatsAreDeduplicated(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	t.Cleanup(func() {
+		database.Chats.DeleteMany(context.Background(), bson.M{"participants": alice})
+	})
+
+	const attempts = 10
+	ids := make(chan string, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		// Both sides open the chat at once
+		from, to := alice, bob
+		if i%2 == 1 {
+			from, to = bob, alice
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := testRequest(t, CreateChat, http.MethodPost, "/api/chats", gin.H{"participants": []string{to.Hex()}}, from.Hex(), nil)
+			if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+				t.Errorf("CreateChat answered %d: %s", w.Code, w.Body.String())
+				ids <- ""
+				return
+			}
+			ids <- decodeBody(t, w)["id"].(string)
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	var first string
+	for id := range ids {
+		if first == "" {
+			first = id
+		} else if id != first {
+			t.Errorf("concurrent CreateChat returned chats %s and %s", first, id)
+		}
+	}
+	if n, _ := database.Chats.CountDocuments(ctx, bson.M{"participants": bson.M{"$all": bson.A{alice, bob}}}); n != 1 {
+		t.Errorf("%d chats stored for the pair, want 1", n)
+	}
+}
+
+// startChat asks CreateChat for a direct chat between from and to
+func startChat(t *testing.T, from, to primitive.ObjectID) *httptest.ResponseRecorder {
+	t.Helper()
+	return testRequest(t, CreateChat, http.MethodPost, "/api/chats", gin.H{"participants": []string{to.Hex()}}, from.Hex(), nil)
+}
+
+func TestActiveChatCapIgnoresArchivedChats(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("MAX_ACTIVE_CHATS", "2")
+	t.Setenv("MAX_CHATS_PER_DAY", "100")
+	alice := insertTestUser(t, ctx, nil)
+	t.Cleanup(func() {
+		database.Chats.DeleteMany(context.Background(), bson.M{"participants": alice})
+	})
+	first := insertDirectChat(t, ctx, alice, insertTestUser(t, ctx, nil))
+	insertDirectChat(t, ctx, alice, insertTestUser(t, ctx, nil))
+
+	w := startChat(t, alice, insertTestUser(t, ctx, nil))
+	expectStatus(t, w, http.StatusForbidden)
+	if body := decodeBody(t, w); body["limit"] != 2.0 {
+		t.Errorf("body = %v, want the limit of 2", body)
+	}
+
+	// Archiving a chat frees its slot
+	insertDocs(t, ctx, database.ChatSettings, models.ChatSettings{ID: primitive.NewObjectID(), ChatID: first, UserID: alice, Archived: true})
+	expectStatus(t, startChat(t, alice, insertTestUser(t, ctx, nil)), http.StatusCreated)
+
+	// Someone else archiving doesn't
+	expectStatus(t, startChat(t, alice, insertTestUser(t, ctx, nil)), http.StatusForbidden)
+}
+
+func TestDailyChatCap(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("MAX_ACTIVE_CHATS", "100")
+	t.Setenv("MAX_CHATS_PER_DAY", "2")
+	alice := insertTestUser(t, ctx, nil)
+	t.Cleanup(func() {
+		database.Chats.DeleteMany(context.Background(), bson.M{"participants": alice})
+	})
+
+	// A chat started two days ago doesn't count towards today
+	old := primitive.NewObjectID()
+	insertDocs(t, ctx, database.Chats, models.Chat{
+		ID: old, Type: models.ChatTypeGroup, Name: "old", CreatedBy: alice,
+		CreatedAt:    time.Now().Add(-48 * time.Hour).Unix(),
+		Participants: []primitive.ObjectID{alice, insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)},
+	})
+
+	for i := 0; i < 2; i++ {
+		expectStatus(t, startChat(t, alice, insertTestUser(t, ctx, nil)), http.StatusCreated)
+	}
+	w := startChat(t, alice, insertTestUser(t, ctx, nil))
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if body := decodeBody(t, w); body["limit"] != 2.0 {
+		t.Errorf("body = %v, want the limit of 2", body)
+	}
+
+	// Reopening an existing chat isn't a new one
+	bob := insertTestUser(t, ctx, nil)
+	insertDirectChat(t, ctx, alice, bob)
+	expectStatus(t, startChat(t, alice, bob), http.StatusOK)
+}
+
+func TestFindChat(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	find := func(other primitive.ObjectID) *httptest.ResponseRecorder {
+		return testRequest(t, FindChat, http.MethodGet, "/api/chats/find?userId="+other.Hex(), nil, alice.Hex(), nil)
+	}
+
+	// A group that has shrunk to the same two members is not their 1:1 chat
+	groupID := primitive.NewObjectID()
+	insertDocs(t, ctx, database.Chats, models.Chat{ID: groupID, Type: models.ChatTypeGroup, Participants: []primitive.ObjectID{alice, bob}})
+	expectStatus(t, find(bob), http.StatusNotFound)
+
+	chatID := insertDirectChat(t, ctx, bob, alice)
+	w := find(bob)
+	expectStatus(t, w, http.StatusOK)
+	if id, _ := decodeBody(t, w)["id"].(string); id != chatID.Hex() {
+		t.Errorf("found chat %q, want the direct chat %s", id, chatID.Hex())
+	}
+
+	expectStatus(t, find(carol), http.StatusNotFound)
+	expectStatus(t, find(alice), http.StatusBadRequest)
+}
+
+func TestGetUnreadCountsPerChat(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	withBob := insertDirectChat(t, ctx, alice, bob)
+	withCarol := insertDirectChat(t, ctx, alice, carol)
+	quiet := insertDirectChat(t, ctx, alice, insertTestUser(t, ctx, nil))
+	elsewhere := insertDirectChat(t, ctx, bob, carol)
+
+	insertUnread(t, ctx, withBob, bob, 3)
+	insertUnread(t, ctx, withBob, alice, 2) // the caller's own messages never count
+	insertUnread(t, ctx, withCarol, carol, 1)
+	insertUnread(t, ctx, elsewhere, bob, 4)
+	insertMessage(t, ctx, models.Message{ChatID: withCarol, SenderID: carol, Content: "seen", IsRead: true, CreatedAt: time.Now().Unix()})
+	insertMessage(t, ctx, models.Message{ChatID: withCarol, SenderID: carol, Deleted: true, CreatedAt: time.Now().Unix()})
+
+	w := testRequest(t, GetUnreadCounts, http.MethodGet, "/api/chats/unread", nil, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	counts := decodeBody(t, w)
+	want := map[string]float64{withBob.Hex(): 3, withCarol.Hex(): 1, quiet.Hex(): 0}
+	if len(counts) != len(want) {
+		t.Errorf("counts = %v, want only the caller's chats %v", counts, want)
+	}
+	for id, n := range want {
+		if got, ok := counts[id].(float64); !ok || got != n {
+			t.Errorf("chat %s unread = %v, want %v", id, counts[id], n)
+		}
+	}
+}
@@ -1,7 +1,17 @@
 package handlers
 
 import (
+    "context"
+    "fmt"
+    "io"
+    "log"
+    "mime/multipart"
+    "net/http"
+
+    "coded/moderation"
     "coded/websocket"
+
+    "github.com/gin-gonic/gin"
     "github.com/SherClockHolmes/webpush-go"
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -11,6 +21,8 @@ const fallbackAvatar = "https://upload.wikimedia.org/wikipedia/commons/8/89/Port
 
 var wsManager *websocket.Manager
 var vapidPrivateKey string
+var contentModerator moderation.Moderator
+var imageModerator moderation.ImageModerator = moderation.AllowAllImages{}
 
 // PushSubscription struct for push notifications
 type PushSubscription struct {
@@ -27,4 +39,88 @@ func SetWebSocketManager(manager *websocket.Manager) {
 // SetVAPIDPrivateKey sets the VAPID private key
 func SetVAPIDPrivateKey(key string) {
     vapidPrivateKey = key
+}
+
+// SetModerator sets the content moderator applied to posts and messages.
+// A nil moderator disables moderation.
+func SetModerator(m moderation.Moderator) {
+    contentModerator = m
+}
+
+// SetImageModerator sets the moderator uploaded avatars and photos are
+// checked with. A nil moderator lets every image through.
+func SetImageModerator(m moderation.ImageModerator) {
+    if m == nil {
+        m = moderation.AllowAllImages{}
+    }
+    imageModerator = m
+}
+
+// moderateImage runs an upload through the image moderator before it is sent
+// to Cloudinary, writing a 422 and returning false when it is rejected. If
+// the moderator can't decide the upload is refused with 503 rather than
+// stored unchecked. The file is rewound afterwards.
+func moderateImage(c *gin.Context, ctx context.Context, file multipart.File) bool {
+    ok, reason, err := imageModerator.CheckImage(ctx, file)
+    if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+        log.Printf("Failed to rewind upload: %v", seekErr)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+        return false
+    }
+    if err != nil {
+        log.Printf("Image moderation error: %v", err)
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Image moderation unavailable, try again later"})
+        return false
+    }
+    if !ok {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{
+            "error":   "Image not allowed",
+            "code":    "IMAGE_REJECTED",
+            "message": reason,
+        })
+        return false
+    }
+    return true
+}
+
+// moderateContent runs text through the configured moderator, writing a 422
+// and returning false when it is rejected
+func moderateContent(c *gin.Context, text string) bool {
+    if contentModerator == nil {
+        return true
+    }
+    if ok, reason := contentModerator.Check(text); !ok {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{
+            "error":   "Content not allowed",
+            "message": reason,
+        })
+        return false
+    }
+    return true
+}
+
+// parseObjectID parses a hex ObjectID taken from the request. On failure it
+// writes a 400 naming the field (e.g. "chat ID") and returns the error so the
+// handler can just return.
+func parseObjectID(c *gin.Context, value, fieldName string) (primitive.ObjectID, error) {
+    id, err := primitive.ObjectIDFromHex(value)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": fmt.Sprintf("Invalid %s", fieldName),
+            "code":  "INVALID_ID",
+        })
+        return primitive.NilObjectID, err
+    }
+    return id, nil
+}
+
+// currentUserID returns the authenticated caller's ID set by the JWT
+// middleware, writing a 401 if it is missing or malformed.
+func currentUserID(c *gin.Context) (primitive.ObjectID, error) {
+    id, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+        return primitive.NilObjectID, err
+    }
+    return id, nil
 }
\ No newline at end of file
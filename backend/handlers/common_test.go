@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseObjectID(t *testing.T) {
+	want := primitive.NewObjectID()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	got, err := parseObjectID(c, want.Hex(), "chat ID")
+	if err != nil || got != want {
+		t.Errorf("parseObjectID(%q) = %v, %v; want %v", want.Hex(), got, err, want)
+	}
+	if c.Writer.Written() {
+		t.Errorf("valid id wrote a response: %s", w.Body.String())
+	}
+
+	for _, value := range []string{"", "not-an-id", want.Hex()[:23], want.Hex() + "0"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		if _, err := parseObjectID(c, value, "chat ID"); err == nil {
+			t.Errorf("parseObjectID(%q) accepted", value)
+			continue
+		}
+		expectStatus(t, w, http.StatusBadRequest)
+		body := decodeBody(t, w)
+		if body["error"] != "Invalid chat ID" || body["code"] != "INVALID_ID" {
+			t.Errorf("parseObjectID(%q) answered %v", value, body)
+		}
+	}
+}
+
+func TestCurrentUserID(t *testing.T) {
+	want := primitive.NewObjectID()
+	w := testRequest(t, func(c *gin.Context) {
+		if got, err := currentUserID(c); err != nil || got != want {
+			t.Errorf("currentUserID = %v, %v; want %v", got, err, want)
+		}
+	}, http.MethodGet, "/", nil, want.Hex(), nil)
+	if w.Body.Len() != 0 {
+		t.Errorf("valid user id wrote a response: %s", w.Body.String())
+	}
+
+	w = testRequest(t, func(c *gin.Context) {
+		if _, err := currentUserID(c); err == nil {
+			t.Error("currentUserID accepted a missing user id")
+		}
+	}, http.MethodGet, "/", nil, "", nil)
+	expectStatus(t, w, http.StatusUnauthorized)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"coded/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// requireDB connects the database package to CODED_TEST_MONGODB_URI, using a
+// throwaway coded_test database that is dropped on first use, or skips the
+// test when no server is configured
+func requireDB(t *testing.T) context.Context {
+	t.Helper()
+	uri := os.Getenv("CODED_TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("CODED_TEST_MONGODB_URI not set")
+	}
+
+	testDBOnce.Do(func() {
+		os.Setenv("MONGODB_URI", uri)
+		os.Setenv("MONGODB_DATABASE", "coded_test")
+		if testDBErr = database.ConnectDB(); testDBErr != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if testDBErr = database.DB.Drop(ctx); testDBErr != nil {
+			return
+		}
+		testDBErr = database.EnsureIndexes(ctx)
+	})
+	if testDBErr != nil {
+		t.Fatalf("test database: %v", testDBErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// insertTestUser stores a user with a unique email and username, plus any
+// extra fields, and removes it when the test ends
+func insertTestUser(t *testing.T, ctx context.Context, fields bson.M) primitive.ObjectID {
+	t.Helper()
+	id := primitive.NewObjectID()
+	user := bson.M{"_id": id, "email": id.Hex() + "@example.com", "username": "u" + id.Hex(), "name": "Test " + id.Hex()[18:]}
+	for k, v := range fields {
+		user[k] = v
+	}
+	if _, err := database.Users.InsertOne(ctx, user); err != nil {
+		t.Fatalf("inserting user: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Users.DeleteOne(context.Background(), bson.M{"_id": id})
+	})
+	return id
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// disposableDomains holds the lowercase email domains Signup refuses. Empty
+// means the check is off.
+var disposableDomains map[string]bool
+
+// SetDisposableEmailDomains sets the domains Signup rejects. Subdomains of a
+// listed domain are rejected too. An empty list turns the check off.
+func SetDisposableEmailDomains(domains []string) {
+	set := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		if d = normalizeDomain(d); d != "" {
+			set[d] = true
+		}
+	}
+	disposableDomains = set
+}
+
+// ReadDomainList reads one domain per line from path. Blank lines and lines
+// starting with # are skipped.
+func ReadDomainList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
+
+// normalizeDomain lowercases d and strips surrounding space, a leading "@"
+// and a trailing dot
+func normalizeDomain(d string) string {
+	d = strings.ToLower(strings.TrimSpace(d))
+	d = strings.TrimPrefix(d, "@")
+	return strings.TrimSuffix(d, ".")
+}
+
+// isDisposableEmail reports whether email's domain, or any parent of it, is
+// on the disposable list
+func isDisposableEmail(email string) bool {
+	if len(disposableDomains) == 0 {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := normalizeDomain(email[at+1:])
+	for domain != "" {
+		if disposableDomains[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+	return false
+}
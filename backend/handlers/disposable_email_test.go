@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func useDisposableDomains(t *testing.T, domains ...string) {
+	t.Helper()
+	SetDisposableEmailDomains(domains)
+	t.Cleanup(func() { SetDisposableEmailDomains(nil) })
+}
+
+func TestIsDisposableEmail(t *testing.T) {
+	useDisposableDomains(t, "Mailinator.com", "@trashmail.io.", " ")
+
+	tests := map[string]bool{
+		"ada@mailinator.com":       true,
+		"Ada@MAILINATOR.COM":       true,
+		"ada@inbox.mailinator.com": true,
+		"ada@trashmail.io":         true,
+		"ada@gmail.com":            false,
+		"ada@notmailinator.com":    false,
+		"ada@mailinator.com.au":    false,
+		"not-an-email":             false,
+	}
+	for email, want := range tests {
+		if got := isDisposableEmail(email); got != want {
+			t.Errorf("isDisposableEmail(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
+
+func TestIsDisposableEmailOffWithoutList(t *testing.T) {
+	useDisposableDomains(t)
+	if isDisposableEmail("ada@mailinator.com") {
+		t.Error("empty list rejected an address")
+	}
+}
+
+func TestReadDomainList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	content := "# disposable providers\nmailinator.com\n\n  trashmail.io  \n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	domains, err := ReadDomainList(path)
+	if err != nil {
+		t.Fatalf("ReadDomainList: %v", err)
+	}
+	if want := []string{"mailinator.com", "trashmail.io"}; !slices.Equal(domains, want) {
+		t.Errorf("ReadDomainList = %v, want %v", domains, want)
+	}
+
+	if _, err := ReadDomainList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file read without error")
+	}
+}
+
+func TestSignupRejectsDisposableEmail(t *testing.T) {
+	useDisposableDomains(t, "mailinator.com")
+
+	w := testRequest(t, Signup, http.MethodPost, "/api/signup",
+		gin.H{"email": "ada@Mailinator.com", "password": "hunter22"}, "", nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	if body := decodeBody(t, w); body["code"] != "DISPOSABLE_EMAIL" {
+		t.Errorf("body = %v, want code DISPOSABLE_EMAIL", body)
+	}
+}
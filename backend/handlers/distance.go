@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Distance labels shown in discovery responses. Every feed/nearby path goes
+// through distanceLabel so the wording stays consistent.
+const (
+	distanceLabelNearby  = "Nearby"
+	distanceLabelUnknown = "Unknown"
+	distanceLabelFormat  = "%.0f km away"
+)
+
+// hasLocation reports whether a user has a usable location. Nil pointers and
+// the (0,0) default are both treated as "no location".
+func hasLocation(u *models.User) bool {
+	if u == nil || u.Latitude == nil || u.Longitude == nil {
+		return false
+	}
+	return !(*u.Latitude == 0 && *u.Longitude == 0)
+}
+
+// distanceLabel applies the distance policy between the viewer and another user:
+//   - viewer has no location: everything is "Nearby"
+//   - other user has no location: "Unknown"
+//   - otherwise the computed distance in km
+func distanceLabel(viewer, other *models.User) string {
+	if !hasLocation(viewer) {
+		return distanceLabelNearby
+	}
+	if !hasLocation(other) {
+		return distanceLabelUnknown
+	}
+	return fmt.Sprintf(distanceLabelFormat, cachedDistance(viewer, other))
+}
+
+// userAtDistance is a user found by a geo query, with their distance from
+// the viewer in meters as computed by Mongo
+type userAtDistance struct {
+	models.User    `bson:",inline"`
+	DistanceMeters float64 `bson:"distanceMeters"`
+}
+
+// usersWithinRadius loads the users within radiusMeters of viewer that match
+// query, nearest first, applying skip and limit when they are positive. It
+// runs $geoNear on the users location index, so only users with a GeoJSON
+// location are found. viewer must have a location.
+func usersWithinRadius(ctx context.Context, viewer *models.User, radiusMeters float64, query bson.M, skip, limit int64) ([]userAtDistance, error) {
+	near := models.NewGeoPoint(*viewer.Latitude, *viewer.Longitude)
+	if near == nil {
+		return nil, nil
+	}
+
+	usersColl := database.Users
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          near,
+			"key":           "location",
+			"distanceField": "distanceMeters",
+			"maxDistance":   radiusMeters,
+			"spherical":     true,
+			"query":         query,
+		}}},
+	}
+	if skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: skip}})
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	cursor, err := usersColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var users []userAtDistance
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// syncUserLocation rewrites the user's GeoJSON location from their stored
+// latitude/longitude, clearing it when they no longer have a usable one
+func syncUserLocation(ctx context.Context, userID primitive.ObjectID) error {
+	usersColl := database.Users
+
+	var user models.User
+	projection := options.FindOne().SetProjection(bson.M{"latitude": 1, "longitude": 1})
+	if err := usersColl.FindOne(ctx, bson.M{"_id": userID}, projection).Decode(&user); err != nil {
+		return err
+	}
+
+	update := bson.M{"$unset": bson.M{"location": ""}}
+	if hasLocation(&user) {
+		if point := models.NewGeoPoint(*user.Latitude, *user.Longitude); point != nil {
+			update = bson.M{"$set": bson.M{"location": point}}
+		}
+	}
+	_, err := usersColl.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	return err
+}
+
+// UpdateMyLocation stores the caller's coordinates and bumps lastSeen. It is
+// the cheap path for frequent location pings; PUT /me does the same as part
+// of a full profile update.
+func UpdateMyLocation(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Latitude  *float64 `json:"latitude" binding:"required"`
+		Longitude *float64 `json:"longitude" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "latitude and longitude are required"})
+		return
+	}
+
+	lat, lng := *req.Latitude, *req.Longitude
+	if lat < -90 || lat > 90 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "latitude must be between -90 and 90"})
+		return
+	}
+	if lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "longitude must be between -180 and 180"})
+		return
+	}
+	// (0,0) is what clients send before they have a fix
+	point := models.NewGeoPoint(lat, lng)
+	if point == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+	result, err := usersColl.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{
+			"latitude":  lat,
+			"longitude": lng,
+			"location":  point,
+			"lastSeen":  time.Now().Unix(),
+		}},
+	)
+	if err != nil {
+		log.Printf("UpdateMyLocation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	invalidateDistances(userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"latitude":  lat,
+		"longitude": lng,
+	})
+}
+
+// calculateDistance calculates distance in kilometers using Haversine formula
+func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371 // Earth's radius in kilometers
+
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return R * c
+}
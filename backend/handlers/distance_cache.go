@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"coded/config"
+	"coded/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultDistanceCacheTTL is used when DISTANCE_CACHE_TTL is unset
+	defaultDistanceCacheTTL = 2 * time.Minute
+	// distanceCachePrecision rounds the viewer's coordinates to 3 decimal
+	// places (~100m) so small GPS jitter still hits the cache
+	distanceCachePrecision = 1000
+	// distanceCacheMaxEntries bounds memory. A full cache first sweeps
+	// expired entries, then evicts arbitrary live ones to make room.
+	distanceCacheMaxEntries = 50000
+)
+
+type distanceCacheKey struct {
+	lat, lon    int64
+	candidateID primitive.ObjectID
+}
+
+type distanceCacheEntry struct {
+	km        float64
+	expiresAt time.Time
+}
+
+// distanceStore holds computed distances, indexed by candidate so a user's
+// entries can be dropped without scanning the whole cache
+type distanceStore struct {
+	sync.Mutex
+	entries     map[distanceCacheKey]distanceCacheEntry
+	byCandidate map[primitive.ObjectID]map[distanceCacheKey]struct{}
+	maxEntries  int
+}
+
+func newDistanceStore(maxEntries int) *distanceStore {
+	return &distanceStore{
+		entries:     make(map[distanceCacheKey]distanceCacheEntry),
+		byCandidate: make(map[primitive.ObjectID]map[distanceCacheKey]struct{}),
+		maxEntries:  maxEntries,
+	}
+}
+
+var distanceCache = newDistanceStore(distanceCacheMaxEntries)
+
+// get returns the cached distance for key if it hasn't expired
+func (d *distanceStore) get(key distanceCacheKey, now time.Time) (float64, bool) {
+	d.Lock()
+	defer d.Unlock()
+	entry, ok := d.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		return 0, false
+	}
+	return entry.km, true
+}
+
+// put stores a distance, making room first if the cache is full
+func (d *distanceStore) put(key distanceCacheKey, km float64, now, expiresAt time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, exists := d.entries[key]; !exists && len(d.entries) >= d.maxEntries {
+		for k, e := range d.entries {
+			if !now.Before(e.expiresAt) {
+				d.remove(k)
+			}
+		}
+		// Map iteration order is unspecified, so this evicts arbitrary
+		// entries
+		for k := range d.entries {
+			if len(d.entries) < d.maxEntries {
+				break
+			}
+			d.remove(k)
+		}
+	}
+
+	d.entries[key] = distanceCacheEntry{km: km, expiresAt: expiresAt}
+	keys := d.byCandidate[key.candidateID]
+	if keys == nil {
+		keys = make(map[distanceCacheKey]struct{})
+		d.byCandidate[key.candidateID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// remove drops one entry and its index record. Caller must hold the lock.
+func (d *distanceStore) remove(key distanceCacheKey) {
+	delete(d.entries, key)
+	if keys := d.byCandidate[key.candidateID]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(d.byCandidate, key.candidateID)
+		}
+	}
+}
+
+// invalidate drops every entry whose candidate is userID
+func (d *distanceStore) invalidate(userID primitive.ObjectID) {
+	d.Lock()
+	defer d.Unlock()
+	for key := range d.byCandidate[userID] {
+		delete(d.entries, key)
+	}
+	delete(d.byCandidate, userID)
+}
+
+// cachedDistance returns the distance in km between viewer and other, reusing
+// a recent result for the same (rounded viewer location, candidate) pair.
+// Both users must have a location (see hasLocation).
+func cachedDistance(viewer, other *models.User) float64 {
+	key := distanceCacheKey{
+		lat:         int64(math.Round(*viewer.Latitude * distanceCachePrecision)),
+		lon:         int64(math.Round(*viewer.Longitude * distanceCachePrecision)),
+		candidateID: other.ID,
+	}
+	now := time.Now()
+
+	if km, ok := distanceCache.get(key, now); ok {
+		return km
+	}
+
+	km := calculateDistance(*viewer.Latitude, *viewer.Longitude, *other.Latitude, *other.Longitude)
+	ttl := config.Duration("DISTANCE_CACHE_TTL", defaultDistanceCacheTTL)
+	distanceCache.put(key, km, now, now.Add(ttl))
+
+	return km
+}
+
+// invalidateDistances drops cached distances to a user after they move.
+// Entries computed from their old location as a viewer are keyed by that
+// location, so they simply stop matching.
+func invalidateDistances(userID primitive.ObjectID) {
+	distanceCache.invalidate(userID)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func distanceKey(lat int64, candidate primitive.ObjectID) distanceCacheKey {
+	return distanceCacheKey{lat: lat, lon: 0, candidateID: candidate}
+}
+
+func TestDistanceStoreEnforcesMaxEntries(t *testing.T) {
+	d := newDistanceStore(10)
+	now := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 100; i++ {
+		d.put(distanceKey(int64(i), primitive.NewObjectID()), 1, now, now.Add(time.Minute))
+		if len(d.entries) > 10 {
+			t.Fatalf("cache grew to %d entries, limit 10", len(d.entries))
+		}
+	}
+
+	indexed := 0
+	for _, keys := range d.byCandidate {
+		indexed += len(keys)
+	}
+	if indexed != len(d.entries) {
+		t.Errorf("index holds %d keys for %d entries", indexed, len(d.entries))
+	}
+}
+
+func TestDistanceStoreSweepsExpiredBeforeEvicting(t *testing.T) {
+	d := newDistanceStore(3)
+	now := time.Unix(1_700_000_000, 0)
+	live := distanceKey(1, primitive.NewObjectID())
+	d.put(live, 1, now, now.Add(time.Hour))
+	d.put(distanceKey(2, primitive.NewObjectID()), 2, now, now.Add(time.Second))
+	d.put(distanceKey(3, primitive.NewObjectID()), 3, now, now.Add(time.Second))
+
+	later := now.Add(time.Minute)
+	d.put(distanceKey(4, primitive.NewObjectID()), 4, later, later.Add(time.Hour))
+	if _, ok := d.get(live, later); !ok {
+		t.Error("live entry evicted while expired ones were available")
+	}
+	if len(d.entries) != 2 {
+		t.Errorf("%d entries after sweep, want 2", len(d.entries))
+	}
+}
+
+func TestDistanceStoreInvalidate(t *testing.T) {
+	d := newDistanceStore(100)
+	now := time.Unix(1_700_000_000, 0)
+	mover, other := primitive.NewObjectID(), primitive.NewObjectID()
+	for i := int64(0); i < 5; i++ {
+		d.put(distanceKey(i, mover), 1, now, now.Add(time.Hour))
+	}
+	d.put(distanceKey(0, other), 2, now, now.Add(time.Hour))
+
+	d.invalidate(mover)
+	for i := int64(0); i < 5; i++ {
+		if _, ok := d.get(distanceKey(i, mover), now); ok {
+			t.Fatalf("entry %d for the moved user survived", i)
+		}
+	}
+	if _, ok := d.get(distanceKey(0, other), now); !ok {
+		t.Error("another user's entry was dropped")
+	}
+	if _, ok := d.byCandidate[mover]; ok {
+		t.Error("index still lists the moved user")
+	}
+}
+
+func TestDistanceStoreExpires(t *testing.T) {
+	d := newDistanceStore(10)
+	now := time.Unix(1_700_000_000, 0)
+	key := distanceKey(1, primitive.NewObjectID())
+	d.put(key, 1.5, now, now.Add(time.Minute))
+
+	if km, ok := d.get(key, now); !ok || km != 1.5 {
+		t.Errorf("get = %v, %v; want 1.5, true", km, ok)
+	}
+	if _, ok := d.get(key, now.Add(time.Minute)); ok {
+		t.Error("expired entry returned")
+	}
+}
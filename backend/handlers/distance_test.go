@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUpdateMyLocationValidation(t *testing.T) {
+	user := primitive.NewObjectID().Hex()
+	tests := map[string]gin.H{
+		"latitude too high":  {"latitude": 90.01, "longitude": 10},
+		"latitude too low":   {"latitude": -91, "longitude": 10},
+		"longitude too high": {"latitude": 10, "longitude": 180.5},
+		"longitude too low":  {"latitude": 10, "longitude": -181},
+		"null island":        {"latitude": 0, "longitude": 0},
+		"missing latitude":   {"longitude": 10},
+		"missing longitude":  {"latitude": 10},
+		"not numbers":        {"latitude": "north", "longitude": "east"},
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, UpdateMyLocation, http.MethodPut, "/api/me/location", body, user, nil)
+			expectStatus(t, w, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestUpdateMyLocationStoresBothForms(t *testing.T) {
+	ctx := requireDB(t)
+	userID := insertTestUser(t, ctx, bson.M{"lastSeen": int64(1)})
+
+	// The range ends are valid, as is a zero on just one axis
+	for _, coords := range [][2]float64{{90, 180}, {-90, -180}, {0, 36.8}, {-1.29, 36.82}} {
+		lat, lng := coords[0], coords[1]
+		before := time.Now().Unix()
+		w := testRequest(t, UpdateMyLocation, http.MethodPut, "/api/me/location",
+			gin.H{"latitude": lat, "longitude": lng}, userID.Hex(), nil)
+		expectStatus(t, w, http.StatusOK)
+
+		var user models.User
+		if err := database.Users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+			t.Fatalf("loading user: %v", err)
+		}
+		if user.Latitude == nil || *user.Latitude != lat || user.Longitude == nil || *user.Longitude != lng {
+			t.Errorf("(%v, %v): stored latitude/longitude %v/%v", lat, lng, user.Latitude, user.Longitude)
+		}
+		if user.Location == nil || user.Location.Coordinates != [2]float64{lng, lat} {
+			t.Errorf("(%v, %v): stored GeoJSON %+v, want [lng, lat]", lat, lng, user.Location)
+		}
+		if user.LastSeen < before {
+			t.Errorf("(%v, %v): lastSeen %d not refreshed", lat, lng, user.LastSeen)
+		}
+	}
+}
+
+// locatedUser is a user at lat/lng, with a fresh id so cached distances
+// from other tests don't apply
+func locatedUser(lat, lng float64) *models.User {
+	return &models.User{ID: primitive.NewObjectID(), Latitude: &lat, Longitude: &lng}
+}
+
+func TestDistanceLabel(t *testing.T) {
+	nairobi := locatedUser(-1.2921, 36.8219)
+	tests := map[string]struct {
+		viewer, other *models.User
+		want          string
+	}{
+		"both located":                {nairobi, locatedUser(-0.0917, 34.7680), "265 km away"},
+		"same spot":                   {nairobi, locatedUser(-1.2921, 36.8219), "0 km away"},
+		"under half a km rounds down": {nairobi, locatedUser(-1.2921+0.004, 36.8219), "0 km away"},
+		"over half a km rounds up":    {nairobi, locatedUser(-1.2921+0.005, 36.8219), "1 km away"},
+		"one degree of latitude":      {locatedUser(10, 20), locatedUser(11, 20), "111 km away"},
+		"zero on one axis is located": {locatedUser(0, 36.8219), locatedUser(1, 36.8219), "111 km away"},
+		"viewer unlocated":            {&models.User{}, nairobi, distanceLabelNearby},
+		"viewer at null island":       {locatedUser(0, 0), nairobi, distanceLabelNearby},
+		"neither located":             {nil, &models.User{}, distanceLabelNearby},
+		"author unlocated":            {nairobi, &models.User{ID: primitive.NewObjectID()}, distanceLabelUnknown},
+		"author at null island":       {nairobi, locatedUser(0, 0), distanceLabelUnknown},
+	}
+	for name, tt := range tests {
+		if got := distanceLabel(tt.viewer, tt.other); got != tt.want {
+			t.Errorf("%s: distanceLabel = %q, want %q", name, got, tt.want)
+		}
+	}
+}
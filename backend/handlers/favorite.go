@@ -5,18 +5,24 @@ import (
 	"net/http"
 	"time"
 
+	"coded/config"
 	"coded/database"
 	"coded/models"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // REMOVE this line - fallbackAvatar is already declared in user.go
 // const fallbackAvatar = "https://upload.wikimedia.org/wikipedia/commons/8/89/Portrait_Placeholder.png"
 
+// defaultMaxFavorites caps how many users one account can favorite when
+// MAX_FAVORITES is unset
+const defaultMaxFavorites = 1000
+
 func AddFavorite(c *gin.Context) {
 	var req struct {
 		TargetUserID string `json:"targetUserId" binding:"required"`
@@ -26,16 +32,13 @@ func AddFavorite(c *gin.Context) {
 		return
 	}
 
-	userIDStr := c.GetString("userId")
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	userID, err := currentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	targetID, err := primitive.ObjectIDFromHex(req.TargetUserID)
+	targetID, err := parseObjectID(c, req.TargetUserID, "target user ID")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target user ID"})
 		return
 	}
 
@@ -44,25 +47,32 @@ func AddFavorite(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	favColl := database.Client.Database("coded").Collection("favorites")
+	if !rejectIfBlocked(c, ctx, userID, []primitive.ObjectID{targetID}) {
+		return
+	}
 
-	// Check if already favorited
-	count, err := favColl.CountDocuments(ctx, bson.M{
-		"userId":       userID,
-		"targetUserId": targetID,
-	})
+	favColl := database.Favorites
+
+	maxFavorites := config.Int("MAX_FAVORITES", defaultMaxFavorites)
+	count, err := favColl.CountDocuments(ctx, bson.M{"userId": userID})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	if count > 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "Already favorited"})
+	if count >= int64(maxFavorites) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Favorite limit reached",
+			"limit":   maxFavorites,
+			"message": "Remove some favorites before adding new ones",
+		})
 		return
 	}
 
+	// The unique {userId, targetUserId} index rejects duplicates, so there's
+	// no count-then-insert race between concurrent requests
 	fav := models.Favorite{
 		ID:           primitive.NewObjectID(),
 		UserID:       userID,
@@ -71,12 +81,21 @@ func AddFavorite(c *gin.Context) {
 	}
 
 	_, err = favColl.InsertOne(ctx, fav)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already favorited"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add favorite"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Favorite added"})
+	matched := handleMutualFavorite(ctx, userID, targetID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Favorite added",
+		"matched": matched,
+	})
 }
 
 func RemoveFavorite(c *gin.Context) {
@@ -95,23 +114,20 @@ func RemoveFavorite(c *gin.Context) {
 		targetUserId = req.TargetUserID
 	}
 
-	userIDStr := c.GetString("userId")
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	userID, err := currentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	targetID, err := primitive.ObjectIDFromHex(targetUserId)
+	targetID, err := parseObjectID(c, targetUserId, "target user ID")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target user ID"})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	favColl := database.Client.Database("coded").Collection("favorites")
+	favColl := database.Favorites
 
 	result, err := favColl.DeleteOne(ctx, bson.M{
 		"userId":       userID,
@@ -131,18 +147,16 @@ func RemoveFavorite(c *gin.Context) {
 }
 
 func GetFavorites(c *gin.Context) {
-	userIDStr := c.GetString("userId")
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	userID, err := currentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	favColl := database.Client.Database("coded").Collection("favorites")
-	usersColl := database.Client.Database("coded").Collection("users")
+	favColl := database.Favorites
+	usersColl := database.Users
 
 	// Fetch favorites
 	findOptions := options.Find().SetSort(bson.D{{"createdAt", -1}})
@@ -221,4 +235,59 @@ func GetFavorites(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, response)
+}
+
+// GetFavorite returns the caller's favorite of one user, with the target's
+// profile and whether they favorited the caller back. 404 if not favorited.
+func GetFavorite(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	targetID, err := parseObjectID(c, c.Param("targetUserId"), "target user ID")
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	favColl := database.Favorites
+
+	var fav models.Favorite
+	err = favColl.FindOne(ctx, bson.M{"userId": userID, "targetUserId": targetID}).Decode(&fav)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not favorited"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorite"})
+		return
+	}
+
+	mutual, err := favColl.CountDocuments(ctx, bson.M{"userId": targetID, "targetUserId": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check mutual favorite"})
+		return
+	}
+
+	usersColl := database.Users
+	var target *models.User
+	var u models.User
+	err = usersColl.FindOne(ctx, bson.M{"_id": targetID}, options.FindOne().SetProjection(publicUserFields)).Decode(&u)
+	if err == nil {
+		target = &u
+	} else if err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           fav.ID.Hex(),
+		"targetUserId": fav.TargetUserID.Hex(),
+		"createdAt":    fav.CreatedAt,
+		"user":         publicProfile(targetID, target),
+		"mutual":       mutual > 0,
+	})
 }
\ No newline at end of file
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConcurrentFavoritesCreateOneRow(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	t.Cleanup(func() {
+		database.Favorites.DeleteMany(context.Background(), bson.M{"userId": alice})
+	})
+
+	const attempts = 10
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := testRequest(t, AddFavorite, http.MethodPost, "/api/favorite", gin.H{"targetUserId": bob.Hex()}, alice.Hex(), nil)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("concurrent favorite answered %d, want 201 or 409", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d requests reported creating the favorite, want 1", created)
+	}
+	if n, _ := database.Favorites.CountDocuments(ctx, bson.M{"userId": alice, "targetUserId": bob}); n != 1 {
+		t.Errorf("%d favorite rows stored, want 1", n)
+	}
+}
+
+func TestAddFavoriteCap(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("MAX_FAVORITES", "2")
+	alice := insertTestUser(t, ctx, nil)
+	t.Cleanup(func() {
+		database.Favorites.DeleteMany(context.Background(), bson.M{"userId": alice})
+	})
+
+	add := func() *httptest.ResponseRecorder {
+		target := insertTestUser(t, ctx, nil)
+		return testRequest(t, AddFavorite, http.MethodPost, "/api/favorite", gin.H{"targetUserId": target.Hex()}, alice.Hex(), nil)
+	}
+	expectStatus(t, add(), http.StatusCreated)
+	expectStatus(t, add(), http.StatusCreated)
+
+	w := add()
+	expectStatus(t, w, http.StatusForbidden)
+	if body := decodeBody(t, w); body["error"] != "Favorite limit reached" || body["limit"] != float64(2) {
+		t.Errorf("body = %v, want the limit error with limit 2", body)
+	}
+	if n, _ := database.Favorites.CountDocuments(ctx, bson.M{"userId": alice}); n != 2 {
+		t.Errorf("%d favorites stored, want 2", n)
+	}
+
+	// Removing one frees a slot
+	database.Favorites.DeleteOne(ctx, bson.M{"userId": alice})
+	expectStatus(t, add(), http.StatusCreated)
+}
+
+func TestGetFavorite(t *testing.T) {
+	ctx := requireDB(t)
+	alice := insertTestUser(t, ctx, nil)
+	bob := insertTestUser(t, ctx, bson.M{"name": "Bob"})
+	get := func(userID, targetID primitive.ObjectID) *httptest.ResponseRecorder {
+		params := gin.Params{{Key: "targetUserId", Value: targetID.Hex()}}
+		return testRequest(t, GetFavorite, http.MethodGet, "/api/favorite/"+targetID.Hex(), nil, userID.Hex(), params)
+	}
+
+	expectStatus(t, get(alice, bob), http.StatusNotFound)
+
+	favorite(t, alice, bob)
+	w := get(alice, bob)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeBody(t, w)
+	user, _ := body["user"].(map[string]interface{})
+	if body["targetUserId"] != bob.Hex() || body["mutual"] != false || user["name"] != "Bob" {
+		t.Errorf("one-way favorite = %v, want bob, not mutual", body)
+	}
+	// Bob hasn't favorited alice, so the reverse lookup is still 404
+	expectStatus(t, get(bob, alice), http.StatusNotFound)
+
+	favorite(t, bob, alice)
+	for _, pair := range [][2]primitive.ObjectID{{alice, bob}, {bob, alice}} {
+		w := get(pair[0], pair[1])
+		expectStatus(t, w, http.StatusOK)
+		if body := decodeBody(t, w); body["mutual"] != true {
+			t.Errorf("mutual favorite = %v, want mutual true", body)
+		}
+	}
+}
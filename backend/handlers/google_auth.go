@@ -2,16 +2,19 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
+	"coded/config"
 	"coded/database"
-	"coded/middleware"
 	"coded/models"
 
 	"github.com/gin-gonic/gin"
@@ -26,28 +29,100 @@ import (
 // Google OAuth Config
 var (
 	googleOAuthConfig *oauth2.Config
+	// googleCallbackPath is the path part of the redirect URL, which the
+	// state cookie is scoped to
+	googleCallbackPath = "/api/google/callback"
+	// googleFrontendRedirect is where the browser is sent after the OAuth
+	// callback, with the session in the URL fragment. Empty means the
+	// callback answers with JSON.
+	googleFrontendRedirect string
 )
 
-// Initialize Google OAuth
-func init() {
+// defaultGoogleRedirectURL is the callback Google is told to use when
+// GOOGLE_REDIRECT_URL is unset; only good for local development
+const defaultGoogleRedirectURL = "http://localhost:8080/api/google/callback"
+
+// ConfigureGoogleOAuth sets up the redirect OAuth flow from GOOGLE_CLIENT_ID,
+// GOOGLE_CLIENT_SECRET, GOOGLE_REDIRECT_URL and GOOGLE_FRONTEND_REDIRECT_URL.
+// It must run after the environment is loaded, and fails if either URL is
+// malformed so a bad deploy is caught at startup rather than at sign-in.
+func ConfigureGoogleOAuth() error {
+	redirectURL := config.String("GOOGLE_REDIRECT_URL", defaultGoogleRedirectURL)
+	callback, err := parseAbsoluteURL(redirectURL)
+	if err != nil {
+		return fmt.Errorf("GOOGLE_REDIRECT_URL: %w", err)
+	}
+
+	if frontend := os.Getenv("GOOGLE_FRONTEND_REDIRECT_URL"); frontend != "" {
+		if _, err := parseAbsoluteURL(frontend); err != nil {
+			return fmt.Errorf("GOOGLE_FRONTEND_REDIRECT_URL: %w", err)
+		}
+		googleFrontendRedirect = frontend
+	}
+
 	clientID := os.Getenv("GOOGLE_CLIENT_ID")
 	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	
-	if clientID != "" && clientSecret != "" {
-		googleOAuthConfig = &oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			RedirectURL:  "http://localhost:8080/api/google/callback",
-			Scopes: []string{
-				"https://www.googleapis.com/auth/userinfo.email",
-				"https://www.googleapis.com/auth/userinfo.profile",
-			},
-			Endpoint: google.Endpoint,
-		}
-		log.Println("✅ Google OAuth configured successfully")
-	} else {
+	if clientID == "" || clientSecret == "" {
 		log.Println("⚠️  Google OAuth not configured - set GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET")
+		return nil
+	}
+
+	googleCallbackPath = callback.Path
+	googleOAuthConfig = &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes: []string{
+			"https://www.googleapis.com/auth/userinfo.email",
+			"https://www.googleapis.com/auth/userinfo.profile",
+		},
+		Endpoint: google.Endpoint,
+	}
+	log.Printf("✅ Google OAuth configured (redirect %s)", redirectURL)
+	return nil
+}
+
+// parseAbsoluteURL parses raw and checks it is an http(s) URL with a host
+func parseAbsoluteURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%q must be an http or https URL", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q has no host", raw)
 	}
+	return u, nil
+}
+
+// The OAuth state issued by GetGoogleAuthURL is kept in this cookie until
+// the callback checks it, so a callback the user didn't start is refused
+const (
+	googleStateCookie    = "google_oauth_state"
+	googleStateCookieTTL = 10 * time.Minute
+)
+
+// setGoogleStateCookie stores state for the callback to check. The cookie is
+// scoped to the callback path and unreadable from scripts.
+func setGoogleStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(googleStateCookie, state, maxAge, googleCallbackPath, "", secure, true)
+}
+
+// verifyGoogleState reports whether the callback's state matches the one
+// issued to this browser. The cookie is cleared either way so a state is
+// only good once.
+func verifyGoogleState(c *gin.Context) bool {
+	expected, err := c.Cookie(googleStateCookie)
+	setGoogleStateCookie(c, "", -1)
+	if err != nil || expected == "" {
+		return false
+	}
+	state := c.Query("state")
+	return subtle.ConstantTimeCompare([]byte(state), []byte(expected)) == 1
 }
 
 // Google user info structure
@@ -67,29 +142,85 @@ type GoogleAuthRequest struct {
 	Credential string `json:"credential" binding:"required"`
 }
 
-// Generate username from email
-func generateUsernameFromEmail(email string) string {
-	// Take the part before @ and clean it up
-	for i := 0; i < len(email); i++ {
-		if email[i] == '@' {
-			username := email[:i]
-			// Remove any dots and make lowercase
-			cleanUsername := ""
-			for _, ch := range username {
-				if ch != '.' {
-					cleanUsername += string(ch)
-				}
+// Username generation limits
+const (
+	maxUsernameBaseLength = 20
+	maxUsernameAttempts   = 10
+)
+
+// usernameBase turns the local part of an email into a username stem:
+// lowercase a-z, 0-9 and single underscores only, at most
+// maxUsernameBaseLength long. Falls back to "user" if nothing is left.
+func usernameBase(email string) string {
+	local := strings.ToLower(email)
+	if at := strings.IndexByte(local, '@'); at >= 0 {
+		local = local[:at]
+	}
+	// Gmail-style "+tag" suffixes aren't part of the name
+	if plus := strings.IndexByte(local, '+'); plus >= 0 {
+		local = local[:plus]
+	}
+
+	var b strings.Builder
+	for _, ch := range local {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9':
+			b.WriteRune(ch)
+		case ch == '_' || ch == '-':
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
 			}
-			return cleanUsername + "_" + primitive.NewObjectID().Hex()[:4]
 		}
+		if b.Len() >= maxUsernameBaseLength {
+			break
+		}
+	}
+
+	base := strings.Trim(b.String(), "_")
+	if len(base) > maxUsernameBaseLength {
+		base = strings.TrimRight(base[:maxUsernameBaseLength], "_")
+	}
+	if base == "" {
+		base = "user"
+	}
+	return base
+}
+
+// generateUsernameFromEmail picks a username that isn't taken yet: the
+// sanitized email stem if free, otherwise the stem with a random suffix,
+// checking the users collection each time like the referral-code loop
+func generateUsernameFromEmail(ctx context.Context, usersColl *mongo.Collection, email string) (string, error) {
+	base := usernameBase(email)
+	candidate := base
+	for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+		count, err := usersColl.CountDocuments(ctx, bson.M{"username": candidate})
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+
+		suffix, err := generateToken()
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "_" + suffix[:4]
 	}
-	return "user_" + primitive.NewObjectID().Hex()[:8]
+	// An ObjectID suffix is unique without another lookup
+	return base + "_" + primitive.NewObjectID().Hex(), nil
 }
 
 // Handle Google OAuth callback (for traditional OAuth flow)
 func GoogleOAuthCallback(c *gin.Context) {
 	fmt.Printf("[%s] 🔐 GET /api/google/callback received\n", time.Now().Format("15:04:05"))
 	
+	if !verifyGoogleState(c) {
+		log.Printf("❌ OAuth state missing or mismatched")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OAuth state"})
+		return
+	}
+
 	code := c.Query("code")
 	if code == "" {
 		log.Printf("❌ Authorization code missing")
@@ -150,28 +281,31 @@ func GoogleAuthWithCredential(c *gin.Context) {
 		return
 	}
 
-	// Verify the Google credential (in production, you should verify the JWT)
-	// For now, we'll parse the JWT to get user info
-	token, _, err := new(jwt.Parser).ParseUnverified(req.Credential, jwt.MapClaims{})
-	if err != nil {
-		log.Printf("❌ Failed to parse Google credential: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Google credential"})
+	if os.Getenv("GOOGLE_CLIENT_ID") == "" {
+		log.Printf("❌ Google credential sign-in attempted without GOOGLE_CLIENT_ID")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Google sign-in not configured"})
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		log.Printf("❌ Invalid Google credential claims")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Google credential"})
+	// Only trust the claims once the signature, audience, issuer and expiry
+	// check out; anyone can mint an unsigned token with any email
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	claims, err := verifyGoogleIDToken(ctx, req.Credential)
+	if err != nil {
+		log.Printf("❌ Google credential rejected: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google credential"})
 		return
 	}
 
 	// Extract user info from claims
 	googleUser := GoogleUserInfo{
-		ID:      getStringClaim(claims, "sub"),
-		Email:   getStringClaim(claims, "email"),
-		Name:    getStringClaim(claims, "name"),
-		Picture: getStringClaim(claims, "picture"),
+		ID:            getStringClaim(claims, "sub"),
+		Email:         getStringClaim(claims, "email"),
+		VerifiedEmail: true,
+		Name:          getStringClaim(claims, "name"),
+		Picture:       getStringClaim(claims, "picture"),
 	}
 
 	if googleUser.Email == "" {
@@ -180,7 +314,7 @@ func GoogleAuthWithCredential(c *gin.Context) {
 		return
 	}
 
-	log.Printf("✅ Google credential parsed: %s (%s)", googleUser.Email, googleUser.Name)
+	log.Printf("✅ Google credential verified: %s (%s)", googleUser.Email, googleUser.Name)
 	handleGoogleUser(c, googleUser, nil)
 }
 
@@ -196,19 +330,26 @@ func getStringClaim(claims jwt.MapClaims, key string) string {
 
 // Handle Google user authentication/registration
 func handleGoogleUser(c *gin.Context, googleUser GoogleUserInfo, token *oauth2.Token) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	usersColl := database.Client.Database("coded").Collection("users")
+	usersColl := database.Users
 
 	// Check if user already exists
 	var user models.User
 	err := usersColl.FindOne(ctx, bson.M{"email": googleUser.Email}).Decode(&user)
+	newAccount := err == mongo.ErrNoDocuments
 
 	if err == mongo.ErrNoDocuments {
 		// New user - create account
 		log.Printf("📝 Creating new user from Google: %s", googleUser.Email)
-		user = createUserFromGoogle(googleUser)
+		username, usernameErr := generateUsernameFromEmail(ctx, usersColl, googleUser.Email)
+		if usernameErr != nil {
+			log.Printf("❌ Failed to generate username: %v", usernameErr)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user account"})
+			return
+		}
+		user = createUserFromGoogle(googleUser, username)
 		
 		// Insert new user
 		_, err = usersColl.InsertOne(ctx, user)
@@ -225,6 +366,9 @@ func handleGoogleUser(c *gin.Context, googleUser GoogleUserInfo, token *oauth2.T
 		log.Printf("❌ Database error checking Google user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
+	} else if user.Disabled {
+		c.JSON(http.StatusForbidden, accountDisabledError)
+		return
 	} else {
 		// Existing user - update last seen and possibly profile picture
 		log.Printf("📝 Existing Google user logging in: %s", googleUser.Email)
@@ -255,42 +399,49 @@ func handleGoogleUser(c *gin.Context, googleUser GoogleUserInfo, token *oauth2.T
 	}
 
 	// Generate JWT token for the user
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &middleware.Claims{
-		UserID: user.ID.Hex(),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key-change-this-in-production"
-	}
-	
-	tokenString, err := jwtToken.SignedString([]byte(jwtSecret))
+	tokenString, expirationTime, err := issueAccessToken(user.ID)
 	if err != nil {
 		log.Printf("❌ Failed to generate JWT token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication token"})
 		return
 	}
 
+	refreshToken, sessionErr := issueRefreshToken(ctx, c, user.ID)
+	if sessionErr != nil {
+		log.Printf("❌ Failed to create session: %v", sessionErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
 	// Check if user has completed onboarding
-	hasCompletedOnboarding := user.Name != "" && user.Name != user.Username && user.Gender != "" && len(user.InterestedIn) > 0
+	hasCompletedOnboarding := user.HasCompletedOnboarding()
 
 	log.Printf("✅ Google authentication successful for: %s", googleUser.Email)
 
+	// The redirect flow (the only one with an OAuth token) hands the session
+	// back to the frontend in the fragment, which never reaches a server
+	if token != nil && googleFrontendRedirect != "" {
+		fragment := url.Values{}
+		fragment.Set("token", tokenString)
+		fragment.Set("refreshToken", refreshToken)
+		fragment.Set("userId", user.ID.Hex())
+		fragment.Set("isNewUser", fmt.Sprint(newAccount))
+		fragment.Set("hasCompletedOnboarding", fmt.Sprint(hasCompletedOnboarding))
+		fragment.Set("expires", fmt.Sprint(expirationTime.Unix()))
+		c.Redirect(http.StatusFound, googleFrontendRedirect+"#"+fragment.Encode())
+		return
+	}
+
 	// Return response
 	c.JSON(http.StatusOK, gin.H{
 		"token":                 tokenString,
+		"refreshToken":          refreshToken,
 		"userId":                user.ID.Hex(),
 		"email":                 user.Email,
 		"username":              user.Username,
 		"avatar":                user.Avatar,
 		"name":                  user.Name,
-		"isNewUser":             err == mongo.ErrNoDocuments,
+		"isNewUser":             newAccount,
 		"hasCompletedOnboarding": hasCompletedOnboarding,
 		"message":               "Authentication successful",
 		"expires":               expirationTime.Unix(),
@@ -298,9 +449,7 @@ func handleGoogleUser(c *gin.Context, googleUser GoogleUserInfo, token *oauth2.T
 }
 
 // Create user from Google info
-func createUserFromGoogle(googleUser GoogleUserInfo) models.User {
-	username := generateUsernameFromEmail(googleUser.Email)
-	
+func createUserFromGoogle(googleUser GoogleUserInfo, username string) models.User {
 	// Use Google picture if available, otherwise use default
 	avatar := googleUser.Picture
 	if avatar == "" {
@@ -318,6 +467,16 @@ func createUserFromGoogle(googleUser GoogleUserInfo) models.User {
 		}
 	}
 
+	// Same rules as UpdateMyProfile, but truncate rather than reject since
+	// the user didn't type it
+	name = strings.TrimSpace(stripControlChars(name, false))
+	if maxLen := config.Int("MAX_NAME_LENGTH", defaultMaxNameLength); len([]rune(name)) > maxLen {
+		name = string([]rune(name)[:maxLen])
+	}
+	if name == "" {
+		name = username
+	}
+
 	return models.User{
 		ID:            primitive.NewObjectID(),
 		Email:         googleUser.Email,
@@ -332,8 +491,10 @@ func createUserFromGoogle(googleUser GoogleUserInfo) models.User {
 		Bio:           "",
 		Gender:        "",
 		InterestedIn:  []string{},
+		Interests:     []string{},
 		Photos:        []string{},
 		Status:        "offline",
+		EmailVerified: googleUser.VerifiedEmail,
 		BirthDate:     0,
 		ReferralCode:  "",
 		Latitude:      nil,
@@ -348,9 +509,16 @@ func GetGoogleAuthURL(c *gin.Context) {
 		return
 	}
 
-	// Generate state token for security
-	state := primitive.NewObjectID().Hex()
-	
+	// Generate state token for security; the callback checks it against the
+	// cookie
+	state, err := generateToken()
+	if err != nil {
+		log.Printf("❌ Failed to generate OAuth state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start Google sign-in"})
+		return
+	}
+	setGoogleStateCookie(c, state, int(googleStateCookieTTL.Seconds()))
+
 	url := googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
 	c.JSON(http.StatusOK, gin.H{"url": url})
 }
\ No newline at end of file
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// configureTestGoogleOAuth runs ConfigureGoogleOAuth with test credentials
+// and the given callback URL, restoring the previous setup afterwards
+func configureTestGoogleOAuth(t *testing.T, redirectURL string) {
+	t.Helper()
+	oldConfig, oldPath, oldFrontend := googleOAuthConfig, googleCallbackPath, googleFrontendRedirect
+	t.Cleanup(func() {
+		googleOAuthConfig, googleCallbackPath, googleFrontendRedirect = oldConfig, oldPath, oldFrontend
+	})
+
+	t.Setenv("GOOGLE_CLIENT_ID", testGoogleClientID)
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-secret")
+	t.Setenv("GOOGLE_REDIRECT_URL", redirectURL)
+	if err := ConfigureGoogleOAuth(); err != nil {
+		t.Fatalf("ConfigureGoogleOAuth: %v", err)
+	}
+}
+
+// startGoogleSignIn calls GetGoogleAuthURL and returns the auth URL and the
+// state cookie it set
+func startGoogleSignIn(t *testing.T, router *gin.Engine) (*url.URL, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/google/auth-url", nil))
+	expectStatus(t, w, http.StatusOK)
+
+	authURL, err := url.Parse(decodeBody(t, w)["url"].(string))
+	if err != nil {
+		t.Fatalf("parsing auth URL: %v", err)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == googleStateCookie {
+			return authURL, cookie
+		}
+	}
+	t.Fatal("no state cookie set")
+	return nil, nil
+}
+
+func googleRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/api/google/auth-url", GetGoogleAuthURL)
+	router.GET("/api/google/callback", GoogleOAuthCallback)
+	return router
+}
+
+// callback hits the OAuth callback with state and, if set, the cookie.
+// There's no code, so a request that gets past the state check fails on
+// that instead.
+func callback(router *gin.Engine, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/google/callback?state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGoogleStateCookie(t *testing.T) {
+	configureTestGoogleOAuth(t, "https://api.coded.example/api/google/callback")
+	authURL, cookie := startGoogleSignIn(t, googleRouter())
+
+	if state := authURL.Query().Get("state"); state == "" || state != cookie.Value {
+		t.Errorf("auth URL state %q doesn't match the cookie %q", state, cookie.Value)
+	}
+	if !cookie.HttpOnly || cookie.Path != "/api/google/callback" || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("state cookie = %+v, want HttpOnly, Lax, scoped to the callback", cookie)
+	}
+}
+
+func TestGoogleOAuthCallbackChecksState(t *testing.T) {
+	configureTestGoogleOAuth(t, "https://api.coded.example/api/google/callback")
+	router := googleRouter()
+	authURL, cookie := startGoogleSignIn(t, router)
+	state := authURL.Query().Get("state")
+
+	rejected := func(name string, w *httptest.ResponseRecorder) {
+		t.Helper()
+		if w.Code != http.StatusBadRequest || decodeBody(t, w)["error"] != "Invalid OAuth state" {
+			t.Errorf("%s: got %d %s, want the state rejected", name, w.Code, w.Body.String())
+		}
+	}
+	rejected("forged state", callback(router, "forged", cookie))
+	rejected("missing state", callback(router, "", cookie))
+	rejected("no cookie", callback(router, state, nil))
+
+	w := callback(router, state, cookie)
+	if body := decodeBody(t, w); body["error"] != "Authorization code missing" {
+		t.Errorf("matching state: got %d %v, want it past the state check", w.Code, body)
+	}
+
+	// The callback expires the cookie so the state can't be replayed
+	expired := false
+	for _, c := range w.Result().Cookies() {
+		if c.Name == googleStateCookie && c.MaxAge < 0 {
+			expired = true
+		}
+	}
+	if !expired {
+		t.Error("callback left the state cookie in place")
+	}
+}
+
+func TestGoogleAuthURLUsesConfiguredRedirect(t *testing.T) {
+	const redirect = "https://api.coded.example/auth/google/done"
+	configureTestGoogleOAuth(t, redirect)
+	authURL, cookie := startGoogleSignIn(t, googleRouter())
+
+	if got := authURL.Query().Get("redirect_uri"); got != redirect {
+		t.Errorf("redirect_uri = %q, want %q", got, redirect)
+	}
+	if cookie.Path != "/auth/google/done" {
+		t.Errorf("state cookie path = %q, want the configured callback path", cookie.Path)
+	}
+}
+
+func TestConfigureGoogleOAuthValidatesURLs(t *testing.T) {
+	for name, env := range map[string]map[string]string{
+		"relative redirect":     {"GOOGLE_REDIRECT_URL": "/api/google/callback"},
+		"non-http redirect":     {"GOOGLE_REDIRECT_URL": "ftp://coded.example/callback"},
+		"hostless redirect":     {"GOOGLE_REDIRECT_URL": "https:///callback"},
+		"bad frontend redirect": {"GOOGLE_FRONTEND_REDIRECT_URL": "coded.example/signed-in"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			configureTestGoogleOAuth(t, "https://api.coded.example/api/google/callback")
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			if err := ConfigureGoogleOAuth(); err == nil {
+				t.Error("invalid URL accepted")
+			}
+		})
+	}
+
+	configureTestGoogleOAuth(t, "https://api.coded.example/api/google/callback")
+	t.Setenv("GOOGLE_FRONTEND_REDIRECT_URL", "https://coded.example/signed-in")
+	if err := ConfigureGoogleOAuth(); err != nil {
+		t.Fatalf("ConfigureGoogleOAuth: %v", err)
+	}
+	if googleFrontendRedirect != "https://coded.example/signed-in" {
+		t.Errorf("frontend redirect = %q", googleFrontendRedirect)
+	}
+}
+
+func TestUsernameBase(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"John.Doe+news@gmail.com", "johndoe"},
+		{"__a--b__@example.com", "a_b"},
+		{"a_-_b@example.com", "a_b"},
+		{"élan.vital@example.com", "lanvital"},
+		{"日本@example.com", "user"},
+		{"@example.com", "user"},
+		{"abcdefghijklmnopqrstuvwxyz@example.com", "abcdefghijklmnopqrst"},
+		{"abcdefghijklmnopqrs_tuv@example.com", "abcdefghijklmnopqrs"},
+	}
+	for _, tt := range tests {
+		if got := usernameBase(tt.email); got != tt.want {
+			t.Errorf("usernameBase(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateUsernameFromEmailAvoidsTakenNames(t *testing.T) {
+	ctx := requireDB(t)
+	stem := "u" + primitive.NewObjectID().Hex()[12:]
+
+	free, err := generateUsernameFromEmail(ctx, database.Users, stem+"@example.com")
+	if err != nil {
+		t.Fatalf("generating username: %v", err)
+	}
+	if free != stem {
+		t.Errorf("free stem generated %q, want %q", free, stem)
+	}
+
+	insertTestUser(t, ctx, bson.M{"username": stem})
+	taken, err := generateUsernameFromEmail(ctx, database.Users, stem+"@example.com")
+	if err != nil {
+		t.Fatalf("generating username: %v", err)
+	}
+	if taken == stem || !strings.HasPrefix(taken, stem+"_") {
+		t.Errorf("taken stem generated %q, want %q with a suffix", taken, stem)
+	}
+	if n, err := database.Users.CountDocuments(ctx, bson.M{"username": taken}); err != nil || n != 0 {
+		t.Errorf("generated username %q is already used by %d users (err %v)", taken, n, err)
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testGoogleClientID = "test-client.apps.googleusercontent.com"
+
+// stubGoogleCerts serves key as Google's JWKS under kid and points the
+// verifier at it for the rest of the test
+func stubGoogleCerts(t *testing.T, kid string, key *rsa.PublicKey) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": kid,
+				"kty": "RSA",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	oldURL, oldKeys := googleCertsURL, googleKeys
+	googleCertsURL, googleKeys = server.URL, &googleKeyCache{}
+	t.Cleanup(func() { googleCertsURL, googleKeys = oldURL, oldKeys })
+	t.Setenv("GOOGLE_CLIENT_ID", testGoogleClientID)
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	return key
+}
+
+// googleClaims are valid ID token claims, which tests then break
+func googleClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            testGoogleClientID,
+		"sub":            "1234567890",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+}
+
+func signGoogleToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyGoogleIDTokenAcceptsValidToken(t *testing.T) {
+	key := newRSAKey(t)
+	stubGoogleCerts(t, "kid-1", &key.PublicKey)
+
+	claims, err := verifyGoogleIDToken(context.Background(), signGoogleToken(t, key, "kid-1", googleClaims()))
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claims["email"] != "ada@example.com" || claims["sub"] != "1234567890" {
+		t.Errorf("claims = %v", claims)
+	}
+}
+
+func TestVerifyGoogleIDTokenRejectsBadTokens(t *testing.T) {
+	key := newRSAKey(t)
+	stubGoogleCerts(t, "kid-1", &key.PublicKey)
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := googleClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	hs256, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, googleClaims()).SignedString([]byte("secret"))
+
+	tests := map[string]string{
+		"forged signature":   signGoogleToken(t, newRSAKey(t), "kid-1", googleClaims()),
+		"unknown key id":     signGoogleToken(t, key, "kid-2", googleClaims()),
+		"other audience":     signGoogleToken(t, key, "kid-1", with("aud", "someone-else")),
+		"other issuer":       signGoogleToken(t, key, "kid-1", with("iss", "https://evil.example.com")),
+		"expired":            signGoogleToken(t, key, "kid-1", with("exp", time.Now().Add(-time.Minute).Unix())),
+		"no expiry":          signGoogleToken(t, key, "kid-1", with("exp", nil)),
+		"unverified email":   signGoogleToken(t, key, "kid-1", with("email_verified", false)),
+		"HMAC signed":        hs256,
+		"not a token at all": "credential",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := verifyGoogleIDToken(context.Background(), token); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"public, max-age=19735, must-revalidate": 19735 * time.Second,
+		"no-cache":                               defaultGoogleCertsTTL,
+		"max-age=nope":                           defaultGoogleCertsTTL,
+		"":                                       defaultGoogleCertsTTL,
+	}
+	for header, want := range tests {
+		if got := cacheMaxAge(header); got != want {
+			t.Errorf("cacheMaxAge(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+// unsignedGoogleToken is a credential anyone could mint, with claims but no
+// signature
+func unsignedGoogleToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("building token: %v", err)
+	}
+	return token
+}
+
+func TestCheckGoogleAudience(t *testing.T) {
+	withAud := func(aud interface{}) string {
+		claims := googleClaims()
+		if aud == nil {
+			delete(claims, "aud")
+		} else {
+			claims["aud"] = aud
+		}
+		return unsignedGoogleToken(t, claims)
+	}
+
+	accepted := map[string]string{
+		"our client id":      withAud(testGoogleClientID),
+		"among several auds": withAud([]string{"someone-else", testGoogleClientID}),
+	}
+	for name, credential := range accepted {
+		if err := checkGoogleAudience(credential, testGoogleClientID); err != nil {
+			t.Errorf("%s: rejected: %v", name, err)
+		}
+	}
+
+	rejected := map[string]string{
+		"other client id":   withAud("someone-else.apps.googleusercontent.com"),
+		"no aud":            withAud(nil),
+		"aud not a string":  withAud(42),
+		"malformed":         "not.a.token",
+		"empty credential":  "",
+		"client id as part": withAud("prefix-" + testGoogleClientID),
+	}
+	for name, credential := range rejected {
+		if err := checkGoogleAudience(credential, testGoogleClientID); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestVerifyGoogleIDTokenChecksAudienceBeforeFetchingKeys(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		http.Error(w, "unexpected", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	oldURL, oldKeys := googleCertsURL, googleKeys
+	googleCertsURL, googleKeys = server.URL, &googleKeyCache{}
+	t.Cleanup(func() { googleCertsURL, googleKeys = oldURL, oldKeys })
+	t.Setenv("GOOGLE_CLIENT_ID", testGoogleClientID)
+
+	claims := googleClaims()
+	claims["aud"] = "someone-else"
+	if _, err := verifyGoogleIDToken(context.Background(), signGoogleToken(t, newRSAKey(t), "kid-1", claims)); err == nil {
+		t.Fatal("token for another audience accepted")
+	}
+	if fetches != 0 {
+		t.Errorf("fetched Google's keys %d times for a token for another audience", fetches)
+	}
+}
+
+func TestGoogleAuthWithCredentialRejectsOtherAudience(t *testing.T) {
+	key := newRSAKey(t)
+	stubGoogleCerts(t, "kid-1", &key.PublicKey)
+
+	claims := googleClaims()
+	claims["aud"] = "someone-else"
+	w := testRequest(t, GoogleAuthWithCredential, http.MethodPost, "/api/google-auth",
+		map[string]string{"credential": signGoogleToken(t, key, "kid-1", claims)}, "", nil)
+	expectStatus(t, w, http.StatusUnauthorized)
+}
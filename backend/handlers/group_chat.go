@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/models"
+	"coded/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Group chat limits; override with MAX_GROUP_SIZE and MAX_GROUP_NAME_LENGTH
+const (
+	defaultMaxGroupSize       = 50
+	defaultMaxGroupNameLength = 50
+)
+
+// createGroupChat handles CreateChat for more than two participants. Groups
+// need a name, aren't deduplicated like direct chats, and start with the
+// creator as the only admin.
+func createGroupChat(c *gin.Context, ctx context.Context, chatsColl *mongo.Collection, userID primitive.ObjectID, participantIDs []primitive.ObjectID, rawName string) {
+	name, err := cleanProfileText("name", rawName, config.Int("MAX_GROUP_NAME_LENGTH", defaultMaxGroupNameLength), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group chats need a name"})
+		return
+	}
+
+	maxSize := config.Int("MAX_GROUP_SIZE", defaultMaxGroupSize)
+	if len(participantIDs) > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many participants", "limit": maxSize})
+		return
+	}
+
+	if !checkChatLimits(c, ctx, chatsColl, userID) {
+		return
+	}
+
+	now := time.Now().Unix()
+	chat := models.Chat{
+		ID:            primitive.NewObjectID(),
+		Type:          models.ChatTypeGroup,
+		Name:          name,
+		CreatedBy:     userID,
+		Participants:  participantIDs,
+		Admins:        []primitive.ObjectID{userID},
+		LastMessageAt: now,
+		CreatedAt:     now,
+	}
+	if _, err := chatsColl.InsertOne(ctx, chat); err != nil {
+		log.Printf("createGroupChat insert error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat"})
+		return
+	}
+
+	users, err := loadPublicProfiles(ctx, participantIDs)
+	if err != nil {
+		log.Printf("createGroupChat profile lookup error: %v", err)
+	}
+	chatData := map[string]interface{}{
+		"id":            chat.ID.Hex(),
+		"type":          chat.Type,
+		"name":          chat.Name,
+		"lastMessageAt": chat.LastMessageAt,
+		"participants":  memberProfiles(participantIDs, users),
+		"admins":        hexIDs(chat.Admins),
+	}
+
+	if wsManager != nil {
+		wsManager.SubscribeUsers(chat.ID.Hex(), hexIDs(participantIDs))
+		wsManager.BroadcastChatCreated(chatData)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":   chat.ID.Hex(),
+		"chat": chatData,
+	})
+}
+
+// loadGroupChatAsAdmin fetches a group chat for a membership change, writing
+// 404 if the caller isn't in it, 400 for direct chats and 403 for non-admins
+func loadGroupChatAsAdmin(c *gin.Context, ctx context.Context, chatID, userID primitive.ObjectID) (*models.Chat, bool) {
+	chatsColl := database.Chats
+
+	var chat models.Chat
+	err := chatsColl.FindOne(ctx, bson.M{"_id": chatID, "participants": userID}).Decode(&chat)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found or access denied"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chat"})
+		return nil, false
+	}
+	if !chat.IsGroup() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only group chats can change members"})
+		return nil, false
+	}
+	if !chat.IsAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only group admins can change members"})
+		return nil, false
+	}
+	return &chat, true
+}
+
+// AddChatParticipants adds users to a group chat (admins only)
+func AddChatParticipants(c *gin.Context) {
+	chatID, err := parseObjectID(c, c.Param("id"), "chat ID")
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Participants []string `json:"participants" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	chat, ok := loadGroupChatAsAdmin(c, ctx, chatID, userID)
+	if !ok {
+		return
+	}
+
+	existing := make(map[primitive.ObjectID]bool, len(chat.Participants))
+	for _, id := range chat.Participants {
+		existing[id] = true
+	}
+	var added []primitive.ObjectID
+	for _, p := range req.Participants {
+		pID, err := parseObjectID(c, p, "participant ID")
+		if err != nil {
+			return
+		}
+		if !existing[pID] {
+			existing[pID] = true
+			added = append(added, pID)
+		}
+	}
+	if len(added) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "No new participants", "added": []string{}})
+		return
+	}
+
+	maxSize := config.Int("MAX_GROUP_SIZE", defaultMaxGroupSize)
+	if len(chat.Participants)+len(added) > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many participants", "limit": maxSize})
+		return
+	}
+
+	if !rejectUnknownUsers(c, ctx, added) {
+		return
+	}
+	if !rejectIfBlocked(c, ctx, userID, added) {
+		return
+	}
+
+	chatsColl := database.Chats
+	_, err = chatsColl.UpdateOne(ctx,
+		bson.M{"_id": chatID},
+		bson.M{"$addToSet": bson.M{"participants": bson.M{"$each": added}}},
+	)
+	if err != nil {
+		log.Printf("AddChatParticipants update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add participants"})
+		return
+	}
+
+	if wsManager != nil {
+		members := append(append([]primitive.ObjectID{}, chat.Participants...), added...)
+		users, err := loadPublicProfiles(ctx, members)
+		if err != nil {
+			log.Printf("AddChatParticipants profile lookup error: %v", err)
+		}
+
+		// New members learn about the chat itself; everyone sees the change
+		wsManager.SubscribeUsers(chatID.Hex(), hexIDs(added))
+		chatData := map[string]interface{}{
+			"id":            chatID.Hex(),
+			"type":          chat.Type,
+			"name":          chat.Name,
+			"lastMessageAt": chat.LastMessageAt,
+			"participants":  memberProfiles(members, users),
+			"admins":        hexIDs(chat.Admins),
+		}
+		for _, id := range added {
+			wsManager.BroadcastToUser(id.Hex(), websocket.Event{Type: "chat_created", Payload: chatData})
+		}
+		wsManager.BroadcastChatMembersChanged(map[string]interface{}{
+			"chatId":    chatID.Hex(),
+			"added":     hexIDs(added),
+			"removed":   []string{},
+			"by":        userID.Hex(),
+			"timestamp": time.Now().Unix(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Participants added",
+		"added":   hexIDs(added),
+	})
+}
+
+// RemoveChatParticipant removes a member from a group chat (admins only).
+// Admins leave through the leave endpoint rather than removing themselves.
+func RemoveChatParticipant(c *gin.Context) {
+	chatID, err := parseObjectID(c, c.Param("id"), "chat ID")
+	if err != nil {
+		return
+	}
+	targetID, err := parseObjectID(c, c.Param("userId"), "user ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+	if targetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave the chat instead of removing yourself"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if _, ok := loadGroupChatAsAdmin(c, ctx, chatID, userID); !ok {
+		return
+	}
+
+	chatsColl := database.Chats
+	result, err := chatsColl.UpdateOne(ctx,
+		bson.M{"_id": chatID, "participants": targetID},
+		bson.M{"$pull": bson.M{"participants": targetID, "admins": targetID}},
+	)
+	if err != nil {
+		log.Printf("RemoveChatParticipant update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove participant"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not in this chat"})
+		return
+	}
+
+	settingsColl := database.ChatSettings
+	if _, err := settingsColl.DeleteOne(ctx, bson.M{"chatId": chatID, "userId": targetID}); err != nil {
+		log.Printf("RemoveChatParticipant settings cleanup error: %v", err)
+	}
+
+	if wsManager != nil {
+		payload := map[string]interface{}{
+			"chatId":    chatID.Hex(),
+			"added":     []string{},
+			"removed":   []string{targetID.Hex()},
+			"by":        userID.Hex(),
+			"timestamp": time.Now().Unix(),
+		}
+		wsManager.UnsubscribeUsers(chatID.Hex(), []string{targetID.Hex()})
+		wsManager.BroadcastToUser(targetID.Hex(), websocket.Event{Type: "chat_members_changed", Payload: payload})
+		wsManager.BroadcastChatMembersChanged(payload)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Participant removed"})
+}
+
+// LeaveChat removes the caller from a chat. The chat (and its messages) is
+// deleted once nobody is left. A direct chat stays alive for the other
+// person with them as the only participant, so they keep the history; its
+// dedup key is dropped so the two users can start a fresh chat later. If a
+// group loses its last admin, the longest-standing member is promoted.
+func LeaveChat(c *gin.Context) {
+	chatID, err := parseObjectID(c, c.Param("id"), "chat ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	chatsColl := database.Chats
+
+	var chat models.Chat
+	err = chatsColl.FindOneAndUpdate(ctx,
+		bson.M{"_id": chatID, "participants": userID},
+		bson.M{
+			"$pull":  bson.M{"participants": userID, "admins": userID},
+			"$unset": bson.M{"participantsKey": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&chat)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found or access denied"})
+		return
+	}
+	if err != nil {
+		log.Printf("LeaveChat update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave chat"})
+		return
+	}
+
+	settingsColl := database.ChatSettings
+	if _, err := settingsColl.DeleteOne(ctx, bson.M{"chatId": chatID, "userId": userID}); err != nil {
+		log.Printf("LeaveChat settings cleanup error: %v", err)
+	}
+
+	deleted := len(chat.Participants) == 0
+	if deleted {
+		if _, err := chatsColl.DeleteOne(ctx, bson.M{"_id": chatID}); err != nil {
+			log.Printf("LeaveChat delete error: %v", err)
+		}
+		messagesColl := database.Messages
+		if _, err := messagesColl.DeleteMany(ctx, bson.M{"chatId": chatID}); err != nil {
+			log.Printf("LeaveChat message cleanup error: %v", err)
+		}
+	} else if chat.IsGroup() && len(chat.Admins) == 0 {
+		_, err := chatsColl.UpdateOne(ctx,
+			bson.M{"_id": chatID},
+			bson.M{"$addToSet": bson.M{"admins": chat.Participants[0]}},
+		)
+		if err != nil {
+			log.Printf("LeaveChat admin promotion error: %v", err)
+		}
+	}
+
+	if wsManager != nil {
+		payload := map[string]interface{}{
+			"chatId":    chatID.Hex(),
+			"userId":    userID.Hex(),
+			"deleted":   deleted,
+			"timestamp": time.Now().Unix(),
+		}
+		// The leaver's other devices are told directly since they stop
+		// receiving the chat's events
+		wsManager.UnsubscribeUsers(chatID.Hex(), []string{userID.Hex()})
+		wsManager.BroadcastToUser(userID.Hex(), websocket.Event{Type: "chat_left", Payload: payload})
+		if !deleted {
+			wsManager.BroadcastChatLeft(payload)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Left chat",
+		"deleted": deleted,
+	})
+}
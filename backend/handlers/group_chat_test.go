@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func insertBlock(t *testing.T, ctx context.Context, userID, targetID primitive.ObjectID) {
+	t.Helper()
+	block := models.Block{UserID: userID, TargetUserID: targetID, CreatedAt: time.Now().Unix()}
+	if _, err := database.Blocks.InsertOne(ctx, block); err != nil {
+		t.Fatalf("inserting block: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Blocks.DeleteMany(context.Background(), bson.M{"userId": userID, "targetUserId": targetID})
+	})
+}
+
+func postChat(t *testing.T, userID primitive.ObjectID, name string, participants ...primitive.ObjectID) *httptest.ResponseRecorder {
+	t.Helper()
+	w := testRequest(t, CreateChat, http.MethodPost, "/api/chats", gin.H{"participants": hexIDs(participants), "name": name}, userID.Hex(), nil)
+	if w.Code == http.StatusCreated || w.Code == http.StatusOK {
+		id, _ := decodeBody(t, w)["id"].(string)
+		t.Cleanup(func() {
+			chatID, _ := primitive.ObjectIDFromHex(id)
+			database.Chats.DeleteOne(context.Background(), bson.M{"_id": chatID})
+		})
+	}
+	return w
+}
+
+func TestCreateGroupChatRejectsUnknownParticipants(t *testing.T) {
+	ctx := requireDB(t)
+	owner, friend := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+
+	w := postChat(t, owner, "ghosts", friend, primitive.NewObjectID())
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestCreateGroupChatRejectsBlockedParticipants(t *testing.T) {
+	ctx := requireDB(t)
+	owner, friend, blocker := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	insertBlock(t, ctx, blocker, owner)
+
+	w := postChat(t, owner, "frenemies", friend, blocker)
+	expectStatus(t, w, http.StatusForbidden)
+}
+
+func TestAddChatParticipantsValidatesNewMembers(t *testing.T) {
+	ctx := requireDB(t)
+	owner, a, b := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	blocked, fine := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	insertBlock(t, ctx, owner, blocked)
+
+	w := postChat(t, owner, "crew", a, b)
+	expectStatus(t, w, http.StatusCreated)
+	chatID, _ := decodeBody(t, w)["id"].(string)
+	params := gin.Params{{Key: "id", Value: chatID}}
+
+	add := func(ids ...primitive.ObjectID) *httptest.ResponseRecorder {
+		return testRequest(t, AddChatParticipants, http.MethodPost, "/api/chats/"+chatID+"/participants", gin.H{"participants": hexIDs(ids)}, owner.Hex(), params)
+	}
+	expectStatus(t, add(primitive.NewObjectID()), http.StatusNotFound)
+	expectStatus(t, add(blocked), http.StatusForbidden)
+	expectStatus(t, add(fine), http.StatusOK)
+
+	var chat models.Chat
+	oid, _ := primitive.ObjectIDFromHex(chatID)
+	if err := database.Chats.FindOne(ctx, bson.M{"_id": oid}).Decode(&chat); err != nil {
+		t.Fatalf("loading chat: %v", err)
+	}
+	if len(chat.Participants) != 4 || chat.Participants[3] != fine {
+		t.Errorf("participants = %v, want owner, a, b and %s", chat.Participants, fine.Hex())
+	}
+}
+
+func leaveChat(t *testing.T, userID, chatID primitive.ObjectID) *httptest.ResponseRecorder {
+	t.Helper()
+	params := gin.Params{{Key: "id", Value: chatID.Hex()}}
+	return testRequest(t, LeaveChat, http.MethodDelete, "/api/chats/"+chatID.Hex()+"/leave", nil, userID.Hex(), params)
+}
+
+func loadChat(t *testing.T, ctx context.Context, chatID primitive.ObjectID) models.Chat {
+	t.Helper()
+	var chat models.Chat
+	if err := database.Chats.FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat); err != nil {
+		t.Fatalf("loading chat: %v", err)
+	}
+	return chat
+}
+
+func TestLeaveGroupChatPromotesAnAdmin(t *testing.T) {
+	ctx := requireDB(t)
+	owner, a, b := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	w := postChat(t, owner, "crew", a, b)
+	expectStatus(t, w, http.StatusCreated)
+	chatID, _ := primitive.ObjectIDFromHex(decodeBody(t, w)["id"].(string))
+
+	expectStatus(t, leaveChat(t, owner, chatID), http.StatusOK)
+	chat := loadChat(t, ctx, chatID)
+	if len(chat.Participants) != 2 || !chat.IsAdmin(a) || len(chat.Admins) != 1 {
+		t.Errorf("after the only admin left: participants %v, admins %v; want %s promoted", chat.Participants, chat.Admins, a.Hex())
+	}
+
+	// A member leaving doesn't touch the admins
+	expectStatus(t, leaveChat(t, b, chatID), http.StatusOK)
+	chat = loadChat(t, ctx, chatID)
+	if len(chat.Participants) != 1 || len(chat.Admins) != 1 || !chat.IsAdmin(a) {
+		t.Errorf("after a member left: participants %v, admins %v", chat.Participants, chat.Admins)
+	}
+
+	expectStatus(t, leaveChat(t, b, chatID), http.StatusNotFound)
+}
+
+func TestLeaveDirectChatFreesAndDeletesIt(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	if _, err := database.Chats.UpdateOne(ctx, bson.M{"_id": chatID}, bson.M{"$set": bson.M{"participantsKey": participantsKey([]primitive.ObjectID{alice, bob})}}); err != nil {
+		t.Fatalf("setting participantsKey: %v", err)
+	}
+	insertUnread(t, ctx, chatID, bob, 2)
+
+	w := leaveChat(t, alice, chatID)
+	expectStatus(t, w, http.StatusOK)
+	if deleted, _ := decodeBody(t, w)["deleted"].(bool); deleted {
+		t.Error("chat reported deleted while bob is still in it")
+	}
+	// The pair can start a fresh chat without colliding with this one
+	if chat := loadChat(t, ctx, chatID); chat.ParticipantsKey != "" || len(chat.Participants) != 1 {
+		t.Errorf("after leaving: participantsKey %q, participants %v; want the key unset", chat.ParticipantsKey, chat.Participants)
+	}
+
+	w = leaveChat(t, bob, chatID)
+	expectStatus(t, w, http.StatusOK)
+	if deleted, _ := decodeBody(t, w)["deleted"].(bool); !deleted {
+		t.Error("last participant leaving didn't report the chat deleted")
+	}
+	if n, _ := database.Chats.CountDocuments(ctx, bson.M{"_id": chatID}); n != 0 {
+		t.Error("empty chat was not deleted")
+	}
+	if n, _ := database.Messages.CountDocuments(ctx, bson.M{"chatId": chatID}); n != 0 {
+		t.Errorf("empty chat left %d messages behind", n)
+	}
+}
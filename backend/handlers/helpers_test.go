@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testRequest runs handler on a request with the given JSON body, as the
+// authenticated user userID (empty for none). params fills route params
+// such as "id".
+func testRequest(t *testing.T, handler gin.HandlerFunc, method, target string, body interface{}, userID string, params gin.Params) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encoding body: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, &buf)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	if userID != "" {
+		c.Set("userId", userID)
+	}
+	handler(c)
+	return w
+}
+
+// decodeBody unmarshals a JSON response body
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// expectStatus fails the test if the response status isn't want
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status = %d, want %d (body %s)", w.Code, want, w.Body.String())
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+
+	"coded/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaxImageDimension caps the width and height (in pixels) of uploaded
+// source images when MAX_IMAGE_DIMENSION is unset
+const defaultMaxImageDimension = 8000
+
+// checkImageDimensions reads just the image header and rejects the upload
+// with 400 if either side is over MAX_IMAGE_DIMENSION, before any bytes go to
+// Cloudinary. Formats the standard library can't read (HEIC, WebP, ...) are
+// let through for Cloudinary's own limits. The file is rewound afterwards.
+func checkImageDimensions(c *gin.Context, file multipart.File) bool {
+	cfg, format, err := image.DecodeConfig(file)
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		log.Printf("Failed to rewind upload: %v", seekErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return false
+	}
+	if err != nil {
+		return true
+	}
+
+	maxDimension := config.Int("MAX_IMAGE_DIMENSION", defaultMaxImageDimension)
+	if cfg.Width > maxDimension || cfg.Height > maxDimension {
+		log.Printf("Rejected %s upload of %dx%d (max %d)", format, cfg.Width, cfg.Height, maxDimension)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":        "Image dimensions too large",
+			"code":         "IMAGE_TOO_LARGE",
+			"maxDimension": maxDimension,
+			"width":        cfg.Width,
+			"height":       cfg.Height,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func pngOf(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encoding png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckImageDimensions(t *testing.T) {
+	t.Setenv("MAX_IMAGE_DIMENSION", "200")
+
+	tests := []struct {
+		name   string
+		upload []byte
+		ok     bool
+	}{
+		{"under the limit", pngOf(t, 120, 80), true},
+		{"exactly the limit", pngOf(t, 200, 200), true},
+		{"too wide", pngOf(t, 201, 10), false},
+		{"too tall", pngOf(t, 10, 201), false},
+		{"unreadable format", []byte("not an image the standard library knows"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			file := memFile{bytes.NewReader(tt.upload)}
+
+			if got := checkImageDimensions(c, file); got != tt.ok {
+				t.Fatalf("checkImageDimensions = %v, want %v", got, tt.ok)
+			}
+			if !tt.ok {
+				expectStatus(t, w, http.StatusBadRequest)
+				body := decodeBody(t, w)
+				if body["code"] != "IMAGE_TOO_LARGE" || body["maxDimension"] != float64(200) {
+					t.Errorf("body = %v, want IMAGE_TOO_LARGE with maxDimension 200", body)
+				}
+				return
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("accepted upload wrote a response: %s", w.Body.String())
+			}
+			if rest, _ := io.ReadAll(file); !bytes.Equal(rest, tt.upload) {
+				t.Error("file was not rewound after reading the header")
+			}
+		})
+	}
+}
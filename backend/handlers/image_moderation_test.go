@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"coded/moderation"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeClassifier is an ImageModerator with a fixed verdict that records
+// what it was shown
+type fakeClassifier struct {
+	allow  bool
+	reason string
+	seen   []byte
+}
+
+func (f *fakeClassifier) CheckImage(ctx context.Context, image io.Reader) (bool, string, error) {
+	seen, err := io.ReadAll(image)
+	f.seen = seen
+	return f.allow, f.reason, err
+}
+
+func useImageModerator(t *testing.T, m moderation.ImageModerator) {
+	t.Helper()
+	SetImageModerator(m)
+	t.Cleanup(func() { SetImageModerator(nil) })
+}
+
+// memFile is an in-memory multipart.File
+type memFile struct{ *bytes.Reader }
+
+func (memFile) Close() error { return nil }
+
+func TestModerateImageAllowsAndRewinds(t *testing.T) {
+	fake := &fakeClassifier{allow: true}
+	useImageModerator(t, fake)
+
+	upload := []byte("not really a jpeg")
+	file := memFile{bytes.NewReader(upload)}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	if !moderateImage(c, context.Background(), file) {
+		t.Fatalf("image rejected: %d %s", w.Code, w.Body.String())
+	}
+	if !bytes.Equal(fake.seen, upload) {
+		t.Errorf("classifier saw %q, want the upload", fake.seen)
+	}
+	if rest, _ := io.ReadAll(file); !bytes.Equal(rest, upload) {
+		t.Errorf("file not rewound after moderation, read %q", rest)
+	}
+	if c.Writer.Written() {
+		t.Errorf("allowed image wrote a response: %s", w.Body.String())
+	}
+}
+
+func TestUploadPhotoRejectedByClassifier(t *testing.T) {
+	useImageModerator(t, &fakeClassifier{allow: false, reason: "Nudity detected"})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("photo", "photo.jpg")
+	part.Write([]byte("not really a jpeg"))
+	form.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/upload-photo", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	c.Set("userId", primitive.NewObjectID().Hex())
+	UploadPhoto(c)
+
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	resp := decodeBody(t, w)
+	if resp["code"] != "IMAGE_REJECTED" || resp["message"] != "Nudity detected" {
+		t.Errorf("response = %v, want IMAGE_REJECTED with the classifier's reason", resp)
+	}
+}
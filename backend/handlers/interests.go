@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxInterests caps how many interest tags a profile can carry
+const maxInterests = 10
+
+// curatedInterests is the list of interest tags users can pick from
+var curatedInterests = []string{
+	"Art", "Board Games", "Books", "Camping", "Coffee", "Cooking", "Cycling",
+	"Dancing", "Fashion", "Fitness", "Football", "Gaming", "Gardening",
+	"Hiking", "Movies", "Music", "Nightlife", "Photography", "Pets",
+	"Running", "Swimming", "Tech", "Travel", "Volunteering", "Wine", "Yoga",
+}
+
+// curatedInterestIndex maps lowercased tags to their canonical spelling
+var curatedInterestIndex = func() map[string]string {
+	index := make(map[string]string, len(curatedInterests))
+	for _, interest := range curatedInterests {
+		index[strings.ToLower(interest)] = interest
+	}
+	return index
+}()
+
+// normalizeInterests validates tags against the curated list, returning them
+// in canonical spelling with duplicates removed
+func normalizeInterests(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		canonical, ok := curatedInterestIndex[strings.ToLower(strings.TrimSpace(tag))]
+		if !ok {
+			return nil, fmt.Errorf("unknown interest: %q", tag)
+		}
+		if seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+		normalized = append(normalized, canonical)
+	}
+	if len(normalized) > maxInterests {
+		return nil, fmt.Errorf("at most %d interests allowed", maxInterests)
+	}
+	return normalized, nil
+}
+
+// compatibilityScore rates how well two interest sets overlap, from 0 to 100
+// (shared tags over all distinct tags)
+func compatibilityScore(a, b []string) int {
+	union := make(map[string]bool, len(a)+len(b))
+	inA := make(map[string]bool, len(a))
+	for _, tag := range a {
+		inA[tag] = true
+		union[tag] = true
+	}
+	shared := make(map[string]bool)
+	for _, tag := range b {
+		if inA[tag] {
+			shared[tag] = true
+		}
+		union[tag] = true
+	}
+	if len(union) == 0 {
+		return 0
+	}
+	return int(math.Round(float64(len(shared)) / float64(len(union)) * 100))
+}
+
+// commonInterests returns the tags in theirs that also appear in mine, in
+// their order. It never returns nil so responses encode an empty array.
+func commonInterests(mine, theirs []string) []string {
+	inMine := make(map[string]bool, len(mine))
+	for _, tag := range mine {
+		inMine[tag] = true
+	}
+	common := []string{}
+	for _, tag := range theirs {
+		if inMine[tag] {
+			common = append(common, tag)
+			delete(inMine, tag) // don't repeat duplicated tags
+		}
+	}
+	return common
+}
+
+// GetInterests returns the curated interest list, optionally filtered by ?q=
+func GetInterests(c *gin.Context) {
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+
+	interests := make([]string, 0, len(curatedInterests))
+	for _, interest := range curatedInterests {
+		if q == "" || strings.Contains(strings.ToLower(interest), q) {
+			interests = append(interests, interest)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"interests": interests,
+		"max":       maxInterests,
+	})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCompatibilityScore(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want int
+	}{
+		{"full overlap", []string{"Hiking", "Music"}, []string{"Music", "Hiking"}, 100},
+		{"no overlap", []string{"Hiking", "Music"}, []string{"Wine", "Yoga"}, 0},
+		{"half", []string{"Hiking", "Music"}, []string{"Hiking", "Yoga"}, 33},
+		{"subset", []string{"Hiking"}, []string{"Hiking", "Music"}, 50},
+		{"duplicates don't inflate", []string{"Hiking", "Hiking"}, []string{"Hiking", "Music"}, 50},
+		{"one side empty", nil, []string{"Hiking"}, 0},
+		{"both empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		got := compatibilityScore(tt.a, tt.b)
+		if got != tt.want {
+			t.Errorf("%s: compatibilityScore = %d, want %d", tt.name, got, tt.want)
+		}
+		if back := compatibilityScore(tt.b, tt.a); back != got {
+			t.Errorf("%s: score depends on argument order: %d vs %d", tt.name, got, back)
+		}
+	}
+}
+
+func TestCompatibilityScoreBounds(t *testing.T) {
+	for i := range curatedInterests {
+		for j := i; j <= len(curatedInterests); j += 3 {
+			score := compatibilityScore(curatedInterests[:i], curatedInterests[i/2:j])
+			if score < 0 || score > 100 {
+				t.Fatalf("score %d for %v and %v is out of 0-100", score, curatedInterests[:i], curatedInterests[i/2:j])
+			}
+		}
+	}
+}
+
+func TestGetInterests(t *testing.T) {
+	w := testRequest(t, GetInterests, http.MethodGet, "/api/interests", nil, "", nil)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeBody(t, w)
+	if got := body["interests"].([]interface{}); len(got) != len(curatedInterests) {
+		t.Errorf("%d interests listed, want all %d", len(got), len(curatedInterests))
+	}
+	if body["max"] != float64(maxInterests) {
+		t.Errorf("max = %v, want %d", body["max"], maxInterests)
+	}
+
+	w = testRequest(t, GetInterests, http.MethodGet, "/api/interests?q=+IN", nil, "", nil)
+	got := decodeBody(t, w)["interests"].([]interface{})
+	want := []string{"Camping", "Cooking", "Cycling", "Dancing", "Gaming", "Gardening", "Hiking", "Running", "Swimming", "Volunteering", "Wine"}
+	if len(got) != len(want) {
+		t.Fatalf("?q=IN listed %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("?q=IN listed %v, want %v", got, want)
+			break
+		}
+	}
+
+	w = testRequest(t, GetInterests, http.MethodGet, "/api/interests?q=zzz", nil, "", nil)
+	if got := decodeBody(t, w)["interests"].([]interface{}); len(got) != 0 {
+		t.Errorf("?q=zzz listed %v, want none", got)
+	}
+}
+
+func TestCommonInterests(t *testing.T) {
+	tests := []struct {
+		name         string
+		mine, theirs []string
+		want         []string
+	}{
+		{"their order", []string{"Music", "Hiking", "Wine"}, []string{"Wine", "Yoga", "Hiking"}, []string{"Wine", "Hiking"}},
+		{"duplicates once", []string{"Hiking", "Hiking"}, []string{"Hiking", "Music", "Hiking"}, []string{"Hiking"}},
+		{"no overlap", []string{"Music"}, []string{"Wine"}, []string{}},
+		{"mine empty", nil, []string{"Wine"}, []string{}},
+		{"theirs empty", []string{"Wine"}, []string{}, []string{}},
+		{"both nil", nil, nil, []string{}},
+	}
+	for _, tt := range tests {
+		got := commonInterests(tt.mine, tt.theirs)
+		if got == nil {
+			t.Errorf("%s: commonInterests returned nil, want an empty slice", tt.name)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: commonInterests = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: commonInterests = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
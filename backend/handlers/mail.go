@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+
+	"coded/config"
+)
+
+// sendMail delivers a plain-text email through the SMTP_* settings. Without
+// SMTP_HOST (local development) the message is logged instead of sent.
+func sendMail(to, subject, body string) error {
+	host := config.String("SMTP_HOST", "")
+	if host == "" {
+		log.Printf("📧 SMTP not configured, would send to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+
+	from := config.String("SMTP_FROM", "no-reply@coded.com")
+	addr := host + ":" + config.String("SMTP_PORT", "587")
+
+	var auth smtp.Auth
+	if username := config.String("SMTP_USERNAME", ""); username != "" {
+		auth = smtp.PlainAuth("", username, config.String("SMTP_PASSWORD", ""), host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(addr, auth, from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("send mail to %s: %w", to, err)
+	}
+	return nil
+}
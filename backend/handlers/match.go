@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/models"
+	"coded/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetMatchCount returns the number of matches and how many of them the user
+// hasn't seen yet, for the navbar badge. It counts the same matches GetMatches
+// lists, so matches with someone either side has since blocked are left out.
+func GetMatchCount(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+	matchesColl := database.Matches
+
+	var user models.User
+	err = usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	blocked, err := blockedUserIDs(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count matches"})
+		return
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": bson.A{
+			bson.M{"users": userID},
+			bson.M{"users": bson.M{"$nin": blocked}},
+		}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"total": bson.M{"$sum": 1},
+			"unseen": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$gt": bson.A{"$createdAt", user.MatchesSeenAt}}, 1, 0},
+			}},
+		}}},
+	}
+
+	cursor, err := matchesColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("GetMatchCount aggregate error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count matches"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var counts struct {
+		Total  int64 `bson:"total"`
+		Unseen int64 `bson:"unseen"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&counts); err != nil {
+			log.Printf("GetMatchCount decode error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count matches"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":  counts.Total,
+		"unseen": counts.Unseen,
+	})
+}
+
+// MarkMatchesSeen clears the unseen-matches badge
+func MarkMatchesSeen(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+
+	now := time.Now().Unix()
+	result, err := usersColl.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+		"$set": bson.M{"matchesSeenAt": now},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update matches"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Matches marked as seen",
+		"seenAt":  now,
+	})
+}
+
+// Matches page sizes; override with MATCHES_DEFAULT_LIMIT and
+// MATCHES_MAX_LIMIT
+const (
+	defaultMatchesLimit = 50
+	maxMatchesLimit     = 100
+)
+
+// GetMatches lists the caller's matches newest first with the other user's
+// profile. Matches with someone either side has since blocked are hidden.
+func GetMatches(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	blocked, err := blockedUserIDs(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch matches"})
+		return
+	}
+
+	matchesColl := database.Matches
+
+	skip, limit := pageParams(c,
+		config.Int("MATCHES_DEFAULT_LIMIT", defaultMatchesLimit),
+		config.Int("MATCHES_MAX_LIMIT", maxMatchesLimit),
+	)
+
+	pipeline := pagedPipeline(
+		bson.D{{Key: "$and", Value: bson.A{
+			bson.M{"users": userID},
+			bson.M{"users": bson.M{"$nin": blocked}},
+		}}},
+		bson.D{{Key: "createdAt", Value: -1}},
+		skip, limit,
+	)
+	pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+		{Key: "otherId", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{
+			bson.D{{Key: "$filter", Value: bson.D{
+				{Key: "input", Value: "$users"},
+				{Key: "as", Value: "u"},
+				{Key: "cond", Value: bson.D{{Key: "$ne", Value: bson.A{"$$u", userID}}}},
+			}}},
+			0,
+		}}}},
+	}}})
+	pipeline = withUserJoin(pipeline, "otherId", "user", publicUserFields)
+
+	cursor, err := matchesColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("GetMatches aggregate error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch matches"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		OtherID   primitive.ObjectID `bson:"otherId"`
+		User      *models.User       `bson:"user"`
+		CreatedAt int64              `bson:"createdAt"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode matches"})
+		return
+	}
+
+	response := make([]map[string]interface{}, len(results))
+	for i, r := range results {
+		response[i] = map[string]interface{}{
+			"id":        r.ID.Hex(),
+			"userId":    r.OtherID.Hex(),
+			"user":      publicProfile(r.OtherID, r.User),
+			"matchedAt": r.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMatch bootstraps a match's conversation: the other user's profile, the
+// id of their 1:1 chat (created if it's missing) and the latest page of
+// messages, sized like GetMessages. 403 if either side has since blocked
+// the other.
+func GetMatch(c *gin.Context) {
+	matchID, err := parseObjectID(c, c.Param("id"), "match ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	matchesColl := database.Matches
+
+	var match models.Match
+	err = matchesColl.FindOne(ctx, bson.M{"_id": matchID, "users": userID}).Decode(&match)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch match"})
+		return
+	}
+
+	var otherID primitive.ObjectID
+	for _, id := range match.Users {
+		if id != userID {
+			otherID = id
+			break
+		}
+	}
+
+	if !rejectIfBlocked(c, ctx, userID, []primitive.ObjectID{otherID}) {
+		return
+	}
+
+	chatsColl := database.Chats
+	participantIDs := []primitive.ObjectID{userID, otherID}
+	chat, err := findChat(ctx, chatsColl, participantIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chat"})
+		return
+	}
+	if chat == nil {
+		created, _, err := createChat(ctx, chatsColl, userID, participantIDs)
+		if err != nil {
+			log.Printf("GetMatch chat create error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat"})
+			return
+		}
+		chat = &created
+	}
+
+	profiles, err := loadPublicProfiles(ctx, []primitive.ObjectID{otherID})
+	if err != nil {
+		log.Printf("GetMatch profile lookup error: %v", err)
+	}
+
+	_, limit := pageParams(c,
+		config.Int("MESSAGES_DEFAULT_LIMIT", defaultMessagesLimit),
+		config.Int("MESSAGES_MAX_LIMIT", maxMessagesLimit),
+	)
+	history := bson.D{{Key: "chatId", Value: chat.ID}}
+	clearedAt, err := chatClearedAt(ctx, chat.ID, userID)
+	if err != nil {
+		log.Printf("GetMatch settings lookup error: %v", err)
+	}
+	if clearedAt > 0 {
+		history = append(history, bson.E{Key: "createdAt", Value: bson.M{"$gt": clearedAt}})
+	}
+	messages, hasMore, err := messagePage(ctx, history, limit, userID)
+	if err != nil {
+		log.Printf("GetMatch messages error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+
+	var nextCursor interface{}
+	if len(messages) > 0 {
+		nextCursor = messages[0]["id"]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         match.ID.Hex(),
+		"matchedAt":  match.CreatedAt,
+		"user":       publicProfile(otherID, profiles[otherID]),
+		"chatId":     chat.ID.Hex(),
+		"messages":   messages,
+		"hasMore":    hasMore,
+		"nextCursor": nextCursor,
+	})
+}
+
+// recordMatch stores the match between two users, reporting whether it is
+// new. A pair that matched before (then unfavorited and refavorited) keeps
+// its original match.
+func recordMatch(ctx context.Context, userID, targetID primitive.ObjectID) (bool, error) {
+	matchesColl := database.Matches
+
+	users := []primitive.ObjectID{userID, targetID}
+	_, err := matchesColl.InsertOne(ctx, models.Match{
+		ID:        primitive.NewObjectID(),
+		Users:     users,
+		PairKey:   participantsKey(users),
+		CreatedAt: time.Now().Unix(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// handleMutualFavorite runs after userID favorites targetID. If targetID had
+// already favorited userID it's a match: it is recorded in matches, their
+// chat is opened (or reused) and both receive a match event with the other's
+// profile and the chat id, plus a push the first time they match.
+// Reports whether it was a match.
+func handleMutualFavorite(ctx context.Context, userID, targetID primitive.ObjectID) bool {
+	favColl := database.Favorites
+	mutual, err := favColl.CountDocuments(ctx, bson.M{"userId": targetID, "targetUserId": userID})
+	if err != nil {
+		log.Printf("[handleMutualFavorite] Failed to check reverse favorite: %v", err)
+		return false
+	}
+	if mutual == 0 {
+		return false
+	}
+
+	isNew, err := recordMatch(ctx, userID, targetID)
+	if err != nil {
+		log.Printf("[handleMutualFavorite] Failed to record match: %v", err)
+	}
+
+	chatsColl := database.Chats
+	participantIDs := []primitive.ObjectID{userID, targetID}
+	chat, err := findChat(ctx, chatsColl, participantIDs)
+	if err != nil {
+		log.Printf("[handleMutualFavorite] Failed to look up chat: %v", err)
+		return true
+	}
+	if chat == nil {
+		created, _, err := createChat(ctx, chatsColl, userID, participantIDs)
+		if err != nil {
+			log.Printf("[handleMutualFavorite] Failed to create chat: %v", err)
+			return true
+		}
+		chat = &created
+	}
+
+	usersColl := database.Users
+	cursor, err := usersColl.Find(ctx,
+		bson.M{"_id": bson.M{"$in": participantIDs}},
+		options.Find().SetProjection(publicUserFields),
+	)
+	if err != nil {
+		log.Printf("[handleMutualFavorite] Failed to load profiles: %v", err)
+		return true
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		log.Printf("[handleMutualFavorite] Failed to decode profiles: %v", err)
+		return true
+	}
+	profiles := make(map[primitive.ObjectID]*models.User, len(users))
+	for i := range users {
+		profiles[users[i].ID] = &users[i]
+	}
+
+	if isNew {
+		for _, pair := range [][2]primitive.ObjectID{{userID, targetID}, {targetID, userID}} {
+			recipient, other := pair[0], pair[1]
+			SendMatchPush(recipient, publicProfile(other, profiles[other]).Name)
+		}
+	}
+
+	if wsManager == nil {
+		return true
+	}
+
+	now := time.Now().Unix()
+	for _, pair := range [][2]primitive.ObjectID{{userID, targetID}, {targetID, userID}} {
+		recipient, other := pair[0], pair[1]
+		wsManager.BroadcastToUser(recipient.Hex(), websocket.Event{
+			Type: "match",
+			Payload: map[string]interface{}{
+				"user":      publicProfile(other, profiles[other]),
+				"chatId":    chat.ID.Hex(),
+				"timestamp": now,
+			},
+		})
+	}
+
+	return true
+}
\ No newline at end of file
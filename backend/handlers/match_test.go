@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func favorite(t *testing.T, userID, targetID primitive.ObjectID) map[string]interface{} {
+	t.Helper()
+	w := testRequest(t, AddFavorite, http.MethodPost, "/api/favorite", gin.H{"targetUserId": targetID.Hex()}, userID.Hex(), nil)
+	expectStatus(t, w, http.StatusCreated)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		database.Favorites.DeleteOne(ctx, bson.M{"userId": userID, "targetUserId": targetID})
+		database.Matches.DeleteMany(ctx, bson.M{"users": userID})
+		database.Chats.DeleteMany(ctx, bson.M{"participants": userID})
+	})
+	return decodeBody(t, w)
+}
+
+func matchCount(t *testing.T, userID primitive.ObjectID) (total, unseen float64) {
+	t.Helper()
+	w := testRequest(t, GetMatchCount, http.MethodGet, "/api/me/matches/count", nil, userID.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeBody(t, w)
+	total, _ = body["total"].(float64)
+	unseen, _ = body["unseen"].(float64)
+	return total, unseen
+}
+
+func TestOneSidedFavoriteIsNotAMatch(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+
+	if body := favorite(t, alice, bob); body["matched"] != false {
+		t.Errorf("one-sided favorite reported matched = %v", body["matched"])
+	}
+	if n, _ := database.Matches.CountDocuments(ctx, bson.M{"users": alice}); n != 0 {
+		t.Errorf("%d matches recorded for a one-sided favorite", n)
+	}
+	for _, id := range []primitive.ObjectID{alice, bob} {
+		if total, unseen := matchCount(t, id); total != 0 || unseen != 0 {
+			t.Errorf("match count for %s = %v/%v, want 0/0", id.Hex(), total, unseen)
+		}
+	}
+}
+
+func TestMutualFavoriteCreatesMatch(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+
+	favorite(t, alice, bob)
+	if body := favorite(t, bob, alice); body["matched"] != true {
+		t.Errorf("mutual favorite reported matched = %v", body["matched"])
+	}
+	if n, _ := database.Matches.CountDocuments(ctx, bson.M{"users": bson.M{"$all": bson.A{alice, bob}}}); n != 1 {
+		t.Errorf("%d matches recorded, want 1", n)
+	}
+	for _, id := range []primitive.ObjectID{alice, bob} {
+		if total, unseen := matchCount(t, id); total != 1 || unseen != 1 {
+			t.Errorf("match count for %s = %v/%v, want 1/1", id.Hex(), total, unseen)
+		}
+	}
+
+	w := testRequest(t, MarkMatchesSeen, http.MethodPost, "/api/me/matches/seen", nil, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	if total, unseen := matchCount(t, alice); total != 1 || unseen != 0 {
+		t.Errorf("match count after seen = %v/%v, want 1/0", total, unseen)
+	}
+}
+
+func TestMatchCountHidesBlockedMatches(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	favorite(t, alice, bob)
+	favorite(t, bob, alice)
+
+	insertBlock(t, ctx, bob, alice)
+	if total, _ := matchCount(t, alice); total != 0 {
+		t.Errorf("match count with a blocked match = %v, want 0", total)
+	}
+}
+
+// insertMatch stores a match between a and b created at createdAt
+func insertMatch(t *testing.T, ctx context.Context, a, b primitive.ObjectID, createdAt int64) {
+	t.Helper()
+	insertDocs(t, ctx, database.Matches, models.Match{
+		ID:        primitive.NewObjectID(),
+		Users:     []primitive.ObjectID{a, b},
+		PairKey:   participantsKey([]primitive.ObjectID{a, b}),
+		CreatedAt: createdAt,
+	})
+}
+
+func TestMarkMatchesSeenResetsBadge(t *testing.T) {
+	ctx := requireDB(t)
+	alice := insertTestUser(t, ctx, nil)
+	hourAgo := time.Now().Add(-time.Hour).Unix()
+	insertMatch(t, ctx, alice, insertTestUser(t, ctx, nil), hourAgo)
+	insertMatch(t, ctx, alice, insertTestUser(t, ctx, nil), hourAgo+1)
+
+	if total, unseen := matchCount(t, alice); total != 2 || unseen != 2 {
+		t.Fatalf("before seen: %v/%v, want 2/2", total, unseen)
+	}
+
+	w := testRequest(t, MarkMatchesSeen, http.MethodPost, "/api/me/matches/seen", nil, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	seenAt := int64(decodeBody(t, w)["seenAt"].(float64))
+	if total, unseen := matchCount(t, alice); total != 2 || unseen != 0 {
+		t.Errorf("after seen: %v/%v, want 2/0", total, unseen)
+	}
+
+	// A match made after the badge was cleared shows up again
+	insertMatch(t, ctx, alice, insertTestUser(t, ctx, nil), seenAt+1)
+	if total, unseen := matchCount(t, alice); total != 3 || unseen != 1 {
+		t.Errorf("after a new match: %v/%v, want 3/1", total, unseen)
+	}
+}
+
+func TestMarkMatchesSeenUnknownUser(t *testing.T) {
+	requireDB(t)
+	w := testRequest(t, MarkMatchesSeen, http.MethodPost, "/api/me/matches/seen", nil, primitive.NewObjectID().Hex(), nil)
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestMutualFavoriteSendsOneMatchEventEach(t *testing.T) {
+	ctx := requireDB(t)
+	alice := insertTestUser(t, ctx, bson.M{"name": "Alice"})
+	bob := insertTestUser(t, ctx, bson.M{"name": "Bob"})
+	m, server := startWebSocketManager(t)
+	conns := map[primitive.ObjectID]*gorillaws.Conn{alice: dialAs(t, m, server, alice), bob: dialAs(t, m, server, bob)}
+
+	// A match announced for the one-sided favorite would show up below as a
+	// second event (readEvent can't check for silence before that: a timed
+	// out read leaves the connection unusable)
+	favorite(t, alice, bob)
+	favorite(t, bob, alice)
+	chats := map[string]bool{}
+	for id, other := range map[primitive.ObjectID]primitive.ObjectID{alice: bob, bob: alice} {
+		event := readEvent(t, conns[id], "match", 2*time.Second)
+		if event == nil {
+			t.Errorf("%s never got the match event", id.Hex())
+			continue
+		}
+		user, _ := event["user"].(map[string]interface{})
+		if user["id"] != other.Hex() {
+			t.Errorf("%s's match event names user %v, want %s", id.Hex(), user["id"], other.Hex())
+		}
+		chatID, _ := event["chatId"].(string)
+		chats[chatID] = true
+		if again := readEvent(t, conns[id], "match", 200*time.Millisecond); again != nil {
+			t.Errorf("%s got the match event twice", id.Hex())
+		}
+	}
+	if len(chats) != 1 || chats[""] {
+		t.Errorf("match events carried chat ids %v, want one shared chat", chats)
+	}
+}
+
+func TestGetMatchCreatesTheChatOnce(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	matchID := primitive.NewObjectID()
+	insertDocs(t, ctx, database.Matches, models.Match{
+		ID:        matchID,
+		Users:     []primitive.ObjectID{alice, bob},
+		PairKey:   participantsKey([]primitive.ObjectID{alice, bob}),
+		CreatedAt: time.Now().Unix(),
+	})
+	t.Cleanup(func() {
+		database.Chats.DeleteMany(context.Background(), bson.M{"participants": alice})
+	})
+	getMatch := func(userID, id primitive.ObjectID) *httptest.ResponseRecorder {
+		params := gin.Params{{Key: "id", Value: id.Hex()}}
+		return testRequest(t, GetMatch, http.MethodGet, "/api/me/matches/"+id.Hex(), nil, userID.Hex(), params)
+	}
+
+	w := getMatch(alice, matchID)
+	expectStatus(t, w, http.StatusOK)
+	first := decodeBody(t, w)
+	chatID, _ := first["chatId"].(string)
+	if chatID == "" {
+		t.Fatalf("GetMatch returned %v, want a chat id", first)
+	}
+	if user, _ := first["user"].(map[string]interface{}); user["id"] != bob.Hex() {
+		t.Errorf("match user = %v, want bob", first["user"])
+	}
+
+	w = getMatch(bob, matchID)
+	expectStatus(t, w, http.StatusOK)
+	if again := decodeBody(t, w); again["chatId"] != chatID {
+		t.Errorf("second GetMatch returned chat %v, want the same chat %s", again["chatId"], chatID)
+	}
+	if n, _ := database.Chats.CountDocuments(ctx, bson.M{"participants": bson.M{"$all": bson.A{alice, bob}}}); n != 1 {
+		t.Errorf("%d chats between the pair, want 1", n)
+	}
+
+	expectStatus(t, getMatch(carol, matchID), http.StatusNotFound)
+	expectStatus(t, getMatch(alice, primitive.NewObjectID()), http.StatusNotFound)
+}
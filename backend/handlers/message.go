@@ -5,8 +5,11 @@ import (
     "encoding/json"
     "log"
     "net/http"
+    "net/url"
+    "strings"
     "time"
 
+    "coded/config"
     "coded/database"
     "coded/models"
 
@@ -14,29 +17,37 @@ import (
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
-    "github.com/SherClockHolmes/webpush-go"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Message history page sizes; override with MESSAGES_DEFAULT_LIMIT and
+// MESSAGES_MAX_LIMIT
+const (
+    defaultMessagesLimit = 50
+    maxMessagesLimit     = 100
+)
+
+// GetMessages returns a page of a chat's history in chronological order:
+// the latest messages, or those older than ?before=<messageId>. nextCursor
+// is the oldest returned message id; pass it as before to load more while
+// hasMore is true.
 func GetMessages(c *gin.Context) {
     chatIDStr := c.Param("chatId")
-    chatID, err := primitive.ObjectIDFromHex(chatIDStr)
+    chatID, err := parseObjectID(c, chatIDStr, "chat ID")
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
     // First, verify user is in the chat
-    chatsColl := database.Client.Database("coded").Collection("chats")
+    chatsColl := database.Chats
     var chat models.Chat
     err = chatsColl.FindOne(ctx, bson.M{"_id": chatID, "participants": userID}).Decode(&chat)
     if err == mongo.ErrNoDocuments {
@@ -48,79 +59,210 @@ func GetMessages(c *gin.Context) {
         return
     }
 
-    messagesColl := database.Client.Database("coded").Collection("messages")
+    messagesColl := database.Messages
+
+    _, limit := pageParams(c,
+        config.Int("MESSAGES_DEFAULT_LIMIT", defaultMessagesLimit),
+        config.Int("MESSAGES_MAX_LIMIT", maxMessagesLimit),
+    )
+
+    match := bson.D{{Key: "chatId", Value: chatID}}
 
-    // Fetch messages with sender user data
-    pipeline := mongo.Pipeline{
-        {{"$match", bson.D{{"chatId", chatID}}}},
-        {{"$sort", bson.D{{"createdAt", 1}}}},
-        {{"$lookup", bson.D{
-            {"from", "users"},
-            {"localField", "senderId"},
-            {"foreignField", "_id"},
-            {"as", "senderProfile"},
-        }}},
-        {{"$unwind", bson.D{
-            {"path", "$senderProfile"},
-            {"preserveNullAndEmptyArrays", true},
-        }}},
+    // Skip whatever the caller cleared
+    clearedAt, err := chatClearedAt(ctx, chatID, userID)
+    if err != nil {
+        log.Printf("GetMessages settings lookup error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+        return
+    }
+    if clearedAt > 0 {
+        match = append(match, bson.E{Key: "createdAt", Value: bson.M{"$gt": clearedAt}})
     }
 
-    cursor, err := messagesColl.Aggregate(ctx, pipeline)
+    if before := c.Query("before"); before != "" {
+        beforeID, err := parseObjectID(c, before, "cursor")
+        if err != nil {
+            return
+        }
+
+        var cursorMessage models.Message
+        err = messagesColl.FindOne(ctx, bson.M{"_id": beforeID, "chatId": chatID}).Decode(&cursorMessage)
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor", "code": "INVALID_ID"})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+            return
+        }
+
+        // createdAt has second resolution, so break ties on _id
+        match = append(match, bson.E{Key: "$or", Value: bson.A{
+            bson.M{"createdAt": bson.M{"$lt": cursorMessage.CreatedAt}},
+            bson.M{"createdAt": cursorMessage.CreatedAt, "_id": bson.M{"$lt": beforeID}},
+        }})
+    }
+
+    response, hasMore, err := messagePage(ctx, match, limit, userID)
     if err != nil {
-        log.Printf("GetMessages aggregate error: %v", err)
+        log.Printf("GetMessages error: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
         return
     }
+
+    var nextCursor interface{}
+    if len(response) > 0 {
+        nextCursor = response[0]["id"]
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "messages":   response,
+        "hasMore":    hasMore,
+        "nextCursor": nextCursor,
+    })
+}
+
+// messagePage loads the latest limit messages matching match, rendered for
+// userID in chronological order, and whether older ones remain
+func messagePage(ctx context.Context, match bson.D, limit int64, userID primitive.ObjectID) ([]map[string]interface{}, bool, error) {
+    messagesColl := database.Messages
+
+    // Newest first so $limit keeps the latest page; one extra tells us
+    // whether older messages remain
+    pipeline := pagedPipeline(match,
+        bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+        0, limit+1,
+    )
+    pipeline = withUserJoin(pipeline, "senderId", "senderProfile", publicUserFields)
+
+    cursor, err := messagesColl.Aggregate(ctx, pipeline)
+    if err != nil {
+        return nil, false, err
+    }
     defer cursor.Close(ctx)
 
     var rawMessages []bson.M
     if err := cursor.All(ctx, &rawMessages); err != nil {
-        log.Printf("GetMessages decode error: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode messages"})
-        return
+        return nil, false, err
+    }
+
+    hasMore := int64(len(rawMessages)) > limit
+    if hasMore {
+        rawMessages = rawMessages[:limit]
+    }
+    for i, j := 0, len(rawMessages)-1; i < j; i, j = i+1, j-1 {
+        rawMessages[i], rawMessages[j] = rawMessages[j], rawMessages[i]
     }
 
     // Build response with safe sender object (never null)
     response := make([]map[string]interface{}, len(rawMessages))
     for i, m := range rawMessages {
-        senderProfile := m["senderProfile"]
-
-        senderMap := map[string]interface{}{
-            "id":     m["senderId"].(primitive.ObjectID).Hex(),
-            "name":   "Unknown",
-            "avatar": fallbackAvatar,
-        }
+        response[i] = renderMessage(m, userID)
+    }
+    return response, hasMore, nil
+}
 
-        if profile, ok := senderProfile.(bson.M); ok && profile != nil {
-            if name, _ := profile["name"].(string); name != "" {
-                senderMap["name"] = name
+// renderMessage formats a message joined with its senderProfile for
+// history responses. userID is the viewer, whose own reaction is returned
+// as myReaction.
+func renderMessage(m bson.M, userID primitive.ObjectID) map[string]interface{} {
+    senderProfile := m["senderProfile"]
+    deleted, _ := m["deleted"].(bool)
+
+    // Per-emoji counts plus the caller's own reaction, so the UI can
+    // highlight it and toggle it off
+    reactions := map[string]int{}
+    var myReaction string
+    if list, ok := m["reactions"].(bson.A); ok {
+        for _, item := range list {
+            r, ok := item.(bson.M)
+            if !ok {
+                continue
             }
-            if avatar, _ := profile["avatar"].(string); avatar != "" {
-                senderMap["avatar"] = avatar
+            emoji, _ := r["emoji"].(string)
+            reactions[emoji]++
+            if id, _ := r["userId"].(primitive.ObjectID); id == userID {
+                myReaction = emoji
             }
         }
+    }
 
-        response[i] = map[string]interface{}{
-            "id":        m["_id"].(primitive.ObjectID).Hex(),
-            "chatId":    m["chatId"].(primitive.ObjectID).Hex(),
-            "senderId":  m["senderId"].(primitive.ObjectID).Hex(),
-            "sender":    senderMap,
-            "content":   m["content"],
-            "type":      m["type"],
-            "isRead":    m["isRead"],
-            "createdAt": m["createdAt"],
+    senderMap := map[string]interface{}{
+        "id":     m["senderId"].(primitive.ObjectID).Hex(),
+        "name":   "Unknown",
+        "avatar": fallbackAvatar,
+    }
+
+    if profile, ok := senderProfile.(bson.M); ok && profile != nil {
+        if name, _ := profile["name"].(string); name != "" {
+            senderMap["name"] = name
+        }
+        if avatar, _ := profile["avatar"].(string); avatar != "" {
+            senderMap["avatar"] = avatar
         }
     }
 
-    c.JSON(http.StatusOK, response)
+    return map[string]interface{}{
+        "id":        m["_id"].(primitive.ObjectID).Hex(),
+        "chatId":    m["chatId"].(primitive.ObjectID).Hex(),
+        "senderId":  m["senderId"].(primitive.ObjectID).Hex(),
+        "sender":    senderMap,
+        "content":   m["content"],
+        "type":      m["type"],
+        "replyToId": m["replyToId"],
+        "isRead":    m["isRead"],
+        "isDelivered": m["isDelivered"],
+        "createdAt": m["createdAt"],
+        "editedAt":  m["editedAt"],
+        "deleted":   deleted,
+        "reactions": reactions,
+        "myReaction": myReaction,
+    }
 }
 
+// maxImagesPerMessage caps how many images one image message may carry
+const maxImagesPerMessage = 10
+
+// isMediaURL reports whether s is an absolute https URL, as returned by
+// UploadPhoto, and so safe to use as an image, voice or video message
+func isMediaURL(s string) bool {
+    u, err := url.Parse(s)
+    return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// isMediaContent reports whether content is valid for a non-text message of
+// type msgType: a single media URL, or for images the JSON array of URLs the
+// web client sends when several are picked at once
+func isMediaContent(msgType, content string) bool {
+    if msgType != models.MessageTypeImage || !strings.HasPrefix(content, "[") {
+        return isMediaURL(content)
+    }
+
+    var urls []string
+    if err := json.Unmarshal([]byte(content), &urls); err != nil {
+        return false
+    }
+    if len(urls) == 0 || len(urls) > maxImagesPerMessage {
+        return false
+    }
+    for _, u := range urls {
+        if !isMediaURL(u) {
+            return false
+        }
+    }
+    return true
+}
+
+// SendMessage stores a message and broadcasts it as new_message. The sender
+// sees it twice (this response and the broadcast); both carry the same "id"
+// and echo the optional clientMessageId, so clients should dedupe on either.
 func SendMessage(c *gin.Context) {
     var req struct {
-        ChatID  string `json:"chatId" binding:"required"`
-        Content string `json:"content" binding:"required"`
-        Type    string `json:"type,omitempty"`
+        ChatID          string `json:"chatId" binding:"required"`
+        Content         string `json:"content" binding:"required"`
+        Type            string `json:"type,omitempty"`
+        ReplyToID       string `json:"replyToId,omitempty"`
+        ClientMessageID string `json:"clientMessageId,omitempty" binding:"max=64"`
     }
 
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -128,28 +270,45 @@ func SendMessage(c *gin.Context) {
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    chatID, err := primitive.ObjectIDFromHex(req.ChatID)
+    chatID, err := parseObjectID(c, req.ChatID, "chat ID")
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
         return
     }
 
     if req.Type == "" {
-        req.Type = "text"
+        req.Type = models.MessageTypeText
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    if !models.IsValidMessageType(req.Type) {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "Invalid message type",
+            "code":  "INVALID_MESSAGE_TYPE",
+        })
+        return
+    }
+
+    if req.Type == models.MessageTypeText {
+        if !moderateContent(c, req.Content) {
+            return
+        }
+    } else if !isMediaContent(req.Type, req.Content) {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "Content must be an https URL for " + req.Type + " messages",
+            "code":  "INVALID_MEDIA_URL",
+        })
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
     // Verify user is in the chat
-    chatsColl := database.Client.Database("coded").Collection("chats")
+    chatsColl := database.Chats
     var chat models.Chat
     err = chatsColl.FindOne(ctx, bson.M{"_id": chatID, "participants": userID}).Decode(&chat)
     if err == mongo.ErrNoDocuments {
@@ -161,7 +320,20 @@ func SendMessage(c *gin.Context) {
         return
     }
 
-    messagesColl := database.Client.Database("coded").Collection("messages")
+    // A block between two group members doesn't silence the whole group
+    if !chat.IsGroup() {
+        var others []primitive.ObjectID
+        for _, participantID := range chat.Participants {
+            if participantID != userID {
+                others = append(others, participantID)
+            }
+        }
+        if !rejectIfBlocked(c, ctx, userID, others) {
+            return
+        }
+    }
+
+    messagesColl := database.Messages
 
     message := models.Message{
         ID:        primitive.NewObjectID(),
@@ -173,6 +345,40 @@ func SendMessage(c *gin.Context) {
         CreatedAt: time.Now().Unix(),
     }
 
+    // Replies must quote a message from the same chat
+    var replyPreview string
+    if req.ReplyToID != "" {
+        replyToID, err := parseObjectID(c, req.ReplyToID, "reply message ID")
+        if err != nil {
+            return
+        }
+
+        var quoted models.Message
+        err = messagesColl.FindOne(ctx, bson.M{"_id": replyToID, "chatId": chatID}).Decode(&quoted)
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Reply target not found in this chat"})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reply target"})
+            return
+        }
+
+        message.ReplyToID = &replyToID
+        replyPreview = quoted.Content
+    }
+
+    // A recipient who has the chat open (join_chat) receives it right away
+    if wsManager != nil {
+        for _, participantID := range chat.Participants {
+            if participantID != userID && wsManager.IsViewingChat(participantID.Hex(), chatID.Hex()) {
+                message.IsDelivered = true
+                message.DeliveredAt = message.CreatedAt
+                break
+            }
+        }
+    }
+
     _, err = messagesColl.InsertOne(ctx, message)
     if err != nil {
         log.Printf("SendMessage insert error: %v", err)
@@ -197,7 +403,7 @@ func SendMessage(c *gin.Context) {
     }
 
     // Get sender info for WebSocket broadcast
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
     var sender models.User
     usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&sender)
 
@@ -213,90 +419,266 @@ func SendMessage(c *gin.Context) {
         },
         "content":   message.Content,
         "type":      message.Type,
+        "replyToId": message.ReplyToID,
         "isRead":    message.IsRead,
+        "isDelivered": message.IsDelivered,
         "createdAt": message.CreatedAt,
     }
+    if req.ClientMessageID != "" {
+        wsMessage["clientMessageId"] = req.ClientMessageID
+    }
 
     // Broadcast via WebSocket
     if wsManager != nil {
         wsManager.BroadcastNewMessage(wsMessage)
     }
 
-    // Send push notification to the other participant(s)
-    go func() {
-        defer func() {
-            if r := recover(); r != nil {
-                log.Printf("Panic in push notification: %v", r)
-            }
-        }()
+    // Send push notification to the other participant(s), except those who
+    // muted the chat
+    muted, err := chatMutedBy(ctx, chat.ID)
+    if err != nil {
+        log.Printf("SendMessage mute lookup error: %v", err)
+    }
+    for _, participantID := range chat.Participants {
+        if participantID == userID || muted[participantID] {
+            continue // Skip sender and muted
+        }
+        SendMessagePush(userID, participantID, req.Content, sender.Name, sender.Avatar, replyPreview)
+    }
 
-        subsColl := database.Client.Database("coded").Collection("subscriptions")
-        usersColl := database.Client.Database("coded").Collection("users")
+    c.JSON(http.StatusCreated, gin.H{
+        "message":         "Message sent",
+        "id":              message.ID.Hex(),
+        "clientMessageId": req.ClientMessageID,
+        "data":            wsMessage,
+    })
+}
 
-        for _, participantID := range chat.Participants {
-            if participantID == userID {
-                continue // Skip sender
-            }
+// defaultMessageEditWindow is how long after sending a message can still be
+// edited; override with MESSAGE_EDIT_WINDOW
+const defaultMessageEditWindow = 15 * time.Minute
 
-            // Get receiver's name for payload (optional)
-            var sender models.User
-            usersColl.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&sender)
+// EditMessage replaces the content of one of the caller's own text messages,
+// within the edit window, and broadcasts message_edited to the chat
+func EditMessage(c *gin.Context) {
+    messageID, err := parseObjectID(c, c.Param("id"), "message ID")
+    if err != nil {
+        return
+    }
 
-            payload := map[string]string{
-                "title": sender.Name + " sent a message",
-                "body":  req.Content,
-                "icon":  sender.Avatar, // Optional
-            }
-            payloadBytes, _ := json.Marshal(payload)
+    var req struct {
+        Content string `json:"content" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
 
-            // Find subscription
-            var sub PushSubscription
-            err = subsColl.FindOne(context.Background(), bson.M{"userId": participantID}).Decode(&sub)
-            if err == mongo.ErrNoDocuments {
-                continue // No subscription
-            }
-            if err != nil {
-                log.Printf("Failed to find subscription: %v", err)
-                continue
-            }
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
 
-            // Send push
-            _, err = webpush.SendNotification(payloadBytes, &sub.Sub, &webpush.Options{
-                Subscriber:      "user@example.com", // Replace with actual if needed
-                VAPIDPrivateKey: vapidPrivateKey,
-                TTL:             30,
-            })
-            if err != nil {
-                log.Printf("Failed to send push: %v", err)
-            }
-        }
-    }()
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
 
-    c.JSON(http.StatusCreated, gin.H{
-        "message": "Message sent",
-        "id":      message.ID.Hex(),
+    messagesColl := database.Messages
+
+    var msg models.Message
+    err = messagesColl.FindOne(ctx, bson.M{"_id": messageID}).Decode(&msg)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message"})
+        return
+    }
+
+    if msg.SenderID != userID {
+        c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own messages"})
+        return
+    }
+    if msg.Deleted {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Deleted messages can't be edited"})
+        return
+    }
+    if msg.Type != "" && msg.Type != "text" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Only text messages can be edited"})
+        return
+    }
+
+    window := config.Duration("MESSAGE_EDIT_WINDOW", defaultMessageEditWindow)
+    cutoff := time.Now().Add(-window).Unix()
+    if msg.CreatedAt < cutoff {
+        c.JSON(http.StatusForbidden, gin.H{
+            "error":   "Edit window has passed",
+            "message": "Messages can only be edited shortly after sending",
+        })
+        return
+    }
+
+    if !moderateContent(c, req.Content) {
+        return
+    }
+
+    // Re-check sender and window in the filter so the edit can't land after
+    // the window closes
+    editedAt := time.Now().Unix()
+    result, err := messagesColl.UpdateOne(ctx,
+        bson.M{"_id": messageID, "senderId": userID, "createdAt": bson.M{"$gte": cutoff}, "deleted": bson.M{"$ne": true}},
+        bson.M{"$set": bson.M{"content": req.Content, "editedAt": editedAt}},
+    )
+    if err != nil {
+        log.Printf("EditMessage update error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Edit window has passed"})
+        return
+    }
+
+    // Keep the chat list preview in sync when this is still the latest message
+    chatsColl := database.Chats
+    _, err = chatsColl.UpdateOne(ctx,
+        bson.M{"_id": msg.ChatID, "lastMessageAt": msg.CreatedAt, "lastMessage": msg.Content},
+        bson.M{"$set": bson.M{"lastMessage": req.Content}},
+    )
+    if err != nil {
+        log.Printf("EditMessage chat preview error: %v", err)
+    }
+
+    payload := map[string]interface{}{
+        "id":       messageID.Hex(),
+        "chatId":   msg.ChatID.Hex(),
+        "senderId": userID.Hex(),
+        "content":  req.Content,
+        "editedAt": editedAt,
+    }
+    if wsManager != nil {
+        wsManager.BroadcastMessageEdited(payload)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Message edited",
+        "data":    payload,
     })
 }
 
+// DeleteMessage soft-deletes one of the caller's messages: the document stays
+// with deleted=true and empty content, and message_deleted is broadcast
+func DeleteMessage(c *gin.Context) {
+    messageID, err := parseObjectID(c, c.Param("id"), "message ID")
+    if err != nil {
+        return
+    }
+
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    messagesColl := database.Messages
+
+    var msg models.Message
+    err = messagesColl.FindOne(ctx, bson.M{"_id": messageID}).Decode(&msg)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message"})
+        return
+    }
+
+    if msg.SenderID != userID {
+        c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own messages"})
+        return
+    }
+    if msg.Deleted {
+        c.JSON(http.StatusOK, gin.H{"message": "Message deleted"})
+        return
+    }
+
+    deletedAt := time.Now().Unix()
+    _, err = messagesColl.UpdateOne(ctx,
+        bson.M{"_id": messageID, "senderId": userID},
+        bson.M{"$set": bson.M{"deleted": true, "content": ""}},
+    )
+    if err != nil {
+        log.Printf("DeleteMessage update error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+        return
+    }
+
+    refreshChatPreview(ctx, msg)
+
+    payload := map[string]interface{}{
+        "id":        messageID.Hex(),
+        "chatId":    msg.ChatID.Hex(),
+        "senderId":  userID.Hex(),
+        "timestamp": deletedAt,
+    }
+    if wsManager != nil {
+        wsManager.BroadcastMessageDeleted(payload)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Message deleted",
+        "data":    payload,
+    })
+}
+
+// refreshChatPreview points the chat's lastMessage at the newest message
+// that isn't deleted, if removed was the one it showed. A chat with no
+// messages left keeps its lastMessageAt so it doesn't jump in the list.
+func refreshChatPreview(ctx context.Context, removed models.Message) {
+    messagesColl := database.Messages
+    chatsColl := database.Chats
+
+    set := bson.M{"lastMessage": ""}
+    var latest models.Message
+    err := messagesColl.FindOne(ctx,
+        bson.M{"chatId": removed.ChatID, "deleted": bson.M{"$ne": true}},
+        options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}),
+    ).Decode(&latest)
+    if err == nil {
+        set["lastMessage"] = latest.Content
+        set["lastMessageAt"] = latest.CreatedAt
+    } else if err != mongo.ErrNoDocuments {
+        log.Printf("refreshChatPreview find error: %v", err)
+        return
+    }
+
+    _, err = chatsColl.UpdateOne(ctx,
+        bson.M{"_id": removed.ChatID, "lastMessageAt": removed.CreatedAt, "lastMessage": removed.Content},
+        bson.M{"$set": set},
+    )
+    if err != nil {
+        log.Printf("refreshChatPreview update error: %v", err)
+    }
+}
+
 func MarkAsRead(c *gin.Context) {
     messageIDStr := c.Param("id")
-    messageID, err := primitive.ObjectIDFromHex(messageIDStr)
+    messageID, err := parseObjectID(c, messageIDStr, "message ID")
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    messagesColl := database.Client.Database("coded").Collection("messages")
+    messagesColl := database.Messages
 
     // Get the chat ID from the message and verify access
     var msg models.Message
@@ -306,64 +688,227 @@ func MarkAsRead(c *gin.Context) {
         return
     }
 
-    chatsColl := database.Client.Database("coded").Collection("chats")
+    chatsColl := database.Chats
     count, err := chatsColl.CountDocuments(ctx, bson.M{"_id": msg.ChatID, "participants": userID})
-    if err != nil || count == 0 {
+    if err != nil {
+        log.Printf("MarkAsRead membership check error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark as read"})
+        return
+    }
+    if count == 0 {
         c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to chat"})
         return
     }
 
-    // Mark all unread messages from the partner in this chat as read
+    read, err := markChatRead(ctx, msg.ChatID, userID)
+    if err != nil {
+        log.Printf("MarkAsRead error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark as read"})
+        return
+    }
+
+    // Broadcast read receipt via WebSocket
+    if wsManager != nil && len(read) > 0 {
+        messageIds := make([]string, len(read))
+        for i, m := range read {
+            messageIds[i] = m.ID.Hex()
+        }
+
+        wsReadReceipt := map[string]interface{}{
+            "chatId":     msg.ChatID.Hex(),
+            "userId":     userID.Hex(),
+            "messageIds": messageIds,
+            "timestamp":  time.Now().Unix(),
+        }
+
+        wsManager.BroadcastMessageRead(wsReadReceipt)
+
+        // Each sender also gets just their own messages, so clients can
+        // flip "sent" to "read" without filtering the chat-wide receipt
+        bySender := make(map[primitive.ObjectID][]string)
+        for _, m := range read {
+            bySender[m.SenderID] = append(bySender[m.SenderID], m.ID.Hex())
+        }
+        for senderID, ids := range bySender {
+            wsManager.BroadcastReadReceipt(senderID.Hex(), map[string]interface{}{
+                "chatId":     msg.ChatID.Hex(),
+                "readBy":     userID.Hex(),
+                "messageIds": ids,
+                "timestamp":  wsReadReceipt["timestamp"],
+            })
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":      "Marked as read",
+        "updatedCount": len(read),
+    })
+}
+
+// markChatRead flips userID's unread messages in chatID to read and returns
+// the ones this call changed. The update stamps a fresh readMarker that the
+// follow-up read selects on, so concurrent calls each report only the
+// messages they flipped themselves.
+func markChatRead(ctx context.Context, chatID, userID primitive.ObjectID) ([]models.Message, error) {
+    messagesColl := database.Messages
+
+    marker := primitive.NewObjectID()
     result, err := messagesColl.UpdateMany(
         ctx,
         bson.M{
-            "chatId":   msg.ChatID,
+            "chatId":   chatID,
             "senderId": bson.M{"$ne": userID},
             "isRead":   false,
         },
-        bson.M{"$set": bson.M{"isRead": true}},
+        bson.M{"$set": bson.M{"isRead": true, "readMarker": marker}},
     )
     if err != nil {
-        log.Printf("MarkAsRead error: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark as read"})
+        return nil, err
+    }
+    if result.ModifiedCount == 0 {
+        return nil, nil
+    }
+
+    cursor, err := messagesColl.Find(ctx,
+        bson.M{"chatId": chatID, "readMarker": marker},
+        options.Find().SetProjection(bson.M{"_id": 1, "senderId": 1}),
+    )
+    if err != nil {
+        return nil, err
+    }
+    var read []models.Message
+    if err := cursor.All(ctx, &read); err != nil {
+        return nil, err
+    }
+    return read, nil
+}
+
+// MarkAsDelivered acknowledges that the caller's client has rendered newly
+// arrived messages, and sends delivery receipts to their senders
+func MarkAsDelivered(c *gin.Context) {
+    var req struct {
+        ChatID     string   `json:"chatId" binding:"required"`
+        MessageIDs []string `json:"messageIds"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    // Broadcast read receipt via WebSocket
-    if wsManager != nil && result.ModifiedCount > 0 {
-        // Get all message IDs that were marked as read
-        cursor, err := messagesColl.Find(ctx, bson.M{
-            "chatId":   msg.ChatID,
-            "senderId": bson.M{"$ne": userID},
-            "isRead":   true,
-        })
-        if err == nil {
-            var messages []models.Message
-            if err = cursor.All(ctx, &messages); err == nil {
-                var messageIds []string
-                for _, msg := range messages {
-                    messageIds = append(messageIds, msg.ID.Hex())
-                }
-                
-                wsReadReceipt := map[string]interface{}{
-                    "chatId":     msg.ChatID.Hex(),
-                    "userId":     userID.Hex(),
-                    "messageIds": messageIds,
-                    "timestamp":  time.Now().Unix(),
-                }
-                
-                wsManager.BroadcastMessageRead(wsReadReceipt)
-            }
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    chatID, err := parseObjectID(c, req.ChatID, "chat ID")
+    if err != nil {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    chatsColl := database.Chats
+    count, err := chatsColl.CountDocuments(ctx, bson.M{"_id": chatID, "participants": userID})
+    if err != nil {
+        log.Printf("MarkAsDelivered membership check error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark as delivered"})
+        return
+    }
+    if count == 0 {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to chat"})
+        return
+    }
+
+    // Optionally narrowed to the ids the client rendered
+    var ids []primitive.ObjectID
+    for _, idStr := range req.MessageIDs {
+        id, err := parseObjectID(c, idStr, "message ID")
+        if err != nil {
+            return
         }
+        ids = append(ids, id)
+    }
+
+    now := time.Now().Unix()
+    delivered, err := markChatDelivered(ctx, chatID, userID, ids, now)
+    if err != nil {
+        log.Printf("MarkAsDelivered error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark as delivered"})
+        return
+    }
+
+    // Broadcast delivery receipt via WebSocket
+    if wsManager != nil && len(delivered) > 0 {
+        messageIds := make([]string, len(delivered))
+        for i, id := range delivered {
+            messageIds[i] = id.Hex()
+        }
+
+        wsManager.BroadcastMessageDelivered(map[string]interface{}{
+            "chatId":     chatID.Hex(),
+            "userId":     userID.Hex(),
+            "messageIds": messageIds,
+            "timestamp":  now,
+        })
     }
 
     c.JSON(http.StatusOK, gin.H{
-        "message":      "Marked as read",
-        "updatedCount": result.ModifiedCount,
+        "message":      "Marked as delivered",
+        "updatedCount": len(delivered),
     })
 }
 
+// markChatDelivered flips userID's undelivered messages in chatID (only
+// those in ids, if given) to delivered and returns the ids this call
+// changed. Like markChatRead it stamps a fresh deliveryMarker and selects on
+// it, so concurrent or repeated calls never report the same message twice.
+func markChatDelivered(ctx context.Context, chatID, userID primitive.ObjectID, ids []primitive.ObjectID, now int64) ([]primitive.ObjectID, error) {
+    messagesColl := database.Messages
+
+    filter := bson.M{
+        "chatId":      chatID,
+        "senderId":    bson.M{"$ne": userID},
+        "isDelivered": bson.M{"$ne": true},
+    }
+    if len(ids) > 0 {
+        filter["_id"] = bson.M{"$in": ids}
+    }
+
+    marker := primitive.NewObjectID()
+    result, err := messagesColl.UpdateMany(ctx, filter,
+        bson.M{"$set": bson.M{"isDelivered": true, "deliveredAt": now, "deliveryMarker": marker}},
+    )
+    if err != nil {
+        return nil, err
+    }
+    if result.ModifiedCount == 0 {
+        return nil, nil
+    }
+
+    cursor, err := messagesColl.Find(ctx,
+        bson.M{"chatId": chatID, "deliveryMarker": marker},
+        options.Find().SetProjection(bson.M{"_id": 1}),
+    )
+    if err != nil {
+        return nil, err
+    }
+    var delivered []models.Message
+    if err := cursor.All(ctx, &delivered); err != nil {
+        return nil, err
+    }
+    deliveredIDs := make([]primitive.ObjectID, len(delivered))
+    for i, m := range delivered {
+        deliveredIDs[i] = m.ID
+    }
+    return deliveredIDs, nil
+}
+
 // New function to send typing indicator via WebSocket
+// SendTypingIndicator is the HTTP fallback for clients without a socket; the
+// typing_start/typing_end WebSocket frames are preferred. Both end up in
+// Manager.BroadcastTyping.
 func SendTypingIndicator(c *gin.Context) {
     var req struct {
         ChatID string `json:"chatId" binding:"required"`
@@ -375,44 +920,29 @@ func SendTypingIndicator(c *gin.Context) {
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    chatID, err := primitive.ObjectIDFromHex(req.ChatID)
+    chatID, err := parseObjectID(c, req.ChatID, "chat ID")
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
     // Verify user is in the chat
-    chatsColl := database.Client.Database("coded").Collection("chats")
+    chatsColl := database.Chats
     count, err := chatsColl.CountDocuments(ctx, bson.M{"_id": chatID, "participants": userID})
     if err != nil || count == 0 {
         c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to chat"})
         return
     }
 
-    // Broadcast typing indicator via WebSocket
     if wsManager != nil {
-        typingMsg := map[string]interface{}{
-            "chatId":    chatID.Hex(),
-            "userId":    userID.Hex(),
-            "typing":    req.Typing,
-            "timestamp": time.Now().Unix(),
-        }
-        
-        if req.Typing {
-            wsManager.BroadcastTypingStart(typingMsg)
-        } else {
-            wsManager.BroadcastTypingEnd(typingMsg)
-        }
+        wsManager.BroadcastTyping(chatID.Hex(), userID.Hex(), req.Typing)
     }
 
     c.JSON(http.StatusOK, gin.H{
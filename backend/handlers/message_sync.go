@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sync limits; override with MESSAGES_SYNC_MAX_CHATS and
+// MESSAGES_SYNC_LIMIT
+const (
+	defaultSyncMaxChats = 100
+	defaultSyncLimit    = 100
+)
+
+// syncPosition is where a chat's sync resumes: after cursor exactly, or after
+// the second cursor.CreatedAt when the client sent a bare timestamp
+type syncPosition struct {
+	cursor pageCursor
+	exact  bool
+}
+
+// SyncMessages returns, for each chat in the request, the messages after a
+// position, oldest first. "chats" maps chat ids to a unix timestamp (messages
+// created after that second); "cursors" maps chat ids to the nextCursor of
+// an earlier sync, which resumes exactly, including messages from the same
+// second. Each chat is capped at MESSAGES_SYNC_LIMIT; when hasMore is true
+// the client syncs that chat again with its nextCursor. Chats the caller
+// isn't in are listed under "denied" instead of failing the whole request.
+func SyncMessages(c *gin.Context) {
+	var req struct {
+		Chats   map[string]int64  `json:"chats"`
+		Cursors map[string]string `json:"cursors"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	// A chat given both ways resumes from its cursor
+	since := make(map[primitive.ObjectID]syncPosition, len(req.Chats)+len(req.Cursors))
+	for idStr, ts := range req.Chats {
+		chatID, err := parseObjectID(c, idStr, "chat ID")
+		if err != nil {
+			return
+		}
+		since[chatID] = syncPosition{cursor: pageCursor{CreatedAt: ts}}
+	}
+	for idStr, raw := range req.Cursors {
+		chatID, err := parseObjectID(c, idStr, "chat ID")
+		if err != nil {
+			return
+		}
+		cursor, ok := parsePageCursor(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor for chat " + idStr, "code": "INVALID_CURSOR"})
+			return
+		}
+		since[chatID] = syncPosition{cursor: cursor, exact: true}
+	}
+
+	if len(since) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chats or cursors is required"})
+		return
+	}
+	maxChats := config.Int("MESSAGES_SYNC_MAX_CHATS", defaultSyncMaxChats)
+	if len(since) > maxChats {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many chats", "limit": maxChats})
+		return
+	}
+
+	chatIDs := make([]primitive.ObjectID, 0, len(since))
+	for chatID := range since {
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	chatsColl := database.Chats
+	messagesColl := database.Messages
+
+	cursor, err := chatsColl.Find(ctx, bson.M{"_id": bson.M{"$in": chatIDs}, "participants": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify chat access"})
+		return
+	}
+	var chats []models.Chat
+	if err := cursor.All(ctx, &chats); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify chat access"})
+		return
+	}
+
+	memberChatIDs := make([]primitive.ObjectID, len(chats))
+	for i, chat := range chats {
+		memberChatIDs[i] = chat.ID
+	}
+	settings, err := chatSettingsFor(ctx, userID, memberChatIDs)
+	if err != nil {
+		log.Printf("SyncMessages settings lookup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+
+	limit := int64(config.Int("MESSAGES_SYNC_LIMIT", defaultSyncLimit))
+	result := make(map[string]interface{}, len(chats))
+	for _, chat := range chats {
+		// Nothing the caller cleared comes back
+		pos, cleared := since[chat.ID], settings[chat.ID].ClearedAt
+		match := bson.D{{Key: "chatId", Value: chat.ID}}
+		if pos.exact {
+			match = append(match, bson.E{Key: "$and", Value: bson.A{pos.cursor.after()}})
+			if cleared > 0 {
+				match = append(match, bson.E{Key: "createdAt", Value: bson.M{"$gt": cleared}})
+			}
+		} else {
+			match = append(match, bson.E{Key: "createdAt", Value: bson.M{"$gt": max(pos.cursor.CreatedAt, cleared)}})
+		}
+
+		// Oldest first so a capped chat can continue from where this stops
+		pipeline := pagedPipeline(
+			match,
+			bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+			0, limit+1,
+		)
+		pipeline = withUserJoin(pipeline, "senderId", "senderProfile", publicUserFields)
+
+		msgCursor, err := messagesColl.Aggregate(ctx, pipeline)
+		if err != nil {
+			log.Printf("SyncMessages aggregate error for chat %s: %v", chat.ID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+			return
+		}
+		var rawMessages []bson.M
+		if err := msgCursor.All(ctx, &rawMessages); err != nil {
+			log.Printf("SyncMessages decode error for chat %s: %v", chat.ID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode messages"})
+			return
+		}
+
+		hasMore := int64(len(rawMessages)) > limit
+		if hasMore {
+			rawMessages = rawMessages[:limit]
+		}
+		messages := make([]map[string]interface{}, len(rawMessages))
+		for i, m := range rawMessages {
+			messages[i] = renderMessage(m, userID)
+		}
+
+		var nextCursor interface{}
+		if len(rawMessages) > 0 {
+			nextCursor = cursorFor(rawMessages[len(rawMessages)-1]).String()
+		}
+
+		result[chat.ID.Hex()] = gin.H{
+			"messages":   messages,
+			"hasMore":    hasMore,
+			"nextCursor": nextCursor,
+		}
+		delete(since, chat.ID)
+	}
+
+	denied := make([]string, 0, len(since))
+	for chatID := range since {
+		denied = append(denied, chatID.Hex())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chats":  result,
+		"denied": denied,
+		"time":   time.Now().Unix(),
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func syncMessages(t *testing.T, userID primitive.ObjectID, body gin.H) map[string]interface{} {
+	t.Helper()
+	w := testRequest(t, SyncMessages, http.MethodPost, "/api/messages/sync", body, userID.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	return decodeBody(t, w)
+}
+
+func TestSyncMessagesValidation(t *testing.T) {
+	user := primitive.NewObjectID().Hex()
+	chat := primitive.NewObjectID().Hex()
+	for name, body := range map[string]gin.H{
+		"empty":      {},
+		"bad chat":   {"chats": gin.H{"nope": 0}},
+		"bad cursor": {"cursors": gin.H{chat: "yesterday"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, SyncMessages, http.MethodPost, "/api/messages/sync", body, user, nil)
+			expectStatus(t, w, http.StatusBadRequest)
+		})
+	}
+}
+
+// insertChatMessages stores messages from sender in chatID at the given
+// createdAt times, in order
+func insertChatMessages(t *testing.T, ctx context.Context, chatID, sender primitive.ObjectID, times ...int64) []primitive.ObjectID {
+	t.Helper()
+	ids := make([]primitive.ObjectID, len(times))
+	docs := make([]interface{}, len(times))
+	for i, ts := range times {
+		ids[i] = primitive.NewObjectID()
+		docs[i] = models.Message{ID: ids[i], ChatID: chatID, SenderID: sender, Type: models.MessageTypeText, Content: "m", CreatedAt: ts}
+	}
+	if _, err := database.Messages.InsertMany(ctx, docs); err != nil {
+		t.Fatalf("inserting messages: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Messages.DeleteMany(context.Background(), bson.M{"chatId": chatID})
+	})
+	return ids
+}
+
+func insertDirectChat(t *testing.T, ctx context.Context, users ...primitive.ObjectID) primitive.ObjectID {
+	t.Helper()
+	chatID := primitive.NewObjectID()
+	if _, err := database.Chats.InsertOne(ctx, models.Chat{ID: chatID, Type: models.ChatTypeDirect, Participants: users}); err != nil {
+		t.Fatalf("inserting chat: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Chats.DeleteOne(context.Background(), bson.M{"_id": chatID})
+	})
+	return chatID
+}
+
+func syncedIDs(t *testing.T, body map[string]interface{}, chatID primitive.ObjectID) (ids []string, hasMore bool, next string) {
+	t.Helper()
+	chats, _ := body["chats"].(map[string]interface{})
+	chat, ok := chats[chatID.Hex()].(map[string]interface{})
+	if !ok {
+		t.Fatalf("chat %s missing from %v", chatID.Hex(), body)
+	}
+	for _, m := range chat["messages"].([]interface{}) {
+		ids = append(ids, m.(map[string]interface{})["id"].(string))
+	}
+	hasMore, _ = chat["hasMore"].(bool)
+	next, _ = chat["nextCursor"].(string)
+	return ids, hasMore, next
+}
+
+func TestSyncMessagesReturnsNewerMessagesFromMemberChats(t *testing.T) {
+	ctx := requireDB(t)
+	me, friend, stranger := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	mine := insertDirectChat(t, ctx, me, friend)
+	theirs := insertDirectChat(t, ctx, friend, stranger)
+	ids := insertChatMessages(t, ctx, mine, friend, 100, 200, 300)
+	insertChatMessages(t, ctx, theirs, friend, 300)
+
+	body := syncMessages(t, me, gin.H{"chats": gin.H{mine.Hex(): 150, theirs.Hex(): 0}})
+	got, hasMore, _ := syncedIDs(t, body, mine)
+	if len(got) != 2 || got[0] != ids[1].Hex() || got[1] != ids[2].Hex() || hasMore {
+		t.Errorf("synced %v (hasMore %v), want the messages at 200 and 300", got, hasMore)
+	}
+
+	denied, _ := body["denied"].([]interface{})
+	if len(denied) != 1 || denied[0] != theirs.Hex() {
+		t.Errorf("denied = %v, want [%s]", denied, theirs.Hex())
+	}
+	if _, leaked := body["chats"].(map[string]interface{})[theirs.Hex()]; leaked {
+		t.Error("messages returned for a chat the caller isn't in")
+	}
+}
+
+func TestSyncMessagesCursorKeepsSameSecondMessages(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("MESSAGES_SYNC_LIMIT", "2")
+	me, friend := primitive.NewObjectID(), primitive.NewObjectID()
+	chat := insertDirectChat(t, ctx, me, friend)
+	want := insertChatMessages(t, ctx, chat, friend, 500, 500, 500, 500, 500)
+
+	var got []string
+	body := syncMessages(t, me, gin.H{"chats": gin.H{chat.Hex(): 0}})
+	for page := 0; ; page++ {
+		ids, hasMore, next := syncedIDs(t, body, chat)
+		got = append(got, ids...)
+		if !hasMore {
+			break
+		}
+		if page > len(want) {
+			t.Fatal("sync never finished paging")
+		}
+		body = syncMessages(t, me, gin.H{"cursors": gin.H{chat.Hex(): next}})
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("synced %d messages, want %d: %v", len(got), len(want), got)
+	}
+	for i, id := range want {
+		if got[i] != id.Hex() {
+			t.Errorf("message %d = %s, want %s", i, got[i], id.Hex())
+		}
+	}
+}
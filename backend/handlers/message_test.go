@@ -0,0 +1,541 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIsMediaContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType string
+		content string
+		want    bool
+	}{
+		{"image url", "image", "https://res.cloudinary.com/demo/image/upload/a.jpg", true},
+		{"voice url", "voice", "https://res.cloudinary.com/demo/video/upload/a.webm", true},
+		{"video url", "video", "https://res.cloudinary.com/demo/video/upload/a.mp4", true},
+		{"image array", "image", `["https://a.example/1.jpg","https://a.example/2.jpg"]`, true},
+		{"image array with one url", "image", `["https://a.example/1.jpg"]`, true},
+		{"plain http", "image", "http://a.example/1.jpg", false},
+		{"not a url", "voice", "hello", false},
+		{"relative", "video", "/uploads/a.mp4", false},
+		{"javascript scheme", "image", "javascript:alert(1)", false},
+		{"empty array", "image", `[]`, false},
+		{"array with bad url", "image", `["https://a.example/1.jpg","ftp://a.example/2.jpg"]`, false},
+		{"malformed array", "image", `["https://a.example/1.jpg"`, false},
+		{"array for voice", "voice", `["https://a.example/1.webm"]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMediaContent(tt.msgType, tt.content); got != tt.want {
+				t.Errorf("isMediaContent(%q, %q) = %v, want %v", tt.msgType, tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMediaContentCapsImageCount(t *testing.T) {
+	urls := `[`
+	for i := 0; i <= maxImagesPerMessage; i++ {
+		if i > 0 {
+			urls += ","
+		}
+		urls += `"https://a.example/x.jpg"`
+	}
+	urls += `]`
+	if isMediaContent("image", urls) {
+		t.Errorf("accepted %d images, cap is %d", maxImagesPerMessage+1, maxImagesPerMessage)
+	}
+}
+
+func TestSendMessageRejectsInvalidTypeAndContent(t *testing.T) {
+	userID := primitive.NewObjectID().Hex()
+	chatID := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name     string
+		body     map[string]string
+		wantCode string
+	}{
+		{"unknown type", map[string]string{"chatId": chatID, "content": "hi", "type": "sticker"}, "INVALID_MESSAGE_TYPE"},
+		{"image without url", map[string]string{"chatId": chatID, "content": "not a url", "type": "image"}, "INVALID_MEDIA_URL"},
+		{"voice with array", map[string]string{"chatId": chatID, "content": `["https://a.example/a.webm"]`, "type": "voice"}, "INVALID_MEDIA_URL"},
+		{"video over http", map[string]string{"chatId": chatID, "content": "http://a.example/a.mp4", "type": "video"}, "INVALID_MEDIA_URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testRequest(t, SendMessage, http.MethodPost, "/api/message", tt.body, userID, nil)
+			expectStatus(t, w, http.StatusBadRequest)
+			if code := decodeBody(t, w)["code"]; code != tt.wantCode {
+				t.Errorf("code = %v, want %s", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// insertUnread stores n unread text messages from senderID in chatID
+func insertUnread(t *testing.T, ctx context.Context, chatID, senderID primitive.ObjectID, n int) []primitive.ObjectID {
+	t.Helper()
+	ids := make([]primitive.ObjectID, n)
+	docs := make([]interface{}, n)
+	for i := range docs {
+		ids[i] = primitive.NewObjectID()
+		docs[i] = models.Message{ID: ids[i], ChatID: chatID, SenderID: senderID, Type: models.MessageTypeText, Content: "hi", CreatedAt: time.Now().Unix()}
+	}
+	if _, err := database.Messages.InsertMany(ctx, docs); err != nil {
+		t.Fatalf("inserting messages: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Messages.DeleteMany(context.Background(), bson.M{"chatId": chatID})
+	})
+	return ids
+}
+
+func TestMarkChatReadReportsEachMessageOnce(t *testing.T) {
+	ctx := requireDB(t)
+	chatID, reader, sender := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	want := insertUnread(t, ctx, chatID, sender, 50)
+	insertUnread(t, ctx, chatID, reader, 5) // the reader's own messages stay unread
+
+	const callers = 8
+	results := make([][]models.Message, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			read, err := markChatRead(ctx, chatID, reader)
+			if err != nil {
+				t.Errorf("markChatRead: %v", err)
+			}
+			results[i] = read
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[primitive.ObjectID]int)
+	for _, read := range results {
+		for _, m := range read {
+			seen[m.ID]++
+			if m.SenderID != sender {
+				t.Errorf("message %s from %s reported as read", m.ID.Hex(), m.SenderID.Hex())
+			}
+		}
+	}
+	for _, id := range want {
+		if seen[id] != 1 {
+			t.Errorf("message %s reported %d times, want once", id.Hex(), seen[id])
+		}
+	}
+	if len(seen) != len(want) {
+		t.Errorf("%d messages reported, want %d", len(seen), len(want))
+	}
+
+	if read, err := markChatRead(ctx, chatID, reader); err != nil || len(read) != 0 {
+		t.Errorf("second pass = %v, %v; want nothing left to mark", read, err)
+	}
+}
+
+func TestMarkAsReadSendsReceiptToEachSender(t *testing.T) {
+	ctx := requireDB(t)
+	m, server := startWebSocketManager(t)
+	reader, alice, bob := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	chatID := primitive.NewObjectID()
+	chat := models.Chat{ID: chatID, Type: models.ChatTypeGroup, Name: "receipts", Participants: []primitive.ObjectID{reader, alice, bob}}
+	if _, err := database.Chats.InsertOne(ctx, chat); err != nil {
+		t.Fatalf("inserting chat: %v", err)
+	}
+	t.Cleanup(func() { database.Chats.DeleteOne(context.Background(), bson.M{"_id": chatID}) })
+	aliceIDs := insertUnread(t, ctx, chatID, alice, 3)
+	insertUnread(t, ctx, chatID, bob, 2)
+
+	aliceConn := dialAs(t, m, server, alice)
+
+	params := gin.Params{{Key: "id", Value: aliceIDs[0].Hex()}}
+	w := testRequest(t, MarkAsRead, http.MethodPost, "/api/messages/"+aliceIDs[0].Hex()+"/read", nil, reader.Hex(), params)
+	expectStatus(t, w, http.StatusOK)
+	if got := decodeBody(t, w)["updatedCount"]; got != 5.0 {
+		t.Errorf("updatedCount = %v, want 5", got)
+	}
+
+	receipt := readEvent(t, aliceConn, "read_receipt", 2*time.Second)
+	if receipt == nil {
+		t.Fatal("sender never received a read_receipt")
+	}
+	if receipt["readBy"] != reader.Hex() || receipt["chatId"] != chatID.Hex() {
+		t.Errorf("receipt = %v, want readBy %s in chat %s", receipt, reader.Hex(), chatID.Hex())
+	}
+	got, _ := receipt["messageIds"].([]interface{})
+	want := make(map[string]bool)
+	for _, id := range aliceIDs {
+		want[id.Hex()] = true
+	}
+	if len(got) != len(want) {
+		t.Fatalf("receipt messageIds = %v, want alice's %d messages", got, len(want))
+	}
+	for _, id := range got {
+		if !want[id.(string)] {
+			t.Errorf("receipt carries %v, which isn't one of alice's messages", id)
+		}
+	}
+
+	// Nothing left unread, so a repeat call sends no second receipt
+	w = testRequest(t, MarkAsRead, http.MethodPost, "/api/messages/"+aliceIDs[0].Hex()+"/read", nil, reader.Hex(), params)
+	expectStatus(t, w, http.StatusOK)
+	if again := readEvent(t, aliceConn, "read_receipt", 300*time.Millisecond); again != nil {
+		t.Errorf("repeat MarkAsRead sent another receipt: %v", again)
+	}
+}
+
+func TestMarkChatDeliveredReportsEachMessageOnce(t *testing.T) {
+	ctx := requireDB(t)
+	chatID, receiver, sender := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	want := insertUnread(t, ctx, chatID, sender, 50)
+	insertUnread(t, ctx, chatID, receiver, 5) // the receiver's own messages aren't theirs to ack
+
+	const callers = 8
+	results := make([][]primitive.ObjectID, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			delivered, err := markChatDelivered(ctx, chatID, receiver, nil, time.Now().Unix())
+			if err != nil {
+				t.Errorf("markChatDelivered: %v", err)
+			}
+			results[i] = delivered
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[primitive.ObjectID]int)
+	for _, delivered := range results {
+		for _, id := range delivered {
+			seen[id]++
+		}
+	}
+	for _, id := range want {
+		if seen[id] != 1 {
+			t.Errorf("message %s reported %d times, want once", id.Hex(), seen[id])
+		}
+	}
+	if len(seen) != len(want) {
+		t.Errorf("%d messages reported, want %d", len(seen), len(want))
+	}
+
+	if delivered, err := markChatDelivered(ctx, chatID, receiver, nil, time.Now().Unix()); err != nil || len(delivered) != 0 {
+		t.Errorf("second pass = %v, %v; want nothing left to mark", delivered, err)
+	}
+}
+
+func TestMarkChatDeliveredOnlyListedMessages(t *testing.T) {
+	ctx := requireDB(t)
+	chatID, receiver, sender := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	ids := insertUnread(t, ctx, chatID, sender, 4)
+
+	delivered, err := markChatDelivered(ctx, chatID, receiver, ids[:2], time.Now().Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 2 {
+		t.Fatalf("delivered %v, want just the 2 listed", hexes(delivered))
+	}
+
+	// Acking an already delivered message alongside a new one reports only the new one
+	delivered, err = markChatDelivered(ctx, chatID, receiver, ids[1:3], time.Now().Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 1 || delivered[0] != ids[2] {
+		t.Errorf("repeat ack reported %v, want only %s", hexes(delivered), ids[2].Hex())
+	}
+}
+
+func TestSendMessageEchoesClientMessageID(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	t.Cleanup(func() {
+		database.Messages.DeleteMany(context.Background(), bson.M{"chatId": chatID})
+	})
+	m, server := startWebSocketManager(t)
+	conns := map[string]*gorillaws.Conn{"alice": dialAs(t, m, server, alice), "bob": dialAs(t, m, server, bob)}
+
+	send := func(body gin.H) map[string]interface{} {
+		t.Helper()
+		body["chatId"] = chatID.Hex()
+		w := testRequest(t, SendMessage, http.MethodPost, "/api/message", body, alice.Hex(), nil)
+		expectStatus(t, w, http.StatusCreated)
+		return decodeBody(t, w)
+	}
+
+	resp := send(gin.H{"content": "hi", "clientMessageId": "tmp-1"})
+	data, _ := resp["data"].(map[string]interface{})
+	if resp["clientMessageId"] != "tmp-1" || data["clientMessageId"] != "tmp-1" {
+		t.Errorf("response = %v, want clientMessageId tmp-1 at the top and in data", resp)
+	}
+	for name, conn := range conns {
+		event := readEvent(t, conn, "new_message", 2*time.Second)
+		if event == nil {
+			t.Errorf("%s never got new_message", name)
+			continue
+		}
+		if event["clientMessageId"] != "tmp-1" || event["id"] != resp["id"] {
+			t.Errorf("%s got %v, want id %v and clientMessageId tmp-1", name, event, resp["id"])
+		}
+	}
+
+	// Without one, the broadcast leaves the field out
+	resp = send(gin.H{"content": "again"})
+	if data, _ := resp["data"].(map[string]interface{}); data["clientMessageId"] != nil {
+		t.Errorf("data = %v, want no clientMessageId", data)
+	}
+	for name, conn := range conns {
+		event := readEvent(t, conn, "new_message", 2*time.Second)
+		if _, ok := event["clientMessageId"]; event == nil || ok {
+			t.Errorf("%s got %v, want new_message without clientMessageId", name, event)
+		}
+	}
+}
+
+func TestSendMessageRejectsLongClientMessageID(t *testing.T) {
+	body := gin.H{"chatId": primitive.NewObjectID().Hex(), "content": "hi", "clientMessageId": strings.Repeat("x", 65)}
+	w := testRequest(t, SendMessage, http.MethodPost, "/api/message", body, primitive.NewObjectID().Hex(), nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestGetMessagesBeforeCursor(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	// ObjectIDs increase as they're generated, so the insertion order (and
+	// the sorted hexes) is also the (createdAt, _id) order
+	ids := insertChatMessages(t, ctx, chatID, bob, 99, 99, 100, 100, 100, 100, 100, 101)
+
+	page := func(before string) (got []string, hasMore bool, next string) {
+		t.Helper()
+		target := "/api/messages/" + chatID.Hex() + "?limit=3"
+		if before != "" {
+			target += "&before=" + before
+		}
+		params := gin.Params{{Key: "chatId", Value: chatID.Hex()}}
+		w := testRequest(t, GetMessages, http.MethodGet, target, nil, alice.Hex(), params)
+		expectStatus(t, w, http.StatusOK)
+		body := decodeBody(t, w)
+		for _, m := range body["messages"].([]interface{}) {
+			got = append(got, m.(map[string]interface{})["id"].(string))
+		}
+		next, _ = body["nextCursor"].(string)
+		hasMore, _ = body["hasMore"].(bool)
+		return got, hasMore, next
+	}
+
+	// Pages come newest first; each is in chronological order and its
+	// nextCursor is its oldest message
+	want := hexes(ids)
+	wantPages := [][]string{want[5:], want[2:5], want[:2]}
+	before := ""
+	for i, wantPage := range wantPages {
+		got, hasMore, next := page(before)
+		if !slices.Equal(got, wantPage) {
+			t.Fatalf("page %d = %v, want %v", i, got, wantPage)
+		}
+		if last := i == len(wantPages)-1; hasMore == last {
+			t.Errorf("page %d hasMore = %v, want %v", i, hasMore, !last)
+		}
+		if next != wantPage[0] {
+			t.Errorf("page %d nextCursor = %q, want %q", i, next, wantPage[0])
+		}
+		before = next
+	}
+
+	// A message from another chat isn't a valid cursor here
+	other := insertDirectChat(t, ctx, alice, bob)
+	foreign := insertChatMessages(t, ctx, other, bob, 100)
+	params := gin.Params{{Key: "chatId", Value: chatID.Hex()}}
+	w := testRequest(t, GetMessages, http.MethodGet, "/api/messages/"+chatID.Hex()+"?before="+foreign[0].Hex(), nil, alice.Hex(), params)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+// insertMessage stores one message with the given fields set
+func insertMessage(t *testing.T, ctx context.Context, msg models.Message) primitive.ObjectID {
+	t.Helper()
+	msg.ID = primitive.NewObjectID()
+	if msg.Type == "" {
+		msg.Type = models.MessageTypeText
+	}
+	insertDocs(t, ctx, database.Messages, msg)
+	return msg.ID
+}
+
+func editMessage(t *testing.T, userID, messageID primitive.ObjectID, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	params := gin.Params{{Key: "id", Value: messageID.Hex()}}
+	return testRequest(t, EditMessage, http.MethodPut, "/api/messages/"+messageID.Hex(), gin.H{"content": content}, userID.Hex(), params)
+}
+
+func TestEditMessage(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("MESSAGE_EDIT_WINDOW", "15m")
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	now := time.Now()
+	message := func(sender primitive.ObjectID, age time.Duration) primitive.ObjectID {
+		return insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: sender, Content: "before", CreatedAt: now.Add(-age).Unix()})
+	}
+	content := func(id primitive.ObjectID) (string, int64) {
+		t.Helper()
+		var msg models.Message
+		if err := database.Messages.FindOne(ctx, bson.M{"_id": id}).Decode(&msg); err != nil {
+			t.Fatalf("loading message: %v", err)
+		}
+		return msg.Content, msg.EditedAt
+	}
+
+	recent := message(alice, time.Minute)
+	w := editMessage(t, alice, recent, "after")
+	expectStatus(t, w, http.StatusOK)
+	if text, editedAt := content(recent); text != "after" || editedAt == 0 {
+		t.Errorf("stored %q edited at %d, want the new text and an edit time", text, editedAt)
+	}
+
+	tests := []struct {
+		name string
+		by   primitive.ObjectID
+		id   primitive.ObjectID
+		want int
+	}{
+		{"someone else's message", bob, message(alice, time.Minute), http.StatusForbidden},
+		{"past the edit window", alice, message(alice, 16*time.Minute), http.StatusForbidden},
+		{"image message", alice, insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: alice, Type: models.MessageTypeImage, Content: "https://res.cloudinary.com/x/a.jpg", CreatedAt: now.Unix()}), http.StatusBadRequest},
+		{"deleted message", alice, insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: alice, Content: "", Deleted: true, CreatedAt: now.Unix()}), http.StatusBadRequest},
+		{"missing message", alice, primitive.NewObjectID(), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, editMessage(t, tt.by, tt.id, "after"), tt.want)
+			if tt.want == http.StatusNotFound {
+				return
+			}
+			if text, editedAt := content(tt.id); text == "after" || editedAt != 0 {
+				t.Errorf("rejected edit still stored %q (editedAt %d)", text, editedAt)
+			}
+		})
+	}
+}
+
+func TestDeleteMessageRefreshesChatPreview(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	now := time.Now().Unix()
+	first := insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: alice, Content: "first", CreatedAt: now - 120})
+	second := insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: bob, Content: "second", CreatedAt: now - 60})
+	third := insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: alice, Content: "third", CreatedAt: now})
+	if _, err := database.Chats.UpdateOne(ctx, bson.M{"_id": chatID}, bson.M{"$set": bson.M{"lastMessage": "third", "lastMessageAt": now}}); err != nil {
+		t.Fatalf("setting preview: %v", err)
+	}
+	deleteMessage := func(by, id primitive.ObjectID) *httptest.ResponseRecorder {
+		params := gin.Params{{Key: "id", Value: id.Hex()}}
+		return testRequest(t, DeleteMessage, http.MethodDelete, "/api/messages/"+id.Hex(), nil, by.Hex(), params)
+	}
+	preview := func() (interface{}, int64) {
+		t.Helper()
+		var chat models.Chat
+		if err := database.Chats.FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat); err != nil {
+			t.Fatalf("loading chat: %v", err)
+		}
+		return chat.LastMessage, chat.LastMessageAt
+	}
+
+	expectStatus(t, deleteMessage(bob, third), http.StatusForbidden)
+
+	expectStatus(t, deleteMessage(alice, third), http.StatusOK)
+	var msg models.Message
+	if err := database.Messages.FindOne(ctx, bson.M{"_id": third}).Decode(&msg); err != nil {
+		t.Fatalf("loading message: %v", err)
+	}
+	if !msg.Deleted || msg.Content != "" {
+		t.Errorf("deleted message stored as deleted=%v content=%q, want hidden", msg.Deleted, msg.Content)
+	}
+	if text, at := preview(); text != "second" || at != now-60 {
+		t.Errorf("preview = %v at %d, want the previous message", text, at)
+	}
+
+	// Deleting an older message leaves a preview that shows another one
+	expectStatus(t, deleteMessage(alice, first), http.StatusOK)
+	if text, at := preview(); text != "second" || at != now-60 {
+		t.Errorf("preview = %v at %d after deleting an older message, want it unchanged", text, at)
+	}
+
+	expectStatus(t, deleteMessage(bob, second), http.StatusOK)
+	if text, at := preview(); text != "" || at != now-60 {
+		t.Errorf("preview = %v at %d with nothing left, want empty text and the old time", text, at)
+	}
+}
+
+func TestReceiptsIgnoreMessagesFromOtherChats(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	withBob := insertDirectChat(t, ctx, alice, bob)
+	withCarol := insertDirectChat(t, ctx, alice, carol)
+	fromBob := insertUnread(t, ctx, withBob, bob, 2)
+	fromAlice := insertUnread(t, ctx, withBob, alice, 1)
+	fromCarol := insertUnread(t, ctx, withCarol, carol, 2)
+	flags := func(id primitive.ObjectID) (read, delivered bool) {
+		t.Helper()
+		var msg models.Message
+		if err := database.Messages.FindOne(ctx, bson.M{"_id": id}).Decode(&msg); err != nil {
+			t.Fatalf("loading message: %v", err)
+		}
+		return msg.IsRead, msg.IsDelivered
+	}
+
+	// Ids from another chat, and the caller's own messages, ride along but
+	// are left alone
+	listed := hexIDs([]primitive.ObjectID{fromBob[0], fromCarol[0], fromAlice[0]})
+	w := testRequest(t, MarkAsDelivered, http.MethodPost, "/api/messages/delivered", gin.H{"chatId": withBob.Hex(), "messageIds": listed}, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	if n := decodeBody(t, w)["updatedCount"]; n != float64(1) {
+		t.Errorf("updatedCount = %v, want 1", n)
+	}
+	for _, id := range []primitive.ObjectID{fromCarol[0], fromAlice[0], fromBob[1]} {
+		if _, delivered := flags(id); delivered {
+			t.Errorf("message %s outside the acked set was marked delivered", id.Hex())
+		}
+	}
+	if _, delivered := flags(fromBob[0]); !delivered {
+		t.Error("the partner's listed message was not marked delivered")
+	}
+
+	params := gin.Params{{Key: "id", Value: fromBob[0].Hex()}}
+	expectStatus(t, testRequest(t, MarkAsRead, http.MethodPost, "/api/messages/"+fromBob[0].Hex()+"/read", nil, carol.Hex(), params), http.StatusForbidden)
+	expectStatus(t, testRequest(t, MarkAsRead, http.MethodPost, "/api/messages/"+fromBob[0].Hex()+"/read", nil, alice.Hex(), params), http.StatusOK)
+	for _, id := range fromBob {
+		if read, _ := flags(id); !read {
+			t.Errorf("message %s in the chat was not marked read", id.Hex())
+		}
+	}
+	for _, id := range append(fromCarol, fromAlice...) {
+		if read, _ := flags(id); read {
+			t.Errorf("message %s was marked read by a receipt for another chat or sender", id.Hex())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"coded/database"
+	"coded/moderation"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func useModerator(t *testing.T, keywords ...string) {
+	t.Helper()
+	SetModerator(moderation.NewKeywordModerator(keywords))
+	t.Cleanup(func() { SetModerator(nil) })
+}
+
+func TestBlockedContentIsRejected(t *testing.T) {
+	useModerator(t, "spam")
+	userID := primitive.NewObjectID().Hex()
+
+	tests := map[string]struct {
+		handler gin.HandlerFunc
+		body    gin.H
+	}{
+		"post":    {CreatePost, gin.H{"content": "Buy SPAM now"}},
+		"message": {SendMessage, gin.H{"chatId": primitive.NewObjectID().Hex(), "content": "spam, spam"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, tt.handler, http.MethodPost, "/", tt.body, userID, nil)
+			expectStatus(t, w, http.StatusUnprocessableEntity)
+			body := decodeBody(t, w)
+			if body["error"] != "Content not allowed" || body["message"] == "" {
+				t.Errorf("body = %v, want the moderation error and reason", body)
+			}
+		})
+	}
+}
+
+func TestAllowedContentIsStored(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("POST_COOLDOWN", "0")
+	useModerator(t, "spam")
+	alice := insertTestUser(t, ctx, nil)
+	bob := insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	t.Cleanup(func() {
+		database.Posts.DeleteMany(context.Background(), bson.M{"userId": alice})
+		database.Messages.DeleteMany(context.Background(), bson.M{"chatId": chatID})
+	})
+
+	// "spammer" is a different word, so it gets through
+	w := testRequest(t, CreatePost, http.MethodPost, "/api/posts", gin.H{"content": "Not a spammer"}, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusCreated)
+	w = testRequest(t, SendMessage, http.MethodPost, "/api/message", gin.H{"chatId": chatID.Hex(), "content": "Not a spammer"}, alice.Hex(), nil)
+	expectStatus(t, w, http.StatusCreated)
+
+	// Blocked content leaves nothing behind
+	testRequest(t, CreatePost, http.MethodPost, "/api/posts", gin.H{"content": "spam"}, alice.Hex(), nil)
+	testRequest(t, SendMessage, http.MethodPost, "/api/message", gin.H{"chatId": chatID.Hex(), "content": "spam"}, alice.Hex(), nil)
+	if n, _ := database.Posts.CountDocuments(ctx, bson.M{"userId": alice}); n != 1 {
+		t.Errorf("%d posts stored, want 1", n)
+	}
+	if n, _ := database.Messages.CountDocuments(ctx, bson.M{"chatId": chatID}); n != 1 {
+		t.Errorf("%d messages stored, want 1", n)
+	}
+}
@@ -5,31 +5,112 @@ import (
     "log"
     "math"
     "net/http"
+    "strconv"
+    "strings"
     "time"
 
+    "coded/config"
     "coded/database"
     "coded/models"
 
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
-    "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// GetNearbyUsers finds users within a certain radius of the current user
+const (
+    // defaultNearbyRadiusMeters is how far GetNearbyUsers looks when neither
+    // ?radius= nor NEARBY_RADIUS_METERS is set
+    defaultNearbyRadiusMeters = 50000
+    // defaultMaxNearbyRadiusMeters caps ?radius=; override with
+    // NEARBY_MAX_RADIUS_METERS
+    defaultMaxNearbyRadiusMeters = 500000
+
+    // defaultNearbyLimit and maxNearbyLimit bound ?limit=; override with
+    // NEARBY_DEFAULT_LIMIT and NEARBY_MAX_LIMIT
+    defaultNearbyLimit = 50
+    maxNearbyLimit     = 100
+)
+
+// interestedInGenders maps interestedIn choices onto the gender values they
+// cover. Choices not listed are taken to be gender values themselves.
+var interestedInGenders = map[string][]string{
+    "men":   {"male"},
+    "women": {"female"},
+}
+
+// discoveryGenders turns interestedIn choices (or a ?gender= list) into the
+// gender values to match. nil means no filter: nothing was chosen, or
+// "everyone" was.
+func discoveryGenders(choices []string) []string {
+    var genders []string
+    for _, choice := range choices {
+        choice = strings.ToLower(strings.TrimSpace(choice))
+        if choice == "" {
+            continue
+        }
+        if choice == "everyone" {
+            return nil
+        }
+        if mapped, ok := interestedInGenders[choice]; ok {
+            genders = append(genders, mapped...)
+        } else {
+            genders = append(genders, choice)
+        }
+    }
+    return genders
+}
+
+// interestedInChoices lists the interestedIn values that take in gender: the
+// gender itself, the choices that map onto it, and "everyone"
+func interestedInChoices(gender string) []string {
+    gender = strings.ToLower(strings.TrimSpace(gender))
+    choices := []string{gender, "everyone"}
+    for choice, genders := range interestedInGenders {
+        for _, g := range genders {
+            if g == gender {
+                choices = append(choices, choice)
+            }
+        }
+    }
+    return choices
+}
+
+// GetNearbyUsers finds users within a certain radius of the current user,
+// nearest first. ?radius= (meters), ?skip= and ?limit= tune the search;
+// ?gender= (comma separated) overrides the caller's interestedIn preferences,
+// and ?minAge=/?maxAge= limit results to that age range. Without ?gender= the
+// match is mutual: only people open to the caller's gender are listed.
 func GetNearbyUsers(c *gin.Context) {
     log.Printf("[GetNearbyUsers] Request received")
     
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    // ?radius= is in meters
+    radius := float64(config.Int("NEARBY_RADIUS_METERS", defaultNearbyRadiusMeters))
+    if raw := c.Query("radius"); raw != "" {
+        r, err := strconv.ParseFloat(raw, 64)
+        if err != nil || r <= 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "radius must be a positive number of meters"})
+            return
+        }
+        radius = r
+    }
+    if maxRadius := float64(config.Int("NEARBY_MAX_RADIUS_METERS", defaultMaxNearbyRadiusMeters)); radius > maxRadius {
+        radius = maxRadius
+    }
+
+    ageFilter, ok := ageRangeFilter(c)
+    if !ok {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
 
     // Get current user's location
     var currentUser models.User
@@ -40,31 +121,57 @@ func GetNearbyUsers(c *gin.Context) {
     }
 
     // Check if current user has location data
-    if currentUser.Latitude == nil || currentUser.Longitude == nil ||
-        *currentUser.Latitude == 0 && *currentUser.Longitude == 0 {
+    if !hasLocation(&currentUser) {
         // User doesn't have location, return empty array
         log.Printf("[GetNearbyUsers] Current user has no location data")
         c.JSON(http.StatusOK, []interface{}{})
         return
     }
 
-    // Get all users except current user
-    cursor, err := usersColl.Find(ctx, bson.M{
-        "_id": bson.M{"$ne": userID},
-        "latitude": bson.M{"$exists": true, "$ne": nil},
-        "longitude": bson.M{"$exists": true, "$ne": nil},
-    })
+    blocked, err := blockedUserIDs(ctx, userID)
     if err != nil {
-        log.Printf("[GetNearbyUsers] Database error: %v", err)
+        log.Printf("[GetNearbyUsers] Block lookup error: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
         return
     }
-    defer cursor.Close(ctx)
 
-    var allUsers []models.User
-    if err = cursor.All(ctx, &allUsers); err != nil {
-        log.Printf("[GetNearbyUsers] Decode error: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users"})
+    // Everyone within range except current user and anyone blocked either
+    // way, narrowed to the genders asked for and to profiles discovery may
+    // show. Filtering happens in the query so pages come back full.
+    query := bson.M{"_id": bson.M{"$nin": append(blocked, userID)}}
+    genders := discoveryGenders(currentUser.InterestedIn)
+    raw, explicit := c.GetQuery("gender")
+    if explicit {
+        genders = discoveryGenders(strings.Split(raw, ","))
+    }
+    if len(genders) > 0 {
+        query["gender"] = bson.M{"$in": genders}
+    }
+    if !explicit && currentUser.Gender != "" {
+        // Under $and so it can't clash with the visibility $or
+        query["$and"] = bson.A{bson.M{"$or": bson.A{
+            bson.M{"interestedIn": bson.M{"$in": interestedInChoices(currentUser.Gender)}},
+            bson.M{"interestedIn.0": bson.M{"$exists": false}},
+        }}}
+    }
+    if ageFilter != nil {
+        query["birthDate"] = ageFilter
+    }
+    if visible := discoveryVisibleFilter(); visible != nil {
+        for k, v := range visible {
+            query[k] = v
+        }
+    }
+
+    skip, limit := pageParams(c,
+        config.Int("NEARBY_DEFAULT_LIMIT", defaultNearbyLimit),
+        config.Int("NEARBY_MAX_LIMIT", maxNearbyLimit),
+    )
+
+    allUsers, err := usersWithinRadius(ctx, &currentUser, radius, query, skip, limit)
+    if err != nil {
+        log.Printf("[GetNearbyUsers] Database error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
         return
     }
 
@@ -73,30 +180,26 @@ func GetNearbyUsers(c *gin.Context) {
     currentLon := *currentUser.Longitude
 
     log.Printf("[GetNearbyUsers] Current location: %f, %f", currentLat, currentLon)
-    log.Printf("[GetNearbyUsers] Found %d total users", len(allUsers))
+    log.Printf("[GetNearbyUsers] Found %d users in range", len(allUsers))
 
     for _, user := range allUsers {
-        if user.Latitude == nil || user.Longitude == nil ||
-            *user.Latitude == 0 && *user.Longitude == 0 {
-            continue
-        }
-
-        // Calculate distance using Haversine formula
-        distance := calculateDistance(currentLat, currentLon, *user.Latitude, *user.Longitude)
-        
-        // Filter users within 50km radius (adjust this as needed)
-        if distance <= 50.0 {
-            distanceMeters := math.Round(distance * 1000)
-            nearbyUsers = append(nearbyUsers, map[string]interface{}{
-                "id":       user.ID.Hex(),
-                "name":     user.Name,
-                "avatar":   user.Avatar,
-                "distance": distanceMeters,
-                "status":   user.Status,
-                "bio":      user.Bio,
-            })
-            log.Printf("[GetNearbyUsers] Found nearby user: %s (%fm)", user.Name, distanceMeters)
-        }
+        distanceMeters := math.Round(user.DistanceMeters)
+        nearbyUsers = append(nearbyUsers, map[string]interface{}{
+            "id":       user.ID.Hex(),
+            "name":     user.Name,
+            "avatar":   user.Avatar,
+            "distance": distanceMeters,
+            "status":   liveStatus(user.ID, user.Status),
+            "isOnline": isUserOnline(user.ID),
+            "bio":      user.Bio,
+            "gender":   user.Gender,
+            "age":      displayAge(user.BirthDate),
+            "interests": user.Interests,
+            "compatibility": compatibilityScore(currentUser.Interests, user.Interests),
+            "commonInterests": commonInterests(currentUser.Interests, user.Interests),
+            "isNew":    isNewUser(user.CreatedAt),
+        })
+        log.Printf("[GetNearbyUsers] Found nearby user: %s (%fm)", user.Name, distanceMeters)
     }
 
     log.Printf("[GetNearbyUsers] Returning %d nearby users", len(nearbyUsers))
@@ -109,19 +212,3 @@ func GetNearbyUsers(c *gin.Context) {
 
     c.JSON(http.StatusOK, nearbyUsers)
 }
-
-// calculateDistance calculates distance in kilometers using Haversine formula
-func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-    const R = 6371 // Earth's radius in kilometers
-    
-    dLat := (lat2 - lat1) * math.Pi / 180
-    dLon := (lon2 - lon1) * math.Pi / 180
-    
-    a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-        math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
-            math.Sin(dLon/2)*math.Sin(dLon/2)
-    
-    c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-    
-    return R * c
-}
\ No newline at end of file
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"coded/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// nearbyOrigin is far out at sea so users left by other tests never fall
+// inside the search
+const nearbyOriginLat, nearbyOriginLng = -45.0, -140.0
+
+// kmNorth is the latitude km kilometers north of the origin
+func kmNorth(km float64) float64 {
+	return nearbyOriginLat + km/111.195
+}
+
+// insertLocatedUser stores a user at lat/lng, with the GeoJSON location the
+// nearby query uses, plus any extra fields
+func insertLocatedUser(t *testing.T, ctx context.Context, lat, lng float64, fields bson.M) primitive.ObjectID {
+	t.Helper()
+	doc := bson.M{"latitude": lat, "longitude": lng, "location": models.NewGeoPoint(lat, lng)}
+	for k, v := range fields {
+		doc[k] = v
+	}
+	return insertTestUser(t, ctx, doc)
+}
+
+// getNearby returns the ids and distances GetNearbyUsers lists for userID
+func getNearby(t *testing.T, userID primitive.ObjectID, query url.Values) (ids []primitive.ObjectID, distances []float64) {
+	t.Helper()
+	w := testRequest(t, GetNearbyUsers, http.MethodGet, "/api/users/nearby?"+query.Encode(), nil, userID.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	var users []struct {
+		ID       string  `json:"id"`
+		Distance float64 `json:"distance"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	for _, u := range users {
+		id, err := primitive.ObjectIDFromHex(u.ID)
+		if err != nil {
+			t.Fatalf("bad id %q", u.ID)
+		}
+		ids = append(ids, id)
+		distances = append(distances, u.Distance)
+	}
+	return ids, distances
+}
+
+func TestGetNearbyUsersRadiusAndOrder(t *testing.T) {
+	ctx := requireDB(t)
+	viewer := insertLocatedUser(t, ctx, nearbyOriginLat, nearbyOriginLng, nil)
+	// Inserted out of order so the result order comes from the query
+	at20 := insertLocatedUser(t, ctx, kmNorth(20), nearbyOriginLng, nil)
+	at1 := insertLocatedUser(t, ctx, kmNorth(1), nearbyOriginLng, nil)
+	insertLocatedUser(t, ctx, kmNorth(80), nearbyOriginLng, nil)
+	at5 := insertLocatedUser(t, ctx, kmNorth(5), nearbyOriginLng, nil)
+	// Only the GeoJSON field is searched; bare coordinates don't count
+	insertTestUser(t, ctx, bson.M{"latitude": kmNorth(2), "longitude": nearbyOriginLng})
+
+	tests := []struct {
+		name   string
+		radius string
+		max    string
+		want   []primitive.ObjectID
+	}{
+		{"default radius", "", "", []primitive.ObjectID{at1, at5, at20}},
+		{"narrower radius", "10000", "", []primitive.ObjectID{at1, at5}},
+		{"radius capped at the maximum", "100000", "30000", []primitive.ObjectID{at1, at5, at20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.max != "" {
+				t.Setenv("NEARBY_MAX_RADIUS_METERS", tt.max)
+			}
+			query := url.Values{}
+			if tt.radius != "" {
+				query.Set("radius", tt.radius)
+			}
+			ids, distances := getNearby(t, viewer, query)
+			if len(ids) != len(tt.want) {
+				t.Fatalf("got %v, want %v", hexIDs(ids), hexIDs(tt.want))
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Errorf("got %v, want %v nearest first", hexIDs(ids), hexIDs(tt.want))
+					break
+				}
+			}
+			for i, want := range []float64{1000, 5000, 20000}[:len(ids)] {
+				if math.Abs(distances[i]-want) > want*0.01 {
+					t.Errorf("distance %d = %v m, want about %v m", i, distances[i], want)
+				}
+			}
+		})
+	}
+
+	for _, bad := range []string{"0", "-5", "far"} {
+		w := testRequest(t, GetNearbyUsers, http.MethodGet, "/api/users/nearby?radius="+bad, nil, viewer.Hex(), nil)
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+}
+
+func TestDiscoveryGenders(t *testing.T) {
+	tests := []struct {
+		choices []string
+		want    []string
+	}{
+		{nil, nil},
+		{[]string{"women"}, []string{"female"}},
+		{[]string{" Men ", "women"}, []string{"male", "female"}},
+		{[]string{"men", "everyone"}, nil},
+		{[]string{"nonbinary", ""}, []string{"nonbinary"}},
+	}
+	for _, tt := range tests {
+		if got := discoveryGenders(tt.choices); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("discoveryGenders(%q) = %q, want %q", tt.choices, got, tt.want)
+		}
+	}
+}
+
+func TestInterestedInChoices(t *testing.T) {
+	tests := map[string][]string{
+		"female":    {"everyone", "female", "women"},
+		"Male":      {"everyone", "male", "men"},
+		"nonbinary": {"everyone", "nonbinary"},
+	}
+	for gender, want := range tests {
+		got := interestedInChoices(gender)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("interestedInChoices(%q) = %q, want %q", gender, got, want)
+		}
+	}
+}
+
+func TestGetNearbyUsersMutualInterestAndPaging(t *testing.T) {
+	ctx := requireDB(t)
+	viewer := insertLocatedUser(t, ctx, nearbyOriginLat, nearbyOriginLng, bson.M{"gender": "male", "interestedIn": []string{"women"}})
+	person := func(km float64, gender string, interestedIn ...string) primitive.ObjectID {
+		fields := bson.M{"gender": gender}
+		if interestedIn != nil {
+			fields["interestedIn"] = interestedIn
+		}
+		return insertLocatedUser(t, ctx, kmNorth(km), nearbyOriginLng, fields)
+	}
+	wantsMen := person(1, "female", "men")
+	wantsEveryone := person(2, "female", "everyone")
+	noPreference := person(3, "female")
+	wantsWomen := person(4, "female", "women")
+	man := person(5, "male", "men")
+
+	tests := []struct {
+		name  string
+		query url.Values
+		max   string
+		want  []primitive.ObjectID
+	}{
+		{"mutual by default", url.Values{}, "", []primitive.ObjectID{wantsMen, wantsEveryone, noPreference}},
+		{"explicit gender skips the mutual check", url.Values{"gender": {"female"}}, "", []primitive.ObjectID{wantsMen, wantsEveryone, noPreference, wantsWomen}},
+		{"explicit gender overrides preferences", url.Values{"gender": {"male"}}, "", []primitive.ObjectID{man}},
+		{"first page", url.Values{"limit": {"2"}}, "", []primitive.ObjectID{wantsMen, wantsEveryone}},
+		{"last partial page", url.Values{"skip": {"2"}, "limit": {"2"}}, "", []primitive.ObjectID{noPreference}},
+		{"past the end", url.Values{"skip": {"3"}}, "", nil},
+		{"limit capped at the maximum", url.Values{"limit": {"50"}}, "2", []primitive.ObjectID{wantsMen, wantsEveryone}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.max != "" {
+				t.Setenv("NEARBY_MAX_LIMIT", tt.max)
+			}
+			ids, _ := getNearby(t, viewer, tt.query)
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("got %v, want %v", hexIDs(ids), hexIDs(tt.want))
+			}
+		})
+	}
+}
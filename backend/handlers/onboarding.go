@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetOnboardingStatus reports whether the caller has finished onboarding and
+// how complete their profile is
+func GetOnboardingStatus(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+
+	var user models.User
+	err = usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	completeness, missing := user.ProfileCompleteness()
+	c.JSON(http.StatusOK, gin.H{
+		"completed":     user.HasCompletedOnboarding(),
+		"completeness":  completeness,
+		"missingFields": missing,
+	})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetOnboardingStatus(t *testing.T) {
+	ctx := requireDB(t)
+	status := func(userID primitive.ObjectID) map[string]interface{} {
+		t.Helper()
+		w := testRequest(t, GetOnboardingStatus, http.MethodGet, "/api/me/onboarding", nil, userID.Hex(), nil)
+		expectStatus(t, w, http.StatusOK)
+		return decodeBody(t, w)
+	}
+	missing := func(body map[string]interface{}) []string {
+		var fields []string
+		for _, f := range body["missingFields"].([]interface{}) {
+			fields = append(fields, f.(string))
+		}
+		return fields
+	}
+
+	// Onboarding done, but no photos, bio, interests, birth date or location
+	onboarded := insertTestUser(t, ctx, bson.M{"name": "Ada", "gender": "female", "interestedIn": bson.A{"male"}})
+	body := status(onboarded)
+	if body["completed"] != true || body["completeness"] != float64(35) {
+		t.Errorf("onboarded user = %v, want completed at 35%%", body)
+	}
+	if got, want := missing(body), []string{"photos", "bio", "interests", "birthDate", "location"}; !slices.Equal(got, want) {
+		t.Errorf("missingFields = %v, want %v", got, want)
+	}
+
+	// A photo and interests outweigh the gender and interestedIn choices,
+	// but onboarding still isn't complete without them
+	partial := insertTestUser(t, ctx, bson.M{"name": "Bo", "photos": bson.A{"p.jpg"}, "interests": bson.A{"Music"}})
+	body = status(partial)
+	if body["completed"] != false || body["completeness"] != float64(50) {
+		t.Errorf("partial user = %v, want not completed at 50%%", body)
+	}
+
+	w := testRequest(t, GetOnboardingStatus, http.MethodGet, "/api/me/onboarding", nil, primitive.NewObjectID().Hex(), nil)
+	expectStatus(t, w, http.StatusNotFound)
+}
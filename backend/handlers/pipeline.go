@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// publicUserFields are the user fields joined into list responses
+var publicUserFields = bson.D{
+	{Key: "name", Value: 1},
+	{Key: "avatar", Value: 1},
+	{Key: "status", Value: 1},
+	{Key: "bio", Value: 1},
+}
+
+// pageParams reads ?skip= and ?limit= for list endpoints. A missing or
+// invalid limit uses defaultLimit; anything above maxLimit is clamped.
+func pageParams(c *gin.Context, defaultLimit, maxLimit int) (skip, limit int64) {
+	limit = int64(defaultLimit)
+	if n, err := strconv.ParseInt(c.Query("limit"), 10, 64); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > int64(maxLimit) {
+		limit = int64(maxLimit)
+	}
+
+	if n, err := strconv.ParseInt(c.Query("skip"), 10, 64); err == nil && n > 0 {
+		skip = n
+	}
+	return skip, limit
+}
+
+// pagedPipeline starts a list aggregation: match, sort, then skip/limit when
+// they are positive
+func pagedPipeline(match, sort bson.D, skip, limit int64) mongo.Pipeline {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: sort}},
+	}
+	if skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: skip}})
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	return pipeline
+}
+
+// pageCursor is a position in a list ordered by (createdAt, _id). createdAt
+// has second resolution, so _id breaks ties between documents created in
+// the same second. It travels as "<createdAt>_<id hex>".
+type pageCursor struct {
+	CreatedAt int64
+	ID        primitive.ObjectID
+}
+
+// cursorFor returns the cursor of a raw document with createdAt and _id
+func cursorFor(doc bson.M) pageCursor {
+	createdAt, _ := doc["createdAt"].(int64)
+	id, _ := doc["_id"].(primitive.ObjectID)
+	return pageCursor{CreatedAt: createdAt, ID: id}
+}
+
+func (p pageCursor) String() string {
+	return strconv.FormatInt(p.CreatedAt, 10) + "_" + p.ID.Hex()
+}
+
+// parsePageCursor decodes a cursor produced by pageCursor.String
+func parsePageCursor(s string) (pageCursor, bool) {
+	ts, hex, found := strings.Cut(s, "_")
+	if !found {
+		return pageCursor{}, false
+	}
+	createdAt, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return pageCursor{}, false
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return pageCursor{}, false
+	}
+	return pageCursor{CreatedAt: createdAt, ID: id}, true
+}
+
+// after matches documents that sort after the cursor in ascending order
+func (p pageCursor) after() bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"createdAt": bson.M{"$gt": p.CreatedAt}},
+		bson.M{"createdAt": p.CreatedAt, "_id": bson.M{"$gt": p.ID}},
+	}}
+}
+
+// before matches documents that sort before the cursor in ascending order,
+// i.e. after it in a newest-first list
+func (p pageCursor) before() bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"createdAt": bson.M{"$lt": p.CreatedAt}},
+		bson.M{"createdAt": p.CreatedAt, "_id": bson.M{"$lt": p.ID}},
+	}}
+}
+
+// withUserJoin appends a join of the user referenced by localField into the
+// field named as. Only the given fields are fetched (nil fetches the whole
+// document). Documents whose user no longer exists are kept with as missing,
+// so callers can fall back via publicProfile.
+func withUserJoin(pipeline mongo.Pipeline, localField, as string, fields bson.D) mongo.Pipeline {
+	userPipeline := bson.A{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "$expr", Value: bson.D{
+			{Key: "$eq", Value: bson.A{"$_id", "$$joinId"}},
+		}}}}},
+	}
+	if fields != nil {
+		userPipeline = append(userPipeline, bson.D{{Key: "$project", Value: fields}})
+	}
+
+	return append(pipeline,
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: database.Users.Name()},
+			{Key: "let", Value: bson.D{{Key: "joinId", Value: "$" + localField}}},
+			{Key: "pipeline", Value: userPipeline},
+			{Key: "as", Value: as},
+		}}},
+		bson.D{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$" + as},
+			{Key: "preserveNullAndEmptyArrays", Value: true},
+		}}},
+	)
+}
+
+// publicProfile renders a joined user for list responses, filling in the
+// standard placeholders for missing users or empty fields
+func publicProfile(id primitive.ObjectID, u *models.User) models.PublicProfile {
+	profile := models.PublicProfile{
+		ID:     id.Hex(),
+		Name:   "Unknown User",
+		Avatar: fallbackAvatar,
+		Status: "offline",
+	}
+	if id.IsZero() {
+		profile.ID = ""
+	}
+
+	if u != nil {
+		if u.Name != "" {
+			profile.Name = u.Name
+		}
+		if u.Avatar != "" {
+			profile.Avatar = u.Avatar
+		}
+		if u.Status != "" {
+			profile.Status = u.Status
+		}
+		if u.Bio != "" {
+			profile.Bio = u.Bio
+		}
+	}
+	if !id.IsZero() {
+		profile.Status = liveStatus(id, profile.Status)
+		profile.IsOnline = isUserOnline(id)
+	}
+
+	return profile
+}
+
+// postWithUser is a post with its author joined by withUserJoin(..., "userId", "user", ...)
+type postWithUser struct {
+	models.Post `bson:",inline"`
+	User        *models.User `bson:"user"`
+	LikeCount   int          `bson:"likeCount"`
+	LikedByMe   bool         `bson:"likedByMe"`
+}
+
+// loadPublicProfiles fetches the public fields of the given users keyed by
+// id. Missing users are simply absent; memberProfiles fills them in.
+func loadPublicProfiles(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.User, error) {
+	profiles := make(map[primitive.ObjectID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return profiles, nil
+	}
+
+	usersColl := database.Users
+	cursor, err := usersColl.Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(publicUserFields),
+	)
+	if err != nil {
+		return profiles, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return profiles, err
+	}
+	for i := range users {
+		profiles[users[i].ID] = &users[i]
+	}
+	return profiles, nil
+}
+
+// memberProfiles renders publicProfile for each id, in order
+func memberProfiles(ids []primitive.ObjectID, users map[primitive.ObjectID]*models.User) []models.PublicProfile {
+	profiles := make([]models.PublicProfile, len(ids))
+	for i, id := range ids {
+		profiles[i] = publicProfile(id, users[id])
+	}
+	return profiles
+}
+
+// hexIDs converts ObjectIDs to their hex strings
+func hexIDs(ids []primitive.ObjectID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.Hex()
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	want := pageCursor{CreatedAt: 1_700_000_000, ID: primitive.NewObjectID()}
+	got, ok := parsePageCursor(want.String())
+	if !ok || got != want {
+		t.Errorf("parsePageCursor(%q) = %v, %v; want %v", want.String(), got, ok, want)
+	}
+
+	if c := cursorFor(bson.M{"createdAt": want.CreatedAt, "_id": want.ID}); c != want {
+		t.Errorf("cursorFor = %v, want %v", c, want)
+	}
+}
+
+func TestParsePageCursorRejectsGarbage(t *testing.T) {
+	for _, s := range []string{"", "123", "abc_" + primitive.NewObjectID().Hex(), "123_nothex", primitive.NewObjectID().Hex()} {
+		if _, ok := parsePageCursor(s); ok {
+			t.Errorf("parsePageCursor(%q) accepted", s)
+		}
+	}
+}
+
+func TestPagedPipeline(t *testing.T) {
+	match := bson.D{{Key: "userId", Value: "u1"}}
+	sort := bson.D{{Key: "createdAt", Value: -1}}
+	stages := func(extra ...bson.D) mongo.Pipeline {
+		return append(mongo.Pipeline{{{Key: "$match", Value: match}}, {{Key: "$sort", Value: sort}}}, extra...)
+	}
+
+	tests := []struct {
+		name        string
+		skip, limit int64
+		want        mongo.Pipeline
+	}{
+		{"no paging", 0, 0, stages()},
+		{"limit only", 0, 20, stages(bson.D{{Key: "$limit", Value: int64(20)}})},
+		{"skip only", 40, 0, stages(bson.D{{Key: "$skip", Value: int64(40)}})},
+		{"skip then limit", 40, 20, stages(bson.D{{Key: "$skip", Value: int64(40)}}, bson.D{{Key: "$limit", Value: int64(20)}})},
+		{"negative values", -1, -5, stages()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pagedPipeline(match, sort, tt.skip, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pagedPipeline(skip %d, limit %d) = %v, want %v", tt.skip, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+// useUsersCollection gives withUserJoin a users collection to name when no
+// test database is connected. The client is never used, so it never dials.
+func useUsersCollection(t *testing.T) {
+	t.Helper()
+	if database.Users != nil {
+		return
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	database.Users = client.Database("coded_test").Collection("users")
+	t.Cleanup(func() {
+		database.Users = nil
+		client.Disconnect(context.Background())
+	})
+}
+
+func TestWithUserJoin(t *testing.T) {
+	useUsersCollection(t)
+	base := pagedPipeline(bson.D{}, bson.D{{Key: "createdAt", Value: -1}}, 0, 10)
+	matchUser := bson.D{{Key: "$match", Value: bson.D{{Key: "$expr", Value: bson.D{
+		{Key: "$eq", Value: bson.A{"$_id", "$$joinId"}},
+	}}}}}
+	join := func(userPipeline bson.A) mongo.Pipeline {
+		return append(append(mongo.Pipeline{}, base...),
+			bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "users"},
+				{Key: "let", Value: bson.D{{Key: "joinId", Value: "$userId"}}},
+				{Key: "pipeline", Value: userPipeline},
+				{Key: "as", Value: "user"},
+			}}},
+			bson.D{{Key: "$unwind", Value: bson.D{
+				{Key: "path", Value: "$user"},
+				{Key: "preserveNullAndEmptyArrays", Value: true},
+			}}},
+		)
+	}
+
+	got := withUserJoin(append(mongo.Pipeline{}, base...), "userId", "user", publicUserFields)
+	if want := join(bson.A{matchUser, bson.D{{Key: "$project", Value: publicUserFields}}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("withUserJoin with fields = %v, want %v", got, want)
+	}
+
+	got = withUserJoin(append(mongo.Pipeline{}, base...), "userId", "user", nil)
+	if want := join(bson.A{matchUser}); !reflect.DeepEqual(got, want) {
+		t.Errorf("withUserJoin without fields = %v, want %v", got, want)
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		query       string
+		skip, limit int64
+	}{
+		{"", 0, 20},
+		{"limit=5", 0, 5},
+		{"limit=100", 0, 50},
+		{"limit=50", 0, 50},
+		{"limit=0", 0, 20},
+		{"limit=-3", 0, 20},
+		{"limit=ten", 0, 20},
+		{"limit=2.5", 0, 20},
+		{"skip=40&limit=10", 40, 10},
+		{"skip=-1", 0, 20},
+		{"skip=x", 0, 20},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		if skip, limit := pageParams(c, 20, 50); skip != tt.skip || limit != tt.limit {
+			t.Errorf("pageParams(%q) = %d, %d; want %d, %d", tt.query, skip, limit, tt.skip, tt.limit)
+		}
+	}
+}
+
+func TestPublicProfileKeepsPrivateFieldsOut(t *testing.T) {
+	hash, googleID, lat, lng := "$2a$10$secrethash", "google-sub-123", -1.29, 36.82
+	user := &models.User{
+		ID:                    primitive.NewObjectID(),
+		Email:                 "private@example.com",
+		PasswordHash:          &hash,
+		GoogleID:              &googleID,
+		Role:                  "admin",
+		Name:                  "Ada",
+		Avatar:                "https://example.com/a.jpg",
+		Bio:                   "hello",
+		Status:                "busy",
+		BirthDate:             631152000,
+		Latitude:              &lat,
+		Longitude:             &lng,
+		VerificationTokenHash: "tokenhash",
+		ReferralCode:          "REF12345",
+	}
+
+	raw, err := json.Marshal(publicProfile(user.ID, user))
+	if err != nil {
+		t.Fatalf("encoding profile: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatalf("decoding profile: %v", err)
+	}
+	want := []string{"avatar", "bio", "id", "isOnline", "name", "status"}
+	got := make([]string, 0, len(fields))
+	for k := range fields {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("profile fields = %v, want only %v", got, want)
+	}
+	for _, secret := range []string{user.Email, hash, googleID, "tokenhash", "REF12345", "631152000", "admin"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("profile JSON %s leaks %q", raw, secret)
+		}
+	}
+
+	// The join projection never loads them in the first place
+	public := map[string]bool{"name": true, "avatar": true, "status": true, "bio": true}
+	for _, field := range publicUserFields {
+		if !public[field.Key] {
+			t.Errorf("publicUserFields projects %q", field.Key)
+		}
+	}
+}
@@ -2,23 +2,70 @@ package handlers
 
 import (
     "context"
-    "fmt"
     "log"
-    "math"
     "net/http"
+    "strconv"
+    "strings"
     "time"
 
+    "coded/config"
     "coded/database"
     "coded/models"
+    "coded/websocket"
 
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // fallbackAvatar is now in user.go - DO NOT declare it here
 
+// defaultPostCooldown is the minimum gap between a user's posts; override
+// with POST_COOLDOWN, where 0 turns the cooldown off
+const defaultPostCooldown = 30 * time.Second
+
+// claimPostSlot records a new post time for userID unless they posted less
+// than cooldown ago, in which case it returns how many seconds they have to
+// wait. The check and the write are one update, so parallel requests can't
+// both get through.
+func claimPostSlot(ctx context.Context, userID primitive.ObjectID, cooldown time.Duration) (int64, error) {
+    now := time.Now()
+    usersColl := database.Users
+
+    result, err := usersColl.UpdateOne(ctx,
+        bson.M{
+            "_id": userID,
+            "$or": bson.A{
+                bson.M{"lastPostAt": bson.M{"$exists": false}},
+                bson.M{"lastPostAt": bson.M{"$lte": now.Add(-cooldown).Unix()}},
+            },
+        },
+        bson.M{"$set": bson.M{"lastPostAt": now.Unix()}},
+    )
+    if err != nil {
+        return 0, err
+    }
+    if result.MatchedCount > 0 {
+        return 0, nil
+    }
+
+    var user models.User
+    err = usersColl.FindOne(ctx, bson.M{"_id": userID},
+        options.FindOne().SetProjection(bson.M{"lastPostAt": 1}),
+    ).Decode(&user)
+    if err != nil {
+        return 0, err
+    }
+
+    retryAfter := user.LastPostAt + int64(cooldown.Seconds()) - now.Unix()
+    if retryAfter < 1 {
+        retryAfter = 1
+    }
+    return retryAfter, nil
+}
+
 type CreatePostRequest struct {
     Content  string   `json:"content" binding:"required"`
     Media    []string `json:"media"`
@@ -32,17 +79,37 @@ func CreatePost(c *gin.Context) {
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    if !moderateContent(c, req.Content) {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    postsColl := database.Client.Database("coded").Collection("posts")
+    if cooldown := config.Duration("POST_COOLDOWN", defaultPostCooldown); cooldown > 0 {
+        retryAfter, err := claimPostSlot(ctx, userID, cooldown)
+        if err != nil {
+            log.Printf("CreatePost cooldown check error: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
+            return
+        }
+        if retryAfter > 0 {
+            c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+            c.JSON(http.StatusTooManyRequests, gin.H{
+                "error":      "You're posting too fast",
+                "code":       "POST_COOLDOWN",
+                "retryAfter": retryAfter,
+            })
+            return
+        }
+    }
+
+    postsColl := database.Posts
 
     post := models.Post{
         ID:        primitive.NewObjectID(),
@@ -60,33 +127,120 @@ func CreatePost(c *gin.Context) {
         return
     }
 
+    notifyNewPost(ctx, post)
+
     c.JSON(http.StatusCreated, gin.H{
         "message": "Post created successfully",
         "postId":  post.ID.Hex(),
     })
 }
 
-func haversine(lat1, lon1, lat2, lon2 float64) float64 {
-    const R = 6371
-    dLat := (lat2 - lat1) * math.Pi / 180
-    dLon := (lon2 - lon1) * math.Pi / 180
-    a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
-    c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-    return R * c
+// defaultLiveFeedRadiusKm is how close a feed subscriber must be to a post's
+// author to get it live; override with FEED_LIVE_RADIUS_KM
+const defaultLiveFeedRadiusKm = 50
+
+// notifyNewPost sends a new_post event to feed subscribers within range of
+// the author. Each recipient gets the post shaped like a GetFeed item, so the
+// distance and compatibility are relative to them. Subscribers without a
+// location see every post, matching the feed's "Nearby" policy.
+func notifyNewPost(ctx context.Context, post models.Post) {
+    if wsManager == nil {
+        return
+    }
+
+    subscribers := wsManager.FeedSubscribers()
+    if len(subscribers) == 0 {
+        return
+    }
+
+    blocked, err := blockedUserIDs(ctx, post.UserID)
+    if err != nil {
+        log.Printf("[notifyNewPost] Failed to load blocks for %s: %v", post.UserID.Hex(), err)
+        return
+    }
+    excluded := map[primitive.ObjectID]bool{post.UserID: true}
+    for _, id := range blocked {
+        excluded[id] = true
+    }
+
+    var subscriberIDs []primitive.ObjectID
+    for _, id := range subscribers {
+        oid, err := primitive.ObjectIDFromHex(id)
+        if err == nil && !excluded[oid] {
+            subscriberIDs = append(subscriberIDs, oid)
+        }
+    }
+    if len(subscriberIDs) == 0 {
+        return
+    }
+
+    usersColl := database.Users
+
+    var author models.User
+    if err := usersColl.FindOne(ctx, bson.M{"_id": post.UserID}).Decode(&author); err != nil {
+        log.Printf("[notifyNewPost] Failed to load author %s: %v", post.UserID.Hex(), err)
+        return
+    }
+    if !visibleInDiscovery(&author) {
+        return
+    }
+
+    cursor, err := usersColl.Find(ctx, bson.M{"_id": bson.M{"$in": subscriberIDs}})
+    if err != nil {
+        log.Printf("[notifyNewPost] Failed to load subscribers: %v", err)
+        return
+    }
+    var viewers []models.User
+    if err := cursor.All(ctx, &viewers); err != nil {
+        log.Printf("[notifyNewPost] Failed to decode subscribers: %v", err)
+        return
+    }
+
+    radius := float64(config.Int("FEED_LIVE_RADIUS_KM", defaultLiveFeedRadiusKm))
+    for i := range viewers {
+        viewer := &viewers[i]
+        if hasLocation(viewer) && (!hasLocation(&author) || cachedDistance(viewer, &author) > radius) {
+            continue
+        }
+
+        wsManager.SendFeedEvent(viewer.ID.Hex(), websocket.Event{
+            Type: "new_post",
+            Payload: map[string]interface{}{
+                "id":              post.ID.Hex(),
+                "user":            author,
+                "content":         post.Content,
+                "category":        post.Category,
+                "createdAt":       post.CreatedAt,
+                "age":             displayAge(author.BirthDate),
+                "distance":        distanceLabel(viewer, &author),
+                "compatibility":   compatibilityScore(viewer.Interests, author.Interests),
+                "commonInterests": commonInterests(viewer.Interests, author.Interests),
+                "isNew":           isNewUser(author.CreatedAt),
+            },
+        })
+    }
 }
 
+// Feed page sizes; override with FEED_DEFAULT_LIMIT and FEED_MAX_LIMIT
+const (
+    defaultFeedLimit = 20
+    maxFeedLimit     = 100
+)
+
+// defaultFeedRadiusKm bounds GetFeed when neither ?radius= nor
+// FEED_RADIUS_KM is set; 0 means no bound
+const defaultFeedRadiusKm = 0
+
 func GetFeed(c *gin.Context) {
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
 
     var currentUser models.User
     err = usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&currentUser)
@@ -95,87 +249,255 @@ func GetFeed(c *gin.Context) {
         return
     }
 
-    hasLocation := currentUser.Latitude != nil && currentUser.Longitude != nil && *currentUser.Latitude != 0 && *currentUser.Longitude != 0
+    blocked, err := blockedUserIDs(ctx, userID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+        return
+    }
+
+    ageFilter, ok := ageRangeFilter(c)
+    if !ok {
+        return
+    }
+
+    authorFilter := bson.M{"$nin": append(blocked, userID)}
+    authorQuery := bson.M{"_id": bson.M{"$nin": append(blocked, userID)}}
+    if ageFilter != nil {
+        authorQuery["birthDate"] = ageFilter
+    }
+
+    // Bound the feed geographically when a radius is set. Authors without a
+    // location are left out; a viewer without one sees everything, matching
+    // distanceLabel calling everyone "Nearby" for them.
+    radius := float64(config.Int("FEED_RADIUS_KM", defaultFeedRadiusKm))
+    if r, err := strconv.ParseFloat(c.Query("radius"), 64); err == nil && r >= 0 {
+        radius = r
+    }
+    if radius > 0 && hasLocation(&currentUser) {
+        authors, err := usersWithinRadius(ctx, &currentUser, radius*1000, authorQuery, 0, 0)
+        if err != nil {
+            log.Printf("GetFeed radius lookup error: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+            return
+        }
+        authorIDs := make([]primitive.ObjectID, len(authors))
+        for i, author := range authors {
+            authorIDs[i] = author.ID
+        }
+        authorFilter = bson.M{"$in": authorIDs}
+    } else if ageFilter != nil {
+        // No radius to narrow by, so look up the authors in the age range
+        authorIDs, err := aggregateIDs(ctx, usersColl, mongo.Pipeline{
+            {{Key: "$match", Value: authorQuery}},
+            {{Key: "$project", Value: bson.M{"_id": 1}}},
+        })
+        if err != nil {
+            log.Printf("GetFeed age lookup error: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+            return
+        }
+        authorFilter = bson.M{"$in": authorIDs}
+    }
+
+    postsColl := database.Posts
+
+    skip, limit := pageParams(c,
+        config.Int("FEED_DEFAULT_LIMIT", defaultFeedLimit),
+        config.Int("FEED_MAX_LIMIT", maxFeedLimit),
+    )
 
-    postsColl := database.Client.Database("coded").Collection("posts")
+    match := bson.D{{Key: "userId", Value: authorFilter}}
 
-    cursor, err := postsColl.Find(ctx, bson.M{"userId": bson.M{"$ne": userID}})
+    // ?before= continues after the cursor returned as nextCursor. The cursor
+    // already says where the page starts, so skip is ignored alongside it.
+    if before := c.Query("before"); before != "" {
+        position, ok, err := parseFeedCursor(ctx, before)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+            return
+        }
+        if !ok {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor", "code": "INVALID_CURSOR"})
+            return
+        }
+        match = append(match, bson.E{Key: "$and", Value: bson.A{position.before()}})
+        skip = 0
+    }
+
+    // One extra post tells us whether there is another page. Authors come
+    // from the same aggregation, so a page costs one round trip whatever
+    // its size.
+    pipeline := pagedPipeline(match,
+        bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+        skip, limit+1,
+    )
+    pipeline = withUserJoin(pipeline, "userId", "user", nil)
+    pipeline = withLikes(pipeline, userID)
+
+    cursor, err := postsColl.Aggregate(ctx, pipeline)
     if err != nil {
+        log.Printf("GetFeed aggregate error: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
         return
     }
     defer cursor.Close(ctx)
 
-    var posts []bson.M
+    var posts []postWithUser
     if err = cursor.All(ctx, &posts); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode posts"})
         return
     }
 
+    hasMore := int64(len(posts)) > limit
+    if hasMore {
+        posts = posts[:limit]
+    }
+    // Take the cursor before reordering so the next page starts after the
+    // oldest post of this one
+    var nextCursor interface{}
+    if hasMore {
+        last := posts[len(posts)-1]
+        nextCursor = pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+    }
+
+    posts = diversifyByAuthor(posts, config.Int("FEED_MAX_CONSECUTIVE_PER_AUTHOR", defaultFeedMaxConsecutive))
+
     var result []map[string]interface{}
     for _, post := range posts {
-        userIDObj, ok := post["userId"].(primitive.ObjectID)
-        if !ok {
+        // Skip posts whose author was deleted
+        if post.User == nil || !visibleInDiscovery(post.User) {
             continue
         }
+        user := *post.User
+        user.Status = liveStatus(user.ID, user.Status)
 
-        var user models.User
-        err = usersColl.FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user)
-        if err != nil {
-            continue
+        postMap := map[string]interface{}{
+            "id":        post.ID,
+            "user":      user,
+            "content":   post.Content,
+            "category":  post.Category,
+            "createdAt": post.CreatedAt,
+            "age":       displayAge(user.BirthDate),
+            "likeCount": post.LikeCount,
+            "likedByMe": post.LikedByMe,
+            "distance":  distanceLabel(&currentUser, &user),
+            "isOnline":  isUserOnline(user.ID),
+            "compatibility": compatibilityScore(currentUser.Interests, user.Interests),
+            "commonInterests": commonInterests(currentUser.Interests, user.Interests),
+            "isNew":     isNewUser(user.CreatedAt),
         }
+        result = append(result, postMap)
+    }
+    if result == nil {
+        result = []map[string]interface{}{}
+    }
 
-        var distStr string
-        if !hasLocation {
-            distStr = "Nearby"
-        } else if user.Latitude == nil || user.Longitude == nil || *user.Latitude == 0 && *user.Longitude == 0 {
-            distStr = "Unknown"
-        } else {
-            distance := haversine(*currentUser.Latitude, *currentUser.Longitude, *user.Latitude, *user.Longitude)
-            distStr = fmt.Sprintf("%.0f km away", distance)
+    c.JSON(http.StatusOK, gin.H{
+        "posts":      result,
+        "hasMore":    hasMore,
+        "nextCursor": nextCursor,
+    })
+}
+
+// parseFeedCursor resolves ?before= to a position in the feed. Besides the
+// "<createdAt>_<id>" cursors GetFeed returns it accepts the older forms, a
+// post id or a createdAt timestamp. A post id whose post has since been
+// deleted falls back to the creation time embedded in the id rather than
+// failing the page.
+func parseFeedCursor(ctx context.Context, before string) (pageCursor, bool, error) {
+    if position, ok := parsePageCursor(before); ok {
+        return position, true, nil
+    }
+    if ts, err := strconv.ParseInt(before, 10, 64); err == nil {
+        // No id sorts below the zero id, so this is createdAt < ts
+        return pageCursor{CreatedAt: ts}, true, nil
+    }
+    postID, err := primitive.ObjectIDFromHex(before)
+    if err != nil {
+        return pageCursor{}, false, nil
+    }
+
+    var post models.Post
+    err = database.Posts.FindOne(ctx, bson.M{"_id": postID},
+        options.FindOne().SetProjection(bson.M{"createdAt": 1}),
+    ).Decode(&post)
+    if err == mongo.ErrNoDocuments {
+        return pageCursor{CreatedAt: postID.Timestamp().Unix(), ID: postID}, true, nil
+    }
+    if err != nil {
+        return pageCursor{}, false, err
+    }
+    return pageCursor{CreatedAt: post.CreatedAt, ID: postID}, true, nil
+}
+
+// defaultFeedMaxConsecutive is how many posts from one author may appear in a
+// row before other authors are interleaved
+const defaultFeedMaxConsecutive = 2
+
+// diversifyByAuthor reorders posts so no author has more than maxRun posts in
+// a row, pulling the next post from a different author forward. Relative
+// order is otherwise kept. When only one author's posts remain they are
+// appended as-is. maxRun <= 0 disables the cap.
+func diversifyByAuthor(posts []postWithUser, maxRun int) []postWithUser {
+    if maxRun <= 0 || len(posts) <= maxRun {
+        return posts
+    }
+
+    pending := posts
+    result := make([]postWithUser, 0, len(posts))
+    var lastAuthor primitive.ObjectID
+    run := 0
+
+    for len(pending) > 0 {
+        pick := 0
+        if run >= maxRun {
+            for i, post := range pending {
+                if post.UserID != lastAuthor {
+                    pick = i
+                    break
+                }
+            }
         }
 
-        postMap := map[string]interface{}{
-            "id":        post["_id"],
-            "user":      user,
-            "content":   post["content"],
-            "category":  post["category"],
-            "createdAt": post["createdAt"],
-            "distance":  distStr,
+        post := pending[pick]
+        pending = append(pending[:pick:pick], pending[pick+1:]...) // copy, don't clobber posts
+        result = append(result, post)
+
+        if post.UserID == lastAuthor {
+            run++
+        } else {
+            lastAuthor = post.UserID
+            run = 1
         }
-        result = append(result, postMap)
     }
 
-    c.JSON(http.StatusOK, result)
+    return result
 }
 
 func GetUserPosts(c *gin.Context) {
     userIDStr := c.Param("id")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := parseObjectID(c, userIDStr, "user ID")
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    viewerID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    postsColl := database.Client.Database("coded").Collection("posts")
+    postsColl := database.Posts
 
-    pipeline := mongo.Pipeline{
-        {{"$match", bson.D{{"userId", userID}}}},
-        {{"$sort", bson.D{{"createdAt", -1}}}},
-        {{"$lookup", bson.D{
-            {"from", "users"},
-            {"localField", "userId"},
-            {"foreignField", "_id"},
-            {"as", "user"},
-        }}},
-        {{"$unwind", bson.D{
-            {"path", "$user"},
-            {"preserveNullAndEmptyArrays", true},
-        }}},
-    }
+    pipeline := pagedPipeline(
+        bson.D{{Key: "userId", Value: userID}},
+        bson.D{{Key: "createdAt", Value: -1}},
+        0, 0,
+    )
+    pipeline = withUserJoin(pipeline, "userId", "user", publicUserFields)
+    pipeline = withLikes(pipeline, viewerID)
 
     cursor, err := postsColl.Aggregate(ctx, pipeline)
     if err != nil {
@@ -185,10 +507,7 @@ func GetUserPosts(c *gin.Context) {
     }
     defer cursor.Close(ctx)
 
-    var posts []struct {
-        models.Post         `bson:",inline"`
-        User                *models.User `bson:"user"`
-    }
+    var posts []postWithUser
     if err := cursor.All(ctx, &posts); err != nil {
         log.Printf("GetUserPosts decode error: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode posts"})
@@ -197,36 +516,15 @@ func GetUserPosts(c *gin.Context) {
 
     response := make([]map[string]interface{}, len(posts))
     for i, p := range posts {
-        userMap := map[string]interface{}{
-            "id":     p.UserID.Hex(),
-            "name":   "Unknown User",
-            "avatar": fallbackAvatar,
-            "status": "offline",
-            "bio":    "",
-        }
-
-        if p.User != nil {
-            if p.User.Name != "" {
-                userMap["name"] = p.User.Name
-            }
-            if p.User.Avatar != "" {
-                userMap["avatar"] = p.User.Avatar
-            }
-            if p.User.Status != "" {
-                userMap["status"] = p.User.Status
-            }
-            if p.User.Bio != "" {
-                userMap["bio"] = p.User.Bio
-            }
-        }
-
         response[i] = map[string]interface{}{
             "id":        p.ID.Hex(),
             "content":   p.Content,
             "media":     p.Media,
             "category":  p.Category,
             "createdAt": p.CreatedAt,
-            "user":      userMap,
+            "likeCount": p.LikeCount,
+            "likedByMe": p.LikedByMe,
+            "user":      publicProfile(p.UserID, p.User),
         }
     }
 
@@ -234,32 +532,23 @@ func GetUserPosts(c *gin.Context) {
 }
 
 func GetMyPosts(c *gin.Context) {
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    postsColl := database.Client.Database("coded").Collection("posts")
+    postsColl := database.Posts
 
-    pipeline := mongo.Pipeline{
-        {{"$match", bson.D{{"userId", userID}}}},
-        {{"$sort", bson.D{{"createdAt", -1}}}},
-        {{"$lookup", bson.D{
-            {"from", "users"},
-            {"localField", "userId"},
-            {"foreignField", "_id"},
-            {"as", "user"},
-        }}},
-        {{"$unwind", bson.D{
-            {"path", "$user"},
-            {"preserveNullAndEmptyArrays", true},
-        }}},
-    }
+    pipeline := pagedPipeline(
+        bson.D{{Key: "userId", Value: userID}},
+        bson.D{{Key: "createdAt", Value: -1}},
+        0, 0,
+    )
+    pipeline = withUserJoin(pipeline, "userId", "user", publicUserFields)
+    pipeline = withLikes(pipeline, userID)
 
     cursor, err := postsColl.Aggregate(ctx, pipeline)
     if err != nil {
@@ -269,10 +558,7 @@ func GetMyPosts(c *gin.Context) {
     }
     defer cursor.Close(ctx)
 
-    var posts []struct {
-        models.Post         `bson:",inline"`
-        User                *models.User `bson:"user"`
-    }
+    var posts []postWithUser
     if err := cursor.All(ctx, &posts); err != nil {
         log.Printf("GetMyPosts decode error: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode posts"})
@@ -281,38 +567,158 @@ func GetMyPosts(c *gin.Context) {
 
     response := make([]map[string]interface{}, len(posts))
     for i, p := range posts {
-        userMap := map[string]interface{}{
-            "id":     p.UserID.Hex(),
-            "name":   "Unknown User",
-            "avatar": fallbackAvatar,
-            "status": "offline",
-            "bio":    "",
-        }
-
-        if p.User != nil {
-            if p.User.Name != "" {
-                userMap["name"] = p.User.Name
-            }
-            if p.User.Avatar != "" {
-                userMap["avatar"] = p.User.Avatar
-            }
-            if p.User.Status != "" {
-                userMap["status"] = p.User.Status
-            }
-            if p.User.Bio != "" {
-                userMap["bio"] = p.User.Bio
-            }
-        }
-
         response[i] = map[string]interface{}{
             "id":        p.ID.Hex(),
             "content":   p.Content,
             "media":     p.Media,
             "category":  p.Category,
             "createdAt": p.CreatedAt,
-            "user":      userMap,
+            "likeCount": p.LikeCount,
+            "likedByMe": p.LikedByMe,
+            "user":      publicProfile(p.UserID, p.User),
         }
     }
 
     c.JSON(http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// loadOwnPost fetches the post in the URL and checks that userID wrote it,
+// writing 404 or 403 and returning false otherwise
+func loadOwnPost(c *gin.Context, ctx context.Context, userID primitive.ObjectID) (*models.Post, bool) {
+    postID, err := parseObjectID(c, c.Param("id"), "post ID")
+    if err != nil {
+        return nil, false
+    }
+
+    postsColl := database.Posts
+
+    var post models.Post
+    err = postsColl.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+        return nil, false
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch post"})
+        return nil, false
+    }
+
+    if post.UserID != userID {
+        c.JSON(http.StatusForbidden, gin.H{"error": "You can only change your own posts"})
+        return nil, false
+    }
+    return &post, true
+}
+
+// UpdatePost edits the caller's post. Only the fields present in the body
+// change; updatedAt is set on every edit.
+func UpdatePost(c *gin.Context) {
+    var req struct {
+        Content  *string   `json:"content"`
+        Media    *[]string `json:"media"`
+        Category *string   `json:"category"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    set := bson.M{}
+    if req.Content != nil {
+        if strings.TrimSpace(*req.Content) == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "content cannot be empty"})
+            return
+        }
+        if !moderateContent(c, *req.Content) {
+            return
+        }
+        set["content"] = *req.Content
+    }
+    if req.Media != nil {
+        media := *req.Media
+        if media == nil {
+            media = []string{}
+        }
+        set["media"] = media
+    }
+    if req.Category != nil {
+        set["category"] = *req.Category
+    }
+    if len(set) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    post, ok := loadOwnPost(c, ctx, userID)
+    if !ok {
+        return
+    }
+
+    set["updatedAt"] = time.Now().Unix()
+
+    // Keep the owner in the filter so the check and the write can't diverge
+    postsColl := database.Posts
+    var updated models.Post
+    err = postsColl.FindOneAndUpdate(ctx,
+        bson.M{"_id": post.ID, "userId": userID},
+        bson.M{"$set": set},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&updated)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+        return
+    }
+    if err != nil {
+        log.Printf("UpdatePost error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Post updated successfully",
+        "post":    updated,
+    })
+}
+
+// DeletePost removes the caller's post
+func DeletePost(c *gin.Context) {
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    post, ok := loadOwnPost(c, ctx, userID)
+    if !ok {
+        return
+    }
+
+    postsColl := database.Posts
+    result, err := postsColl.DeleteOne(ctx, bson.M{"_id": post.ID, "userId": userID})
+    if err != nil {
+        log.Printf("DeletePost error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
+        return
+    }
+    if result.DeletedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+        return
+    }
+
+    likesColl := database.PostLikes
+    if _, err := likesColl.DeleteMany(ctx, bson.M{"postId": post.ID}); err != nil {
+        log.Printf("DeletePost likes cleanup error: %v", err)
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
+}
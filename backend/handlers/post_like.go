@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withLikes adds likeCount and likedByMe (for viewerID) to each post in a
+// posts aggregation
+func withLikes(pipeline mongo.Pipeline, viewerID primitive.ObjectID) mongo.Pipeline {
+	return append(pipeline,
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: database.PostLikes.Name()},
+			{Key: "let", Value: bson.D{{Key: "postId", Value: "$_id"}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$postId", "$$postId"}}}},
+				}}},
+				bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "userId", Value: 1}}}},
+			}},
+			{Key: "as", Value: "likes"},
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "likeCount", Value: bson.D{{Key: "$size", Value: "$likes"}}},
+			{Key: "likedByMe", Value: bson.D{{Key: "$in", Value: bson.A{viewerID, "$likes.userId"}}}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "likes", Value: 0}}}},
+	)
+}
+
+// countPostLikes returns how many likes postID has
+func countPostLikes(ctx context.Context, postID primitive.ObjectID) (int64, error) {
+	likesColl := database.PostLikes
+	return likesColl.CountDocuments(ctx, bson.M{"postId": postID})
+}
+
+// LikePost likes a post for the caller. Liking twice is a no-op; the
+// author gets a push for each new like from someone else.
+func LikePost(c *gin.Context) {
+	postID, err := parseObjectID(c, c.Param("id"), "post ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	postsColl := database.Posts
+	var post models.Post
+	err = postsColl.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch post"})
+		return
+	}
+
+	if post.UserID != userID && !rejectIfBlocked(c, ctx, userID, []primitive.ObjectID{post.UserID}) {
+		return
+	}
+
+	likesColl := database.PostLikes
+	_, err = likesColl.InsertOne(ctx, models.PostLike{
+		ID:        primitive.NewObjectID(),
+		PostID:    postID,
+		UserID:    userID,
+		CreatedAt: time.Now().Unix(),
+	})
+	isNew := err == nil
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("LikePost insert error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
+		return
+	}
+
+	if isNew && post.UserID != userID {
+		usersColl := database.Users
+		var liker models.User
+		if err := usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&liker); err == nil {
+			SendPostLikedPush(post.UserID, liker.Name)
+		}
+	}
+
+	count, err := countPostLikes(ctx, postID)
+	if err != nil {
+		log.Printf("LikePost count error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"liked":     true,
+		"likeCount": count,
+	})
+}
+
+// UnlikePost removes the caller's like from a post, if any
+func UnlikePost(c *gin.Context) {
+	postID, err := parseObjectID(c, c.Param("id"), "post ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	likesColl := database.PostLikes
+	if _, err := likesColl.DeleteOne(ctx, bson.M{"postId": postID, "userId": userID}); err != nil {
+		log.Printf("UnlikePost delete error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike post"})
+		return
+	}
+
+	count, err := countPostLikes(ctx, postID)
+	if err != nil {
+		log.Printf("UnlikePost count error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"liked":     false,
+		"likeCount": count,
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// likeRequest likes (POST) or unlikes (DELETE) postID as userID and returns
+// the response body
+func likeRequest(t *testing.T, method string, userID, postID primitive.ObjectID, wantStatus int) map[string]interface{} {
+	t.Helper()
+	handler := LikePost
+	if method == http.MethodDelete {
+		handler = UnlikePost
+	}
+	t.Cleanup(func() {
+		database.PostLikes.DeleteMany(context.Background(), bson.M{"userId": userID})
+	})
+	w := testRequest(t, handler, method, "/api/post/"+postID.Hex()+"/like", nil, userID.Hex(), postParams(postID))
+	expectStatus(t, w, wantStatus)
+	if wantStatus != http.StatusOK {
+		return nil
+	}
+	return decodeBody(t, w)
+}
+
+func TestLikePostToggles(t *testing.T) {
+	ctx := requireDB(t)
+	author, fan := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	postID := insertPosts(t, ctx, author, 100)[0]
+
+	steps := []struct {
+		method    string
+		liked     bool
+		likeCount float64
+	}{
+		{http.MethodPost, true, 1},
+		{http.MethodPost, true, 1}, // liking twice is a no-op
+		{http.MethodDelete, false, 0},
+		{http.MethodDelete, false, 0},
+		{http.MethodPost, true, 1},
+	}
+	for i, step := range steps {
+		body := likeRequest(t, step.method, fan, postID, http.StatusOK)
+		if body["liked"] != step.liked || body["likeCount"] != step.likeCount {
+			t.Errorf("step %d (%s): got %v, want liked %v with %v likes", i+1, step.method, body, step.liked, step.likeCount)
+		}
+	}
+
+	if n, _ := database.PostLikes.CountDocuments(ctx, bson.M{"postId": postID}); n != 1 {
+		t.Errorf("%d likes stored, want 1", n)
+	}
+}
+
+func TestPostLikesAreUnique(t *testing.T) {
+	ctx := requireDB(t)
+	postID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+	t.Cleanup(func() {
+		database.PostLikes.DeleteMany(context.Background(), bson.M{"postId": postID})
+	})
+
+	like := func() error {
+		_, err := database.PostLikes.InsertOne(ctx, models.PostLike{PostID: postID, UserID: userID, CreatedAt: 100})
+		return err
+	}
+	if err := like(); err != nil {
+		t.Fatalf("first like: %v", err)
+	}
+	if err := like(); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("second like for the same user and post: err = %v, want a duplicate key error", err)
+	}
+}
+
+func TestLikePostRejectsMissingAndBlocked(t *testing.T) {
+	ctx := requireDB(t)
+	author, fan := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	postID := insertPosts(t, ctx, author, 100)[0]
+
+	likeRequest(t, http.MethodPost, fan, primitive.NewObjectID(), http.StatusNotFound)
+
+	insertBlock(t, ctx, author, fan)
+	likeRequest(t, http.MethodPost, fan, postID, http.StatusForbidden)
+	if n, _ := database.PostLikes.CountDocuments(ctx, bson.M{"postId": postID}); n != 0 {
+		t.Errorf("blocked user's like was stored (%d likes)", n)
+	}
+
+	// Liking your own post never involves a block
+	likeRequest(t, http.MethodPost, author, postID, http.StatusOK)
+}
+
+// likesByPost reads likeCount and likedByMe per post id from a list of posts
+func likesByPost(t *testing.T, posts []interface{}) map[string][2]interface{} {
+	t.Helper()
+	out := make(map[string][2]interface{}, len(posts))
+	for _, p := range posts {
+		post := p.(map[string]interface{})
+		out[post["id"].(string)] = [2]interface{}{post["likeCount"], post["likedByMe"]}
+	}
+	return out
+}
+
+func TestPostListsCountLikes(t *testing.T) {
+	ctx := requireDB(t)
+	author, fan, other := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	ids := insertPosts(t, ctx, author, 100, 200)
+	liked, unliked := ids[0].Hex(), ids[1].Hex()
+
+	likeRequest(t, http.MethodPost, fan, ids[0], http.StatusOK)
+	likeRequest(t, http.MethodPost, other, ids[0], http.StatusOK)
+
+	lists := map[string]func(viewer primitive.ObjectID) []interface{}{
+		"GetFeed": func(viewer primitive.ObjectID) []interface{} {
+			w := testRequest(t, GetFeed, http.MethodGet, "/api/posts/feed", nil, viewer.Hex(), nil)
+			expectStatus(t, w, http.StatusOK)
+			return decodeBody(t, w)["posts"].([]interface{})
+		},
+		"GetUserPosts": func(viewer primitive.ObjectID) []interface{} {
+			w := testRequest(t, GetUserPosts, http.MethodGet, "/api/posts/user/"+author.Hex(), nil, viewer.Hex(), gin.Params{{Key: "id", Value: author.Hex()}})
+			expectStatus(t, w, http.StatusOK)
+			var posts []interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &posts); err != nil {
+				t.Fatalf("decoding %s: %v", w.Body.String(), err)
+			}
+			return posts
+		},
+	}
+	for name, list := range lists {
+		got := likesByPost(t, list(fan))
+		if got[liked] != [2]interface{}{2.0, true} || got[unliked] != [2]interface{}{0.0, false} {
+			t.Errorf("%s for a liker = %v, want 2 likes incl. mine on %s and none on %s", name, got, liked, unliked)
+		}
+	}
+
+	w := testRequest(t, GetMyPosts, http.MethodGet, "/api/posts/me", nil, author.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	var mine []interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &mine); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body.String(), err)
+	}
+	if got := likesByPost(t, mine); got[liked] != [2]interface{}{2.0, false} {
+		t.Errorf("GetMyPosts = %v, want 2 likes, none mine, on %s", got, liked)
+	}
+}
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseFeedCursorWithoutLookup(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		before string
+		want   pageCursor
+		ok     bool
+	}{
+		{pageCursor{CreatedAt: 1700000000, ID: id}.String(), pageCursor{CreatedAt: 1700000000, ID: id}, true},
+		{"1700000000", pageCursor{CreatedAt: 1700000000}, true},
+		{"yesterday", pageCursor{}, false},
+		{"1700000000_nothex", pageCursor{}, false},
+	}
+	for _, tt := range tests {
+		got, ok, err := parseFeedCursor(context.Background(), tt.before)
+		if err != nil || ok != tt.ok || got != tt.want {
+			t.Errorf("parseFeedCursor(%q) = %v, %v, %v; want %v, %v", tt.before, got, ok, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// insertPosts stores a post by author at each createdAt time, in order
+func insertPosts(t *testing.T, ctx context.Context, author primitive.ObjectID, times ...int64) []primitive.ObjectID {
+	t.Helper()
+	ids := make([]primitive.ObjectID, len(times))
+	docs := make([]interface{}, len(times))
+	for i, ts := range times {
+		ids[i] = primitive.NewObjectID()
+		docs[i] = models.Post{ID: ids[i], UserID: author, Content: "p", Media: []string{}, CreatedAt: ts}
+	}
+	if _, err := database.Posts.InsertMany(ctx, docs); err != nil {
+		t.Fatalf("inserting posts: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Posts.DeleteMany(context.Background(), bson.M{"userId": author})
+	})
+	return ids
+}
+
+func getFeed(t *testing.T, userID primitive.ObjectID, query url.Values) (ids []string, hasMore bool, next string) {
+	t.Helper()
+	w := testRequest(t, GetFeed, http.MethodGet, "/api/posts/feed?"+query.Encode(), nil, userID.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeBody(t, w)
+	for _, p := range body["posts"].([]interface{}) {
+		ids = append(ids, p.(map[string]interface{})["id"].(string))
+	}
+	hasMore, _ = body["hasMore"].(bool)
+	next, _ = body["nextCursor"].(string)
+	return ids, hasMore, next
+}
+
+func hexes(ids []primitive.ObjectID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.Hex()
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestGetFeedPagesThroughSameSecondPostsWithCursor(t *testing.T) {
+	ctx := requireDB(t)
+	viewer := insertTestUser(t, ctx, nil)
+	alice := insertTestUser(t, ctx, nil)
+	bob := insertTestUser(t, ctx, nil)
+	want := append(insertPosts(t, ctx, alice, 100, 100, 100), insertPosts(t, ctx, bob, 100, 100)...)
+
+	var seen []string
+	query := url.Values{"limit": {"2"}}
+	for page := 0; ; page++ {
+		if page > len(want) {
+			t.Fatal("feed never stopped paging")
+		}
+		ids, hasMore, next := getFeed(t, viewer, query)
+		seen = append(seen, ids...)
+		if !hasMore {
+			break
+		}
+		if next == "" {
+			t.Fatal("hasMore without a nextCursor")
+		}
+		query.Set("before", next)
+	}
+
+	sort.Strings(seen)
+	if !slices.Equal(seen, hexes(want)) {
+		t.Errorf("paged %v, want each of %v once", seen, hexes(want))
+	}
+}
+
+func TestGetFeedIgnoresSkipWithCursor(t *testing.T) {
+	ctx := requireDB(t)
+	viewer := insertTestUser(t, ctx, nil)
+	author := insertTestUser(t, ctx, nil)
+	ids := insertPosts(t, ctx, author, 100, 200, 300, 400)
+
+	before := pageCursor{CreatedAt: 400, ID: ids[3]}.String()
+	got, _, _ := getFeed(t, viewer, url.Values{"before": {before}, "skip": {"2"}, "limit": {"1"}})
+	if len(got) != 1 || got[0] != ids[2].Hex() {
+		t.Errorf("feed = %v, want the post right after the cursor (%s)", got, ids[2].Hex())
+	}
+}
+
+func TestGetFeedAcceptsCursorOfDeletedPost(t *testing.T) {
+	ctx := requireDB(t)
+	viewer := insertTestUser(t, ctx, nil)
+	author := insertTestUser(t, ctx, nil)
+	older := insertPosts(t, ctx, author, 100)
+
+	// A legacy post-id cursor whose post is gone: its id still says when
+	// it was created, which is after the older post
+	gone := primitive.NewObjectID()
+	got, _, _ := getFeed(t, viewer, url.Values{"before": {gone.Hex()}})
+	if len(got) != 1 || got[0] != older[0].Hex() {
+		t.Errorf("feed = %v, want [%s]", got, older[0].Hex())
+	}
+}
+
+func createPost(t *testing.T, userID primitive.ObjectID) *httptest.ResponseRecorder {
+	t.Helper()
+	t.Cleanup(func() {
+		database.Posts.DeleteMany(context.Background(), bson.M{"userId": userID})
+	})
+	return testRequest(t, CreatePost, http.MethodPost, "/api/posts", gin.H{"content": "hello"}, userID.Hex(), nil)
+}
+
+func TestCreatePostCooldown(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("POST_COOLDOWN", "30s")
+	author := insertTestUser(t, ctx, nil)
+
+	expectStatus(t, createPost(t, author), http.StatusCreated)
+
+	w := createPost(t, author)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 30 {
+		t.Errorf("Retry-After = %q, want 1-30 seconds", w.Header().Get("Retry-After"))
+	}
+	if body := decodeBody(t, w); body["code"] != "POST_COOLDOWN" {
+		t.Errorf("body = %v, want code POST_COOLDOWN", body)
+	}
+	if n, _ := database.Posts.CountDocuments(ctx, bson.M{"userId": author}); n != 1 {
+		t.Errorf("%d posts stored, want 1", n)
+	}
+
+	// Once the cooldown has passed the author may post again
+	database.Users.UpdateOne(ctx, bson.M{"_id": author}, bson.M{"$set": bson.M{"lastPostAt": time.Now().Add(-31 * time.Second).Unix()}})
+	expectStatus(t, createPost(t, author), http.StatusCreated)
+}
+
+func TestCreatePostCooldownHoldsUnderConcurrency(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("POST_COOLDOWN", "30s")
+	author := insertTestUser(t, ctx, nil)
+	t.Cleanup(func() {
+		database.Posts.DeleteMany(context.Background(), bson.M{"userId": author})
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testRequest(t, CreatePost, http.MethodPost, "/api/posts", gin.H{"content": "hello"}, author.Hex(), nil)
+		}()
+	}
+	wg.Wait()
+
+	if n, _ := database.Posts.CountDocuments(ctx, bson.M{"userId": author}); n != 1 {
+		t.Errorf("%d posts stored from parallel requests, want 1", n)
+	}
+}
+
+func TestCreatePostCooldownDisabled(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("POST_COOLDOWN", "0")
+	author := insertTestUser(t, ctx, nil)
+
+	expectStatus(t, createPost(t, author), http.StatusCreated)
+	expectStatus(t, createPost(t, author), http.StatusCreated)
+}
+
+func postParams(postID primitive.ObjectID) gin.Params {
+	return gin.Params{{Key: "id", Value: postID.Hex()}}
+}
+
+func TestUpdatePostOwnership(t *testing.T) {
+	ctx := requireDB(t)
+	owner, stranger := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	postID := insertPosts(t, ctx, owner, 100)[0]
+	edit := gin.H{"content": "edited"}
+
+	w := testRequest(t, UpdatePost, http.MethodPut, "/api/post/"+postID.Hex(), edit, stranger.Hex(), postParams(postID))
+	expectStatus(t, w, http.StatusForbidden)
+
+	missing := primitive.NewObjectID()
+	w = testRequest(t, UpdatePost, http.MethodPut, "/api/post/"+missing.Hex(), edit, owner.Hex(), postParams(missing))
+	expectStatus(t, w, http.StatusNotFound)
+
+	var post models.Post
+	database.Posts.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if post.Content != "p" || post.UpdatedAt != 0 {
+		t.Fatalf("rejected edits changed the post: %+v", post)
+	}
+
+	w = testRequest(t, UpdatePost, http.MethodPut, "/api/post/"+postID.Hex(), edit, owner.Hex(), postParams(postID))
+	expectStatus(t, w, http.StatusOK)
+	database.Posts.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if post.Content != "edited" || post.UpdatedAt == 0 {
+		t.Errorf("owner's edit stored as %+v, want new content and updatedAt", post)
+	}
+}
+
+func TestDeletePostOwnership(t *testing.T) {
+	ctx := requireDB(t)
+	owner, stranger := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	postID := insertPosts(t, ctx, owner, 100)[0]
+	insertDocs(t, ctx, database.PostLikes,
+		models.PostLike{ID: primitive.NewObjectID(), PostID: postID, UserID: stranger, CreatedAt: 100},
+	)
+
+	w := testRequest(t, DeletePost, http.MethodDelete, "/api/post/"+postID.Hex(), nil, stranger.Hex(), postParams(postID))
+	expectStatus(t, w, http.StatusForbidden)
+	if n, _ := database.Posts.CountDocuments(ctx, bson.M{"_id": postID}); n != 1 {
+		t.Fatal("someone else deleted the post")
+	}
+
+	w = testRequest(t, DeletePost, http.MethodDelete, "/api/post/"+postID.Hex(), nil, owner.Hex(), postParams(postID))
+	expectStatus(t, w, http.StatusOK)
+	if n, _ := database.Posts.CountDocuments(ctx, bson.M{"_id": postID}); n != 0 {
+		t.Error("owner's delete left the post behind")
+	}
+	if n, _ := database.PostLikes.CountDocuments(ctx, bson.M{"postId": postID}); n != 0 {
+		t.Errorf("%d likes left on the deleted post", n)
+	}
+
+	// Gone now, so a second delete is a 404
+	w = testRequest(t, DeletePost, http.MethodDelete, "/api/post/"+postID.Hex(), nil, owner.Hex(), postParams(postID))
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestDiversifyByAuthor(t *testing.T) {
+	authors := map[byte]primitive.ObjectID{}
+	// feed builds posts from labels like "a1"; the letter names the author
+	feed := func(labels ...string) []postWithUser {
+		posts := make([]postWithUser, len(labels))
+		for i, label := range labels {
+			if _, ok := authors[label[0]]; !ok {
+				authors[label[0]] = primitive.NewObjectID()
+			}
+			posts[i].UserID = authors[label[0]]
+			posts[i].Content = label
+		}
+		return posts
+	}
+	labels := func(posts []postWithUser) []string {
+		out := make([]string, len(posts))
+		for i, post := range posts {
+			out[i] = post.Content
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		in     []string
+		maxRun int
+		want   []string
+	}{
+		{"empty", nil, 2, nil},
+		{"already mixed", []string{"a1", "b1", "a2", "b2"}, 2, []string{"a1", "b1", "a2", "b2"}},
+		{"run at the cap", []string{"a1", "a2", "b1"}, 2, []string{"a1", "a2", "b1"}},
+		{"run over the cap", []string{"a1", "a2", "a3", "b1", "a4"}, 2, []string{"a1", "a2", "b1", "a3", "a4"}},
+		{"cap of one", []string{"a1", "a2", "b1", "b2", "c1"}, 1, []string{"a1", "b1", "a2", "b2", "c1"}},
+		{"single-author tail", []string{"a1", "b1", "b2", "b3", "b4", "b5"}, 2, []string{"a1", "b1", "b2", "b3", "b4", "b5"}},
+		{"tail after mixing", []string{"a1", "a2", "a3", "a4", "b1"}, 2, []string{"a1", "a2", "b1", "a3", "a4"}},
+		{"cap disabled", []string{"a1", "a2", "a3", "b1"}, 0, []string{"a1", "a2", "a3", "b1"}},
+		{"negative cap", []string{"a1", "a2", "a3", "b1"}, -1, []string{"a1", "a2", "a3", "b1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts := feed(tt.in...)
+			before := labels(posts)
+
+			got := labels(diversifyByAuthor(posts, tt.maxRun))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("diversifyByAuthor(%v, %d) = %v, want %v", tt.in, tt.maxRun, got, tt.want)
+			}
+			if after := labels(posts); !slices.Equal(after, before) {
+				t.Errorf("input reordered to %v, want %v", after, before)
+			}
+		})
+	}
+}
+
+func TestGetFeedLimit(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("FEED_DEFAULT_LIMIT", "3")
+	t.Setenv("FEED_MAX_LIMIT", "5")
+	viewer := insertTestUser(t, ctx, nil)
+	insertPosts(t, ctx, insertTestUser(t, ctx, nil), 101, 102, 103, 104)
+	insertPosts(t, ctx, insertTestUser(t, ctx, nil), 101, 102, 103, 104)
+
+	tests := []struct {
+		limit string
+		want  int
+	}{
+		{"", 3},
+		{"4", 4},
+		{"5", 5},
+		{"50", 5},
+		{"0", 3},
+		{"-2", 3},
+		{"lots", 3},
+	}
+	for _, tt := range tests {
+		query := url.Values{}
+		if tt.limit != "" {
+			query.Set("limit", tt.limit)
+		}
+		if ids, hasMore, _ := getFeed(t, viewer, query); len(ids) != tt.want || !hasMore {
+			t.Errorf("limit=%q returned %d posts (hasMore %v), want %d and more", tt.limit, len(ids), hasMore, tt.want)
+		}
+	}
+}
+
+func TestNotifyNewPostReachesNearbyUnblockedSubscribers(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("FEED_LIVE_RADIUS_KM", "50")
+	at := func(lat, lng float64) bson.M { return bson.M{"latitude": lat, "longitude": lng} }
+	author := insertTestUser(t, ctx, at(-1.2921, 36.8219)) // Nairobi
+	viewers := map[string]primitive.ObjectID{
+		"nearby":    insertTestUser(t, ctx, at(-1.2921+0.1, 36.8219)), // ~11 km
+		"far":       insertTestUser(t, ctx, at(-0.0917, 34.7680)),     // Kisumu, ~265 km
+		"unlocated": insertTestUser(t, ctx, nil),
+		"blocked":   insertTestUser(t, ctx, at(-1.2921, 36.8219)),
+		"blocker":   insertTestUser(t, ctx, at(-1.2921, 36.8219)),
+		"author":    author,
+	}
+	insertBlock(t, ctx, author, viewers["blocked"])
+	insertBlock(t, ctx, viewers["blocker"], author)
+	want := map[string]bool{"nearby": true, "unlocated": true}
+
+	m, server := startWebSocketManager(t)
+	conns := map[string]*gorillaws.Conn{}
+	for name, id := range viewers {
+		conns[name] = dialAs(t, m, server, id)
+		if err := conns[name].WriteJSON(map[string]string{"type": "subscribe_feed"}); err != nil {
+			t.Fatalf("subscribing %s: %v", name, err)
+		}
+	}
+	for deadline := time.Now().Add(2 * time.Second); len(m.FeedSubscribers()) < len(viewers); {
+		if time.Now().After(deadline) {
+			t.Fatal("feed subscriptions never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	post := models.Post{ID: primitive.NewObjectID(), UserID: author, Content: "hello", CreatedAt: time.Now().Unix()}
+	notifyNewPost(ctx, post)
+
+	for name, conn := range conns {
+		wait := 200 * time.Millisecond
+		if want[name] {
+			wait = 2 * time.Second
+		}
+		event := readEvent(t, conn, "new_post", wait)
+		if got := event != nil; got != want[name] {
+			t.Errorf("%s got new_post = %v, want %v", name, got, want[name])
+		}
+		if event != nil && event["id"] != post.ID.Hex() {
+			t.Errorf("%s got post %v, want %s", name, event["id"], post.ID.Hex())
+		}
+	}
+}
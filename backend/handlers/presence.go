@@ -0,0 +1,19 @@
+package handlers
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// isUserOnline reports whether userID has at least one open WebSocket
+// connection on this server
+func isUserOnline(userID primitive.ObjectID) bool {
+	return wsManager != nil && wsManager.IsUserOnline(userID.Hex())
+}
+
+// liveStatus corrects a stored status with live connection state. users.status
+// is only rewritten when a connection opens or closes, so a crash or restart
+// can leave it saying "online" for someone who isn't.
+func liveStatus(userID primitive.ObjectID, status string) string {
+	if status == "online" && !isUserOnline(userID) {
+		return "offline"
+	}
+	return status
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLiveStatusWithoutConnections(t *testing.T) {
+	SetWebSocketManager(nil)
+	id := primitive.NewObjectID()
+
+	if isUserOnline(id) {
+		t.Error("isUserOnline with no manager = true")
+	}
+	tests := map[string]string{"online": "offline", "busy": "busy", "offline": "offline", "": ""}
+	for stored, want := range tests {
+		if got := liveStatus(id, stored); got != want {
+			t.Errorf("liveStatus(%q) = %q, want %q", stored, got, want)
+		}
+	}
+}
+
+func TestIsOnlineFollowsLiveConnections(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	m, server := startWebSocketManager(t)
+	conn := dialAs(t, m, server, alice)
+
+	// Stale stored statuses: alice connected but recorded offline, bob
+	// recorded online with no connection
+	setStatus := func(id primitive.ObjectID, status string) {
+		t.Helper()
+		if _, err := database.Users.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"status": status}}); err != nil {
+			t.Fatalf("setting status: %v", err)
+		}
+	}
+	setStatus(alice, "offline")
+	setStatus(bob, "online")
+
+	profile := func(id primitive.ObjectID) (status string, online bool) {
+		t.Helper()
+		params := gin.Params{{Key: "id", Value: id.Hex()}}
+		w := testRequest(t, GetUser, http.MethodGet, "/api/user/"+id.Hex(), nil, "", params)
+		expectStatus(t, w, http.StatusOK)
+		body := decodeBody(t, w)
+		status, _ = body["status"].(string)
+		online, _ = body["isOnline"].(bool)
+		return status, online
+	}
+
+	if _, online := profile(alice); !online {
+		t.Error("connected user reported offline because of the stored status")
+	}
+	if status, online := profile(bob); online || status != "offline" {
+		t.Errorf("unconnected user reported status %q, isOnline %v; want offline, false", status, online)
+	}
+
+	conn.Close()
+	for deadline := time.Now().Add(2 * time.Second); m.IsUserOnline(alice.Hex()); {
+		if time.Now().After(deadline) {
+			t.Fatal("connection never unregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	setStatus(alice, "online")
+	if status, online := profile(alice); online || status != "offline" {
+		t.Errorf("after disconnecting: status %q, isOnline %v; want offline, false", status, online)
+	}
+}
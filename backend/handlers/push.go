@@ -9,6 +9,7 @@ import (
     "time"
 
     "coded/database"
+    "coded/models"
 
     "github.com/gin-gonic/gin"
     "github.com/SherClockHolmes/webpush-go"
@@ -73,17 +74,15 @@ func SubscribePush(c *gin.Context) {
         return
     }
 
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    subsColl := database.Client.Database("coded").Collection("subscriptions")
+    subsColl := database.Subscriptions
 
     subscription := webpush.Subscription{
         Endpoint: req.Endpoint,
@@ -122,6 +121,24 @@ func SubscribePush(c *gin.Context) {
 
 // Helper function to send push notification
 func SendPushNotification(userID primitive.ObjectID, title, body, icon string) {
+    sendPush(userID, title, body, icon, nil)
+}
+
+// sendPush delivers a push payload to the user's subscription in the
+// background. extra is merged into the payload's data object.
+func sendPush(userID primitive.ObjectID, title, body, icon string, extra map[string]interface{}) {
+    goPush(func(ctx context.Context) {
+        deliverPush(ctx, userID, title, body, icon, extra)
+    })
+}
+
+// pushTimeout bounds all the work behind one push notification: settings
+// lookups, the subscription lookup and the send
+const pushTimeout = 10 * time.Second
+
+// goPush runs fn in the background with a pushTimeout context, so push work
+// never holds up the request that triggered it
+func goPush(fn func(ctx context.Context)) {
     go func() {
         defer func() {
             if r := recover(); r != nil {
@@ -129,79 +146,137 @@ func SendPushNotification(userID primitive.ObjectID, title, body, icon string) {
             }
         }()
 
-        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
         defer cancel()
+        fn(ctx)
+    }()
+}
 
-        subsColl := database.Client.Database("coded").Collection("subscriptions")
+// deliverPush sends a push payload to the user's subscription, deleting the
+// subscription if the push service says it has expired
+func deliverPush(ctx context.Context, userID primitive.ObjectID, title, body, icon string, extra map[string]interface{}) {
+    subsColl := database.Subscriptions
 
-        var sub PushSubscription
-        err := subsColl.FindOne(ctx, bson.M{"userId": userID}).Decode(&sub)
-        if err == mongo.ErrNoDocuments {
-            log.Printf("No push subscription found for user: %s", userID.Hex())
-            return // No subscription
-        }
-        if err != nil {
-            log.Printf("Failed to find subscription for user %s: %v", userID.Hex(), err)
-            return
-        }
+    var sub PushSubscription
+    err := subsColl.FindOne(ctx, bson.M{"userId": userID}).Decode(&sub)
+    if err == mongo.ErrNoDocuments {
+        log.Printf("No push subscription found for user: %s", userID.Hex())
+        return // No subscription
+    }
+    if err != nil {
+        log.Printf("Failed to find subscription for user %s: %v", userID.Hex(), err)
+        return
+    }
 
-        payload := map[string]interface{}{
-            "title": title,
-            "body":  body,
-            "icon":  icon,
-            "data": map[string]interface{}{
-                "url": "/chats.html",
-                "timestamp": time.Now().Unix(),
-            },
-        }
-        
-        payloadBytes, err := json.Marshal(payload)
-        if err != nil {
-            log.Printf("Failed to marshal push payload: %v", err)
-            return
-        }
+    data := map[string]interface{}{
+        "url": "/chats.html",
+        "timestamp": time.Now().Unix(),
+    }
+    for k, v := range extra {
+        data[k] = v
+    }
 
-        // Send push
-        resp, err := webpush.SendNotification(payloadBytes, &sub.Sub, &webpush.Options{
-            Subscriber:      "mailto:admin@coded.com",
-            VAPIDPrivateKey: vapidPrivateKey,
-            TTL:             30,
-        })
+    payload := map[string]interface{}{
+        "title": title,
+        "body":  body,
+        "icon":  icon,
+        "data":  data,
+    }
+    
+    payloadBytes, err := json.Marshal(payload)
+    if err != nil {
+        log.Printf("Failed to marshal push payload: %v", err)
+        return
+    }
+
+    // Send push
+    resp, err := webpush.SendNotification(payloadBytes, &sub.Sub, &webpush.Options{
+        Subscriber:      "mailto:admin@coded.com",
+        VAPIDPrivateKey: vapidPrivateKey,
+        TTL:             30,
+    })
+    
+    if err != nil {
+        log.Printf("Failed to send push notification to user %s: %v", userID.Hex(), err)
         
-        if err != nil {
-            log.Printf("Failed to send push notification to user %s: %v", userID.Hex(), err)
-            
-            // If subscription is invalid (410), delete it
-            if resp != nil && resp.StatusCode == 410 {
-                log.Printf("Push subscription expired for user %s, deleting...", userID.Hex())
-                _, delErr := subsColl.DeleteOne(ctx, bson.M{"userId": userID})
-                if delErr != nil {
-                    log.Printf("Failed to delete expired subscription: %v", delErr)
-                }
+        // If subscription is invalid (410), delete it
+        if resp != nil && resp.StatusCode == 410 {
+            log.Printf("Push subscription expired for user %s, deleting...", userID.Hex())
+            _, delErr := subsColl.DeleteOne(ctx, bson.M{"userId": userID})
+            if delErr != nil {
+                log.Printf("Failed to delete expired subscription: %v", delErr)
             }
-            return
         }
-        
-        log.Printf("Push notification sent successfully to user: %s", userID.Hex())
-        resp.Body.Close()
-    }()
+        return
+    }
+    
+    log.Printf("Push notification sent successfully to user: %s", userID.Hex())
+    resp.Body.Close()
+}
+
+// pushPreviewLength is the maximum number of characters of message text
+// shown in a notification body or reply preview
+const pushPreviewLength = 100
+
+// truncatePreview shortens s to at most n runes, appending an ellipsis
+func truncatePreview(s string, n int) string {
+    runes := []rune(s)
+    if len(runes) <= n {
+        return s
+    }
+    return string(runes[:n]) + "..."
+}
+
+// genericMessagePushBody replaces the message text for users who hide
+// previews
+const genericMessagePushBody = "You have a new message"
+
+// hidesMessagePreviews reports whether the user turned on
+// HideMessagePreviews. Lookup failures fall back to showing previews.
+func hidesMessagePreviews(ctx context.Context, userID primitive.ObjectID) bool {
+    usersColl := database.Users
+
+    var user models.User
+    projection := options.FindOne().SetProjection(bson.M{"hideMessagePreviews": 1})
+    if err := usersColl.FindOne(ctx, bson.M{"_id": userID}, projection).Decode(&user); err != nil {
+        log.Printf("Failed to load push preview setting for user %s: %v", userID.Hex(), err)
+        return false
+    }
+    return user.HideMessagePreviews
 }
 
-// SendMessagePush sends push notification for new messages
-func SendMessagePush(senderID, receiverID primitive.ObjectID, messageContent string, senderName string) {
+// messagePushPayload builds the title, body and extra data fields of a new
+// message notification. replyTo is the content of the quoted message when
+// the new message is a reply, or empty. With hidePreview the body is generic
+// and neither the text nor the quote is included.
+func messagePushPayload(senderName, messageContent, replyTo string, hidePreview bool) (title, body string, extra map[string]interface{}) {
     if senderName == "" {
         senderName = "Someone"
     }
-    
-    title := senderName + " sent a message"
-    body := messageContent
-    
-    // Truncate long messages
-    if len(body) > 100 {
-        body = body[:100] + "..."
+    title = senderName + " sent a message"
+    if hidePreview {
+        return title, genericMessagePushBody, nil
     }
-    
-    SendPushNotification(receiverID, title, body, "")
+
+    body = truncatePreview(messageContent, pushPreviewLength)
+    if replyTo != "" {
+        preview := truncatePreview(replyTo, pushPreviewLength)
+        body = "Replying to: " + preview + "\n" + body
+        extra = map[string]interface{}{
+            "replyTo": preview,
+        }
+    }
+    return title, body, extra
+}
+
+// SendMessagePush sends push notification for new messages in the
+// background. Receivers with HideMessagePreviews get a generic body instead
+// of the text; the setting is looked up off the request path.
+func SendMessagePush(senderID, receiverID primitive.ObjectID, messageContent string, senderName string, senderAvatar string, replyTo string) {
+    goPush(func(ctx context.Context) {
+        title, body, extra := messagePushPayload(senderName, messageContent, replyTo, hidesMessagePreviews(ctx, receiverID))
+        deliverPush(ctx, receiverID, title, body, senderAvatar, extra)
+    })
 }
 
 // SendMatchPush sends push notification for new matches
@@ -218,6 +293,13 @@ func SendPostAcceptedPush(userID primitive.ObjectID, acceptorName string) {
     SendPushNotification(userID, title, body, "")
 }
 
+// SendPostLikedPush sends push notification when someone likes your post
+func SendPostLikedPush(userID primitive.ObjectID, likerName string) {
+    title := "New like ❤️"
+    body := likerName + " liked your post"
+    SendPushNotification(userID, title, body, "")
+}
+
 // SendNewChatPush sends push notification for new chat creation
 func SendNewChatPush(userID primitive.ObjectID, chatPartnerName string) {
     title := "New chat started 💬"
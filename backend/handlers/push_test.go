@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessagePushPayload(t *testing.T) {
+	title, body, extra := messagePushPayload("Ada", "see you at 8", "", false)
+	if title != "Ada sent a message" || body != "see you at 8" {
+		t.Errorf("plain message: title %q, body %q", title, body)
+	}
+	if extra != nil {
+		t.Errorf("plain message carries extra data %v", extra)
+	}
+
+	_, body, extra = messagePushPayload("Ada", "yes!", "dinner tonight?", false)
+	if body != "Replying to: dinner tonight?\nyes!" {
+		t.Errorf("reply body = %q", body)
+	}
+	if extra["replyTo"] != "dinner tonight?" {
+		t.Errorf("reply extra = %v, want the quoted text", extra)
+	}
+
+	if title, _, _ := messagePushPayload("", "hi", "", false); title != "Someone sent a message" {
+		t.Errorf("nameless sender title = %q", title)
+	}
+}
+
+func TestMessagePushPayloadTruncates(t *testing.T) {
+	long := strings.Repeat("é", pushPreviewLength+20)
+	want := strings.Repeat("é", pushPreviewLength) + "..."
+
+	_, body, extra := messagePushPayload("Ada", long, long, false)
+	if extra["replyTo"] != want {
+		t.Errorf("quote preview = %q, want %d runes and an ellipsis", extra["replyTo"], pushPreviewLength)
+	}
+	if body != "Replying to: "+want+"\n"+want {
+		t.Errorf("body = %q, want both quote and text truncated", body)
+	}
+
+	exact := strings.Repeat("a", pushPreviewLength)
+	if _, body, _ := messagePushPayload("Ada", exact, "", false); body != exact {
+		t.Errorf("text of exactly the limit was changed to %q", body)
+	}
+}
+
+func TestMessagePushPayloadHidesPreview(t *testing.T) {
+	title, body, extra := messagePushPayload("Ada", "my address is 12 Elm St", "where do you live?", true)
+	if title != "Ada sent a message" {
+		t.Errorf("title = %q", title)
+	}
+	if body != genericMessagePushBody {
+		t.Errorf("body = %q, want the generic body", body)
+	}
+	if extra != nil {
+		t.Errorf("hidden preview still carries %v", extra)
+	}
+}
+
+func TestHidesMessagePreviews(t *testing.T) {
+	ctx := requireDB(t)
+	hiding := insertTestUser(t, ctx, bson.M{"hideMessagePreviews": true})
+	showing := insertTestUser(t, ctx, nil)
+
+	if !hidesMessagePreviews(ctx, hiding) {
+		t.Error("hideMessagePreviews was ignored")
+	}
+	if hidesMessagePreviews(ctx, showing) {
+		t.Error("previews hidden for a user who didn't ask")
+	}
+	if hidesMessagePreviews(ctx, primitive.NewObjectID()) {
+		t.Error("a failed lookup hid the preview")
+	}
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"coded/config"
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxEmojiRunes bounds a single reaction; the longest ZWJ family sequences
+// are around a dozen code points
+const maxEmojiRunes = 16
+
+// isEmojiBase reports whether r is a pictographic code point that can stand
+// on its own as an emoji
+func isEmojiBase(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // symbols, pictographs, flags, faces
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // misc symbols, dingbats
+		return true
+	case r >= 0x2300 && r <= 0x23FF, r >= 0x2B00 && r <= 0x2BFF, r >= 0x2190 && r <= 0x21FF:
+		return true
+	case r == 0x00A9, r == 0x00AE, r == 0x203C, r == 0x2049, r == 0x2122, r == 0x2139,
+		r == 0x3030, r == 0x303D, r == 0x3297, r == 0x3299:
+		return true
+	}
+	return false
+}
+
+// isEmojiModifier reports whether r only makes sense attached to another
+// emoji: joiners, variation selectors, skin tones, keycaps and tag letters
+func isEmojiModifier(r rune) bool {
+	switch {
+	case r == 0x200D, r == 0xFE0F, r == 0xFE0E, r == 0x20E3:
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF:
+		return true
+	case r >= 0xE0020 && r <= 0xE007F:
+		return true
+	}
+	return false
+}
+
+// isValidEmoji accepts a single emoji or emoji sequence and rejects plain
+// text. Keycaps (1️⃣, #️⃣) are the only sequences allowed to contain ASCII.
+func isValidEmoji(s string) bool {
+	if s == "" || !utf8.ValidString(s) || utf8.RuneCountInString(s) > maxEmojiRunes {
+		return false
+	}
+
+	hasBase := false
+	hasKeycap := false
+	for _, r := range s {
+		switch {
+		case isEmojiBase(r):
+			hasBase = true
+		case r == 0x20E3:
+			hasKeycap = true
+		case isEmojiModifier(r):
+		case (r >= '0' && r <= '9') || r == '#' || r == '*':
+		default:
+			return false
+		}
+	}
+	if hasKeycap {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x80 {
+			return false
+		}
+	}
+	return hasBase
+}
+
+// reactionSummary counts reactions per emoji
+func reactionSummary(reactions []models.Reaction) map[string]int {
+	summary := make(map[string]int, len(reactions))
+	for _, r := range reactions {
+		summary[r.Emoji]++
+	}
+	return summary
+}
+
+// loadReactableMessage fetches a message the caller can react to: it must
+// exist, not be deleted and belong to one of their chats. It writes the
+// error response otherwise.
+func loadReactableMessage(c *gin.Context, ctx context.Context, messageID, userID primitive.ObjectID) (*models.Message, bool) {
+	messagesColl := database.Messages
+
+	var msg models.Message
+	err := messagesColl.FindOne(ctx, bson.M{"_id": messageID}).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message"})
+		return nil, false
+	}
+	if msg.Deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot react to a deleted message"})
+		return nil, false
+	}
+
+	chatsColl := database.Chats
+	count, err := chatsColl.CountDocuments(ctx, bson.M{"_id": msg.ChatID, "participants": userID})
+	if err != nil || count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to chat"})
+		return nil, false
+	}
+	return &msg, true
+}
+
+// AddReaction sets the caller's reaction on a message. Each user has at most
+// one reaction per message: a different emoji replaces it and the same emoji
+// again removes it.
+func AddReaction(c *gin.Context) {
+	messageID, err := parseObjectID(c, c.Param("id"), "message ID")
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Emoji string `json:"emoji" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !isValidEmoji(req.Emoji) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reaction must be a single emoji"})
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	msg, ok := loadReactableMessage(c, ctx, messageID, userID)
+	if !ok {
+		return
+	}
+
+	emoji := req.Emoji
+	for _, r := range msg.Reactions {
+		if r.UserID == userID && r.Emoji == req.Emoji {
+			emoji = ""
+			break
+		}
+	}
+	setReaction(c, ctx, msg, userID, emoji)
+}
+
+// RemoveReaction clears the caller's reaction on a message, if any
+func RemoveReaction(c *gin.Context) {
+	messageID, err := parseObjectID(c, c.Param("id"), "message ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	msg, ok := loadReactableMessage(c, ctx, messageID, userID)
+	if !ok {
+		return
+	}
+	setReaction(c, ctx, msg, userID, "")
+}
+
+// setReaction replaces userID's reaction on msg with emoji (or removes it
+// when emoji is empty) in a single update, then broadcasts message_reaction
+// to the chat with the action and the new per-emoji counts. The reactor's
+// own connections are skipped unless WS_REACTION_ECHO is on (the default).
+func setReaction(c *gin.Context, ctx context.Context, msg *models.Message, userID primitive.ObjectID, emoji string) {
+	var previous string
+	for _, r := range msg.Reactions {
+		if r.UserID == userID {
+			previous = r.Emoji
+			break
+		}
+	}
+
+	messagesColl := database.Messages
+
+	others := bson.D{{Key: "$filter", Value: bson.D{
+		{Key: "input", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$reactions", bson.A{}}}}},
+		{Key: "as", Value: "r"},
+		{Key: "cond", Value: bson.D{{Key: "$ne", Value: bson.A{"$$r.userId", userID}}}},
+	}}}
+	reactions := interface{}(others)
+	if emoji != "" {
+		reactions = bson.D{{Key: "$concatArrays", Value: bson.A{
+			others,
+			bson.A{bson.D{{Key: "userId", Value: userID}, {Key: "emoji", Value: emoji}}},
+		}}}
+	}
+
+	var updated models.Message
+	err := messagesColl.FindOneAndUpdate(ctx,
+		bson.M{"_id": msg.ID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "reactions", Value: reactions}}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		log.Printf("setReaction update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reaction"})
+		return
+	}
+
+	// A removal reports the emoji that was taken away; a replacement is an
+	// add that also carries the emoji it replaced
+	action := "added"
+	if emoji == "" {
+		action = "removed"
+	}
+	payload := map[string]interface{}{
+		"messageId": msg.ID.Hex(),
+		"chatId":    msg.ChatID.Hex(),
+		"userId":    userID.Hex(),
+		"emoji":     emoji,
+		"action":    action,
+		"reactions": reactionSummary(updated.Reactions),
+		"timestamp": time.Now().Unix(),
+	}
+	if action == "removed" {
+		payload["emoji"] = previous
+	} else if previous != "" {
+		payload["previousEmoji"] = previous
+	}
+
+	// Removing a reaction that wasn't there changes nothing worth announcing
+	if wsManager != nil && emoji != previous {
+		exclude := ""
+		if !config.Bool("WS_REACTION_ECHO", true) {
+			exclude = userID.Hex()
+		}
+		wsManager.BroadcastMessageReaction(payload, exclude)
+	}
+
+	c.JSON(http.StatusOK, payload)
+}
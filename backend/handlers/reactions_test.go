@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIsValidEmoji(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"👍", true},
+		{"❤️", true},
+		{"👍🏽", true},
+		{"👨‍👩‍👧", true},
+		{"1️⃣", true},
+		{"🇳🇬", true},
+		{"", false},
+		{"a", false},
+		{"lol", false},
+		{"👍 nice", false},
+		{"\u200d", false},
+		{"👍👍👍👍👍👍👍👍👍👍👍👍👍👍👍👍👍", false},
+	}
+	for _, tt := range tests {
+		if got := isValidEmoji(tt.in); got != tt.want {
+			t.Errorf("isValidEmoji(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func react(t *testing.T, method string, userID, messageID primitive.ObjectID, emoji string) *httptest.ResponseRecorder {
+	t.Helper()
+	handler, body := AddReaction, interface{}(gin.H{"emoji": emoji})
+	if method == http.MethodDelete {
+		handler, body = RemoveReaction, nil
+	}
+	params := gin.Params{{Key: "id", Value: messageID.Hex()}}
+	return testRequest(t, handler, method, "/api/messages/"+messageID.Hex()+"/reactions", body, userID.Hex(), params)
+}
+
+func TestReactions(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	msgID := insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: alice, Content: "hi", CreatedAt: time.Now().Unix()})
+	stored := func() map[string]string {
+		t.Helper()
+		var msg models.Message
+		if err := database.Messages.FindOne(ctx, bson.M{"_id": msgID}).Decode(&msg); err != nil {
+			t.Fatalf("loading message: %v", err)
+		}
+		byUser := make(map[string]string, len(msg.Reactions))
+		for _, r := range msg.Reactions {
+			byUser[r.UserID.Hex()] = r.Emoji
+		}
+		return byUser
+	}
+	expectReactions := func(step string, want map[string]string) {
+		t.Helper()
+		got := stored()
+		if len(got) != len(want) {
+			t.Errorf("%s: reactions = %v, want %v", step, got, want)
+			return
+		}
+		for user, emoji := range want {
+			if got[user] != emoji {
+				t.Errorf("%s: reactions = %v, want %v", step, got, want)
+				return
+			}
+		}
+	}
+
+	w := react(t, http.MethodPost, alice, msgID, "👍")
+	expectStatus(t, w, http.StatusOK)
+	if body := decodeBody(t, w); body["action"] != "added" || body["emoji"] != "👍" {
+		t.Errorf("add response = %v", body)
+	}
+	expectStatus(t, react(t, http.MethodPost, bob, msgID, "😂"), http.StatusOK)
+	expectReactions("after adding", map[string]string{alice.Hex(): "👍", bob.Hex(): "😂"})
+
+	// A different emoji replaces the caller's reaction
+	w = react(t, http.MethodPost, alice, msgID, "❤️")
+	expectStatus(t, w, http.StatusOK)
+	if body := decodeBody(t, w); body["action"] != "added" || body["previousEmoji"] != "👍" {
+		t.Errorf("replace response = %v", body)
+	}
+	expectReactions("after replacing", map[string]string{alice.Hex(): "❤️", bob.Hex(): "😂"})
+
+	// The same emoji again toggles it off
+	w = react(t, http.MethodPost, alice, msgID, "❤️")
+	expectStatus(t, w, http.StatusOK)
+	if body := decodeBody(t, w); body["action"] != "removed" || body["emoji"] != "❤️" {
+		t.Errorf("toggle response = %v", body)
+	}
+	expectReactions("after toggling", map[string]string{bob.Hex(): "😂"})
+
+	expectStatus(t, react(t, http.MethodDelete, bob, msgID, ""), http.StatusOK)
+	expectStatus(t, react(t, http.MethodDelete, bob, msgID, ""), http.StatusOK)
+	expectReactions("after removing", map[string]string{})
+
+	tests := []struct {
+		name   string
+		method string
+		by     primitive.ObjectID
+		id     primitive.ObjectID
+		emoji  string
+		want   int
+	}{
+		{"plain text", http.MethodPost, alice, msgID, "ok", http.StatusBadRequest},
+		{"several emoji and text", http.MethodPost, alice, msgID, "👍 yes", http.StatusBadRequest},
+		{"non-participant adds", http.MethodPost, carol, msgID, "👍", http.StatusForbidden},
+		{"non-participant removes", http.MethodDelete, carol, msgID, "", http.StatusForbidden},
+		{"deleted message", http.MethodPost, alice, insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: bob, Deleted: true, CreatedAt: time.Now().Unix()}), "👍", http.StatusBadRequest},
+		{"missing message", http.MethodPost, alice, primitive.NewObjectID(), "👍", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, react(t, tt.method, tt.by, tt.id, tt.emoji), tt.want)
+		})
+	}
+	expectReactions("after rejected requests", map[string]string{})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// reportCooldown is how long before the same reporter can report the
+	// same user again
+	reportCooldown = 24 * time.Hour
+
+	// defaultMaxReportDetailsLength caps the free-text details when
+	// MAX_REPORT_DETAILS_LENGTH is unset
+	defaultMaxReportDetailsLength = 1000
+
+	defaultReportsLimit = 20
+	maxReportsLimit     = 100
+)
+
+// ReportUser files a moderation report against another user
+func ReportUser(c *gin.Context) {
+	var req struct {
+		TargetUserID string `json:"targetUserId" binding:"required"`
+		Reason       string `json:"reason" binding:"required"`
+		Details      string `json:"details"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	targetID, err := parseObjectID(c, req.TargetUserID, "target user ID")
+	if err != nil {
+		return
+	}
+
+	if userID == targetID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot report yourself"})
+		return
+	}
+
+	if !models.IsValidReportReason(req.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid reason",
+			"allowed": []string{
+				models.ReportReasonSpam,
+				models.ReportReasonHarassment,
+				models.ReportReasonFake,
+				models.ReportReasonOther,
+			},
+		})
+		return
+	}
+
+	details, err := cleanProfileText("details", req.Details, config.Int("MAX_REPORT_DETAILS_LENGTH", defaultMaxReportDetailsLength), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	reportsColl := database.Reports
+
+	now := time.Now()
+	recent, err := reportsColl.CountDocuments(ctx, bson.M{
+		"reporterId":   userID,
+		"targetUserId": targetID,
+		"createdAt":    bson.M{"$gte": now.Add(-reportCooldown).Unix()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if recent > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Already reported",
+			"message": "You have already reported this user recently",
+		})
+		return
+	}
+
+	report := models.Report{
+		ID:           primitive.NewObjectID(),
+		ReporterID:   userID,
+		TargetUserID: targetID,
+		Reason:       req.Reason,
+		Details:      details,
+		CreatedAt:    now.Unix(),
+	}
+	if _, err := reportsColl.InsertOne(ctx, report); err != nil {
+		log.Printf("ReportUser insert error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit report"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Report submitted",
+		"id":      report.ID.Hex(),
+	})
+}
+
+// GetReports lists reports newest first for admins, with ?skip= and ?limit=
+func GetReports(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	reportsColl := database.Reports
+
+	skip, limit := pageParams(c,
+		config.Int("REPORTS_DEFAULT_LIMIT", defaultReportsLimit),
+		config.Int("REPORTS_MAX_LIMIT", maxReportsLimit),
+	)
+
+	total, err := reportsColl.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count reports"})
+		return
+	}
+
+	pipeline := pagedPipeline(bson.D{}, bson.D{{Key: "createdAt", Value: -1}}, skip, limit)
+	pipeline = withUserJoin(pipeline, "reporterId", "reporter", publicUserFields)
+	pipeline = withUserJoin(pipeline, "targetUserId", "target", publicUserFields)
+
+	cursor, err := reportsColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("GetReports aggregate error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		models.Report `bson:",inline"`
+		Reporter      *models.User `bson:"reporter"`
+		Target        *models.User `bson:"target"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode reports"})
+		return
+	}
+
+	reports := make([]map[string]interface{}, len(results))
+	for i, r := range results {
+		reports[i] = map[string]interface{}{
+			"id":        r.ID.Hex(),
+			"reason":    r.Reason,
+			"details":   r.Details,
+			"createdAt": r.CreatedAt,
+			"reporter":  publicProfile(r.ReporterID, r.Reporter),
+			"target":    publicProfile(r.TargetUserID, r.Target),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": reports,
+		"total":   total,
+		"skip":    skip,
+		"limit":   limit,
+	})
+}
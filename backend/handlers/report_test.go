@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func fileReport(t *testing.T, reporter primitive.ObjectID, body gin.H) *httptest.ResponseRecorder {
+	t.Helper()
+	return testRequest(t, ReportUser, http.MethodPost, "/api/report", body, reporter.Hex(), nil)
+}
+
+func TestReportUserValidation(t *testing.T) {
+	t.Setenv("MAX_REPORT_DETAILS_LENGTH", "50")
+	reporter, target := primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name string
+		body gin.H
+	}{
+		{"missing target", gin.H{"reason": models.ReportReasonSpam}},
+		{"missing reason", gin.H{"targetUserId": target.Hex()}},
+		{"malformed target", gin.H{"targetUserId": "nope", "reason": models.ReportReasonSpam}},
+		{"self report", gin.H{"targetUserId": reporter.Hex(), "reason": models.ReportReasonSpam}},
+		{"unknown reason", gin.H{"targetUserId": target.Hex(), "reason": "ugly"}},
+		{"details too long", gin.H{"targetUserId": target.Hex(), "reason": models.ReportReasonOther, "details": strings.Repeat("x", 51)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, fileReport(t, reporter, tt.body), http.StatusBadRequest)
+		})
+	}
+}
+
+func TestReportUserRejectsDuplicatesWithinCooldown(t *testing.T) {
+	ctx := requireDB(t)
+	reporter, target, other := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	t.Cleanup(func() {
+		database.Reports.DeleteMany(context.Background(), bson.M{"reporterId": reporter})
+	})
+	report := func(about primitive.ObjectID) *httptest.ResponseRecorder {
+		return fileReport(t, reporter, gin.H{"targetUserId": about.Hex(), "reason": models.ReportReasonHarassment, "details": "  rude  "})
+	}
+
+	w := report(target)
+	expectStatus(t, w, http.StatusCreated)
+	id, _ := primitive.ObjectIDFromHex(decodeBody(t, w)["id"].(string))
+	var stored models.Report
+	if err := database.Reports.FindOne(ctx, bson.M{"_id": id}).Decode(&stored); err != nil {
+		t.Fatalf("loading report: %v", err)
+	}
+	if stored.ReporterID != reporter || stored.TargetUserID != target || stored.Details != "rude" {
+		t.Errorf("stored report = %+v", stored)
+	}
+
+	expectStatus(t, report(target), http.StatusConflict)
+	expectStatus(t, report(other), http.StatusCreated)
+
+	// Once the cooldown has passed the same user can be reported again
+	old := time.Now().Add(-reportCooldown - time.Minute).Unix()
+	if _, err := database.Reports.UpdateMany(ctx, bson.M{"reporterId": reporter, "targetUserId": target}, bson.M{"$set": bson.M{"createdAt": old}}); err != nil {
+		t.Fatalf("ageing reports: %v", err)
+	}
+	expectStatus(t, report(target), http.StatusCreated)
+}
+
+func TestGetReportsListsNewestFirst(t *testing.T) {
+	ctx := requireDB(t)
+	reporter, target := insertTestUser(t, ctx, bson.M{"name": "Reporter"}), insertTestUser(t, ctx, bson.M{"name": "Target"})
+	// Dated ahead so they sort above anything else in the collection
+	future := time.Now().Add(time.Hour).Unix()
+	reports := make([]interface{}, 3)
+	ids := make([]string, 3)
+	for i := range reports {
+		id := primitive.NewObjectID()
+		ids[i] = id.Hex()
+		reports[i] = models.Report{ID: id, ReporterID: reporter, TargetUserID: target, Reason: models.ReportReasonFake, CreatedAt: future + int64(i)}
+	}
+	insertDocs(t, ctx, database.Reports, reports...)
+
+	list := func(query string) []interface{} {
+		t.Helper()
+		w := testRequest(t, GetReports, http.MethodGet, "/api/admin/reports?"+query, nil, reporter.Hex(), nil)
+		expectStatus(t, w, http.StatusOK)
+		body := decodeBody(t, w)
+		if total, _ := body["total"].(float64); total < 3 {
+			t.Errorf("total = %v, want at least the 3 inserted", body["total"])
+		}
+		return body["reports"].([]interface{})
+	}
+
+	page := list("limit=2")
+	if len(page) != 2 {
+		t.Fatalf("limit=2 returned %d reports", len(page))
+	}
+	for i, want := range []string{ids[2], ids[1]} {
+		r := page[i].(map[string]interface{})
+		if r["id"] != want {
+			t.Errorf("report %d = %v, want %s", i, r["id"], want)
+		}
+		reporterProfile, _ := r["reporter"].(map[string]interface{})
+		targetProfile, _ := r["target"].(map[string]interface{})
+		if reporterProfile["name"] != "Reporter" || targetProfile["name"] != "Target" {
+			t.Errorf("report %d joined reporter %v and target %v", i, reporterProfile, targetProfile)
+		}
+	}
+
+	if next := list("skip=2&limit=1"); len(next) != 1 || next[0].(map[string]interface{})["id"] != ids[0] {
+		t.Errorf("skip=2&limit=1 returned %v, want the oldest inserted report", next)
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/middleware"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultRefreshTokenTTL is used when REFRESH_TOKEN_TTL is unset
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	// defaultAccessTokenTTL is used when ACCESS_TOKEN_TTL is unset; clients
+	// renew through POST /refresh before it runs out
+	defaultAccessTokenTTL = 15 * time.Minute
+)
+
+// issueAccessToken signs a JWT for userID and returns it with its expiry
+func issueAccessToken(userID primitive.ObjectID) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(config.Duration("ACCESS_TOKEN_TTL", defaultAccessTokenTTL))
+	claims := &middleware.Claims{
+		UserID: userID.Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		jwtSecret = "your-secret-key-change-this-in-production"
+		log.Println("⚠️  Using default JWT secret. Set JWT_SECRET environment variable!")
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expirationTime, nil
+}
+
+// generateToken returns a random 256-bit token, hex encoded
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the value stored for a raw refresh or verification
+// token; the raw token itself is only ever given to the client
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// approximateIP truncates an address to its network (/24 for IPv4, /48 for
+// IPv6) so sessions show a rough location without storing the exact IP
+func approximateIP(raw string) string {
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// issueRefreshToken creates a new session for the user and returns the raw
+// refresh token to hand to the client
+func issueRefreshToken(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	ttl := config.Duration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+
+	session := models.RefreshToken{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		TokenHash:  hashToken(token),
+		Device:     c.Request.UserAgent(),
+		IP:         approximateIP(c.ClientIP()),
+		CreatedAt:  now.Unix(),
+		LastUsedAt: now.Unix(),
+		ExpiresAt:  now.Add(ttl).Unix(),
+	}
+
+	tokensColl := database.RefreshTokens
+	if _, err := tokensColl.InsertOne(ctx, session); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshSession exchanges a refresh token for a new access token. The
+// refresh token is rotated: the response carries a new one and the old one
+// stops working, so a replayed token is rejected. The session keeps its id
+// and its expiry slides forward.
+func RefreshSession(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refreshToken is required"})
+		return
+	}
+
+	newToken, err := generateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	tokensColl := database.RefreshTokens
+
+	// Matching on the old hash makes rotation atomic: of two concurrent
+	// refreshes with the same token only one succeeds
+	now := time.Now()
+	var session models.RefreshToken
+	err = tokensColl.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(req.RefreshToken),
+			"expiresAt": bson.M{"$gt": now.Unix()},
+		},
+		bson.M{"$set": bson.M{
+			"tokenHash":  hashToken(newToken),
+			"lastUsedAt": now.Unix(),
+			"expiresAt":  now.Add(config.Duration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)).Unix(),
+		}},
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid refresh token",
+			"code":    "INVALID_REFRESH_TOKEN",
+			"message": "Please log in again",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("RefreshSession update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	accessToken, expirationTime, err := issueAccessToken(session.UserID)
+	if err != nil {
+		log.Printf("RefreshSession token error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        accessToken,
+		"refreshToken": newToken,
+		"expires":      expirationTime.Unix(),
+	})
+}
+
+// Logout revokes the presented refresh token. It needs no access token, so
+// clients can sign out after theirs has expired, and succeeds even if the
+// token was already revoked.
+func Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refreshToken is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	tokensColl := database.RefreshTokens
+
+	if _, err := tokensColl.DeleteOne(ctx, bson.M{"tokenHash": hashToken(req.RefreshToken)}); err != nil {
+		log.Printf("Logout delete error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// GetSessions lists the caller's active (unexpired) sessions, most recently
+// used first
+func GetSessions(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	tokensColl := database.RefreshTokens
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "lastUsedAt", Value: -1}})
+	cursor, err := tokensColl.Find(ctx, bson.M{
+		"userId":    userID,
+		"expiresAt": bson.M{"$gt": time.Now().Unix()},
+	}, findOptions)
+	if err != nil {
+		log.Printf("GetSessions find error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.RefreshToken{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		log.Printf("GetSessions decode error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs out one of the caller's sessions by deleting its
+// refresh token
+func RevokeSession(c *gin.Context) {
+	sessionID, err := parseObjectID(c, c.Param("id"), "session ID")
+	if err != nil {
+		return
+	}
+
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	tokensColl := database.RefreshTokens
+
+	result, err := tokensColl.DeleteOne(ctx, bson.M{"_id": sessionID, "userId": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAccessTokenUsesShortTTL(t *testing.T) {
+	before := time.Now()
+	_, expires, err := issueAccessToken(primitive.NewObjectID())
+	if err != nil {
+		t.Fatalf("issueAccessToken: %v", err)
+	}
+	if got := expires.Sub(before); got < defaultAccessTokenTTL-time.Second || got > defaultAccessTokenTTL+time.Second {
+		t.Errorf("access token lives %v, want %v", got, defaultAccessTokenTTL)
+	}
+}
+
+func TestRefreshAndLogoutRequireToken(t *testing.T) {
+	for name, handler := range map[string]gin.HandlerFunc{"refresh": RefreshSession, "logout": Logout} {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, handler, http.MethodPost, "/api/"+name, map[string]string{}, "", nil)
+			expectStatus(t, w, http.StatusBadRequest)
+		})
+	}
+}
+
+// newSession issues a refresh token for a fresh user id
+func newSession(t *testing.T) string {
+	t.Helper()
+	return newSessionFor(t, primitive.NewObjectID())
+}
+
+// newSessionFor issues a refresh token for userID
+func newSessionFor(t *testing.T, userID primitive.ObjectID) string {
+	t.Helper()
+	ctx := requireDB(t)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	token, err := issueRefreshToken(ctx, c, userID)
+	if err != nil {
+		t.Fatalf("issueRefreshToken: %v", err)
+	}
+	return token
+}
+
+func refresh(t *testing.T, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	return testRequest(t, RefreshSession, http.MethodPost, "/api/refresh", map[string]string{"refreshToken": token}, "", nil)
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	first := newSession(t)
+
+	w := refresh(t, first)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeBody(t, w)
+	second, _ := body["refreshToken"].(string)
+	if second == "" || second == first {
+		t.Fatalf("refresh returned refreshToken %q, want a new one", second)
+	}
+	if token, _ := body["token"].(string); token == "" {
+		t.Error("refresh returned no access token")
+	}
+
+	// The rotated token works once more
+	expectStatus(t, refresh(t, second), http.StatusOK)
+}
+
+func TestRefreshRejectsReuseAfterRotation(t *testing.T) {
+	first := newSession(t)
+	expectStatus(t, refresh(t, first), http.StatusOK)
+
+	w := refresh(t, first)
+	expectStatus(t, w, http.StatusUnauthorized)
+	if code := decodeBody(t, w)["code"]; code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("code = %v, want INVALID_REFRESH_TOKEN", code)
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	token := newSession(t)
+
+	w := testRequest(t, Logout, http.MethodPost, "/api/logout", map[string]string{"refreshToken": token}, "", nil)
+	expectStatus(t, w, http.StatusOK)
+
+	expectStatus(t, refresh(t, token), http.StatusUnauthorized)
+
+	// Logging out again is harmless
+	w = testRequest(t, Logout, http.MethodPost, "/api/logout", map[string]string{"refreshToken": token}, "", nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+// listSessions returns the ids of userID's sessions from GetSessions
+func listSessions(t *testing.T, userID primitive.ObjectID) []string {
+	t.Helper()
+	w := testRequest(t, GetSessions, http.MethodGet, "/api/sessions", nil, userID.Hex(), nil)
+	expectStatus(t, w, http.StatusOK)
+	var sessions []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("decoding sessions: %v", err)
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if _, ok := session["tokenHash"]; ok {
+			t.Error("session listing exposes the token hash")
+		}
+		id, _ := session["id"].(string)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// sessionID returns the id of the session a refresh token belongs to
+func sessionID(t *testing.T, ctx context.Context, token string) string {
+	t.Helper()
+	var session models.RefreshToken
+	if err := database.RefreshTokens.FindOne(ctx, bson.M{"tokenHash": hashToken(token)}).Decode(&session); err != nil {
+		t.Fatalf("loading session: %v", err)
+	}
+	return session.ID.Hex()
+}
+
+func revokeSession(t *testing.T, userID primitive.ObjectID, sessionID string) *httptest.ResponseRecorder {
+	t.Helper()
+	params := gin.Params{{Key: "id", Value: sessionID}}
+	return testRequest(t, RevokeSession, http.MethodDelete, "/api/sessions/"+sessionID, nil, userID.Hex(), params)
+}
+
+func TestRevokeSessionLeavesOthers(t *testing.T) {
+	ctx := requireDB(t)
+	alice := primitive.NewObjectID()
+	laptop := newSessionFor(t, alice)
+	phone := newSessionFor(t, alice)
+	tablet := newSessionFor(t, alice)
+
+	if ids := listSessions(t, alice); len(ids) != 3 {
+		t.Fatalf("GetSessions listed %d sessions, want 3", len(ids))
+	}
+
+	phoneID := sessionID(t, ctx, phone)
+	expectStatus(t, revokeSession(t, alice, phoneID), http.StatusOK)
+
+	left := listSessions(t, alice)
+	if len(left) != 2 || slices.Contains(left, phoneID) {
+		t.Errorf("sessions after revoking the phone = %v, want the other two", left)
+	}
+	expectStatus(t, refresh(t, phone), http.StatusUnauthorized)
+	expectStatus(t, refresh(t, laptop), http.StatusOK)
+	expectStatus(t, refresh(t, tablet), http.StatusOK)
+
+	// Revoking it again finds nothing
+	expectStatus(t, revokeSession(t, alice, phoneID), http.StatusNotFound)
+}
+
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+	ctx := requireDB(t)
+	alice, mallory := primitive.NewObjectID(), primitive.NewObjectID()
+	token := newSessionFor(t, alice)
+	newSessionFor(t, mallory)
+
+	w := revokeSession(t, mallory, sessionID(t, ctx, token))
+	expectStatus(t, w, http.StatusNotFound)
+	if got := listSessions(t, mallory); len(got) != 1 {
+		t.Errorf("mallory lists %d sessions, want only the one issued to mallory", len(got))
+	}
+	if got := listSessions(t, alice); len(got) != 1 {
+		t.Errorf("alice lists %d sessions, want 1", len(got))
+	}
+	expectStatus(t, refresh(t, token), http.StatusOK)
+}
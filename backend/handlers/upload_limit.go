@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+
+	"coded/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaxConcurrentUploads is used when MAX_CONCURRENT_UPLOADS is unset
+const defaultMaxConcurrentUploads = 2
+
+// uploadLimiter tracks in-flight Cloudinary uploads per user so a single
+// client can't tie up the server with many parallel 30s uploads
+type uploadLimiter struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+var uploads = &uploadLimiter{inFlight: make(map[string]int)}
+
+// acquire reserves an upload slot for the user, returning false when the
+// user already has max uploads in flight
+func (l *uploadLimiter) acquire(userID string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight[userID] >= max {
+		return false
+	}
+	l.inFlight[userID]++
+	return true
+}
+
+// release frees a slot taken by acquire
+func (l *uploadLimiter) release(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight[userID] <= 1 {
+		delete(l.inFlight, userID)
+		return
+	}
+	l.inFlight[userID]--
+}
+
+// acquireUploadSlot reserves an upload slot for the user or writes a 429.
+// Callers must defer releaseUploadSlot when it returns true.
+func acquireUploadSlot(c *gin.Context, userID string) bool {
+	max := config.Int("MAX_CONCURRENT_UPLOADS", defaultMaxConcurrentUploads)
+	if !uploads.acquire(userID, max) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Too many uploads in progress",
+			"message": "Wait for your current uploads to finish and try again",
+		})
+		return false
+	}
+	return true
+}
+
+// releaseUploadSlot frees a slot reserved by acquireUploadSlot
+func releaseUploadSlot(userID string) {
+	uploads.release(userID)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// blockingClassifier holds every image in CheckImage until release is
+// closed, then rejects it so no upload reaches Cloudinary
+type blockingClassifier struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingClassifier) CheckImage(ctx context.Context, image io.Reader) (bool, string, error) {
+	b.entered <- struct{}{}
+	<-b.release
+	return false, "held for the test", nil
+}
+
+// uploadPhotoAs posts a small photo to UploadPhoto as userID
+func uploadPhotoAs(t *testing.T, userID string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("photo", "photo.jpg")
+	part.Write([]byte("not really a jpeg"))
+	form.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/upload-photo", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	c.Set("userId", userID)
+	UploadPhoto(c)
+	return w
+}
+
+func TestThirdConcurrentUploadIsRefused(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_UPLOADS", "2")
+	classifier := &blockingClassifier{entered: make(chan struct{}, 2), release: make(chan struct{})}
+	useImageModerator(t, classifier)
+	user := primitive.NewObjectID().Hex()
+
+	// Two uploads stuck in moderation hold both of the user's slots
+	var wg sync.WaitGroup
+	held := make([]*httptest.ResponseRecorder, 2)
+	for i := range held {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			held[i] = uploadPhotoAs(t, user)
+		}(i)
+	}
+	for range held {
+		select {
+		case <-classifier.entered:
+		case <-time.After(2 * time.Second):
+			t.Fatal("upload never reached moderation")
+		}
+	}
+
+	// The third is refused before it reaches the classifier
+	w := uploadPhotoAs(t, user)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	select {
+	case <-classifier.entered:
+		t.Error("refused upload was still sent to moderation")
+	default:
+	}
+
+	// Another user isn't affected
+	other := make(chan *httptest.ResponseRecorder, 1)
+	go func() { other <- uploadPhotoAs(t, primitive.NewObjectID().Hex()) }()
+	select {
+	case <-classifier.entered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("another user's upload was held back")
+	}
+
+	close(classifier.release)
+	wg.Wait()
+	<-other
+	for i, w := range held {
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("held upload %d: status %d, want the classifier's 422", i, w.Code)
+		}
+	}
+
+	// Rejected uploads give their slots back
+	classifier.entered = make(chan struct{}, 1)
+	if w := uploadPhotoAs(t, user); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("upload after the others finished: status %d, want 422", w.Code)
+	}
+}
@@ -4,11 +4,16 @@ import (
     "context"
     "crypto/rand"
     "encoding/hex"
+    "fmt"
     "log"
     "net/http"
+    "net/url"
     "os"
+    "strings"
     "time"
+    "unicode"
 
+    "coded/config"
     "coded/database"
     "coded/models"
 
@@ -18,6 +23,7 @@ import (
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // DO NOT DECLARE fallbackAvatar HERE - it's now in common.go
@@ -28,11 +34,22 @@ type OnboardingData struct {
     BirthDate    int64    `json:"birthDate,omitempty" form:"birthDate"`
     Gender       string   `json:"gender" form:"gender"`
     InterestedIn []string `json:"interestedIn" form:"interestedIn"`
+    Interests    []string `json:"interests" form:"interests"`
     Bio          string   `json:"bio" form:"bio"`
     Status       string   `json:"status" form:"status"`
     Photos       []string `json:"photos" form:"photos"`
     Latitude     *float64 `json:"latitude,omitempty" form:"latitude"`
     Longitude    *float64 `json:"longitude,omitempty" form:"longitude"`
+    // Clear lists list fields to reset to empty. JSON clients can also send
+    // an explicit [] for the field; an absent field is left unchanged.
+    Clear        []string `json:"clear" form:"clear"`
+}
+
+// clearableProfileFields are the list fields UpdateMyProfile can reset to empty
+var clearableProfileFields = map[string]bool{
+    "interestedIn": true,
+    "interests":    true,
+    "photos":       true,
 }
 
 // Helper: generate a unique 8-character referral code
@@ -44,6 +61,41 @@ func generateReferralCode() (string, error) {
     return hex.EncodeToString(b), nil
 }
 
+// uniqueReferralCode generates referral codes until one isn't taken
+func uniqueReferralCode(ctx context.Context, usersColl *mongo.Collection) (string, error) {
+    for {
+        code, err := generateReferralCode()
+        if err != nil {
+            return "", err
+        }
+        count, err := usersColl.CountDocuments(ctx, bson.M{"referralCode": code})
+        if err != nil {
+            return "", err
+        }
+        if count == 0 {
+            return code, nil
+        }
+    }
+}
+
+// referralURL is the signup link shared for a referral code
+func referralURL(code string) string {
+    baseURL := "https://codedsignal.org/"
+    return baseURL + "/register?ref=" + code
+}
+
+// newUserWindow is how long after signup a profile shows the "New" badge
+const newUserWindow = 7 * 24 * time.Hour
+
+// isNewUser reports whether an account was created within NEW_USER_WINDOW
+func isNewUser(createdAt int64) bool {
+    if createdAt == 0 {
+        return false
+    }
+    window := config.Duration("NEW_USER_WINDOW", newUserWindow)
+    return time.Since(time.Unix(createdAt, 0)) < window
+}
+
 // GetUser - Fixed to always return 200 OK with fallback data for missing users
 func GetUser(c *gin.Context) {
     userIDStr := c.Param("id")
@@ -67,15 +119,19 @@ func GetUser(c *gin.Context) {
             "distance":   0,
             "rating":     0,
             "lastActive": 0,
+            "lastSeen":   0,
             "interests":  []string{},
+            "commonInterests": []string{},
+            "isNew":      false,
+            "isOnline":   false,
         })
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
 
     var user models.User
     err = usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
@@ -92,7 +148,11 @@ func GetUser(c *gin.Context) {
             "distance":   0,
             "rating":     0,
             "lastActive": 0,
+            "lastSeen":   0,
             "interests":  []string{},
+            "commonInterests": []string{},
+            "isNew":      false,
+            "isOnline":   false,
         })
         return
     }
@@ -102,7 +162,27 @@ func GetUser(c *gin.Context) {
         return
     }
 
-    c.JSON(http.StatusOK, user)
+    if user.Interests == nil {
+        user.Interests = []string{}
+    }
+    user.Status = liveStatus(user.ID, user.Status)
+
+    // Shared hobbies with the caller
+    var viewer models.User
+    if viewerID, err := primitive.ObjectIDFromHex(c.GetString("userId")); err == nil {
+        projection := options.FindOne().SetProjection(bson.M{"interests": 1})
+        if err := usersColl.FindOne(ctx, bson.M{"_id": viewerID}, projection).Decode(&viewer); err != nil && err != mongo.ErrNoDocuments {
+            log.Printf("[GetUser] Failed to load viewer interests: %v", err)
+        }
+    }
+
+    c.JSON(http.StatusOK, struct {
+        models.User
+        Age             int      `json:"age"`
+        CommonInterests []string `json:"commonInterests"`
+        IsNew           bool     `json:"isNew"`
+        IsOnline        bool     `json:"isOnline"`
+    }{user, displayAge(user.BirthDate), commonInterests(viewer.Interests, user.Interests), isNewUser(user.CreatedAt), isUserOnline(user.ID)})
 }
 
 // GetMyProfile - Fixed with better error handling
@@ -134,10 +214,10 @@ func GetMyProfile(c *gin.Context) {
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
     log.Printf("[GetMyProfile] Querying MongoDB for user: %s", userID.Hex())
 
     var user models.User
@@ -177,23 +257,16 @@ func GetMyProfile(c *gin.Context) {
     if user.InterestedIn == nil {
         user.InterestedIn = []string{}
     }
+    if user.Interests == nil {
+        user.Interests = []string{}
+    }
 
     // Generate referral code if missing
     if user.ReferralCode == "" {
-        var code string
-        for {
-            code, err = generateReferralCode()
-            if err != nil {
-                log.Printf("[GetMyProfile] Failed to generate referral code: %v", err)
-                break
-            }
-            count, _ := usersColl.CountDocuments(ctx, bson.M{"referralCode": code})
-            if count == 0 {
-                break
-            }
-        }
-
-        if code != "" {
+        code, err := uniqueReferralCode(ctx, usersColl)
+        if err != nil {
+            log.Printf("[GetMyProfile] Failed to generate referral code: %v", err)
+        } else {
             _, err = usersColl.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"referralCode": code}})
             if err != nil {
                 log.Printf("[GetMyProfile] Failed to save referral code: %v", err)
@@ -203,6 +276,8 @@ func GetMyProfile(c *gin.Context) {
         }
     }
 
+    completeness, _ := user.ProfileCompleteness()
+
     // Return successful response
     c.JSON(http.StatusOK, gin.H{
         "id":           user.ID.Hex(),
@@ -216,27 +291,134 @@ func GetMyProfile(c *gin.Context) {
         "birthDate":    user.BirthDate,
         "gender":       user.Gender,
         "interestedIn": user.InterestedIn,
+        "interests":    user.Interests,
         "latitude":     user.Latitude,
         "longitude":    user.Longitude,
         "createdAt":    user.CreatedAt,
+        "isNew":        isNewUser(user.CreatedAt),
         "lastSeen":     user.LastSeen,
         "referralCode": user.ReferralCode,
+        "hideMessagePreviews": user.HideMessagePreviews,
+        "profileCompleteness": completeness,
         "message":      "Profile fetched successfully",
     })
 }
 
+// defaultMaxProfilePhotos caps the photos array when MAX_PROFILE_PHOTOS is unset
+const defaultMaxProfilePhotos = 6
+
+// cloudinaryHost serves every asset uploaded through UploadPhoto
+const cloudinaryHost = "res.cloudinary.com"
+
+// defaultCloudinaryFolderPrefix namespaces uploads when
+// CLOUDINARY_FOLDER_PREFIX is unset. Give each environment its own prefix
+// (e.g. "coded-dev") so they don't share assets.
+const defaultCloudinaryFolderPrefix = "coded"
+
+// uploadFolder returns the Cloudinary folder for a kind of upload
+// ("avatars", "photos", "posts") under the environment's prefix
+func uploadFolder(kind string) string {
+    prefix := strings.Trim(config.String("CLOUDINARY_FOLDER_PREFIX", defaultCloudinaryFolderPrefix), "/")
+    if prefix == "" {
+        prefix = defaultCloudinaryFolderPrefix
+    }
+    return prefix + "/" + kind
+}
+
+// validateProfilePhotos checks the photo count and that each URL was served
+// from our Cloudinary account (https://res.cloudinary.com/<cloud>/...), so
+// profiles can't point at arbitrary external images
+func validateProfilePhotos(photos []string) error {
+    maxPhotos := config.Int("MAX_PROFILE_PHOTOS", defaultMaxProfilePhotos)
+    if len(photos) > maxPhotos {
+        return fmt.Errorf("at most %d photos allowed", maxPhotos)
+    }
+
+    // cloudinary://<key>:<secret>@<cloud name>
+    var cloudName string
+    if cldURL, err := url.Parse(os.Getenv("CLOUDINARY_URL")); err == nil {
+        cloudName = cldURL.Host
+    }
+
+    for _, photo := range photos {
+        u, err := url.Parse(photo)
+        if err != nil || u.Scheme != "https" || u.Host != cloudinaryHost {
+            return fmt.Errorf("photo must be uploaded through the app: %s", photo)
+        }
+        if cloudName != "" && !strings.HasPrefix(u.Path, "/"+cloudName+"/") {
+            return fmt.Errorf("photo must be uploaded through the app: %s", photo)
+        }
+    }
+    return nil
+}
+
+// Profile text limits (in characters); override with MAX_NAME_LENGTH and
+// MAX_BIO_LENGTH
+const (
+    defaultMaxNameLength = 50
+    defaultMaxBioLength  = 500
+)
+
+// stripControlChars removes control characters, keeping newlines when
+// keepNewlines is set (bios may span lines)
+func stripControlChars(s string, keepNewlines bool) string {
+    return strings.Map(func(r rune) rune {
+        if r == '\n' && keepNewlines {
+            return r
+        }
+        if unicode.IsControl(r) {
+            return -1
+        }
+        return r
+    }, s)
+}
+
+// cleanProfileText strips control characters and surrounding whitespace,
+// then rejects values longer than maxLen characters
+func cleanProfileText(field, value string, maxLen int, keepNewlines bool) (string, error) {
+    cleaned := strings.TrimSpace(stripControlChars(value, keepNewlines))
+    if n := len([]rune(cleaned)); n > maxLen {
+        return "", fmt.Errorf("%s must be at most %d characters", field, maxLen)
+    }
+    return cleaned, nil
+}
+
+// hasProfilePhoto reports whether the user has a real avatar (not the
+// placeholder) or at least one uploaded photo
+func hasProfilePhoto(u *models.User) bool {
+    return (u.Avatar != "" && u.Avatar != fallbackAvatar) || len(u.Photos) > 0
+}
+
+// visibleInDiscovery reports whether a user may appear in the feed and nearby
+// lists. With REQUIRE_PHOTO_FOR_VISIBILITY set, photoless profiles are hidden
+// (they can still browse).
+func visibleInDiscovery(u *models.User) bool {
+    return !config.Bool("REQUIRE_PHOTO_FOR_VISIBILITY", false) || hasProfilePhoto(u)
+}
+
+// discoveryVisibleFilter is visibleInDiscovery as a query, for lists that
+// page in the database. It returns nil when everyone is visible.
+func discoveryVisibleFilter() bson.M {
+    if !config.Bool("REQUIRE_PHOTO_FOR_VISIBILITY", false) {
+        return nil
+    }
+    return bson.M{"$or": bson.A{
+        bson.M{"avatar": bson.M{"$exists": true, "$nin": bson.A{"", fallbackAvatar}}},
+        bson.M{"photos.0": bson.M{"$exists": true}},
+    }}
+}
+
 func UpdateMyProfile(c *gin.Context) {
     userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
     defer cancel()
 
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
 
     update := bson.M{"$set": bson.M{}}
 
@@ -260,31 +442,85 @@ func UpdateMyProfile(c *gin.Context) {
         }
     }
 
+    clearFields := make(map[string]bool, len(data.Clear))
+    for _, field := range data.Clear {
+        if !clearableProfileFields[field] {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Field cannot be cleared: " + field})
+            return
+        }
+        clearFields[field] = true
+    }
+
     if data.Name != "" {
-        update["$set"].(bson.M)["name"] = data.Name
+        name, err := cleanProfileText("name", data.Name, config.Int("MAX_NAME_LENGTH", defaultMaxNameLength), false)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if name == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be blank"})
+            return
+        }
+        update["$set"].(bson.M)["name"] = name
     }
     if data.BirthDate != 0 {
+        if !validateBirthDate(c, data.BirthDate) {
+            return
+        }
         update["$set"].(bson.M)["birthDate"] = data.BirthDate
     }
     if data.Gender != "" {
         update["$set"].(bson.M)["gender"] = data.Gender
     }
+    // A nil slice means the field was absent; a non-nil empty one is an
+    // explicit [] and clears it
     if len(data.InterestedIn) > 0 {
         update["$set"].(bson.M)["interestedIn"] = data.InterestedIn
+    } else if data.InterestedIn != nil || clearFields["interestedIn"] {
+        update["$set"].(bson.M)["interestedIn"] = []string{}
+    }
+    if len(data.Interests) > 0 {
+        interests, err := normalizeInterests(data.Interests)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        update["$set"].(bson.M)["interests"] = interests
+    } else if data.Interests != nil || clearFields["interests"] {
+        update["$set"].(bson.M)["interests"] = []string{}
     }
     if data.Bio != "" {
-        update["$set"].(bson.M)["bio"] = data.Bio
+        bio, err := cleanProfileText("bio", data.Bio, config.Int("MAX_BIO_LENGTH", defaultMaxBioLength), true)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        update["$set"].(bson.M)["bio"] = bio
     }
     if data.Status != "" {
         update["$set"].(bson.M)["status"] = data.Status
     }
     if len(data.Photos) > 0 {
+        if err := validateProfilePhotos(data.Photos); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
         update["$set"].(bson.M)["photos"] = data.Photos
+    } else if data.Photos != nil || clearFields["photos"] {
+        update["$set"].(bson.M)["photos"] = []string{}
     }
     if data.Latitude != nil {
+        if *data.Latitude < -90 || *data.Latitude > 90 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "latitude must be between -90 and 90"})
+            return
+        }
         update["$set"].(bson.M)["latitude"] = *data.Latitude
     }
     if data.Longitude != nil {
+        if *data.Longitude < -180 || *data.Longitude > 180 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "longitude must be between -180 and 180"})
+            return
+        }
         update["$set"].(bson.M)["longitude"] = *data.Longitude
     }
 
@@ -296,6 +532,21 @@ func UpdateMyProfile(c *gin.Context) {
     if err == nil {
         defer avatarFile.Close()
 
+        // Take the slot before moderation so the external classifier calls
+        // are bounded per user too
+        if !acquireUploadSlot(c, userIDStr) {
+            return
+        }
+        defer releaseUploadSlot(userIDStr)
+
+        if !checkImageDimensions(c, avatarFile) {
+            return
+        }
+
+        if !moderateImage(c, ctx, avatarFile) {
+            return
+        }
+
         cld, err := cloudinary.NewFromURL(os.Getenv("CLOUDINARY_URL"))
         if err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Cloudinary configuration error"})
@@ -303,7 +554,7 @@ func UpdateMyProfile(c *gin.Context) {
         }
 
         uploadParams := uploader.UploadParams{
-            Folder:         "coded/avatars",
+            Folder:         uploadFolder("avatars"),
             PublicID:       userID.Hex(),
             Transformation: "c_limit,w_400,h_400,q_auto",
         }
@@ -332,18 +583,78 @@ func UpdateMyProfile(c *gin.Context) {
         return
     }
 
+    if data.Latitude != nil || data.Longitude != nil {
+        invalidateDistances(userID)
+        if err := syncUserLocation(ctx, userID); err != nil {
+            log.Printf("UpdateProfile location sync error: %v", err)
+        }
+    }
+
+    // Let chat partners refresh headers/avatars when public fields change
+    for _, field := range []string{"name", "avatar", "status"} {
+        if _, ok := update["$set"].(bson.M)[field]; ok {
+            notifyProfileUpdated(ctx, userID)
+            break
+        }
+    }
+
     c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
+// notifyProfileUpdated sends the user's current public fields to everyone
+// they share a chat with
+func notifyProfileUpdated(ctx context.Context, userID primitive.ObjectID) {
+    if wsManager == nil {
+        return
+    }
+
+    usersColl := database.Users
+    chatsColl := database.Chats
+
+    var user models.User
+    if err := usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+        log.Printf("[notifyProfileUpdated] Failed to load user %s: %v", userID.Hex(), err)
+        return
+    }
+
+    partners, err := chatsColl.Distinct(ctx, "participants", bson.M{"participants": userID})
+    if err != nil {
+        log.Printf("[notifyProfileUpdated] Failed to load chat partners: %v", err)
+        return
+    }
+
+    var partnerIDs []string
+    for _, p := range partners {
+        if id, ok := p.(primitive.ObjectID); ok && id != userID {
+            partnerIDs = append(partnerIDs, id.Hex())
+        }
+    }
+    if len(partnerIDs) == 0 {
+        return
+    }
+
+    avatar := user.Avatar
+    if avatar == "" {
+        avatar = fallbackAvatar
+    }
+
+    wsManager.BroadcastProfileUpdated(partnerIDs, map[string]interface{}{
+        "userId":    user.ID.Hex(),
+        "name":      user.Name,
+        "avatar":    avatar,
+        "status":    user.Status,
+        "timestamp": time.Now().Unix(),
+    })
+}
+
 func UploadPhoto(c *gin.Context) {
     userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
     defer cancel()
 
     if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
@@ -358,6 +669,21 @@ func UploadPhoto(c *gin.Context) {
     }
     defer photoFile.Close()
 
+    // Take the slot before moderation so the external classifier calls are
+    // bounded per user too
+    if !acquireUploadSlot(c, userIDStr) {
+        return
+    }
+    defer releaseUploadSlot(userIDStr)
+
+    if !checkImageDimensions(c, photoFile) {
+        return
+    }
+
+    if !moderateImage(c, ctx, photoFile) {
+        return
+    }
+
     cld, err := cloudinary.NewFromURL(os.Getenv("CLOUDINARY_URL"))
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Cloudinary configuration error"})
@@ -365,7 +691,7 @@ func UploadPhoto(c *gin.Context) {
     }
 
     uploadParams := uploader.UploadParams{
-        Folder:         "coded/photos",
+        Folder:         uploadFolder("photos"),
         PublicID:       userID.Hex() + "_" + time.Now().Format("20060102150405"),
         Transformation: "c_limit,w_800,h_800,q_auto",
     }
@@ -379,18 +705,62 @@ func UploadPhoto(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"url": uploadResult.SecureURL})
 }
 
+// SelectAvatar makes one of the caller's existing photos their avatar, so
+// they don't have to upload it again
+func SelectAvatar(c *gin.Context) {
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    var req struct {
+        URL string `json:"url" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    usersColl := database.Users
+
+    // Matching on photos checks ownership in the same write
+    result, err := usersColl.UpdateOne(ctx,
+        bson.M{"_id": userID, "photos": req.URL},
+        bson.M{"$set": bson.M{"avatar": req.URL}},
+    )
+    if err != nil {
+        log.Printf("SelectAvatar error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update avatar"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Photo is not one of your photos"})
+        return
+    }
+
+    if result.ModifiedCount > 0 {
+        notifyProfileUpdated(ctx, userID)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Avatar updated successfully",
+        "avatar":  req.URL,
+    })
+}
+
 func GetReferral(c *gin.Context) {
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
 
     var user models.User
     err = usersColl.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
@@ -404,12 +774,46 @@ func GetReferral(c *gin.Context) {
         return
     }
 
-    baseURL := "https://codedsignal.org/"
-    referralURL := baseURL + "/register?ref=" + user.ReferralCode
-
     c.JSON(http.StatusOK, gin.H{
         "referralCode": user.ReferralCode,
-        "referralUrl":  referralURL,
+        "referralUrl":  referralURL(user.ReferralCode),
+    })
+}
+
+// RegenerateReferral replaces the caller's referral code with a fresh one.
+// The old code stops resolving to this user from now on.
+func RegenerateReferral(c *gin.Context) {
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    usersColl := database.Users
+
+    code, err := uniqueReferralCode(ctx, usersColl)
+    if err != nil {
+        log.Printf("[RegenerateReferral] Failed to generate referral code: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate referral code"})
+        return
+    }
+
+    result, err := usersColl.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"referralCode": code}})
+    if err != nil {
+        log.Printf("[RegenerateReferral] Failed to save referral code: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save referral code"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "referralCode": code,
+        "referralUrl":  referralURL(code),
     })
 }
 
@@ -434,10 +838,8 @@ func TestAuth(c *gin.Context) {
 
 // UpdateUserStatus - Update user status (available, busy, offline)
 func UpdateUserStatus(c *gin.Context) {
-    userIDStr := c.GetString("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
+    userID, err := currentUserID(c)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
         return
     }
 
@@ -450,10 +852,10 @@ func UpdateUserStatus(c *gin.Context) {
         return
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
     defer cancel()
 
-    usersColl := database.Client.Database("coded").Collection("users")
+    usersColl := database.Users
 
     result, err := usersColl.UpdateOne(
         ctx,
@@ -475,12 +877,57 @@ func UpdateUserStatus(c *gin.Context) {
         return
     }
 
+    notifyProfileUpdated(ctx, userID)
+
     c.JSON(http.StatusOK, gin.H{
         "message": "Status updated successfully",
         "status":  req.Status,
     })
 }
 
-func GetMatches(c *gin.Context) {
-    c.JSON(http.StatusOK, gin.H{"message": "GetMatches - not implemented"})
-}
\ No newline at end of file
+// UpdateSettings changes the caller's account preferences. Only the fields
+// present in the body are updated.
+func UpdateSettings(c *gin.Context) {
+    userID, err := currentUserID(c)
+    if err != nil {
+        return
+    }
+
+    var req struct {
+        HideMessagePreviews *bool `json:"hideMessagePreviews"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+        return
+    }
+
+    set := bson.M{}
+    if req.HideMessagePreviews != nil {
+        set["hideMessagePreviews"] = *req.HideMessagePreviews
+    }
+    if len(set) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "No settings to update"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    usersColl := database.Users
+
+    result, err := usersColl.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": set})
+    if err != nil {
+        log.Printf("[UpdateSettings] Database error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "Settings updated successfully",
+        "settings": set,
+    })
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Verification defaults; override with RESEND_VERIFICATION_INTERVAL and
+// VERIFICATION_TOKEN_TTL
+const (
+	defaultResendVerificationInterval = time.Minute
+	defaultVerificationTokenTTL       = 24 * time.Hour
+)
+
+// errVerificationThrottled means a verification email went out less than the
+// resend interval ago (or the user is already verified)
+var errVerificationThrottled = errors.New("verification email sent too recently")
+
+// rotateVerificationToken replaces the user's verification token and emails
+// the new link. Storing the new hash invalidates every earlier link. The
+// update only matches if no email was sent within minInterval, so concurrent
+// resends can't both go out.
+func rotateVerificationToken(ctx context.Context, userID primitive.ObjectID, minInterval time.Duration) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	filter := bson.M{"_id": userID, "emailVerified": bson.M{"$ne": true}}
+	if minInterval > 0 {
+		filter["$or"] = bson.A{
+			bson.M{"verificationSentAt": bson.M{"$exists": false}},
+			bson.M{"verificationSentAt": bson.M{"$lte": now.Add(-minInterval).Unix()}},
+		}
+	}
+
+	usersColl := database.Users
+
+	var user models.User
+	err = usersColl.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{
+			"verificationTokenHash": hashToken(token),
+			"verificationSentAt":    now.Unix(),
+		}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"email": 1}),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return errVerificationThrottled
+	}
+	if err != nil {
+		return err
+	}
+
+	link := config.String("APP_BASE_URL", "http://localhost:8080") + "/api/verify-email?token=" + token
+	return sendMail(user.Email, "Verify your Coded email",
+		"Confirm your email address by opening this link:\n\n"+link+"\n\nIf you didn't sign up for Coded, ignore this email.")
+}
+
+// ResendVerification emails a fresh verification link to the caller, at most
+// once per RESEND_VERIFICATION_INTERVAL
+func ResendVerification(c *gin.Context) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+
+	var user models.User
+	projection := bson.M{"emailVerified": 1, "verificationSentAt": 1}
+	err = usersColl.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(projection)).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email already verified"})
+		return
+	}
+
+	interval := config.Duration("RESEND_VERIFICATION_INTERVAL", defaultResendVerificationInterval)
+	err = rotateVerificationToken(ctx, userID, interval)
+	if err == errVerificationThrottled {
+		retryAfter := user.VerificationSentAt + int64(interval.Seconds()) - time.Now().Unix()
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":      "Verification email sent recently",
+			"retryAfter": retryAfter,
+			"message":    "Check your inbox or try again shortly",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("[ResendVerification] Failed for %s: %v", userID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// VerifyEmail marks the account owning ?token= as verified. Only the most
+// recently sent token works, and only within VERIFICATION_TOKEN_TTL.
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing verification token"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+
+	ttl := config.Duration("VERIFICATION_TOKEN_TTL", defaultVerificationTokenTTL)
+	result, err := usersColl.UpdateOne(ctx,
+		bson.M{
+			"verificationTokenHash": hashToken(token),
+			"verificationSentAt":    bson.M{"$gte": time.Now().Add(-ttl).Unix()},
+		},
+		bson.M{
+			"$set":   bson.M{"emailVerified": true},
+			"$unset": bson.M{"verificationTokenHash": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func verifyEmail(t *testing.T, token string) int {
+	t.Helper()
+	return testRequest(t, VerifyEmail, http.MethodGet, "/api/verify-email?token="+token, nil, "", nil).Code
+}
+
+func emailVerified(t *testing.T, ctx context.Context, userID primitive.ObjectID) bool {
+	t.Helper()
+	var user models.User
+	if err := database.Users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	return user.EmailVerified
+}
+
+func TestVerifyEmailTokenExpiry(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("VERIFICATION_TOKEN_TTL", "1h")
+	issued := func(ago time.Duration) (primitive.ObjectID, string) {
+		token, err := generateToken()
+		if err != nil {
+			t.Fatalf("generateToken: %v", err)
+		}
+		id := insertTestUser(t, ctx, bson.M{
+			"verificationTokenHash": hashToken(token),
+			"verificationSentAt":    time.Now().Add(-ago).Unix(),
+		})
+		return id, token
+	}
+
+	expired, expiredToken := issued(61 * time.Minute)
+	if code := verifyEmail(t, expiredToken); code != http.StatusBadRequest {
+		t.Errorf("expired token answered %d, want 400", code)
+	}
+	if emailVerified(t, ctx, expired) {
+		t.Error("expired token verified the email")
+	}
+
+	fresh, freshToken := issued(59 * time.Minute)
+	if code := verifyEmail(t, freshToken); code != http.StatusOK {
+		t.Errorf("fresh token answered %d, want 200", code)
+	}
+	if !emailVerified(t, ctx, fresh) {
+		t.Error("fresh token didn't verify the email")
+	}
+	// Tokens are single use
+	if code := verifyEmail(t, freshToken); code != http.StatusBadRequest {
+		t.Errorf("reused token answered %d, want 400", code)
+	}
+	if code := verifyEmail(t, "not-a-token"); code != http.StatusBadRequest {
+		t.Errorf("unknown token answered %d, want 400", code)
+	}
+}
+
+func TestResendVerificationRateLimit(t *testing.T) {
+	ctx := requireDB(t)
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("RESEND_VERIFICATION_INTERVAL", "1m")
+	user := insertTestUser(t, ctx, nil)
+	resend := func() *httptest.ResponseRecorder {
+		return testRequest(t, ResendVerification, http.MethodPost, "/api/resend-verification", nil, user.Hex(), nil)
+	}
+	storedHash := func() string {
+		t.Helper()
+		var doc bson.M
+		if err := database.Users.FindOne(ctx, bson.M{"_id": user}).Decode(&doc); err != nil {
+			t.Fatalf("loading user: %v", err)
+		}
+		hash, _ := doc["verificationTokenHash"].(string)
+		return hash
+	}
+
+	expectStatus(t, resend(), http.StatusOK)
+	first := storedHash()
+
+	w := resend()
+	expectStatus(t, w, http.StatusTooManyRequests)
+	body := decodeBody(t, w)
+	if retry, _ := body["retryAfter"].(float64); retry < 1 || retry > 60 {
+		t.Errorf("retryAfter = %v, want 1-60 seconds", body["retryAfter"])
+	}
+	if storedHash() != first {
+		t.Error("a throttled resend replaced the token")
+	}
+
+	// Once the interval has passed a new token replaces the old one
+	database.Users.UpdateOne(ctx, bson.M{"_id": user}, bson.M{"$set": bson.M{"verificationSentAt": time.Now().Add(-2 * time.Minute).Unix()}})
+	expectStatus(t, resend(), http.StatusOK)
+	if hash := storedHash(); hash == "" || hash == first {
+		t.Error("resend after the interval kept the old token")
+	}
+
+	// Verified accounts have nothing to resend
+	database.Users.UpdateOne(ctx, bson.M{"_id": user}, bson.M{"$set": bson.M{"emailVerified": true}})
+	expectStatus(t, resend(), http.StatusBadRequest)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"coded/database"
+	"coded/models"
+	"coded/websocket"
+
+	gorillaws "github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startWebSocketManager runs a manager behind a test server and installs it
+// as the handlers' wsManager until the test ends
+func startWebSocketManager(t *testing.T) (*websocket.Manager, *httptest.Server) {
+	t.Helper()
+	m := websocket.NewManager()
+	go m.Start()
+	server := httptest.NewServer(websocket.WebSocketHandler(m))
+	SetWebSocketManager(m)
+	t.Cleanup(func() {
+		SetWebSocketManager(nil)
+		server.Close()
+	})
+	return m, server
+}
+
+// dialAs connects to server as userID and waits until the manager has
+// registered the connection
+func dialAs(t *testing.T, m *websocket.Manager, server *httptest.Server, userID primitive.ObjectID) *gorillaws.Conn {
+	t.Helper()
+	token, _, err := issueAccessToken(userID)
+	if err != nil {
+		t.Fatalf("issueAccessToken: %v", err)
+	}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?token=" + token
+	conn, _, err := gorillaws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dialing websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	for deadline := time.Now().Add(2 * time.Second); !m.IsUserOnline(userID.Hex()); {
+		if time.Now().After(deadline) {
+			t.Fatal("websocket client never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return conn
+}
+
+// readEvent returns the payload of the next eventType frame on conn, skipping
+// other events, or nil if none arrives within wait
+func readEvent(t *testing.T, conn *gorillaws.Conn, eventType string, wait time.Duration) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(wait))
+	for {
+		var event struct {
+			Type    string                 `json:"type"`
+			Payload map[string]interface{} `json:"payload"`
+		}
+		if err := conn.ReadJSON(&event); err != nil {
+			return nil
+		}
+		if event.Type == eventType {
+			return event.Payload
+		}
+	}
+}
+
+func TestPresenceReachesPartnersAndPersists(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	insertDirectChat(t, ctx, alice, bob)
+
+	m, server := startWebSocketManager(t)
+	partner := dialAs(t, m, server, bob)
+	stranger := dialAs(t, m, server, carol)
+
+	status := func() (string, int64) {
+		t.Helper()
+		var user models.User
+		if err := database.Users.FindOne(ctx, bson.M{"_id": alice}).Decode(&user); err != nil {
+			t.Fatalf("loading user: %v", err)
+		}
+		return user.Status, user.LastSeen
+	}
+
+	first := dialAs(t, m, server, alice)
+	second := dialAs(t, m, server, alice)
+	if event := readEvent(t, partner, "presence", 2*time.Second); event == nil || event["userId"] != alice.Hex() || event["status"] != "online" {
+		t.Fatalf("partner got %v, want alice online", event)
+	}
+	if s, _ := status(); s != "online" {
+		t.Errorf("stored status = %q, want online", s)
+	}
+
+	// Closing one of two connections changes nothing; the next presence
+	// event the partner sees is for the last one closing
+	first.Close()
+	before := time.Now().Unix()
+	second.Close()
+	event := readEvent(t, partner, "presence", 2*time.Second)
+	if event == nil || event["userId"] != alice.Hex() || event["status"] != "offline" {
+		t.Fatalf("partner got %v, want alice offline", event)
+	}
+	if s, lastSeen := status(); s != "offline" || lastSeen < before {
+		t.Errorf("stored status = %q, lastSeen %d; want offline, at least %d", s, lastSeen, before)
+	}
+
+	if event := readEvent(t, stranger, "presence", 200*time.Millisecond); event != nil && event["userId"] == alice.Hex() {
+		t.Errorf("a user sharing no chat got %v", event)
+	}
+}
+
+func TestMessageReactionReachesOnlyParticipants(t *testing.T) {
+	ctx := requireDB(t)
+	alice, bob, carol := insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil), insertTestUser(t, ctx, nil)
+	chatID := insertDirectChat(t, ctx, alice, bob)
+	msgID := insertMessage(t, ctx, models.Message{ChatID: chatID, SenderID: alice, Content: "hi", CreatedAt: time.Now().Unix()})
+
+	m, server := startWebSocketManager(t)
+	conns := make(map[primitive.ObjectID]*gorillaws.Conn)
+	for _, id := range []primitive.ObjectID{alice, bob, carol} {
+		conns[id] = dialAs(t, m, server, id)
+		// "connected" follows the chat subscriptions
+		if readEvent(t, conns[id], "connected", 2*time.Second) == nil {
+			t.Fatal("no connected event")
+		}
+	}
+
+	expectStatus(t, react(t, http.MethodPost, bob, msgID, "🔥"), http.StatusOK)
+	for _, id := range []primitive.ObjectID{alice, bob} {
+		event := readEvent(t, conns[id], "message_reaction", 2*time.Second)
+		if event == nil || event["userId"] != bob.Hex() || event["emoji"] != "🔥" || event["action"] != "added" || event["chatId"] != chatID.Hex() {
+			t.Fatalf("participant got %v, want bob's 🔥 added", event)
+		}
+	}
+
+	// With echo off the reactor's own connections are skipped
+	t.Setenv("WS_REACTION_ECHO", "false")
+	expectStatus(t, react(t, http.MethodDelete, bob, msgID, ""), http.StatusOK)
+	if event := readEvent(t, conns[alice], "message_reaction", 2*time.Second); event == nil || event["action"] != "removed" || event["emoji"] != "🔥" {
+		t.Fatalf("partner got %v, want bob's 🔥 removed", event)
+	}
+	if event := readEvent(t, conns[bob], "message_reaction", 200*time.Millisecond); event != nil {
+		t.Errorf("reactor got %v with WS_REACTION_ECHO off", event)
+	}
+	if event := readEvent(t, conns[carol], "message_reaction", 200*time.Millisecond); event != nil {
+		t.Errorf("non-participant got %v", event)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
     "context"
+    "fmt"
     "log"
     "net/http"
     "os"
@@ -9,8 +10,10 @@ import (
     "syscall"
     "time"
 
+    "coded/config"
     "coded/database"
     "coded/handlers"
+    "coded/moderation"
     "coded/routes"
     "coded/websocket"
 
@@ -18,7 +21,41 @@ import (
     "github.com/joho/godotenv"
 )
 
-func validateEnv() {
+// minJWTSecretLength is the shortest JWT_SECRET accepted in release mode
+const minJWTSecretLength = 32
+
+// insecureJWTSecrets are the placeholder secrets used by dev fallbacks
+var insecureJWTSecrets = map[string]bool{
+    "dev-secret-key-change-this-in-production":  true,
+    "your-secret-key-change-this-in-production": true,
+}
+
+// checkCriticalEnv returns a problem description for each critical variable
+// that is missing or insecure, keyed by variable name
+func checkCriticalEnv() map[string]string {
+    problems := map[string]string{}
+
+    secret := os.Getenv("JWT_SECRET")
+    switch {
+    case secret == "":
+        problems["JWT_SECRET"] = "not set"
+    case insecureJWTSecrets[secret]:
+        problems["JWT_SECRET"] = "uses a placeholder value"
+    case len(secret) < minJWTSecretLength:
+        problems["JWT_SECRET"] = fmt.Sprintf("shorter than %d characters", minJWTSecretLength)
+    }
+
+    if os.Getenv("MONGODB_URI") == "" {
+        problems["MONGODB_URI"] = "not set"
+    }
+
+    return problems
+}
+
+// validateEnv logs a startup checklist. In release mode a missing or
+// insecure critical variable is an error; in debug mode dev defaults are
+// filled in instead so the server still starts locally.
+func validateEnv(release bool) error {
     required := []string{
         "JWT_SECRET",
         "MONGODB_URI",
@@ -28,6 +65,23 @@ func validateEnv() {
         "VAPID_PRIVATE_KEY": "Push notifications disabled",
         "CLOUDINARY_URL":    "Photo uploads disabled",
         "PORT":              "Using default port 8080",
+        "GOOGLE_REDIRECT_URL": "Using http://localhost:8080/api/google/callback",
+        "TRUSTED_PROXIES":   "X-Forwarded-For ignored; client IP is the connecting address",
+    }
+
+    problems := checkCriticalEnv()
+
+    log.Println("📋 Environment checklist:")
+    for _, env := range required {
+        if problem, ok := problems[env]; ok {
+            log.Printf("  ❌ %s: %s", env, problem)
+        } else {
+            log.Printf("  ✅ %s", env)
+        }
+    }
+
+    if release && len(problems) > 0 {
+        return fmt.Errorf("%d critical environment variable(s) missing or insecure in release mode", len(problems))
     }
 
     for _, env := range required {
@@ -50,6 +104,8 @@ func validateEnv() {
             log.Printf("ℹ️  %s: %s", env, message)
         }
     }
+
+    return nil
 }
 
 func PrintRoutes(router *gin.Engine) {
@@ -72,8 +128,11 @@ func main() {
         log.Println("ℹ️  No .env file found or unable to load it")
     }
 
-    // Validate environment variables with fallbacks
-    validateEnv()
+    // Validate environment variables; release mode refuses insecure config,
+    // debug mode falls back to dev defaults
+    if err := validateEnv(os.Getenv("GIN_MODE") == "release"); err != nil {
+        log.Fatal("❌ Startup self-check failed: ", err)
+    }
 
     // Connect to MongoDB with retry logic
     log.Println("🔌 Connecting to MongoDB...")
@@ -118,6 +177,16 @@ func main() {
     }
     log.Println("✅ MongoDB ping successful")
 
+    // Create missing indexes; the app still works without them, just slower
+    indexCtx, indexCancel := context.WithTimeout(context.Background(), 30*time.Second)
+    if err := database.EnsureIndexes(indexCtx); err != nil {
+        log.Printf("⚠️ %v", err)
+    }
+    indexCancel()
+
+    // Keep database.Available current so requests get 503 during an outage
+    go database.MonitorConnection(config.Duration("DB_HEALTH_INTERVAL", 5*time.Second))
+
     // Initialize WebSocket Manager
     log.Println("🔌 Initializing WebSocket manager...")
     wsManager := websocket.NewManager()
@@ -127,6 +196,45 @@ func main() {
     // Pass WebSocket manager to handlers
     handlers.SetWebSocketManager(wsManager)
 
+    // Content moderation for posts and messages
+    if keywords := config.List("MODERATION_KEYWORDS", nil); len(keywords) > 0 {
+        handlers.SetModerator(moderation.NewKeywordModerator(keywords))
+        log.Printf("✅ Content moderation enabled (%d keywords)", len(keywords))
+    } else {
+        log.Println("ℹ️  MODERATION_KEYWORDS not set - content moderation disabled")
+    }
+
+    // Image moderation for avatar and profile photo uploads. Post media are
+    // URLs the client supplies, never uploaded through us, so they aren't
+    // checked.
+    if url := os.Getenv("IMAGE_MODERATION_URL"); url != "" {
+        handlers.SetImageModerator(moderation.NewHTTPImageModerator(url))
+        log.Println("✅ Image moderation enabled")
+    } else {
+        log.Println("ℹ️  IMAGE_MODERATION_URL not set - image moderation disabled")
+    }
+
+    // Disposable email blocklist for signup, from the env and/or a file
+    disposable := config.List("DISPOSABLE_EMAIL_DOMAINS", nil)
+    if path := os.Getenv("DISPOSABLE_EMAIL_DOMAINS_FILE"); path != "" {
+        fromFile, err := handlers.ReadDomainList(path)
+        if err != nil {
+            log.Printf("⚠️  Failed to read DISPOSABLE_EMAIL_DOMAINS_FILE: %v", err)
+        }
+        disposable = append(disposable, fromFile...)
+    }
+    if len(disposable) > 0 {
+        handlers.SetDisposableEmailDomains(disposable)
+        log.Printf("✅ Disposable email check enabled (%d domains)", len(disposable))
+    } else {
+        log.Println("ℹ️  DISPOSABLE_EMAIL_DOMAINS not set - disposable email check disabled")
+    }
+
+    // Google OAuth redirect flow
+    if err := handlers.ConfigureGoogleOAuth(); err != nil {
+        log.Fatal("❌ Invalid Google OAuth configuration: ", err)
+    }
+
     // Set VAPID private key if available
     if vapidKey := os.Getenv("VAPID_PRIVATE_KEY"); vapidKey != "" {
         handlers.SetVAPIDPrivateKey(vapidKey)
@@ -250,12 +358,14 @@ func main() {
         port = "8080"
     }
 
-    // HTTP server configuration
+    // HTTP server configuration. Read and write timeouts leave room for the
+    // longest request deadline (uploads) so its 504 still gets written.
+    ioTimeout := routes.UploadRequestTimeout() + 15*time.Second
     server := &http.Server{
         Addr:         ":" + port,
         Handler:      router,
-        ReadTimeout:  15 * time.Second,
-        WriteTimeout: 15 * time.Second,
+        ReadTimeout:  ioTimeout,
+        WriteTimeout: ioTimeout,
         IdleTimeout:  60 * time.Second,
     }
 
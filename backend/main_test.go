@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const goodJWTSecret = "0123456789abcdef0123456789abcdef"
+
+func TestCheckCriticalEnv(t *testing.T) {
+	tests := map[string]struct {
+		secret, mongoURI string
+		want             []string
+	}{
+		"all set":            {goodJWTSecret, "mongodb://db", nil},
+		"secret missing":     {"", "mongodb://db", []string{"JWT_SECRET"}},
+		"placeholder secret": {"dev-secret-key-change-this-in-production", "mongodb://db", []string{"JWT_SECRET"}},
+		"short secret":       {goodJWTSecret[:minJWTSecretLength-1], "mongodb://db", []string{"JWT_SECRET"}},
+		"mongo missing":      {goodJWTSecret, "", []string{"MONGODB_URI"}},
+		"both missing":       {"", "", []string{"JWT_SECRET", "MONGODB_URI"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", tt.secret)
+			t.Setenv("MONGODB_URI", tt.mongoURI)
+			problems := checkCriticalEnv()
+			if len(problems) != len(tt.want) {
+				t.Errorf("problems = %v, want %v", problems, tt.want)
+			}
+			for _, env := range tt.want {
+				if _, ok := problems[env]; !ok {
+					t.Errorf("%s not reported: %v", env, problems)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateEnvReleaseModeRefusesBadSecrets(t *testing.T) {
+	for name, secret := range map[string]string{
+		"missing":     "",
+		"placeholder": "your-secret-key-change-this-in-production",
+		"short":       "short",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", secret)
+			t.Setenv("MONGODB_URI", "mongodb://db")
+			err := validateEnv(true)
+			if err == nil || !strings.Contains(err.Error(), "release mode") {
+				t.Errorf("validateEnv(release) = %v, want a release mode error", err)
+			}
+			if got := os.Getenv("JWT_SECRET"); got != secret {
+				t.Errorf("release mode replaced JWT_SECRET with %q", got)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", goodJWTSecret)
+		t.Setenv("MONGODB_URI", "mongodb://db")
+		if err := validateEnv(true); err != nil {
+			t.Errorf("validateEnv(release) = %v with a valid config", err)
+		}
+	})
+}
+
+func TestValidateEnvDebugModeOnlyWarns(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("MONGODB_URI", "")
+	if err := validateEnv(false); err != nil {
+		t.Fatalf("validateEnv(debug) = %v, want it to fall back to dev defaults", err)
+	}
+	if secret := os.Getenv("JWT_SECRET"); !insecureJWTSecrets[secret] {
+		t.Errorf("JWT_SECRET = %q, want the dev placeholder", secret)
+	}
+	if uri := os.Getenv("MONGODB_URI"); uri != "mongodb://localhost:27017" {
+		t.Errorf("MONGODB_URI = %q, want the local default", uri)
+	}
+
+	// An insecure secret that is set is kept, with a warning
+	t.Setenv("JWT_SECRET", "short")
+	if err := validateEnv(false); err != nil {
+		t.Errorf("validateEnv(debug) = %v for a short secret", err)
+	}
+	if got := os.Getenv("JWT_SECRET"); got != "short" {
+		t.Errorf("debug mode replaced a set JWT_SECRET with %q", got)
+	}
+}
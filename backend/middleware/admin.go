@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RoleAdmin is the models.User.Role value that grants access to /api/admin
+const RoleAdmin = "admin"
+
+// RequireAdmin only lets through users whose role is admin. It must run after
+// JWTAuthMiddleware so userId is in the context.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		usersColl := database.Users
+
+		var user models.User
+		err = usersColl.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(bson.M{"role": 1})).Decode(&user)
+		if err != nil || user.Role != RoleAdmin {
+			if err != nil {
+				log.Printf("[RequireAdmin] Failed to load user %s: %v", userID.Hex(), err)
+			}
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Admin access required",
+				"message": "You don't have permission to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -15,6 +15,31 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// ParseToken validates a signed JWT against JWT_SECRET and returns its
+// claims. Expired or tampered tokens return an error.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Validate the alg is what we expect
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			jwtSecret = "your-secret-key-change-this-in-production"
+		}
+		return []byte(jwtSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("token is not valid")
+	}
+	return claims, nil
+}
+
 func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip middleware for OPTIONS requests (CORS preflight)
@@ -53,20 +78,7 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Parse and validate the token
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// Validate the alg is what we expect
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			
-			jwtSecret := os.Getenv("JWT_SECRET")
-			if jwtSecret == "" {
-				jwtSecret = "your-secret-key-change-this-in-production"
-			}
-			return []byte(jwtSecret), nil
-		})
-
+		claims, err := ParseToken(tokenString)
 		if err != nil {
 			fmt.Printf("JWT validation error: %v\n", err)
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -77,10 +89,13 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Invalid token",
-				"message": "Token is not valid",
+		// Tokens issued before a moderator disabled the account stop
+		// working too
+		if AccountDisabled(c.Request.Context(), claims.UserID) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Account disabled",
+				"code":    "ACCOUNT_DISABLED",
+				"message": "This account has been disabled",
 			})
 			c.Abort()
 			return
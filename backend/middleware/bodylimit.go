@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimitMiddleware caps request body sizes. Routes listed in overrides
+// (keyed by the registered route path, e.g. "/api/upload-photo") get their
+// own limit; everything else uses defaultLimit. Requests that declare a
+// larger Content-Length are rejected with 413 up front. Bodies of unknown
+// length (chunked) are read through http.MaxBytesReader before the handler
+// runs, so an oversized stream also gets 413 rather than surfacing as a
+// bind error in each handler.
+func BodyLimitMiddleware(defaultLimit int64, overrides map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		limit := defaultLimit
+		if override, ok := overrides[c.FullPath()]; ok {
+			limit = override
+		}
+
+		if c.Request.ContentLength > limit {
+			abortTooLarge(c, limit)
+			return
+		}
+
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		if c.Request.ContentLength < 0 {
+			// The server stops at a declared Content-Length, so only
+			// streams of unknown length can run past the limit
+			data, err := io.ReadAll(body)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortTooLarge(c, limit)
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+				return
+			}
+			body.Close()
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			c.Request.ContentLength = int64(len(data))
+		} else {
+			c.Request.Body = body
+		}
+		c.Next()
+	}
+}
+
+// abortTooLarge answers 413 for a body over limit
+func abortTooLarge(c *gin.Context, limit int64) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":   "Request body too large",
+		"limit":   limit,
+		"message": "Reduce the size of the request and try again",
+	})
+	c.Abort()
+}
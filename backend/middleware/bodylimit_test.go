@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodyLimitServer echoes the size of the body it read, behind a 1KB limit
+// with 4KB allowed on /upload
+func bodyLimitServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	router := gin.New()
+	router.Use(BodyLimitMiddleware(1<<10, map[string]int64{"/upload": 4 << 10}))
+	echo := func(c *gin.Context) {
+		var req struct {
+			Text string `json:"text"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"read": len(req.Text)})
+	}
+	router.POST("/post", echo)
+	router.POST("/upload", echo)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// jsonOfSize is a JSON body of roughly n bytes
+func jsonOfSize(n int) string {
+	return `{"text":"` + strings.Repeat("a", n-11) + `"}`
+}
+
+// streamed hides the length of body so the client sends it chunked
+func streamed(body string) io.Reader {
+	return io.MultiReader(strings.NewReader(body))
+}
+
+func TestBodyLimit(t *testing.T) {
+	server := bodyLimitServer(t)
+	tests := map[string]struct {
+		path string
+		body io.Reader
+		want int
+	}{
+		"declared, within limit":       {"/post", strings.NewReader(jsonOfSize(1 << 10)), http.StatusOK},
+		"declared, over limit":         {"/post", strings.NewReader(jsonOfSize(2 << 10)), http.StatusRequestEntityTooLarge},
+		"streamed, within limit":       {"/post", streamed(jsonOfSize(1 << 10)), http.StatusOK},
+		"streamed, over limit":         {"/post", streamed(jsonOfSize(2 << 10)), http.StatusRequestEntityTooLarge},
+		"upload route allows more":     {"/upload", strings.NewReader(jsonOfSize(3 << 10)), http.StatusOK},
+		"upload route, streamed":       {"/upload", streamed(jsonOfSize(3 << 10)), http.StatusOK},
+		"upload route, over its limit": {"/upload", streamed(jsonOfSize(5 << 10)), http.StatusRequestEntityTooLarge},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, server.URL+tt.path, tt.body)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", resp.StatusCode, tt.want, body)
+			}
+			if tt.want == http.StatusRequestEntityTooLarge && !bytes.Contains(body, []byte("Request body too large")) {
+				t.Errorf("body = %s, want the 413 error", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireDatabase answers 503 while MongoDB is unreachable, so clients can
+// tell an outage (retry later) apart from a genuine server error
+func RequireDatabase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !database.Available() {
+			log.Printf("⚠️ Rejecting %s %s: database unavailable", c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Service temporarily unavailable",
+				"code":    "DB_UNAVAILABLE",
+				"message": "Please try again in a moment",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireDatabaseRejectsWhileUnavailable(t *testing.T) {
+	if database.Available() {
+		t.Skip("database is connected")
+	}
+
+	reached := false
+	router := gin.New()
+	router.GET("/api/me", RequireDatabase(), func(c *gin.Context) {
+		reached = true
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/me", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if reached {
+		t.Error("handler ran while the database was unavailable")
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["code"] != "DB_UNAVAILABLE" {
+		t.Errorf("body = %s, want code DB_UNAVAILABLE", w.Body.String())
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"coded/config"
+	"coded/database"
+	"coded/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultAccountStatusTTL is how long a user's disabled flag is cached;
+// override with ACCOUNT_STATUS_TTL
+const defaultAccountStatusTTL = 30 * time.Second
+
+// accountStatus caches whether users are disabled so JWT auth doesn't read
+// the user on every request. A moderator's change is seen at once on the
+// instance that made it (see ForgetAccountStatus) and within ttl elsewhere.
+type accountStatus struct {
+	mu      sync.Mutex
+	entries map[string]accountStatusEntry
+	// ttl is read from ACCOUNT_STATUS_TTL when zero
+	ttl       time.Duration
+	lastSweep time.Time
+	lookup    func(ctx context.Context, userID primitive.ObjectID) (bool, error)
+	now       func() time.Time
+}
+
+type accountStatusEntry struct {
+	disabled  bool
+	checkedAt time.Time
+}
+
+var accounts = &accountStatus{
+	entries: make(map[string]accountStatusEntry),
+	lookup:  lookupDisabled,
+	now:     time.Now,
+}
+
+// lookupDisabled reads the user's disabled flag
+func lookupDisabled(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	usersColl := database.Users
+
+	var user models.User
+	err := usersColl.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(bson.M{"disabled": 1})).Decode(&user)
+	if err != nil {
+		return false, err
+	}
+	return user.Disabled, nil
+}
+
+// disabled reports whether userID is disabled, from the cache while the
+// entry is fresh. Lookup failures let the request through uncached; a
+// missing user is left to the handlers.
+func (a *accountStatus) disabled(ctx context.Context, userID string) bool {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false
+	}
+
+	now, ttl := a.now(), a.maxAge()
+	a.mu.Lock()
+	a.sweep(now, ttl)
+	entry, ok := a.entries[userID]
+	a.mu.Unlock()
+	if ok && now.Sub(entry.checkedAt) < ttl {
+		return entry.disabled
+	}
+
+	disabled, err := a.lookup(ctx, oid)
+	if err != nil {
+		log.Printf("[AccountStatus] Failed to load user %s: %v", userID, err)
+		return false
+	}
+
+	a.mu.Lock()
+	a.entries[userID] = accountStatusEntry{disabled: disabled, checkedAt: now}
+	a.mu.Unlock()
+	return disabled
+}
+
+func (a *accountStatus) maxAge() time.Duration {
+	if a.ttl > 0 {
+		return a.ttl
+	}
+	return config.Duration("ACCOUNT_STATUS_TTL", defaultAccountStatusTTL)
+}
+
+// sweep drops stale entries, at most once per ttl. Callers hold a.mu.
+func (a *accountStatus) sweep(now time.Time, ttl time.Duration) {
+	if now.Sub(a.lastSweep) < ttl {
+		return
+	}
+	a.lastSweep = now
+	for userID, entry := range a.entries {
+		if now.Sub(entry.checkedAt) >= ttl {
+			delete(a.entries, userID)
+		}
+	}
+}
+
+func (a *accountStatus) forget(userID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.entries, userID)
+}
+
+// AccountDisabled reports whether a moderator has disabled userID
+func AccountDisabled(ctx context.Context, userID string) bool {
+	return accounts.disabled(ctx, userID)
+}
+
+// ForgetAccountStatus drops the cached status for userID so a change made
+// by a moderator applies to that user's next request
+func ForgetAccountStatus(userID string) {
+	accounts.forget(userID)
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeAccounts answers lookups from a map and counts them
+type fakeAccounts struct {
+	disabled map[primitive.ObjectID]bool
+	err      error
+	lookups  int
+}
+
+func (f *fakeAccounts) lookup(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	f.lookups++
+	return f.disabled[userID], f.err
+}
+
+func newTestAccountStatus(ttl time.Duration) (*accountStatus, *fakeAccounts, *fakeClock) {
+	fake := &fakeAccounts{disabled: make(map[primitive.ObjectID]bool)}
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	return &accountStatus{
+		entries: make(map[string]accountStatusEntry),
+		ttl:     ttl,
+		lookup:  fake.lookup,
+		now:     clock.now,
+	}, fake, clock
+}
+
+func TestAccountStatusCachesWithinTTL(t *testing.T) {
+	a, fake, clock := newTestAccountStatus(time.Minute)
+	user := primitive.NewObjectID()
+	ctx := context.Background()
+
+	if a.disabled(ctx, user.Hex()) {
+		t.Fatal("active user reported disabled")
+	}
+	fake.disabled[user] = true
+	if a.disabled(ctx, user.Hex()) {
+		t.Error("cached status ignored")
+	}
+	if fake.lookups != 1 {
+		t.Errorf("%d lookups within the ttl, want 1", fake.lookups)
+	}
+
+	clock.t = clock.t.Add(time.Minute)
+	if !a.disabled(ctx, user.Hex()) {
+		t.Error("disable not seen after the ttl")
+	}
+}
+
+func TestAccountStatusForget(t *testing.T) {
+	a, fake, _ := newTestAccountStatus(time.Hour)
+	user := primitive.NewObjectID()
+	ctx := context.Background()
+
+	a.disabled(ctx, user.Hex())
+	fake.disabled[user] = true
+	a.forget(user.Hex())
+	if !a.disabled(ctx, user.Hex()) {
+		t.Error("disable not seen after forget")
+	}
+}
+
+func TestAccountStatusFailsOpen(t *testing.T) {
+	a, fake, _ := newTestAccountStatus(time.Minute)
+	fake.err = errors.New("database down")
+	user := primitive.NewObjectID()
+
+	if a.disabled(context.Background(), user.Hex()) {
+		t.Error("lookup failure reported the account disabled")
+	}
+	if _, ok := a.entries[user.Hex()]; ok {
+		t.Error("failed lookup was cached")
+	}
+}
+
+func TestAccountStatusSweepsStaleEntries(t *testing.T) {
+	a, _, clock := newTestAccountStatus(time.Minute)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		a.disabled(ctx, primitive.NewObjectID().Hex())
+	}
+
+	clock.t = clock.t.Add(2 * time.Minute)
+	a.disabled(ctx, primitive.NewObjectID().Hex())
+	if len(a.entries) != 1 {
+		t.Errorf("%d entries after sweep, want only the fresh one", len(a.entries))
+	}
+}
+
+func TestJWTAuthRejectsDisabledAccounts(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	a, fake, _ := newTestAccountStatus(time.Minute)
+	saved := accounts
+	accounts = a
+	t.Cleanup(func() { accounts = saved })
+
+	active, banned := primitive.NewObjectID(), primitive.NewObjectID()
+	fake.disabled[banned] = true
+
+	router := gin.New()
+	router.GET("/me", JWTAuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for user, want := range map[primitive.ObjectID]int{active: http.StatusOK, banned: http.StatusForbidden} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+			UserID:           user.Hex(),
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		})
+		signed, err := token.SignedString([]byte("test-secret"))
+		if err != nil {
+			t.Fatalf("signing token: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+signed)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("user %s: status %d, want %d", user.Hex(), w.Code, want)
+		}
+	}
+}
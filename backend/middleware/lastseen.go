@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"coded/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lastSeenWriter remembers when each user's lastSeen was last written so a
+// burst of requests costs at most one update per interval
+type lastSeenWriter struct {
+	mu       sync.Mutex
+	written  map[string]time.Time
+	interval time.Duration
+	// write stores the update; it runs in its own goroutine
+	write func(userID primitive.ObjectID, at time.Time)
+}
+
+// due reports whether userID's lastSeen should be written now, recording the
+// write if so
+func (w *lastSeenWriter) due(userID string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if last, ok := w.written[userID]; ok && now.Sub(last) < w.interval {
+		return false
+	}
+	w.written[userID] = now
+	return true
+}
+
+// TrackLastSeen updates the caller's lastSeen after each successful
+// request, at most once per interval per user. It must run after
+// JWTAuthMiddleware so userId is in the context.
+func TrackLastSeen(interval time.Duration) gin.HandlerFunc {
+	return trackLastSeen(&lastSeenWriter{
+		written:  make(map[string]time.Time),
+		interval: interval,
+		write:    writeLastSeen,
+	})
+}
+
+// writeLastSeen stores at as userID's lastSeen
+func writeLastSeen(userID primitive.ObjectID, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	usersColl := database.Users
+	_, err := usersColl.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"lastSeen": at.Unix()}},
+	)
+	if err != nil {
+		log.Printf("[TrackLastSeen] Failed to update lastSeen for %s: %v", userID.Hex(), err)
+	}
+}
+
+func trackLastSeen(writer *lastSeenWriter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Writer.Status() >= 400 {
+			return
+		}
+		userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		if !writer.due(userID.Hex(), now) {
+			return
+		}
+
+		go writer.write(userID, now)
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLastSeenWriterThrottlesPerUser(t *testing.T) {
+	w := &lastSeenWriter{written: make(map[string]time.Time), interval: time.Minute}
+	start := time.Unix(1_700_000_000, 0)
+
+	steps := []struct {
+		user string
+		at   time.Duration
+		want bool
+	}{
+		{"alice", 0, true},
+		{"alice", 30 * time.Second, false},
+		{"bob", 30 * time.Second, true},
+		{"alice", 59 * time.Second, false},
+		{"alice", time.Minute, true},
+		{"alice", time.Minute + time.Second, false},
+		{"bob", 89 * time.Second, false},
+		{"bob", 90 * time.Second, true},
+	}
+	for _, s := range steps {
+		if got := w.due(s.user, start.Add(s.at)); got != s.want {
+			t.Errorf("due(%s, +%v) = %v, want %v", s.user, s.at, got, s.want)
+		}
+	}
+}
+
+// lastSeenRecorder stands in for writeLastSeen
+type lastSeenRecorder struct {
+	mu     sync.Mutex
+	writes map[primitive.ObjectID]int
+}
+
+func (r *lastSeenRecorder) write(userID primitive.ObjectID, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes[userID]++
+}
+
+func (r *lastSeenRecorder) count(userID primitive.ObjectID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writes[userID]
+}
+
+func TestTrackLastSeenWritesOncePerInterval(t *testing.T) {
+	rec := &lastSeenRecorder{writes: make(map[primitive.ObjectID]int)}
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userId", c.GetHeader("X-User")) })
+	router.Use(trackLastSeen(&lastSeenWriter{written: make(map[string]time.Time), interval: time.Hour, write: rec.write}))
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+
+	request := func(path string, userID string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User", userID)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	alice, bob, carol := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	for i := 0; i < 5; i++ {
+		request("/ok", alice.Hex())
+	}
+	request("/ok", bob.Hex())
+	request("/fail", carol.Hex()) // failed requests don't count as activity
+	request("/ok", "not-an-id")
+	time.Sleep(50 * time.Millisecond)
+
+	for id, want := range map[primitive.ObjectID]int{alice: 1, bob: 1, carol: 0} {
+		if got := rec.count(id); got != want {
+			t.Errorf("%s: %d writes, want %d", id.Hex(), got, want)
+		}
+	}
+
+	// A failed request doesn't use up the interval either
+	request("/ok", carol.Hex())
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.count(carol); got != 1 {
+		t.Errorf("carol: %d writes after a successful request, want 1", got)
+	}
+}
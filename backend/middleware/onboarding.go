@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"coded/database"
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RequireOnboarding blocks users who haven't finished onboarding (see
+// models.User.HasCompletedOnboarding). It must run after JWTAuthMiddleware
+// so userId is in the context.
+func RequireOnboarding() gin.HandlerFunc {
+	return requireOnboarding(lookupOnboarding)
+}
+
+// lookupOnboarding loads the fields HasCompletedOnboarding looks at
+func lookupOnboarding(ctx context.Context, userID primitive.ObjectID) (*models.User, error) {
+	usersColl := database.Users
+
+	projection := bson.M{"name": 1, "username": 1, "gender": 1, "interestedIn": 1}
+	var user models.User
+	err := usersColl.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(projection)).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func requireOnboarding(lookup func(ctx context.Context, userID primitive.ObjectID) (*models.User, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		user, err := lookup(ctx, userID)
+		if err != nil {
+			log.Printf("[RequireOnboarding] Failed to load user %s: %v", userID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+			c.Abort()
+			return
+		}
+
+		if !user.HasCompletedOnboarding() {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Onboarding required",
+				"code":    "onboarding_required",
+				"message": "Complete your profile to continue",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"coded/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRequireOnboarding(t *testing.T) {
+	complete := &models.User{Name: "Ada", Username: "ada99", Gender: "female", InterestedIn: []string{"male"}}
+	tests := []struct {
+		name   string
+		userID string
+		user   *models.User
+		err    error
+		want   int
+	}{
+		{"complete", primitive.NewObjectID().Hex(), complete, nil, http.StatusOK},
+		{"name is the username", primitive.NewObjectID().Hex(), &models.User{Name: "ada99", Username: "ada99", Gender: "female", InterestedIn: []string{"male"}}, nil, http.StatusForbidden},
+		{"no gender", primitive.NewObjectID().Hex(), &models.User{Name: "Ada", Username: "ada99", InterestedIn: []string{"male"}}, nil, http.StatusForbidden},
+		{"no interestedIn", primitive.NewObjectID().Hex(), &models.User{Name: "Ada", Username: "ada99", Gender: "female"}, nil, http.StatusForbidden},
+		{"lookup fails", primitive.NewObjectID().Hex(), nil, errors.New("down"), http.StatusInternalServerError},
+		{"bad user id", "nope", complete, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(ctx context.Context, userID primitive.ObjectID) (*models.User, error) {
+				return tt.user, tt.err
+			}
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) { c.Set("userId", tt.userID) }, requireOnboarding(lookup), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
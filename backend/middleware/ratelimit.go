@@ -2,17 +2,23 @@ package middleware
 
 import (
     "net/http"
+    "strconv"
     "sync"
     "time"
 
     "github.com/gin-gonic/gin"
 )
 
+// IPRateLimiter allows each key (a client IP, or a user id for
+// RateLimitByUser) at most limit requests in any sliding window. A limit of
+// zero or less disables it.
 type IPRateLimiter struct {
-    mu       sync.Mutex
-    requests map[string][]time.Time
-    limit    int
-    window   time.Duration
+    mu        sync.Mutex
+    requests  map[string][]time.Time
+    limit     int
+    window    time.Duration
+    lastSweep time.Time
+    now       func() time.Time
 }
 
 func NewIPRateLimiter(limit int, window time.Duration) *IPRateLimiter {
@@ -20,18 +26,37 @@ func NewIPRateLimiter(limit int, window time.Duration) *IPRateLimiter {
         requests: make(map[string][]time.Time),
         limit:    limit,
         window:   window,
+        now:      time.Now,
     }
 }
 
+// Enabled reports whether the limiter limits anything
+func (rl *IPRateLimiter) Enabled() bool {
+    return rl.limit > 0
+}
+
 func (rl *IPRateLimiter) Allow(ip string) bool {
+    allowed, _, _ := rl.Take(ip)
+    return allowed
+}
+
+// Take records a request for key if it is under the limit. It returns how
+// many requests key has left in the window and, when refused, how long until
+// the oldest request falls out of it.
+func (rl *IPRateLimiter) Take(key string) (bool, int, time.Duration) {
+    if !rl.Enabled() {
+        return true, 0, 0
+    }
+
     rl.mu.Lock()
     defer rl.mu.Unlock()
 
-    now := time.Now()
+    now := rl.now()
     cutoff := now.Add(-rl.window)
+    rl.sweep(now, cutoff)
 
     // Clean old requests
-    requests := rl.requests[ip]
+    requests := rl.requests[key]
     i := 0
     for ; i < len(requests); i++ {
         if requests[i].After(cutoff) {
@@ -42,21 +67,82 @@ func (rl *IPRateLimiter) Allow(ip string) bool {
 
     // Check if under limit
     if len(requests) >= rl.limit {
-        return false
+        rl.requests[key] = requests
+        return false, 0, requests[0].Add(rl.window).Sub(now)
     }
 
     // Add current request
-    rl.requests[ip] = append(requests, now)
-    return true
+    rl.requests[key] = append(requests, now)
+    return true, rl.limit - len(requests) - 1, 0
+}
+
+// sweep drops keys with no request inside the window, at most once per
+// window, so clients that stop sending don't stay in the map forever.
+// Callers hold rl.mu.
+func (rl *IPRateLimiter) sweep(now, cutoff time.Time) {
+    if now.Sub(rl.lastSweep) < rl.window {
+        return
+    }
+    rl.lastSweep = now
+    for key, requests := range rl.requests {
+        if len(requests) == 0 || !requests[len(requests)-1].After(cutoff) {
+            delete(rl.requests, key)
+        }
+    }
 }
 
 var ipLimiter = NewIPRateLimiter(60, time.Minute)
 
+// RateLimitMiddleware applies the default limit of 60 requests a minute per
+// client IP
 func RateLimitMiddleware() gin.HandlerFunc {
+    return RateLimitByIP(ipLimiter)
+}
+
+// RateLimitByIP limits requests per client IP with the given limiter. Give
+// each route its own limiter so they are counted separately. The client IP
+// only comes from X-Forwarded-For when the router trusts the proxy that set
+// it (see gin's SetTrustedProxies).
+func RateLimitByIP(limiter *IPRateLimiter) gin.HandlerFunc {
+    return rateLimit(limiter, func(c *gin.Context) string {
+        return c.ClientIP()
+    })
+}
+
+// RateLimitByUser limits requests per authenticated user, so users behind a
+// shared IP don't use up each other's allowance. It must run after
+// JWTAuthMiddleware; requests without a userId fall back to the client IP.
+func RateLimitByUser(limiter *IPRateLimiter) gin.HandlerFunc {
+    return rateLimit(limiter, func(c *gin.Context) string {
+        if userID := c.GetString("userId"); userID != "" {
+            return "user:" + userID
+        }
+        return c.ClientIP()
+    })
+}
+
+// rateLimit sends X-RateLimit-Limit and X-RateLimit-Remaining on every
+// response, and answers 429 with Retry-After once the key is over the limit.
+// A disabled limiter lets everything through without headers.
+func rateLimit(limiter *IPRateLimiter, key func(c *gin.Context) string) gin.HandlerFunc {
+    if !limiter.Enabled() {
+        return func(c *gin.Context) {
+            c.Next()
+        }
+    }
+
     return func(c *gin.Context) {
-        ip := c.ClientIP()
-        if !ipLimiter.Allow(ip) {
-            c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+        allowed, remaining, retryAfter := limiter.Take(key(c))
+        c.Header("X-RateLimit-Limit", strconv.Itoa(limiter.limit))
+        c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+        if !allowed {
+            // Round up so clients never retry a moment too early
+            seconds := int((retryAfter + time.Second - 1) / time.Second)
+            c.Header("Retry-After", strconv.Itoa(seconds))
+            c.JSON(http.StatusTooManyRequests, gin.H{
+                "error":      "Too many requests",
+                "retryAfter": seconds,
+            })
             c.Abort()
             return
         }
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// fakeClock is a settable time source for limiters under test
+type fakeClock struct{ t time.Time }
+
+func (f *fakeClock) now() time.Time { return f.t }
+
+func newTestLimiter(limit int, window time.Duration) (*IPRateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	rl := NewIPRateLimiter(limit, window)
+	rl.now = clock.now
+	return rl, clock
+}
+
+// limitedRouter serves GET /limited behind mw. userID, when set, plays the
+// part of JWTAuthMiddleware.
+func limitedRouter(mw gin.HandlerFunc, userID func(*http.Request) string) *gin.Engine {
+	router := gin.New()
+	router.GET("/limited", func(c *gin.Context) {
+		if userID != nil {
+			if id := userID(c.Request); id != "" {
+				c.Set("userId", id)
+			}
+		}
+		c.Next()
+	}, mw, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func get(router *gin.Engine, remoteAddr, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.RemoteAddr = remoteAddr
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	rl, clock := newTestLimiter(2, time.Minute)
+	router := limitedRouter(RateLimitByIP(rl), nil)
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := get(router, "10.0.0.1:1234", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %q", i+1, got, wantRemaining)
+		}
+		clock.t = clock.t.Add(10 * time.Second)
+	}
+
+	w := get(router, "10.0.0.1:1234", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: status %d, want 429", w.Code)
+	}
+	// The first request leaves the window 40s from now
+	if got := w.Header().Get("Retry-After"); got != "40" {
+		t.Errorf("Retry-After = %q, want 40", got)
+	}
+
+	// Another IP has its own allowance
+	if w := get(router, "10.0.0.2:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("other IP: status %d, want 200", w.Code)
+	}
+
+	// Once the window has passed the first IP may send again
+	clock.t = clock.t.Add(time.Minute)
+	if w := get(router, "10.0.0.1:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("after window: status %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitByIPIgnoresForwardedForFromUntrustedClients(t *testing.T) {
+	rl, _ := newTestLimiter(1, time.Minute)
+	router := limitedRouter(RateLimitByIP(rl), nil)
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := send("1.1.1.1"); code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", code)
+	}
+	if code := send("2.2.2.2"); code != http.StatusTooManyRequests {
+		t.Errorf("rotated X-Forwarded-For: status %d, want 429", code)
+	}
+}
+
+func TestRateLimitByUser(t *testing.T) {
+	rl, _ := newTestLimiter(1, time.Minute)
+	router := limitedRouter(RateLimitByUser(rl), func(r *http.Request) string {
+		return r.Header.Get("X-Test-User")
+	})
+
+	if w := get(router, "10.0.0.1:1234", "alice"); w.Code != http.StatusOK {
+		t.Fatalf("alice: status %d, want 200", w.Code)
+	}
+	// Same IP, different user: counted separately
+	if w := get(router, "10.0.0.1:1234", "bob"); w.Code != http.StatusOK {
+		t.Errorf("bob on alice's IP: status %d, want 200", w.Code)
+	}
+	// Same user, different IP: shares the user's allowance
+	w := get(router, "10.0.0.9:1234", "alice")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("alice from another IP: status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+
+	// Without a user the IP is the key
+	if w := get(router, "10.0.0.5:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("anonymous: status %d, want 200", w.Code)
+	}
+	if w := get(router, "10.0.0.5:1234", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("anonymous again: status %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimitDisabledWithZeroLimit(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		rl, _ := newTestLimiter(limit, time.Minute)
+		router := limitedRouter(RateLimitByIP(rl), nil)
+		for i := 0; i < 5; i++ {
+			w := get(router, "10.0.0.1:1234", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("limit %d, request %d: status %d, want 200", limit, i+1, w.Code)
+			}
+			if h := w.Header().Get("X-RateLimit-Limit"); h != "" {
+				t.Errorf("limit %d: X-RateLimit-Limit = %q on a disabled limiter", limit, h)
+			}
+		}
+		if allowed, _, _ := rl.Take("direct"); !allowed {
+			t.Errorf("limit %d: Take refused on a disabled limiter", limit)
+		}
+	}
+}
+
+func TestRateLimiterSweepsIdleKeys(t *testing.T) {
+	rl, clock := newTestLimiter(5, time.Minute)
+	for i := 0; i < 100; i++ {
+		rl.Take("10.0.1." + strconv.Itoa(i))
+	}
+	if len(rl.requests) != 100 {
+		t.Fatalf("tracking %d keys, want 100", len(rl.requests))
+	}
+
+	clock.t = clock.t.Add(2 * time.Minute)
+	rl.Take("10.0.2.1")
+	if len(rl.requests) != 1 {
+		t.Errorf("tracking %d keys after the window, want 1", len(rl.requests))
+	}
+}
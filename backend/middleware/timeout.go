@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutWriter buffers a handler's response so RequestTimeout can answer
+// 504 at the deadline without racing the handler for the connection. The
+// buffered response reaches the client only if the handler finishes in
+// time; after a timeout, further writes are dropped.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	written  bool
+	timedOut bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	header := make(http.Header)
+	for k, v := range w.Header() {
+		header[k] = append([]string(nil), v...)
+	}
+	return &timeoutWriter{ResponseWriter: w, header: header, status: http.StatusOK}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if code > 0 && !w.written && !w.timedOut {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(data), nil
+	}
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// Flush is a no-op: nothing reaches the client until the handler is done
+func (w *timeoutWriter) Flush() {}
+
+// timeOut stops accepting writes from the handler
+func (w *timeoutWriter) timeOut() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timedOut = true
+}
+
+// copyTo sends the buffered response to dst
+func (w *timeoutWriter) copyTo(dst gin.ResponseWriter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for k, v := range w.header {
+		dst.Header()[k] = v
+	}
+	dst.WriteHeader(w.status)
+	if w.written {
+		dst.WriteHeaderNow()
+	}
+	if w.body.Len() > 0 {
+		dst.Write(w.body.Bytes())
+	}
+}
+
+// timeoutBody is the 504 response
+var timeoutBody, _ = json.Marshal(gin.H{
+	"error":   "Request timed out",
+	"code":    "REQUEST_TIMEOUT",
+	"message": "The server took too long to respond. Please try again.",
+})
+
+// RequestTimeout gives every request an overall deadline. Routes listed in
+// overrides (keyed by the registered route path, as in BodyLimitMiddleware)
+// get their own deadline instead. Handlers derive
+// their own Mongo timeouts from the request context, so whichever deadline
+// is sooner wins and queries are cancelled once the request runs out of
+// time. The handler runs in its own goroutine with its response buffered;
+// if it hasn't finished at the deadline the client gets 504 right away and
+// whatever the handler writes afterwards is discarded. The middleware still
+// waits for the handler to return before releasing the gin context, so a
+// handler that ignores its context keeps a goroutine busy, though not the
+// client.
+func RequestTimeout(defaultTimeout time.Duration, overrides map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.IsWebsocket() {
+			c.Next()
+			return
+		}
+
+		timeout := defaultTimeout
+		if override, ok := overrides[c.FullPath()]; ok {
+			timeout = override
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		dst := c.Writer
+		writer := newTimeoutWriter(dst)
+		c.Writer = writer
+
+		done := make(chan struct{})
+		var panicked interface{}
+		go func() {
+			defer close(done)
+			defer func() { panicked = recover() }()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+			c.Writer = dst
+			if panicked != nil {
+				// Let Recovery further up answer it
+				panic(panicked)
+			}
+			writer.copyTo(dst)
+
+		case <-ctx.Done():
+			writer.timeOut()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("⚠️ %s %s exceeded the %s request timeout", c.Request.Method, c.Request.URL.Path, timeout)
+				dst.Header().Set("Content-Type", "application/json; charset=utf-8")
+				dst.Header().Set("Content-Length", strconv.Itoa(len(timeoutBody)))
+				dst.WriteHeader(http.StatusGatewayTimeout)
+				dst.Write(timeoutBody)
+				dst.Flush()
+			}
+
+			<-done
+			c.Writer = dst
+			if panicked != nil {
+				log.Printf("⚠️ %s %s panicked after timing out: %v", c.Request.Method, c.Request.URL.Path, panicked)
+			}
+			c.Abort()
+		}
+	}
+}
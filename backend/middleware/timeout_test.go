@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutServer serves GET /slow behind RequestTimeout(timeout, nil)
+func timeoutServer(t *testing.T, timeout time.Duration, handler gin.HandlerFunc) *httptest.Server {
+	t.Helper()
+	router := gin.New()
+	router.Use(gin.Recovery(), RequestTimeout(timeout, nil))
+	router.GET("/slow", handler)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRequestTimeoutCutsOffSlowHandlerAtDeadline(t *testing.T) {
+	finished := make(chan struct{})
+	server := timeoutServer(t, 50*time.Millisecond, func(c *gin.Context) {
+		defer close(finished)
+		// Ignores the request context on purpose
+		time.Sleep(time.Second)
+		c.JSON(http.StatusOK, gin.H{"late": true})
+	})
+
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "REQUEST_TIMEOUT") || strings.Contains(string(body), "late") {
+		t.Errorf("body = %s, want only the timeout error", body)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Errorf("504 arrived after %s, want it at the 50ms deadline", elapsed)
+	}
+	<-finished
+}
+
+func TestRequestTimeoutCancelsRequestContext(t *testing.T) {
+	cancelled := make(chan error, 1)
+	server := timeoutServer(t, 50*time.Millisecond, func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		cancelled <- c.Request.Context().Err()
+		c.JSON(http.StatusOK, gin.H{"late": true})
+	})
+
+	resp, err := http.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", resp.StatusCode)
+	}
+	select {
+	case err := <-cancelled:
+		if err == nil {
+			t.Error("handler context was not cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler never saw its context cancelled")
+	}
+}
+
+func TestRequestTimeoutPassesFastResponseThrough(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestTimeout(time.Second, nil))
+	router.GET("/fast", func(c *gin.Context) {
+		c.Header("X-Test", "yes")
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+	router.GET("/empty", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", w.Code)
+	}
+	if got := w.Header().Get("X-Test"); got != "yes" {
+		t.Errorf("X-Test = %q, want yes", got)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", got)
+	}
+	if body := w.Body.String(); body != `{"ok":true}` {
+		t.Errorf("body = %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/empty", nil))
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("got %d %q, want an empty 204", w.Code, w.Body.String())
+	}
+}
+
+func TestRequestTimeoutLeavesPanicsToRecovery(t *testing.T) {
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}), RequestTimeout(time.Second, nil))
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
+
+func TestRequestTimeoutGivesOverriddenRoutesLonger(t *testing.T) {
+	slowUpload := func(c *gin.Context) {
+		time.Sleep(200 * time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{"uploaded": true})
+	}
+	router := gin.New()
+	router.Use(RequestTimeout(50*time.Millisecond, map[string]time.Duration{
+		"/api/upload-photo": 2 * time.Second,
+	}))
+	router.POST("/api/upload-photo", slowUpload)
+	router.POST("/api/post", slowUpload)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	for path, want := range map[string]int{
+		"/api/upload-photo": http.StatusOK,
+		"/api/post":         http.StatusGatewayTimeout,
+	} {
+		resp, err := http.Post(server.URL+path, "image/jpeg", strings.NewReader("photo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: status = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Block records that UserID blocked TargetUserID. Blocking works both ways:
+// neither user can contact or discover the other.
+type Block struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"userId" json:"userId"`
+	TargetUserID primitive.ObjectID `bson:"targetUserId" json:"targetUserId"`
+	CreatedAt    int64              `bson:"createdAt" json:"createdAt"`
+}
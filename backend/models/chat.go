@@ -2,10 +2,40 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Chat types. Chats created before group chats existed have no type and are
+// direct chats.
+const (
+	ChatTypeDirect = "direct"
+	ChatTypeGroup  = "group"
+)
+
 type Chat struct {
 	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
 	Participants  []primitive.ObjectID `bson:"participants" json:"participants"`
+	// ParticipantsKey is the sorted participant ids joined with ":"; it backs
+	// a unique index so concurrent CreateChat calls can't create duplicates
+	ParticipantsKey string `bson:"participantsKey,omitempty" json:"-"`
+	CreatedBy     primitive.ObjectID   `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
 	LastMessage   interface{}          `bson:"lastMessage,omitempty" json:"lastMessage,omitempty"`
 	LastMessageAt int64                `bson:"lastMessageAt" json:"lastMessageAt"`
 	CreatedAt     int64                `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+
+	Type   string               `bson:"type,omitempty" json:"type"`
+	Name   string               `bson:"name,omitempty" json:"name,omitempty"`     // groups only
+	Admins []primitive.ObjectID `bson:"admins,omitempty" json:"admins,omitempty"` // groups only
+}
+
+// IsGroup reports whether this is a named group chat rather than a 1:1 chat
+func (c *Chat) IsGroup() bool {
+	return c.Type == ChatTypeGroup
+}
+
+// IsAdmin reports whether userID may manage the group's members
+func (c *Chat) IsAdmin(userID primitive.ObjectID) bool {
+	for _, id := range c.Admins {
+		if id == userID {
+			return true
+		}
+	}
+	return false
 }
\ No newline at end of file
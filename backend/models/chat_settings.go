@@ -0,0 +1,16 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ChatSettings holds one user's preferences for one chat. They only affect
+// that user's view; the other participants never see them.
+type ChatSettings struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	ChatID    primitive.ObjectID `bson:"chatId" json:"chatId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"-"`
+	Archived  bool               `bson:"archived" json:"archived"`
+	Muted     bool               `bson:"muted" json:"muted"` // no push notifications
+	Pinned    bool               `bson:"pinned" json:"pinned"`
+	ClearedAt int64              `bson:"clearedAt,omitempty" json:"clearedAt"` // history before this is hidden
+	UpdatedAt int64              `bson:"updatedAt" json:"updatedAt"`
+}
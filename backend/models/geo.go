@@ -0,0 +1,22 @@
+package models
+
+// GeoPoint is a GeoJSON Point, the shape the users 2dsphere index needs.
+// Coordinates are [longitude, latitude], the reverse of the order the rest
+// of the app uses.
+type GeoPoint struct {
+	Type        string     `bson:"type" json:"type"`
+	Coordinates [2]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewGeoPoint returns the point for lat/lng, or nil when the pair isn't a
+// usable location: the (0,0) default, or out of range values that the
+// 2dsphere index would refuse
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	if lat == 0 && lng == 0 {
+		return nil
+	}
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil
+	}
+	return &GeoPoint{Type: "Point", Coordinates: [2]float64{lng, lat}}
+}
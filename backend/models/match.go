@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Match is created when two users have favorited each other
+type Match struct {
+	ID    primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Users []primitive.ObjectID `bson:"users" json:"users"`
+	// PairKey is the sorted user ids joined with ":"; a unique index on it
+	// keeps one match per pair even if favorites are removed and re-added
+	PairKey   string `bson:"pairKey" json:"-"`
+	CreatedAt int64  `bson:"createdAt" json:"createdAt"`
+}
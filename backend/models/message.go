@@ -2,12 +2,47 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Message types. Anything other than text carries a media URL as content.
+const (
+    MessageTypeText  = "text"
+    MessageTypeImage = "image"
+    MessageTypeVoice = "voice"
+    MessageTypeVideo = "video"
+)
+
+// IsValidMessageType reports whether t is one of the message types above
+func IsValidMessageType(t string) bool {
+    switch t {
+    case MessageTypeText, MessageTypeImage, MessageTypeVoice, MessageTypeVideo:
+        return true
+    }
+    return false
+}
+
 type Message struct {
     ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
     ChatID    primitive.ObjectID `bson:"chatId" json:"chatId"`
     SenderID  primitive.ObjectID `bson:"senderId" json:"senderId"`
     Content   string             `bson:"content" json:"content"`
-    Type      string             `bson:"type" json:"type"` // text, image, voice
+    Type      string             `bson:"type" json:"type"` // text, image, voice, video
+    ReplyToID *primitive.ObjectID `bson:"replyToId,omitempty" json:"replyToId,omitempty"`
     IsRead    bool               `bson:"isRead" json:"isRead"`
+    IsDelivered bool             `bson:"isDelivered" json:"isDelivered"`
+    DeliveredAt int64            `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+    // DeliveryMarker identifies the MarkAsDelivered call that flipped IsDelivered
+    DeliveryMarker primitive.ObjectID `bson:"deliveryMarker,omitempty" json:"-"`
+    // ReadMarker identifies the MarkAsRead call that flipped IsRead
+    ReadMarker primitive.ObjectID `bson:"readMarker,omitempty" json:"-"`
     CreatedAt int64              `bson:"createdAt" json:"createdAt"`
+    EditedAt  int64              `bson:"editedAt,omitempty" json:"editedAt,omitempty"`
+    // Deleted messages keep their document (so replies and receipts still
+    // resolve) but have their content cleared
+    Deleted   bool               `bson:"deleted,omitempty" json:"deleted"`
+    // At most one reaction per user
+    Reactions []Reaction         `bson:"reactions,omitempty" json:"reactions,omitempty"`
+}
+
+type Reaction struct {
+    UserID primitive.ObjectID `bson:"userId" json:"userId"`
+    Emoji  string             `bson:"emoji" json:"emoji"`
 }
@@ -9,5 +9,6 @@ type Post struct {
 	Media     []string           `bson:"media" json:"media"`
 	Category  string             `bson:"category,omitempty" json:"category"` // Optional
 	CreatedAt int64              `bson:"createdAt" json:"createdAt"`
-	User      *Profile           `bson:"-" json:"user,omitempty"` // Populated in response only
+	UpdatedAt int64              `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"` // set on edit
+	User      *PublicProfile     `bson:"-" json:"user,omitempty"` // Populated in response only
 }
\ No newline at end of file
@@ -0,0 +1,12 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// PostLike records that UserID liked PostID. A unique index on the pair
+// keeps a user to one like per post.
+type PostLike struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostID    primitive.ObjectID `bson:"postId" json:"postId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	CreatedAt int64              `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Report reasons accepted by POST /report
+const (
+	ReportReasonSpam       = "spam"
+	ReportReasonHarassment = "harassment"
+	ReportReasonFake       = "fake"
+	ReportReasonOther      = "other"
+)
+
+// IsValidReportReason reports whether reason is one of the ReportReason values
+func IsValidReportReason(reason string) bool {
+	switch reason {
+	case ReportReasonSpam, ReportReasonHarassment, ReportReasonFake, ReportReasonOther:
+		return true
+	}
+	return false
+}
+
+// Report is a user's complaint about another user, reviewed by admins
+type Report struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ReporterID   primitive.ObjectID `bson:"reporterId" json:"reporterId"`
+	TargetUserID primitive.ObjectID `bson:"targetUserId" json:"targetUserId"`
+	Reason       string             `bson:"reason" json:"reason"`
+	Details      string             `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt    int64              `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// RefreshToken is a long-lived login session. Only a hash of the token is
+// stored; the raw value is returned to the client once at issue time.
+type RefreshToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"-"`
+	TokenHash  string             `bson:"tokenHash" json:"-"`
+	Device     string             `bson:"device" json:"device"` // User-Agent at sign-in
+	IP         string             `bson:"ip" json:"ip"`         // approximate (truncated) client IP
+	CreatedAt  int64              `bson:"createdAt" json:"createdAt"`
+	LastUsedAt int64              `bson:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt  int64              `bson:"expiresAt" json:"expiresAt"`
+}
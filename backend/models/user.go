@@ -7,7 +7,9 @@ type User struct {
     Email        string             `bson:"email" json:"email"`
     PasswordHash *string            `bson:"passwordHash,omitempty" json:"-"`
     AuthProvider string             `bson:"authProvider" json:"authProvider"`
+    Role         string             `bson:"role,omitempty" json:"-"` // "admin" for moderators, empty otherwise
     GoogleID     *string            `bson:"googleId,omitempty" json:"-"`
+    Disabled     bool               `bson:"disabled,omitempty" json:"-"` // set by moderators
     CreatedAt    int64              `bson:"createdAt" json:"createdAt"`
     
     // Profile fields
@@ -17,15 +19,77 @@ type User struct {
     Bio          string   `bson:"bio" json:"bio"`
     Gender       string   `bson:"gender" json:"gender"`
     InterestedIn []string `bson:"interestedIn" json:"interestedIn"`
+    Interests    []string `bson:"interests" json:"interests"`
     Photos       []string `bson:"photos" json:"photos"`
     Status       string   `bson:"status" json:"status"`
     
     Latitude     *float64 `bson:"latitude,omitempty" json:"latitude,omitempty"`
     Longitude    *float64 `bson:"longitude,omitempty" json:"longitude,omitempty"`
+    // Location mirrors Latitude/Longitude as GeoJSON for the 2dsphere index;
+    // nil when the user has no usable location
+    Location     *GeoPoint `bson:"location,omitempty" json:"-"`
     
-    BirthDate    int64 `bson:"birthDate" json:"birthDate"`
+    // Only the owner sees the birthdate; everyone else gets the age
+    BirthDate    int64 `bson:"birthDate" json:"-"`
     LastSeen     int64 `bson:"lastSeen" json:"lastSeen"`
     
+    // Email verification; Google accounts arrive verified. The token hash is
+    // replaced on every resend, which invalidates earlier links.
+    EmailVerified         bool   `bson:"emailVerified" json:"emailVerified"`
+    VerificationTokenHash string `bson:"verificationTokenHash,omitempty" json:"-"`
+    VerificationSentAt    int64  `bson:"verificationSentAt,omitempty" json:"-"`
+    
     // NEW: Referral system
     ReferralCode string `bson:"referralCode,omitempty" json:"referralCode"`
+
+    // Matches created after this time count as unseen in the navbar badge
+    MatchesSeenAt int64 `bson:"matchesSeenAt,omitempty" json:"-"`
+
+    // LastPostAt is when the user last created a post, for the post cooldown
+    LastPostAt int64 `bson:"lastPostAt,omitempty" json:"-"`
+
+    // HideMessagePreviews keeps message text out of push notifications
+    HideMessagePreviews bool `bson:"hideMessagePreviews" json:"hideMessagePreviews"`
+}
+
+// HasCompletedOnboarding reports whether the profile has the fields
+// onboarding asks for: a display name other than the username, a gender and
+// at least one interestedIn choice
+func (u *User) HasCompletedOnboarding() bool {
+    return u.Name != "" && u.Name != u.Username && u.Gender != "" && len(u.InterestedIn) > 0
+}
+
+// profileFields lists what counts toward ProfileCompleteness and how much.
+// The weights add up to 100; change them here only.
+var profileFields = []struct {
+    name   string
+    weight int
+    filled func(u *User) bool
+}{
+    {"name", 15, func(u *User) bool { return u.Name != "" && u.Name != u.Username }},
+    {"photos", 20, func(u *User) bool { return len(u.Photos) > 0 }},
+    {"bio", 10, func(u *User) bool { return u.Bio != "" }},
+    {"interests", 15, func(u *User) bool { return len(u.Interests) > 0 }},
+    {"gender", 10, func(u *User) bool { return u.Gender != "" }},
+    {"interestedIn", 10, func(u *User) bool { return len(u.InterestedIn) > 0 }},
+    {"birthDate", 10, func(u *User) bool { return u.BirthDate != 0 }},
+    {"location", 10, func(u *User) bool {
+        return u.Latitude != nil && u.Longitude != nil && !(*u.Latitude == 0 && *u.Longitude == 0)
+    }},
+}
+
+// ProfileCompleteness returns how complete the profile is as a percentage,
+// along with the fields still missing (in profileFields order) so the client
+// can nudge the user
+func (u *User) ProfileCompleteness() (int, []string) {
+    percent := 0
+    missing := []string{}
+    for _, f := range profileFields {
+        if f.filled(u) {
+            percent += f.weight
+        } else {
+            missing = append(missing, f.name)
+        }
+    }
+    return percent, missing
 }
\ No newline at end of file
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProfileFieldWeightsAddUpTo100(t *testing.T) {
+	total := 0
+	for _, f := range profileFields {
+		total += f.weight
+	}
+	if total != 100 {
+		t.Errorf("profile field weights add up to %d, want 100", total)
+	}
+}
+
+func TestProfileCompleteness(t *testing.T) {
+	lat, lng, zero := -1.29, 36.82, 0.0
+	complete := func() User {
+		return User{
+			Name: "Ada", Username: "ada99", Photos: []string{"p.jpg"}, Bio: "hi",
+			Interests: []string{"Music"}, Gender: "female", InterestedIn: []string{"male"},
+			BirthDate: 631152000, Latitude: &lat, Longitude: &lng,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		edit        func(u *User)
+		wantPercent int
+		wantMissing []string
+	}{
+		{"complete", func(u *User) {}, 100, []string{}},
+		{"empty", func(u *User) { *u = User{} }, 0, []string{"name", "photos", "bio", "interests", "gender", "interestedIn", "birthDate", "location"}},
+		{"name is the username", func(u *User) { u.Name = u.Username }, 85, []string{"name"}},
+		{"no photos", func(u *User) { u.Photos = nil }, 80, []string{"photos"}},
+		{"no bio", func(u *User) { u.Bio = "" }, 90, []string{"bio"}},
+		{"no interests", func(u *User) { u.Interests = []string{} }, 85, []string{"interests"}},
+		{"no location", func(u *User) { u.Latitude = nil }, 90, []string{"location"}},
+		{"location at 0,0", func(u *User) { u.Latitude, u.Longitude = &zero, &zero }, 90, []string{"location"}},
+		{"photos and bio missing", func(u *User) { u.Photos, u.Bio = nil, "" }, 70, []string{"photos", "bio"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := complete()
+			tt.edit(&u)
+			percent, missing := u.ProfileCompleteness()
+			if percent != tt.wantPercent || !slices.Equal(missing, tt.wantMissing) {
+				t.Errorf("ProfileCompleteness = %d, %v; want %d, %v", percent, missing, tt.wantPercent, tt.wantMissing)
+			}
+		})
+	}
+}
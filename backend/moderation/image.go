@@ -0,0 +1,70 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ImageModerator decides whether an uploaded image may be stored, e.g. by
+// running it through an NSFW classifier. CheckImage returns false with a
+// human-readable reason when the image is disallowed, and an error when no
+// decision could be made.
+type ImageModerator interface {
+	CheckImage(ctx context.Context, image io.Reader) (bool, string, error)
+}
+
+// AllowAllImages is the ImageModerator used when no classifier is
+// configured. It accepts every image.
+type AllowAllImages struct{}
+
+// CheckImage implements ImageModerator
+func (AllowAllImages) CheckImage(ctx context.Context, image io.Reader) (bool, string, error) {
+	return true, "", nil
+}
+
+// HTTPImageModerator sends the raw image bytes to an external classifier,
+// which answers with {"allowed": bool, "reason": string}
+type HTTPImageModerator struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPImageModerator builds a moderator for the classifier at url, e.g.
+// the IMAGE_MODERATION_URL env var
+func NewHTTPImageModerator(url string) *HTTPImageModerator {
+	return &HTTPImageModerator{URL: url, Client: http.DefaultClient}
+}
+
+// CheckImage implements ImageModerator
+func (m *HTTPImageModerator) CheckImage(ctx context.Context, image io.Reader) (bool, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, image)
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return false, "", fmt.Errorf("calling image classifier: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("calling image classifier: status %d", resp.StatusCode)
+	}
+
+	var verdict struct {
+		Allowed bool   `json:"allowed"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return false, "", fmt.Errorf("decoding image classifier response: %w", err)
+	}
+	if !verdict.Allowed && verdict.Reason == "" {
+		verdict.Reason = "Image is not allowed"
+	}
+	return verdict.Allowed, verdict.Reason, nil
+}
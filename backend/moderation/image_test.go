@@ -0,0 +1,49 @@
+package moderation
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// classifier serves a fake NSFW classifier that rejects images containing
+// "nsfw" and fails on "broken"
+func classifier(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		image, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(image), "broken"):
+			w.WriteHeader(http.StatusInternalServerError)
+		case strings.Contains(string(image), "nsfw"):
+			w.Write([]byte(`{"allowed": false}`))
+		default:
+			w.Write([]byte(`{"allowed": true}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPImageModerator(t *testing.T) {
+	m := NewHTTPImageModerator(classifier(t).URL)
+	tests := []struct {
+		image   string
+		allowed bool
+		reason  string
+		err     bool
+	}{
+		{image: "a cat", allowed: true},
+		{image: "nsfw", reason: "Image is not allowed"},
+		{image: "broken", err: true},
+	}
+	for _, tt := range tests {
+		allowed, reason, err := m.CheckImage(context.Background(), strings.NewReader(tt.image))
+		if allowed != tt.allowed || reason != tt.reason || (err != nil) != tt.err {
+			t.Errorf("CheckImage(%q) = %v, %q, %v; want %v, %q, error %v", tt.image, allowed, reason, err, tt.allowed, tt.reason, tt.err)
+		}
+	}
+}
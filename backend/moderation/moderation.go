@@ -0,0 +1,60 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Moderator decides whether user-generated text may be stored. Check returns
+// false with a human-readable reason when the text is disallowed.
+type Moderator interface {
+	Check(text string) (bool, string)
+}
+
+// KeywordModerator rejects text containing any of a fixed list of terms.
+// Single words match whole words only; multi-word terms match as phrases.
+// Matching is case-insensitive.
+type KeywordModerator struct {
+	words   map[string]bool
+	phrases []string
+}
+
+// NewKeywordModerator builds a moderator from a keyword list, e.g. the
+// MODERATION_KEYWORDS env var
+func NewKeywordModerator(keywords []string) *KeywordModerator {
+	m := &KeywordModerator{words: make(map[string]bool)}
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" {
+			continue
+		}
+		if strings.ContainsFunc(keyword, unicode.IsSpace) {
+			m.phrases = append(m.phrases, keyword)
+		} else {
+			m.words[keyword] = true
+		}
+	}
+	return m
+}
+
+// Check implements Moderator
+func (m *KeywordModerator) Check(text string) (bool, string) {
+	lower := strings.ToLower(text)
+
+	for _, phrase := range m.phrases {
+		if strings.Contains(lower, phrase) {
+			return false, "Content contains a blocked phrase"
+		}
+	}
+
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		if m.words[word] {
+			return false, "Content contains a blocked word"
+		}
+	}
+
+	return true, ""
+}
@@ -0,0 +1,29 @@
+package moderation
+
+import "testing"
+
+func TestKeywordModerator(t *testing.T) {
+	m := NewKeywordModerator([]string{" Spam ", "", "buy now"})
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"hello there", true},
+		{"this is SPAM", false},
+		{"spam!", false},
+		{"a spammer", true},
+		{"Buy   now", true},
+		{"please BUY NOW", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		ok, reason := m.Check(tt.text)
+		if ok != tt.want {
+			t.Errorf("Check(%q) = %v, want %v", tt.text, ok, tt.want)
+		}
+		if !ok && reason == "" {
+			t.Errorf("Check(%q) rejected without a reason", tt.text)
+		}
+	}
+}
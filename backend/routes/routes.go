@@ -1,57 +1,141 @@
 package routes
 
 import (
+    "coded/config"
+    "coded/database"
     "coded/handlers"
     "coded/middleware"
+    "errors"
     "time"
 
     "github.com/gin-contrib/cors"
     "github.com/gin-gonic/gin"
 )
 
+// UploadRequestTimeout is the deadline for the upload routes, which stream up
+// to MAX_UPLOAD_BODY_BYTES and then wait on Cloudinary and image moderation
+func UploadRequestTimeout() time.Duration {
+    return config.Duration("UPLOAD_REQUEST_TIMEOUT", 45*time.Second)
+}
+
+// onboardingGate returns a function giving each named route group its own
+// subgroup of parent, with gate applied only to the groups in required
+func onboardingGate(parent *gin.RouterGroup, required []string, gate gin.HandlerFunc) func(group string) *gin.RouterGroup {
+    return func(group string) *gin.RouterGroup {
+        g := parent.Group("")
+        for _, name := range required {
+            if name == group {
+                g.Use(gate)
+                break
+            }
+        }
+        return g
+    }
+}
+
 func SetupRouter() *gin.Engine {
     router := gin.Default()
+    if err := configureTrustedProxies(router); err != nil {
+        panic(err)
+    }
 
     // Add health check endpoint for testing
     router.GET("/api/health", func(c *gin.Context) {
         c.JSON(200, gin.H{
-            "status":  "ok",
-            "message": "Coded API is running",
-            "time":    time.Now().Unix(),
-            "ws":      "WebSocket available at /ws",
-            "google":  "Google OAuth available",
+            "status":   "ok",
+            "message":  "Coded API is running",
+            "time":     time.Now().Unix(),
+            "ws":       "WebSocket available at /ws",
+            "google":   "Google OAuth available",
+            "database": database.Available(),
         })
     })
 
     // CORS configuration - FIXED with WebSocket support
-    router.Use(cors.New(cors.Config{
-        AllowOrigins:     []string{"http://localhost:8080", "http://127.0.0.1:8080", "http://localhost:5500", "http://127.0.0.1:5500", "http://localhost:3000"},
+    corsConfig := cors.Config{
+        AllowOrigins:     config.List("CORS_ALLOWED_ORIGINS", []string{"http://localhost:8080", "http://127.0.0.1:8080", "http://localhost:5500", "http://127.0.0.1:5500", "http://localhost:3000"}),
         AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
         AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With"},
-        ExposeHeaders:    []string{"Content-Length", "Content-Type"},
-        AllowCredentials: true,
+        ExposeHeaders:    []string{"Content-Length", "Content-Type", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining"},
+        AllowCredentials: config.Bool("CORS_ALLOW_CREDENTIALS", true),
         MaxAge:           12 * time.Hour,
-    }))
+    }
+    if err := validateCORSConfig(corsConfig); err != nil {
+        panic(err)
+    }
+    router.Use(cors.New(corsConfig))
+
+    // Request body limits - uploads get a larger allowance than JSON APIs
+    uploadLimit := config.Int64("MAX_UPLOAD_BODY_BYTES", 15<<20)
+    router.Use(middleware.BodyLimitMiddleware(
+        config.Int64("MAX_BODY_BYTES", 1<<20),
+        map[string]int64{
+            "/api/me":           uploadLimit,
+            "/api/upload-photo": uploadLimit,
+        },
+    ))
+
+    // Everything under /api needs MongoDB; fail fast with 503 during an outage
+    api := router.Group("/api")
+    api.Use(middleware.RequireDatabase())
+
+    // Overall deadline per request; kept under the server's WriteTimeout so
+    // the 504 still reaches the client. Uploads get longer, matching their
+    // larger body allowance.
+    uploadTimeout := UploadRequestTimeout()
+    api.Use(middleware.RequestTimeout(
+        config.Duration("REQUEST_TIMEOUT", 12*time.Second),
+        map[string]time.Duration{
+            "/api/me":           uploadTimeout,
+            "/api/upload-photo": uploadTimeout,
+        },
+    ))
+
+    // Per-route limits on the auth endpoints, per client IP; override with
+    // <NAME>_RATE_LIMIT and RATE_LIMIT_WINDOW. Each route counts separately.
+    rateWindow := config.Duration("RATE_LIMIT_WINDOW", time.Minute)
+    limitByIP := func(name string, def int) gin.HandlerFunc {
+        return middleware.RateLimitByIP(middleware.NewIPRateLimiter(config.Int(name+"_RATE_LIMIT", def), rateWindow))
+    }
 
     // Public routes (no auth required)
-    router.POST("/api/signup", handlers.Signup)
-    router.POST("/api/login", handlers.Login)
-    router.GET("/api/vapid-public-key", handlers.GetVapidPublicKey)
+    api.POST("/signup", limitByIP("SIGNUP", 5), handlers.Signup)
+    api.POST("/login", limitByIP("LOGIN", 10), handlers.Login)
+    api.POST("/refresh", limitByIP("REFRESH", 30), handlers.RefreshSession)
+    api.POST("/logout", handlers.Logout)
+    api.GET("/vapid-public-key", handlers.GetVapidPublicKey)
+    api.GET("/interests", handlers.GetInterests)
+    api.GET("/verify-email", handlers.VerifyEmail)
     
     // Google OAuth routes
-    router.GET("/api/google/auth-url", handlers.GetGoogleAuthURL)
-    router.GET("/api/google/callback", handlers.GoogleOAuthCallback)
-    router.POST("/api/google-auth", handlers.GoogleAuthWithCredential)
+    api.GET("/google/auth-url", handlers.GetGoogleAuthURL)
+    api.GET("/google/callback", handlers.GoogleOAuthCallback)
+    api.POST("/google-auth", limitByIP("GOOGLE_AUTH", 10), handlers.GoogleAuthWithCredential)
 
     // Protected routes group
-    protected := router.Group("/api")
+    protected := api.Group("")
     protected.Use(middleware.JWTAuthMiddleware())
+    protected.Use(middleware.TrackLastSeen(config.Duration("LAST_SEEN_INTERVAL", time.Minute)))
+
+    // Route groups listed in ONBOARDING_REQUIRED_FOR ("posts", "messages",
+    // "favorites") only accept users who have finished onboarding
+    gated := onboardingGate(protected, config.List("ONBOARDING_REQUIRED_FOR", nil), middleware.RequireOnboarding())
 
     // Profile
     protected.GET("/me", handlers.GetMyProfile)
     protected.PUT("/me", handlers.UpdateMyProfile)
+    protected.DELETE("/me", handlers.DeleteAccount)
     protected.GET("/user/:id", handlers.GetUser)
     protected.PUT("/me/status", handlers.UpdateUserStatus)
+    protected.PUT("/me/location", handlers.UpdateMyLocation)
+    protected.PUT("/me/avatar/select", handlers.SelectAvatar)
+    protected.PUT("/me/settings", handlers.UpdateSettings)
+    protected.GET("/me/onboarding", handlers.GetOnboardingStatus)
+    protected.POST("/resend-verification", handlers.ResendVerification)
+
+    // Sessions
+    protected.GET("/me/sessions", handlers.GetSessions)
+    protected.DELETE("/me/sessions/:id", handlers.RevokeSession)
 
     // Test endpoint
     protected.GET("/test-auth", handlers.TestAuth)
@@ -60,28 +144,59 @@ func SetupRouter() *gin.Engine {
     protected.GET("/users/nearby", handlers.GetNearbyUsers)
 
     // Posts
-    protected.POST("/post", handlers.CreatePost)
+    gated("posts").POST("/post", handlers.CreatePost)
+    protected.PUT("/post/:id", handlers.UpdatePost)
+    protected.DELETE("/post/:id", handlers.DeletePost)
+    protected.POST("/post/:id/like", handlers.LikePost)
+    protected.DELETE("/post/:id/like", handlers.UnlikePost)
     protected.GET("/feed", handlers.GetFeed)
     protected.GET("/user/:id/posts", handlers.GetUserPosts)
     protected.GET("/my/posts", handlers.GetMyPosts)
 
     // Favorites
-    protected.POST("/favorite", handlers.AddFavorite)
+    gated("favorites").POST("/favorite", handlers.AddFavorite)
     protected.DELETE("/favorite", handlers.RemoveFavorite)
     protected.GET("/favorites", handlers.GetFavorites)
+    protected.GET("/favorite/:targetUserId", handlers.GetFavorite)
+
+    // Blocking
+    protected.POST("/block", handlers.BlockUser)
+    protected.DELETE("/block", handlers.UnblockUser)
+    protected.GET("/blocks", handlers.GetBlocks)
+
+    // Moderation reports
+    protected.POST("/report", handlers.ReportUser)
 
     // Matches
     protected.GET("/matches", handlers.GetMatches)
+    protected.GET("/me/matches/count", handlers.GetMatchCount)
+    protected.GET("/me/matches/:id", handlers.GetMatch)
+    protected.POST("/me/matches/seen", handlers.MarkMatchesSeen)
 
     // Chats
     protected.GET("/chats", handlers.GetChatList)
-    protected.POST("/chats", handlers.CreateChat)
+    gated("messages").POST("/chats", handlers.CreateChat)
+    protected.GET("/chats/find", handlers.FindChat)
+    protected.GET("/chats/unread", handlers.GetUnreadCounts)
     protected.GET("/chats/:id", handlers.GetChat)
+    protected.POST("/chats/:id/participants", handlers.AddChatParticipants)
+    protected.DELETE("/chats/:id/participants/:userId", handlers.RemoveChatParticipant)
+    protected.DELETE("/chats/:id/leave", handlers.LeaveChat)
+    protected.PUT("/chats/:id/settings", handlers.UpdateChatSettings)
+    protected.POST("/chats/:id/clear", handlers.ClearChat)
 
     // Messages
-    protected.POST("/message", handlers.SendMessage)
+    gated("messages").POST("/message",
+        middleware.RateLimitByUser(middleware.NewIPRateLimiter(config.Int("MESSAGE_RATE_LIMIT", 60), rateWindow)),
+        handlers.SendMessage)
     protected.GET("/messages/:chatId", handlers.GetMessages)
+    protected.PUT("/messages/:id", handlers.EditMessage)
+    protected.DELETE("/messages/:id", handlers.DeleteMessage)
     protected.POST("/messages/:id/read", handlers.MarkAsRead)
+    protected.POST("/messages/:id/reactions", handlers.AddReaction)
+    protected.DELETE("/messages/:id/reactions", handlers.RemoveReaction)
+    protected.POST("/messages/delivered", handlers.MarkAsDelivered)
+    protected.POST("/messages/sync", handlers.SyncMessages)
     protected.POST("/typing", handlers.SendTypingIndicator) // New endpoint
 
     // Photo upload
@@ -89,10 +204,20 @@ func SetupRouter() *gin.Engine {
 
     // Referral
     protected.GET("/me/referral", handlers.GetReferral)
+    protected.POST("/me/referral/regenerate", handlers.RegenerateReferral)
 
     // Push subscriptions
     protected.POST("/subscribe", handlers.SubscribePush)
 
+    // Admin routes
+    admin := protected.Group("/admin")
+    admin.Use(middleware.RequireAdmin())
+    admin.GET("/ws-stats", handlers.GetWebSocketStats)
+    admin.POST("/cleanup-orphans", handlers.CleanupOrphans)
+    admin.GET("/reports", handlers.GetReports)
+    admin.GET("/users", handlers.GetAdminUsers)
+    admin.PUT("/users/:id/disabled", handlers.SetUserDisabled)
+
     // Add a catch-all for undefined API routes
     router.NoRoute(func(c *gin.Context) {
         // If it's an API route, return JSON 404
@@ -117,4 +242,30 @@ func SetupRouter() *gin.Engine {
     })
 
     return router
+}
+
+// configureTrustedProxies tells gin which proxies may set X-Forwarded-For,
+// from TRUSTED_PROXIES (IPs or CIDRs, comma separated). With none listed the
+// header is ignored and ClientIP is the connecting address, so clients can't
+// pick their own IP to get around the per-IP rate limits.
+func configureTrustedProxies(router *gin.Engine) error {
+    return router.SetTrustedProxies(config.List("TRUSTED_PROXIES", nil))
+}
+
+// validateCORSConfig rejects combinations that are unsafe or that
+// gin-contrib/cors won't honour. Credentials with a "*" origin would let any
+// site make authenticated requests.
+func validateCORSConfig(cfg cors.Config) error {
+    if !cfg.AllowCredentials {
+        return nil
+    }
+    if cfg.AllowAllOrigins {
+        return errors.New("cors: AllowCredentials cannot be combined with AllowAllOrigins")
+    }
+    for _, origin := range cfg.AllowOrigins {
+        if origin == "*" {
+            return errors.New("cors: AllowCredentials cannot be combined with a \"*\" origin; list origins explicitly")
+        }
+    }
+    return nil
 }
\ No newline at end of file
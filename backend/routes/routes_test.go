@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+func clientIPWith(t *testing.T, trusted string) string {
+	t.Helper()
+	t.Setenv("TRUSTED_PROXIES", trusted)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := configureTrustedProxies(router); err != nil {
+		t.Fatalf("configureTrustedProxies: %v", err)
+	}
+	router.GET("/ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestForwardedForIgnoredByDefault(t *testing.T) {
+	if ip := clientIPWith(t, ""); ip != "10.0.0.1" {
+		t.Errorf("ClientIP = %q, want the connecting address 10.0.0.1", ip)
+	}
+}
+
+func TestForwardedForHonouredFromTrustedProxy(t *testing.T) {
+	if ip := clientIPWith(t, "10.0.0.0/8"); ip != "203.0.113.7" {
+		t.Errorf("ClientIP = %q, want the forwarded 203.0.113.7", ip)
+	}
+}
+
+func TestValidateCORSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     cors.Config
+		wantErr bool
+	}{
+		{"credentials with listed origins", cors.Config{AllowCredentials: true, AllowOrigins: []string{"https://coded.app"}}, false},
+		{"credentials with wildcard origin", cors.Config{AllowCredentials: true, AllowOrigins: []string{"https://coded.app", "*"}}, true},
+		{"credentials with all origins", cors.Config{AllowCredentials: true, AllowAllOrigins: true}, true},
+		{"wildcard without credentials", cors.Config{AllowOrigins: []string{"*"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCORSConfig(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateCORSConfig = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetupRouterRejectsCredentialedWildcard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SetupRouter accepted credentials with a wildcard origin")
+		}
+	}()
+	SetupRouter()
+}
+
+func TestOnboardingGateOnlyGatesListedGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	groups := []string{"posts", "messages", "favorites"}
+
+	tests := []struct {
+		name     string
+		required []string
+		gated    map[string]bool
+	}{
+		{"none configured", nil, map[string]bool{}},
+		{"one group", []string{"messages"}, map[string]bool{"messages": true}},
+		{"two groups", []string{"posts", "favorites"}, map[string]bool{"posts": true, "favorites": true}},
+		{"unknown name", []string{"photos"}, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			gate := func(c *gin.Context) { c.AbortWithStatus(http.StatusForbidden) }
+			gated := onboardingGate(router.Group("/api"), tt.required, gate)
+			for _, group := range groups {
+				gated(group).GET("/"+group, func(c *gin.Context) { c.Status(http.StatusOK) })
+			}
+
+			for _, group := range groups {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/"+group, nil))
+				want := http.StatusOK
+				if tt.gated[group] {
+					want = http.StatusForbidden
+				}
+				if w.Code != want {
+					t.Errorf("%s: status = %d, want %d", group, w.Code, want)
+				}
+			}
+		})
+	}
+}
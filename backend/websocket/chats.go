@@ -0,0 +1,200 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"coded/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// subscribe adds the connection to chatID's recipient set
+func (m *Manager) subscribe(c *Client, chatID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.clients[c]; !ok {
+		return // already disconnected
+	}
+	if m.chatClients[chatID] == nil {
+		m.chatClients[chatID] = make(map[*Client]bool)
+	}
+	m.chatClients[chatID][c] = true
+	c.chats[chatID] = true
+}
+
+// removeClient drops a connection from the registry, its user's connection
+// set, the feed and every chat it was subscribed to, closing its send
+// channel. It reports whether this was the user's last connection. Caller
+// must hold m.mu.
+func (m *Manager) removeClient(c *Client) bool {
+	if _, ok := m.clients[c]; !ok {
+		return false
+	}
+	delete(m.clients, c)
+	delete(m.userClients[c.userID], c)
+	lastConnection := len(m.userClients[c.userID]) == 0
+	if lastConnection {
+		delete(m.userClients, c.userID)
+	}
+	delete(m.feedClients, c)
+	for chatID := range c.chats {
+		delete(m.chatClients[chatID], c)
+		if len(m.chatClients[chatID]) == 0 {
+			delete(m.chatClients, chatID)
+		}
+	}
+	close(c.send)
+	return lastConnection
+}
+
+// SubscribeUsers subscribes every open connection of the given users to
+// chatID. Called when a chat is created so participants get its events
+// without re-subscribing.
+func (m *Manager) SubscribeUsers(chatID string, userIDs []string) {
+	m.mu.RLock()
+	var conns []*Client
+	for _, id := range userIDs {
+		for client := range m.userClients[id] {
+			conns = append(conns, client)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, client := range conns {
+		m.subscribe(client, chatID)
+	}
+}
+
+// UnsubscribeUsers stops chatID's events for every open connection of the
+// given users, e.g. after they are removed from a group
+func (m *Manager) UnsubscribeUsers(chatID string, userIDs []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range userIDs {
+		for client := range m.userClients[id] {
+			delete(m.chatClients[chatID], client)
+			delete(client.chats, chatID)
+			delete(client.activeChats, chatID)
+		}
+	}
+	if len(m.chatClients[chatID]) == 0 {
+		delete(m.chatClients, chatID)
+	}
+}
+
+// inChat reports whether this connection is subscribed to chatID
+func (c *Client) inChat(chatID string) bool {
+	c.manager.mu.RLock()
+	defer c.manager.mu.RUnlock()
+	return c.chats[chatID]
+}
+
+// isChatParticipant checks that userID is a participant of chatID
+func isChatParticipant(chatID, userID string) bool {
+	chatOID, err := primitive.ObjectIDFromHex(chatID)
+	if err != nil {
+		return false
+	}
+	userOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chatsColl := database.Chats
+	count, err := chatsColl.CountDocuments(ctx, bson.M{"_id": chatOID, "participants": userOID})
+	if err != nil {
+		log.Printf("❌ WebSocket chat membership check failed: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// userChatIDs lists the ids of every chat userID participates in
+func userChatIDs(userID string) ([]string, error) {
+	userOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chatsColl := database.Chats
+	cursor, err := chatsColl.Find(ctx, bson.M{"participants": userOID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var chats []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &chats); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(chats))
+	for i, chat := range chats {
+		ids[i] = chat.ID.Hex()
+	}
+	return ids, nil
+}
+
+// readableMessageIDs narrows ids to the messages of chatID that userID
+// could have read: ones in that chat that someone else sent. Ids that are
+// malformed or belong elsewhere are dropped.
+func readableMessageIDs(chatID, userID string, ids []string) ([]string, error) {
+	chatOID, err := primitive.ObjectIDFromHex(chatID)
+	if err != nil {
+		return nil, err
+	}
+	userOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	oids := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	if len(oids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messagesColl := database.Messages
+	filter := bson.M{
+		"_id":      bson.M{"$in": oids},
+		"chatId":   chatOID,
+		"senderId": bson.M{"$ne": userOID},
+	}
+	cursor, err := messagesColl.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	readable := make([]string, len(messages))
+	for i, m := range messages {
+		readable[i] = m.ID.Hex()
+	}
+	return readable, nil
+}
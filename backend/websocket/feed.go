@@ -0,0 +1,75 @@
+package websocket
+
+import "log"
+
+// handleSubscribeFeed marks the connection as watching the post feed so it
+// receives new_post events
+func (c *Client) handleSubscribeFeed() {
+	c.manager.mu.Lock()
+	if _, ok := c.manager.clients[c]; ok {
+		c.manager.feedClients[c] = true
+	}
+	c.manager.mu.Unlock()
+
+	c.sendEvent(Event{
+		Type: "feed_subscribed",
+		Payload: map[string]interface{}{
+			"userId": c.userID,
+		},
+	})
+}
+
+// handleUnsubscribeFeed stops new_post events for the connection
+func (c *Client) handleUnsubscribeFeed() {
+	c.manager.mu.Lock()
+	delete(c.manager.feedClients, c)
+	c.manager.mu.Unlock()
+}
+
+// FeedSubscribers returns the distinct users with at least one connection
+// subscribed to the feed
+func (m *Manager) FeedSubscribers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool, len(m.feedClients))
+	var userIDs []string
+	for client := range m.feedClients {
+		if !seen[client.userID] {
+			seen[client.userID] = true
+			userIDs = append(userIDs, client.userID)
+		}
+	}
+	return userIDs
+}
+
+// SendFeedEvent sends an event to userID's feed-subscribed connections only.
+// The caller decides which users should see it (range, visibility).
+func (m *Manager) SendFeedEvent(userID string, event Event) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	encoded := make(map[int][]byte)
+	for client := range m.userClients[userID] {
+		if !m.feedClients[client] {
+			continue
+		}
+
+		msg, ok := encoded[client.version]
+		if !ok {
+			var err error
+			msg, err = event.encodeFor(client.version)
+			if err != nil {
+				log.Printf("❌ Error marshaling WebSocket event %s: %v", event.Type, err)
+				return
+			}
+			encoded[client.version] = msg
+		}
+
+		select {
+		case client.send <- msg:
+		default:
+			log.Printf("⚠️ WebSocket send buffer full for user %s, dropping %s", userID, event.Type)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"coded/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testJWTSecret = "websocket-test-secret-at-least-32-bytes"
+
+func signToken(t *testing.T, secret, userID string, expiresAt time.Time) string {
+	t.Helper()
+	claims := middleware.Claims{
+		UserID:           userID,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expiresAt)},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return token
+}
+
+func TestWebSocketHandlerRejectsBadTokensBeforeUpgrade(t *testing.T) {
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	server := httptest.NewServer(WebSocketHandler(NewManager()))
+	t.Cleanup(server.Close)
+
+	userID := primitive.NewObjectID().Hex()
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, middleware.Claims{UserID: userID}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	tests := map[string]string{
+		"missing":           "",
+		"raw user id":       userID,
+		"forged":            signToken(t, "someone-elses-secret-of-32-bytes!!", userID, time.Now().Add(time.Hour)),
+		"expired":           signToken(t, testJWTSecret, userID, time.Now().Add(-time.Minute)),
+		"unsigned":          unsigned,
+		"non-ObjectID user": signToken(t, testJWTSecret, "admin", time.Now().Add(time.Hour)),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			target := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + url.QueryEscape(token)
+			conn, resp, err := websocket.DefaultDialer.Dial(target, nil)
+			if err == nil {
+				conn.Close()
+				t.Fatal("connection was upgraded")
+			}
+			if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("response = %v, want 401", resp)
+			}
+		})
+	}
+}
+
+// dialManager connects to m as userID over a test server. The server side
+// mirrors WebSocketHandler after authentication, skipping the account and
+// chat lookups that need a database.
+func dialManager(t *testing.T, m *Manager, userID string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := upgradeConn(w, r)
+		if !ok {
+			return
+		}
+		client := newTestClient(m, userID)
+		client.conn = conn
+		client.lastFrameAt.Store(client.connectedAt.UnixNano())
+		client.sendEvent(Event{Type: "connected", Payload: map[string]interface{}{"userId": userID}})
+		go client.writePump()
+		go client.readPump()
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestClientStatsPopulateAfterTraffic(t *testing.T) {
+	m := newRoutingManager()
+	m.pingInterval = 50 * time.Millisecond
+	userID := primitive.NewObjectID().Hex()
+	conn := dialManager(t, m, userID)
+
+	// Reading lets the dialer answer the server's protocol pings
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	if err := conn.WriteJSON(map[string]interface{}{"type": "ping", "payload": map[string]int64{"time": 1}}); err != nil {
+		t.Fatalf("sending ping: %v", err)
+	}
+
+	var stats ClientStats
+	waitFor(t, func() bool {
+		clients := m.ClientStats()[userID]
+		if len(clients) != 1 {
+			return false
+		}
+		stats = clients[0]
+		return stats.BytesReceived > 0 && stats.BytesSent > 0 && stats.LastPongAt > 0
+	})
+	if stats.UserID != userID {
+		t.Errorf("UserID = %q, want %q", stats.UserID, userID)
+	}
+	if now := time.Now().Unix(); stats.ConnectedAt > now || stats.ConnectedAt < now-5 {
+		t.Errorf("ConnectedAt = %d, want about %d", stats.ConnectedAt, now)
+	}
+	if stats.AgeSeconds < 0 {
+		t.Errorf("AgeSeconds = %d, want >= 0", stats.AgeSeconds)
+	}
+	if len(m.ClientStats()) != 1 {
+		t.Errorf("ClientStats has %d users, want 1", len(m.ClientStats()))
+	}
+}
+
+// readFrame returns the next event on conn, keeping numbers as json.Number
+func readFrame(t *testing.T, conn *websocket.Conn) Event {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var event Event
+	if err := decoder.Decode(&event); err != nil {
+		t.Fatalf("decoding frame %s: %v", data, err)
+	}
+	return event
+}
+
+func TestBadFramesKeepConnectionOpen(t *testing.T) {
+	m := newRoutingManager()
+	conn := dialManager(t, m, primitive.NewObjectID().Hex())
+	if event := readFrame(t, conn); event.Type != "connected" {
+		t.Fatalf("first frame = %q, want connected", event.Type)
+	}
+
+	// Each bad frame is followed by a bare ping, whose pong shows the
+	// connection survived and that nothing else was sent in between
+	tests := []struct {
+		name  string
+		raw   string
+		reply string // "" when the frame is dropped silently
+	}{
+		{"not json", `{"type":`, "error"},
+		{"unknown type", `{"type":"self_destruct"}`, "error"},
+		{"missing type", `{"payload":{"chatId":"c1"}}`, "error"},
+		{"wrong payload type", `{"type":"join_chat","payload":{"chatId":42}}`, ""},
+		{"array payload", `{"type":"subscribe_chat","payload":[1,2]}`, ""},
+		{"non-numeric time", `{"type":"ping","payload":{"time":"soon"}}`, "pong"},
+		{"fractional time", `{"type":"ping","payload":{"time":1.5}}`, "pong"},
+	}
+	for _, tt := range tests {
+		for _, raw := range []string{tt.raw, `{"type":"ping"}`} {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+				t.Fatalf("%s: writing frame: %v", tt.name, err)
+			}
+		}
+		if tt.reply != "" {
+			event := readFrame(t, conn)
+			if event.Type != tt.reply || event.Payload["clientTime"] != nil {
+				t.Errorf("%s: reply = %v, want %s without clientTime", tt.name, event, tt.reply)
+			}
+		}
+		if event := readFrame(t, conn); event.Type != "pong" {
+			t.Errorf("%s: got %v before the pong", tt.name, event)
+		}
+	}
+
+	// A large millisecond timestamp survives the round trip exactly
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping","payload":{"time":9007199254740993}}`)); err != nil {
+		t.Fatalf("writing ping: %v", err)
+	}
+	event := readFrame(t, conn)
+	if event.Type != "pong" || event.Payload["clientTime"] != json.Number("9007199254740993") {
+		t.Errorf("reply = %v, want pong echoing clientTime 9007199254740993", event)
+	}
+}
+
+func TestIdleConnectionIsClosed(t *testing.T) {
+	m := newRoutingManager()
+	m.pingInterval = 20 * time.Millisecond
+	m.idleTimeout = 300 * time.Millisecond
+	idle := dialManager(t, m, primitive.NewObjectID().Hex())
+	active := dialManager(t, m, primitive.NewObjectID().Hex())
+
+	// The active client keeps sending application pings well inside the
+	// timeout, for longer than the timeout
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if err := active.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`)); err != nil {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	// Protocol pongs (answered while reading) don't count as activity
+	idle.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = idle.ReadMessage()
+	}
+	if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Code != websocket.CloseGoingAway || closeErr.Text != "idle timeout" {
+		t.Fatalf("idle connection ended with %v, want an idle timeout close", err)
+	}
+
+	<-done
+	active.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	for {
+		if _, _, err := active.ReadMessage(); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Error("active connection was closed as idle")
+			}
+			break
+		}
+	}
+}
@@ -4,144 +4,461 @@ import (
     "encoding/json"
     "log"
     "net/http"
+    "strconv"
     "sync"
+    "sync/atomic"
     "time"
 
+    "coded/config"
+    "coded/middleware"
+
     "github.com/gorilla/websocket"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProtocolVersion is the newest event schema the server emits. Clients pick
+// a version with the ?v= query param at connect time; clients that don't send
+// one are treated as MinProtocolVersion so older builds keep working.
+const (
+    ProtocolVersion    = 1
+    MinProtocolVersion = 1
 )
 
+// Event is a server-emitted WebSocket frame. It is encoded separately for
+// each negotiated protocol version so payloads can be adapted for old clients.
+type Event struct {
+    Type    string                 `json:"type"`
+    Version int                    `json:"v"`
+    Payload map[string]interface{} `json:"payload"`
+
+    // ChatID routes the event to that chat's subscribers only. Empty means
+    // every connected client.
+    ChatID string `json:"-"`
+
+    // ExcludeUserID skips every connection of that user, e.g. so a sender
+    // doesn't get their own typing events back
+    ExcludeUserID string `json:"-"`
+}
+
+// payloadAdapter rewrites a current-version payload into the shape expected
+// by clients on an older protocol version
+type payloadAdapter struct {
+    // below applies the adapter to clients whose version is lower than this
+    below int
+    adapt func(payload map[string]interface{}) map[string]interface{}
+}
+
+// payloadAdapters lists, per event type, the downgrades applied for older
+// clients. Register an adapter here whenever ProtocolVersion is bumped
+// because an event's payload shape changed.
+var payloadAdapters = map[string][]payloadAdapter{}
+
+// encodeFor renders the event for a client speaking the given version,
+// applying any registered downgrades from newest to oldest
+func (e Event) encodeFor(version int) ([]byte, error) {
+    payload := e.Payload
+    adapters := payloadAdapters[e.Type]
+    for i := len(adapters) - 1; i >= 0; i-- {
+        if version < adapters[i].below {
+            payload = adapters[i].adapt(payload)
+        }
+    }
+
+    return json.Marshal(Event{
+        Type:    e.Type,
+        Version: version,
+        Payload: payload,
+    })
+}
+
+// negotiateVersion parses the client's requested version, clamping it to the
+// range the server supports
+func negotiateVersion(raw string) int {
+    version, err := strconv.Atoi(raw)
+    if err != nil || version < MinProtocolVersion {
+        return MinProtocolVersion
+    }
+    if version > ProtocolVersion {
+        return ProtocolVersion
+    }
+    return version
+}
+
 type Manager struct {
     clients    map[*Client]bool
-    broadcast  chan []byte
-    register   chan *Client
+    // chatClients indexes subscribed connections by chatID
+    chatClients map[string]map[*Client]bool
+    // userClients indexes connections by userID; a user may be connected
+    // from several devices at once
+    userClients map[string]map[*Client]bool
+    // feedClients is the set of connections subscribed to new_post events
+    feedClients map[*Client]bool
+    broadcast  chan Event
     unregister chan *Client
     mu         sync.RWMutex
+
+    // typingDebounce is the minimum gap between typing_start broadcasts
+    // from one client for the same chat
+    typingDebounce time.Duration
+
+    // recordingTimeout ends a voice recording indicator that the client
+    // never closed with recording_end
+    recordingTimeout time.Duration
+
+    // idleTimeout closes connections that haven't sent a frame (including an
+    // application-level ping) for this long. Zero disables it.
+    idleTimeout time.Duration
+
+    // pingInterval is how often writePump sends a protocol ping (and checks
+    // idleTimeout). A connection that misses two pongs is dropped.
+    pingInterval time.Duration
+
+    // presenceLocks serializes announcePresence per user; writePresence
+    // persists and fans out one status change
+    presenceLocks *keyedMutex
+    writePresence func(userID, status string)
+
+    // isParticipant checks chat membership before a connection may
+    // subscribe to, open or send receipts for a chat
+    isParticipant func(chatID, userID string) bool
 }
 
 type Client struct {
     conn     *websocket.Conn
     userID   string
+    version  int
     send     chan []byte
     manager  *Manager
+
+    // typingSentAt holds the last typing_start broadcast per chat. Only
+    // touched from readPump, so it needs no locking.
+    typingSentAt map[string]time.Time
+
+    // recordingTimers holds the auto-expiry for each chat this connection is
+    // recording a voice message in. Guarded by manager.mu.
+    recordingTimers map[string]*time.Timer
+
+    // activeChats is the set of chats this connection has open (join_chat /
+    // leave_chat). Guarded by manager.mu since handlers read it.
+    activeChats map[string]bool
+
+    // chats is the set of chats this connection receives events for (see
+    // Manager.chatClients). Guarded by manager.mu.
+    chats map[string]bool
+
+    // Heartbeat/traffic counters for the admin ws-stats endpoint
+    connectedAt   time.Time
+    lastPongAt    atomic.Int64
+    lastFrameAt   atomic.Int64 // UnixNano of the last inbound application frame; control pongs don't count
+    bytesSent     atomic.Int64
+    bytesReceived atomic.Int64
+}
+
+// ClientStats is a snapshot of one connection's health, used to diagnose
+// flaky clients
+type ClientStats struct {
+    UserID        string `json:"userId"`
+    Version       int    `json:"version"`
+    ConnectedAt   int64  `json:"connectedAt"`
+    AgeSeconds    int64  `json:"ageSeconds"`
+    LastPongAt    int64  `json:"lastPongAt"`
+    BytesSent     int64  `json:"bytesSent"`
+    BytesReceived int64  `json:"bytesReceived"`
+}
+
+// isIdle reports whether the client has been silent for longer than the
+// manager's idle timeout
+func (c *Client) isIdle() bool {
+    timeout := c.manager.idleTimeout
+    if timeout <= 0 {
+        return false
+    }
+    return time.Since(time.Unix(0, c.lastFrameAt.Load())) > timeout
+}
+
+func (c *Client) stats() ClientStats {
+    return ClientStats{
+        UserID:        c.userID,
+        Version:       c.version,
+        ConnectedAt:   c.connectedAt.Unix(),
+        AgeSeconds:    int64(time.Since(c.connectedAt).Seconds()),
+        LastPongAt:    c.lastPongAt.Load(),
+        BytesSent:     c.bytesSent.Load(),
+        BytesReceived: c.bytesReceived.Load(),
+    }
 }
 
 func NewManager() *Manager {
-    return &Manager{
-        clients:    make(map[*Client]bool),
-        broadcast:  make(chan []byte),
-        register:   make(chan *Client),
-        unregister: make(chan *Client),
+    m := &Manager{
+        clients:          make(map[*Client]bool),
+        chatClients:      make(map[string]map[*Client]bool),
+        userClients:      make(map[string]map[*Client]bool),
+        feedClients:      make(map[*Client]bool),
+        broadcast:        make(chan Event),
+        unregister:       make(chan *Client),
+        typingDebounce:   config.Duration("WS_TYPING_DEBOUNCE", time.Second),
+        idleTimeout:      config.Duration("WS_IDLE_TIMEOUT", 30*time.Minute),
+        pingInterval:     config.Duration("WS_PING_INTERVAL", 30*time.Second),
+        recordingTimeout: config.Duration("WS_RECORDING_TIMEOUT", time.Minute),
+        presenceLocks:    newKeyedMutex(),
+    }
+    if m.pingInterval <= 0 {
+        m.pingInterval = 30 * time.Second
+    }
+    m.writePresence = m.persistPresence
+    m.isParticipant = isChatParticipant
+    return m
+}
+
+// registerClient adds a new connection to the registry. The handler calls
+// it directly rather than through Start so the connection is registered by
+// the time its chats are subscribed; subscribe ignores unknown clients.
+func (m *Manager) registerClient(client *Client) {
+    m.mu.Lock()
+    m.clients[client] = true
+    firstConnection := m.userClients[client.userID] == nil
+    if firstConnection {
+        m.userClients[client.userID] = make(map[*Client]bool)
+    }
+    m.userClients[client.userID][client] = true
+    total := len(m.clients)
+    m.mu.Unlock()
+
+    log.Printf("✅ WebSocket client registered. Total clients: %d", total)
+    if firstConnection {
+        go m.announcePresence(client.userID, presenceOnline)
     }
 }
 
 func (m *Manager) Start() {
     for {
         select {
-        case client := <-m.register:
+        case client := <-m.unregister:
             m.mu.Lock()
-            m.clients[client] = true
+            lastConnection := m.removeClient(client)
+            total := len(m.clients)
             m.mu.Unlock()
-            log.Printf("✅ WebSocket client registered. Total clients: %d", len(m.clients))
+            log.Printf("❌ WebSocket client unregistered. Total clients: %d", total)
+            if lastConnection {
+                go m.announcePresence(client.userID, presenceOffline)
+            }
             
-        case client := <-m.unregister:
+        case event := <-m.broadcast:
+            // Encode once per protocol version in use
+            encoded := make(map[int][]byte)
             m.mu.Lock()
-            if _, ok := m.clients[client]; ok {
-                delete(m.clients, client)
-                close(client.send)
+            recipients := m.clients
+            if event.ChatID != "" {
+                recipients = m.chatClients[event.ChatID]
             }
-            m.mu.Unlock()
-            log.Printf("❌ WebSocket client unregistered. Total clients: %d", len(m.clients))
-            
-        case message := <-m.broadcast:
-            m.mu.RLock()
-            for client := range m.clients {
+            for client := range recipients {
+                if event.ExcludeUserID != "" && client.userID == event.ExcludeUserID {
+                    continue
+                }
+                msg, ok := encoded[client.version]
+                if !ok {
+                    var err error
+                    msg, err = event.encodeFor(client.version)
+                    if err != nil {
+                        log.Printf("❌ Error marshaling WebSocket event %s: %v", event.Type, err)
+                        continue
+                    }
+                    encoded[client.version] = msg
+                }
+
                 select {
-                case client.send <- message:
+                case client.send <- msg:
                 default:
-                    close(client.send)
-                    delete(m.clients, client)
+                    if m.removeClient(client) {
+                        go m.announcePresence(client.userID, presenceOffline)
+                    }
                 }
             }
-            m.mu.RUnlock()
+            m.mu.Unlock()
         }
     }
 }
 
-func (m *Manager) BroadcastNewMessage(message map[string]interface{}) {
-    data := map[string]interface{}{
-        "type":    "new_message",
-        "payload": message,
-    }
-    
-    msg, err := json.Marshal(data)
-    if err != nil {
-        log.Printf("❌ Error marshaling WebSocket message: %v", err)
+// broadcastToChat queues an event for the subscribers of the chat named by
+// payload[chatKey]. Events without a chat id are dropped rather than sent
+// to everyone.
+func (m *Manager) broadcastToChat(eventType, chatKey string, payload map[string]interface{}) {
+    chatID, _ := payload[chatKey].(string)
+    if chatID == "" {
+        log.Printf("⚠️ Dropping %s broadcast without a chat id", eventType)
         return
     }
-    
-    log.Printf("📢 Broadcasting new message to %d clients", len(m.clients))
-    m.broadcast <- msg
+    m.broadcast <- Event{Type: eventType, ChatID: chatID, Payload: payload}
 }
 
+func (m *Manager) BroadcastNewMessage(message map[string]interface{}) {
+    m.broadcastToChat("new_message", "chatId", message)
+}
+
+// BroadcastChatCreated announces a chat to its participants. Call
+// SubscribeUsers for the participants first.
 func (m *Manager) BroadcastChatCreated(chatData map[string]interface{}) {
-    data := map[string]interface{}{
-        "type":    "chat_created",
-        "payload": chatData,
-    }
-    
-    msg, err := json.Marshal(data)
-    if err != nil {
-        log.Printf("❌ Error marshaling WebSocket message: %v", err)
+    m.broadcastToChat("chat_created", "id", chatData)
+}
+
+// BroadcastChatMembersChanged tells a group's current members who was added
+// or removed
+func (m *Manager) BroadcastChatMembersChanged(payload map[string]interface{}) {
+    m.broadcastToChat("chat_members_changed", "chatId", payload)
+}
+
+// BroadcastChatLeft tells a chat's remaining members that someone left. The
+// same event type acks leave_chat frames, but those only reach the sender
+// and carry no "deleted" field.
+func (m *Manager) BroadcastChatLeft(payload map[string]interface{}) {
+    m.broadcastToChat("chat_left", "chatId", payload)
+}
+
+func (m *Manager) BroadcastMessageRead(payload map[string]interface{}) {
+    m.broadcastToChat("message_read", "chatId", payload)
+}
+
+func (m *Manager) BroadcastMessageEdited(payload map[string]interface{}) {
+    m.broadcastToChat("message_edited", "chatId", payload)
+}
+
+func (m *Manager) BroadcastMessageDeleted(payload map[string]interface{}) {
+    m.broadcastToChat("message_deleted", "chatId", payload)
+}
+
+// BroadcastMessageReaction sends message_reaction to the chat's subscribed
+// participants. A non-empty excludeUserID skips that user's connections, so
+// the reactor can be left out since the HTTP response already told them.
+func (m *Manager) BroadcastMessageReaction(payload map[string]interface{}, excludeUserID string) {
+    chatID, _ := payload["chatId"].(string)
+    if chatID == "" {
+        log.Printf("⚠️ Dropping message_reaction broadcast without a chat id")
         return
     }
-    
-    log.Printf("📢 Broadcasting chat created to %d clients", len(m.clients))
-    m.broadcast <- msg
+    m.broadcast <- Event{
+        Type:          "message_reaction",
+        ChatID:        chatID,
+        ExcludeUserID: excludeUserID,
+        Payload:       payload,
+    }
 }
 
-func (m *Manager) BroadcastMessageRead(payload map[string]interface{}) {
-    data := map[string]interface{}{
-        "type":    "message_read",
-        "payload": payload,
+func (m *Manager) BroadcastMessageDelivered(payload map[string]interface{}) {
+    m.broadcastToChat("message_delivered", "chatId", payload)
+}
+
+// BroadcastTyping sends typing_start or typing_end to the other participants
+// subscribed to chatID, never back to userID. Callers must have checked that
+// userID belongs to the chat.
+func (m *Manager) BroadcastTyping(chatID, userID string, typing bool) {
+    eventType := "typing_end"
+    if typing {
+        eventType = "typing_start"
     }
-    
-    msg, err := json.Marshal(data)
-    if err != nil {
-        log.Printf("❌ Error marshaling WebSocket message: %v", err)
-        return
+    m.broadcast <- Event{
+        Type:          eventType,
+        ChatID:        chatID,
+        ExcludeUserID: userID,
+        Payload: map[string]interface{}{
+            "chatId":    chatID,
+            "userId":    userID,
+            "typing":    typing,
+            "timestamp": time.Now().Unix(),
+        },
     }
-    
-    m.broadcast <- msg
 }
 
-func (m *Manager) BroadcastTypingStart(payload map[string]interface{}) {
-    data := map[string]interface{}{
-        "type":    "typing_start",
-        "payload": payload,
+// BroadcastToUser sends an event to every connection belonging to userID.
+// Clients whose send buffer is full are skipped rather than blocking.
+func (m *Manager) BroadcastToUser(userID string, event Event) {
+    m.SendToUser(userID, event)
+}
+
+// SendToUser sends an event to every connection (device) belonging to
+// userID, encoded for each connection's protocol version, and reports
+// whether any connection accepted it. False means the user is offline or
+// every one of their send buffers was full.
+func (m *Manager) SendToUser(userID string, event Event) bool {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    delivered := false
+    encoded := make(map[int][]byte)
+    for client := range m.userClients[userID] {
+        msg, ok := encoded[client.version]
+        if !ok {
+            var err error
+            msg, err = event.encodeFor(client.version)
+            if err != nil {
+                log.Printf("❌ Error marshaling WebSocket event %s: %v", event.Type, err)
+                return false
+            }
+            encoded[client.version] = msg
+        }
+
+        select {
+        case client.send <- msg:
+            delivered = true
+        default:
+            log.Printf("⚠️ WebSocket send buffer full for user %s, dropping %s", userID, event.Type)
+        }
     }
-    
-    msg, err := json.Marshal(data)
-    if err != nil {
-        log.Printf("❌ Error marshaling WebSocket message: %v", err)
-        return
+    return delivered
+}
+
+// BroadcastChatSettingsUpdated sends a user's new settings for one chat to
+// all of their connections, so archive/mute/pin/clear changes made on one
+// device show up on the others
+func (m *Manager) BroadcastChatSettingsUpdated(userID string, payload map[string]interface{}) {
+    m.BroadcastToUser(userID, Event{Type: "chat_settings_updated", Payload: payload})
+}
+
+// BroadcastReadReceipt tells a sender which of their messages were just
+// read, on all of their connections
+func (m *Manager) BroadcastReadReceipt(senderID string, payload map[string]interface{}) {
+    m.BroadcastToUser(senderID, Event{Type: "read_receipt", Payload: payload})
+}
+
+// BroadcastProfileUpdated tells each of the given users (the profile owner's
+// chat partners) about the owner's new public profile fields
+func (m *Manager) BroadcastProfileUpdated(partnerIDs []string, payload map[string]interface{}) {
+    event := Event{Type: "profile_updated", Payload: payload}
+    for _, partnerID := range partnerIDs {
+        m.BroadcastToUser(partnerID, event)
     }
-    
-    m.broadcast <- msg
 }
 
-func (m *Manager) BroadcastTypingEnd(payload map[string]interface{}) {
-    data := map[string]interface{}{
-        "type":    "typing_end",
-        "payload": payload,
+// ClientStats returns per-connection stats grouped by userID
+func (m *Manager) ClientStats() map[string][]ClientStats {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    stats := make(map[string][]ClientStats)
+    for client := range m.clients {
+        stats[client.userID] = append(stats[client.userID], client.stats())
     }
-    
-    msg, err := json.Marshal(data)
-    if err != nil {
-        log.Printf("❌ Error marshaling WebSocket message: %v", err)
-        return
+    return stats
+}
+
+// IsViewingChat reports whether any of userID's connections currently has
+// chatID open
+func (m *Manager) IsViewingChat(userID, chatID string) bool {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    for client := range m.userClients[userID] {
+        if client.activeChats[chatID] {
+            return true
+        }
     }
-    
-    m.broadcast <- msg
+    return false
+}
+
+// IsUserOnline reports whether userID has at least one open connection
+func (m *Manager) IsUserOnline(userID string) bool {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return len(m.userClients[userID]) > 0
 }
 
 func (m *Manager) GetConnectedUsers() int {
@@ -161,42 +478,77 @@ var upgrader = websocket.Upgrader{
 func WebSocketHandler(manager *Manager) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         token := r.URL.Query().Get("token")
+        if token == "" {
+            token = subprotocolToken(r)
+        }
         if token == "" {
             log.Printf("❌ WebSocket connection rejected: no token provided")
             http.Error(w, "Token required", http.StatusUnauthorized)
             return
         }
         
-        // TODO: Validate JWT token and extract userID
-        // For now, we'll use the token as userID
-        userID := token
-        
-        conn, err := upgrader.Upgrade(w, r, nil)
+        // Reject forged or expired tokens before upgrading
+        claims, err := middleware.ParseToken(token)
         if err != nil {
-            log.Printf("❌ WebSocket upgrade failed: %v", err)
+            log.Printf("❌ WebSocket connection rejected: %v", err)
+            http.Error(w, "Invalid token", http.StatusUnauthorized)
+            return
+        }
+        if _, err := primitive.ObjectIDFromHex(claims.UserID); err != nil {
+            log.Printf("❌ WebSocket connection rejected: invalid user ID in token")
+            http.Error(w, "Invalid token", http.StatusUnauthorized)
+            return
+        }
+        userID := claims.UserID
+        if middleware.AccountDisabled(r.Context(), userID) {
+            log.Printf("❌ WebSocket connection rejected: account %s is disabled", userID)
+            http.Error(w, "Account disabled", http.StatusForbidden)
+            return
+        }
+        
+        conn, ok := upgradeConn(w, r)
+        if !ok {
             return
         }
         
         client := &Client{
             conn:    conn,
             userID:  userID,
+            version: negotiateVersion(r.URL.Query().Get("v")),
             send:    make(chan []byte, 256),
             manager: manager,
+
+            typingSentAt:    make(map[string]time.Time),
+            activeChats:     make(map[string]bool),
+            chats:           make(map[string]bool),
+            recordingTimers: make(map[string]*time.Timer),
+            connectedAt:     time.Now(),
         }
         
-        manager.register <- client
+        client.lastFrameAt.Store(client.connectedAt.UnixNano())
+        
+        manager.registerClient(client)
+        
+        // Route events for all of the user's existing chats to this connection
+        chatIDs, err := userChatIDs(userID)
+        if err != nil {
+            log.Printf("⚠️ Failed to load chats for WebSocket user %s: %v", userID, err)
+        }
+        for _, chatID := range chatIDs {
+            manager.subscribe(client, chatID)
+        }
         
         // Send connection success message
-        welcomeMsg := map[string]interface{}{
-            "type": "connected",
-            "payload": map[string]interface{}{
-                "userId":  userID,
-                "message": "WebSocket connected successfully",
-                "time":    time.Now().Unix(),
+        client.sendEvent(Event{
+            Type: "connected",
+            Payload: map[string]interface{}{
+                "userId":        userID,
+                "message":       "WebSocket connected successfully",
+                "time":          time.Now().Unix(),
+                "serverVersion": ProtocolVersion,
+                "subprotocol":   conn.Subprotocol(),
             },
-        }
-        msg, _ := json.Marshal(welcomeMsg)
-        client.send <- msg
+        })
         
         // Start goroutines for this client
         go client.writePump()
@@ -210,10 +562,12 @@ func (c *Client) readPump() {
         c.conn.Close()
     }()
     
+    pongWait := 2 * c.manager.pingInterval
     c.conn.SetReadLimit(512)
-    c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+    c.conn.SetReadDeadline(time.Now().Add(pongWait))
     c.conn.SetPongHandler(func(string) error {
-        c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+        c.lastPongAt.Store(time.Now().Unix())
+        c.conn.SetReadDeadline(time.Now().Add(pongWait))
         return nil
     })
     
@@ -225,35 +579,52 @@ func (c *Client) readPump() {
             }
             break
         }
+        c.bytesReceived.Add(int64(len(message)))
+        c.lastFrameAt.Store(time.Now().UnixNano())
         
-        var data map[string]interface{}
-        if err := json.Unmarshal(message, &data); err != nil {
+        var frame inboundFrame
+        if err := json.Unmarshal(message, &frame); err != nil {
             log.Printf("❌ WebSocket message unmarshal error: %v", err)
+            c.sendError("Malformed frame")
             continue
         }
         
-        log.Printf("📨 WebSocket message from user %s: %v", c.userID, data)
+        log.Printf("📨 WebSocket message from user %s: %s", c.userID, frame.Type)
         
         // Handle different message types
-        switch data["type"] {
+        switch frame.Type {
         case "subscribe":
-            c.handleSubscribe(data)
+            c.handleSubscribe(frame)
         case "subscribe_chat":
-            c.handleSubscribeChat(data)
+            c.handleSubscribeChat(frame)
+        case "subscribe_feed":
+            c.handleSubscribeFeed()
+        case "unsubscribe_feed":
+            c.handleUnsubscribeFeed()
+        case "join_chat":
+            c.handleJoinChat(frame)
+        case "leave_chat":
+            c.handleLeaveChat(frame)
         case "typing_start":
-            c.handleTypingStart(data)
+            c.handleTypingStart(frame)
         case "typing_end":
-            c.handleTypingEnd(data)
+            c.handleTypingEnd(frame)
+        case "recording_start":
+            c.handleRecordingStart(frame)
+        case "recording_end":
+            c.handleRecordingEnd(frame)
         case "message_read":
-            c.handleMessageRead(data)
+            c.handleMessageRead(frame)
         case "ping":
-            c.sendPong()
+            c.handlePing(frame)
+        default:
+            c.sendError("Unknown frame type")
         }
     }
 }
 
 func (c *Client) writePump() {
-    ticker := time.NewTicker(30 * time.Second)
+    ticker := time.NewTicker(c.manager.pingInterval)
     defer func() {
         ticker.Stop()
         c.conn.Close()
@@ -277,9 +648,21 @@ func (c *Client) writePump() {
             if err := w.Close(); err != nil {
                 return
             }
+            c.bytesSent.Add(int64(len(message)))
             
         case <-ticker.C:
             c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+            // Browsers answer protocol pings on their own, so only frames
+            // the client app sends prove it's still in use. A tab that just
+            // listens must send "ping" frames to stay connected.
+            if c.isIdle() {
+                log.Printf("⏱️ Closing idle WebSocket for user %s", c.userID)
+                c.conn.WriteMessage(websocket.CloseMessage,
+                    websocket.FormatCloseMessage(websocket.CloseGoingAway, "idle timeout"))
+                return
+            }
+
             if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
                 return
             }
@@ -287,138 +670,238 @@ func (c *Client) writePump() {
     }
 }
 
-func (c *Client) handleSubscribe(data map[string]interface{}) {
-    channel, ok := data["channel"].(string)
-    if !ok {
+// sendEvent encodes the event for this client's protocol version and queues it
+func (c *Client) sendEvent(event Event) {
+    msg, err := event.encodeFor(c.version)
+    if err != nil {
+        log.Printf("❌ Error marshaling WebSocket event %s: %v", event.Type, err)
         return
     }
     
-    response := map[string]interface{}{
-        "type": "subscribed",
-        "payload": map[string]interface{}{
-            "channel": channel,
-            "userId":  c.userID,
-            "time":    time.Now().Unix(),
-        },
+    c.send <- msg
+}
+
+// inboundFrame is the envelope of a client->server frame. The payload is kept
+// raw and decoded into a typed struct per event, so numbers don't turn into
+// float64 on the way through map[string]interface{}.
+type inboundFrame struct {
+    Type    string          `json:"type"`
+    Channel string          `json:"channel,omitempty"`
+    Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// chatPayload is the payload of the per-chat frames (subscribe_chat,
+// join_chat, leave_chat, typing_start, typing_end)
+type chatPayload struct {
+    ChatID string `json:"chatId"`
+}
+
+// messageReadPayload is the payload of message_read
+type messageReadPayload struct {
+    ChatID     string   `json:"chatId"`
+    MessageIDs []string `json:"messageIds"`
+}
+
+// pingPayload is the optional payload of ping; Time is the client's clock
+// in milliseconds and is echoed back so clients can measure round trips
+type pingPayload struct {
+    Time int64 `json:"time"`
+}
+
+// sendError tells the client a frame was rejected. The connection stays
+// open; the client just gets no other reply to that frame.
+func (c *Client) sendError(message string) {
+    c.sendEvent(Event{
+        Type:    "error",
+        Payload: map[string]interface{}{"message": message},
+    })
+}
+
+// decodePayload unmarshals the frame payload into v, reporting whether it
+// was present and well-formed
+func (f inboundFrame) decodePayload(v interface{}) bool {
+    if len(f.Payload) == 0 {
+        return false
     }
-    
-    msg, err := json.Marshal(response)
-    if err != nil {
-        log.Printf("❌ Error marshaling subscription response: %v", err)
+    if err := json.Unmarshal(f.Payload, v); err != nil {
+        log.Printf("❌ WebSocket %s payload error: %v", f.Type, err)
+        return false
+    }
+    return true
+}
+
+func (c *Client) handleSubscribe(frame inboundFrame) {
+    if frame.Channel == "" {
         return
     }
     
-    c.send <- msg
+    c.sendEvent(Event{
+        Type: "subscribed",
+        Payload: map[string]interface{}{
+            "channel": frame.Channel,
+            "userId":  c.userID,
+            "time":    time.Now().Unix(),
+        },
+    })
 }
 
-func (c *Client) handleSubscribeChat(data map[string]interface{}) {
-    payload, ok := data["payload"].(map[string]interface{})
-    if !ok {
+// handleSubscribeChat starts routing a chat's events to this connection once
+// the user is confirmed as a participant. Existing chats are subscribed at
+// connect time; this covers chats created since.
+func (c *Client) handleSubscribeChat(frame inboundFrame) {
+    var payload chatPayload
+    if !frame.decodePayload(&payload) || payload.ChatID == "" {
         return
     }
-    
-    chatID, ok := payload["chatId"].(string)
-    if !ok {
+
+    if !c.manager.isParticipant(payload.ChatID, c.userID) {
+        log.Printf("⚠️ User %s tried to subscribe to chat %s without being a participant", c.userID, payload.ChatID)
+        c.sendEvent(Event{
+            Type: "error",
+            Payload: map[string]interface{}{
+                "message": "Not a participant of this chat",
+                "chatId":  payload.ChatID,
+            },
+        })
         return
     }
+    c.manager.subscribe(c, payload.ChatID)
     
-    response := map[string]interface{}{
-        "type": "chat_subscribed",
-        "payload": map[string]interface{}{
-            "chatId": chatID,
+    c.sendEvent(Event{
+        Type: "chat_subscribed",
+        Payload: map[string]interface{}{
+            "chatId": payload.ChatID,
             "userId": c.userID,
         },
+    })
+}
+
+// handleJoinChat marks a chat as open on this connection, so messages sent to
+// it while open count as delivered. Only participants can open a chat.
+func (c *Client) handleJoinChat(frame inboundFrame) {
+    var payload chatPayload
+    if !frame.decodePayload(&payload) || payload.ChatID == "" {
+        return
     }
-    
-    msg, err := json.Marshal(response)
-    if err != nil {
-        log.Printf("❌ Error marshaling chat subscription response: %v", err)
+
+    if !c.manager.isParticipant(payload.ChatID, c.userID) {
+        log.Printf("⚠️ User %s tried to join chat %s without being a participant", c.userID, payload.ChatID)
+        c.sendEvent(Event{
+            Type: "error",
+            Payload: map[string]interface{}{
+                "message": "Not a participant of this chat",
+                "chatId":  payload.ChatID,
+            },
+        })
         return
     }
-    
-    c.send <- msg
+
+    c.manager.mu.Lock()
+    c.activeChats[payload.ChatID] = true
+    c.manager.mu.Unlock()
+
+    c.sendEvent(Event{
+        Type: "chat_joined",
+        Payload: map[string]interface{}{
+            "chatId": payload.ChatID,
+            "userId": c.userID,
+        },
+    })
 }
 
-func (c *Client) handleTypingStart(data map[string]interface{}) {
-    // Broadcast typing start to other clients
-    if payload, ok := data["payload"].(map[string]interface{}); ok {
-        typingData := map[string]interface{}{
-            "type": "typing_start",
-            "payload": map[string]interface{}{
-                "chatId":    payload["chatId"],
-                "userId":    c.userID,
-                "timestamp": time.Now().Unix(),
-            },
-        }
-        
-        msg, err := json.Marshal(typingData)
-        if err != nil {
-            log.Printf("❌ Error marshaling typing start: %v", err)
-            return
-        }
-        
-        c.manager.broadcast <- msg
+// handleLeaveChat marks a chat as closed on this connection. The ack is
+// chat_closed; chat_left means the user left the conversation itself.
+func (c *Client) handleLeaveChat(frame inboundFrame) {
+    var payload chatPayload
+    if !frame.decodePayload(&payload) || payload.ChatID == "" {
+        return
     }
+
+    c.manager.mu.Lock()
+    delete(c.activeChats, payload.ChatID)
+    c.manager.mu.Unlock()
+
+    c.sendEvent(Event{
+        Type: "chat_closed",
+        Payload: map[string]interface{}{
+            "chatId": payload.ChatID,
+            "userId": c.userID,
+        },
+    })
 }
 
-func (c *Client) handleTypingEnd(data map[string]interface{}) {
-    // Broadcast typing end to other clients
-    if payload, ok := data["payload"].(map[string]interface{}); ok {
-        typingData := map[string]interface{}{
-            "type": "typing_end",
-            "payload": map[string]interface{}{
-                "chatId":    payload["chatId"],
-                "userId":    c.userID,
-                "timestamp": time.Now().Unix(),
-            },
-        }
-        
-        msg, err := json.Marshal(typingData)
-        if err != nil {
-            log.Printf("❌ Error marshaling typing end: %v", err)
+func (c *Client) handleTypingStart(frame inboundFrame) {
+    // Tell the chat's other participants; subscription implies membership
+    var payload chatPayload
+    if frame.decodePayload(&payload) && c.inChat(payload.ChatID) {
+        // Coalesce rapid typing_start frames for the same chat
+        now := time.Now()
+        if last, ok := c.typingSentAt[payload.ChatID]; ok && now.Sub(last) < c.manager.typingDebounce {
             return
         }
-        
-        c.manager.broadcast <- msg
+        c.typingSentAt[payload.ChatID] = now
+
+        c.manager.BroadcastTyping(payload.ChatID, c.userID, true)
     }
 }
 
-func (c *Client) handleMessageRead(data map[string]interface{}) {
-    // Broadcast message read to other clients
-    if payload, ok := data["payload"].(map[string]interface{}); ok {
-        readData := map[string]interface{}{
-            "type": "message_read",
-            "payload": map[string]interface{}{
-                "chatId":     payload["chatId"],
-                "userId":     c.userID,
-                "messageIds": payload["messageIds"],
-                "timestamp":  time.Now().Unix(),
-            },
-        }
-        
-        msg, err := json.Marshal(readData)
-        if err != nil {
-            log.Printf("❌ Error marshaling message read: %v", err)
-            return
-        }
-        
-        c.manager.broadcast <- msg
+func (c *Client) handleTypingEnd(frame inboundFrame) {
+    // Tell the chat's other participants; subscription implies membership
+    var payload chatPayload
+    if frame.decodePayload(&payload) && c.inChat(payload.ChatID) {
+        // typing_end always goes out immediately and resets the debounce
+        delete(c.typingSentAt, payload.ChatID)
+
+        c.manager.BroadcastTyping(payload.ChatID, c.userID, false)
     }
 }
 
-func (c *Client) sendPong() {
-    response := map[string]interface{}{
-        "type": "pong",
-        "payload": map[string]interface{}{
-            "time": time.Now().Unix(),
-        },
+func (c *Client) handleMessageRead(frame inboundFrame) {
+    // Broadcast message read to other clients. The subscription can outlive
+    // membership, so re-check it, and only pass on ids that really are
+    // partner messages in this chat.
+    var payload messageReadPayload
+    if !frame.decodePayload(&payload) || !c.inChat(payload.ChatID) {
+        return
     }
-    
-    msg, err := json.Marshal(response)
+    if !c.manager.isParticipant(payload.ChatID, c.userID) {
+        log.Printf("⚠️ User %s sent message_read for chat %s without being a participant", c.userID, payload.ChatID)
+        return
+    }
+
+    messageIDs, err := readableMessageIDs(payload.ChatID, c.userID, payload.MessageIDs)
     if err != nil {
-        log.Printf("❌ Error marshaling pong: %v", err)
+        log.Printf("❌ WebSocket message_read lookup failed: %v", err)
         return
     }
-    
-    c.send <- msg
-}
\ No newline at end of file
+    if len(messageIDs) == 0 {
+        return
+    }
+
+    c.manager.broadcast <- Event{
+        Type:   "message_read",
+        ChatID: payload.ChatID,
+        Payload: map[string]interface{}{
+            "chatId":     payload.ChatID,
+            "userId":     c.userID,
+            "messageIds": messageIDs,
+            "timestamp":  time.Now().Unix(),
+        },
+    }
+}
+
+func (c *Client) handlePing(frame inboundFrame) {
+    pong := map[string]interface{}{
+        "time": time.Now().Unix(),
+    }
+
+    var payload pingPayload
+    if frame.decodePayload(&payload) && payload.Time > 0 {
+        pong["clientTime"] = payload.Time
+    }
+
+    c.sendEvent(Event{
+        Type:    "pong",
+        Payload: pong,
+    })
+}
@@ -0,0 +1,459 @@
+package websocket
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newRoutingManager starts a manager that skips presence writes and treats
+// no one as a chat participant, so no database is needed
+func newRoutingManager() *Manager {
+	m := NewManager()
+	m.writePresence = func(userID, status string) {}
+	m.isParticipant = func(chatID, userID string) bool { return false }
+	go m.Start()
+	return m
+}
+
+// withParticipants makes members (chatID -> userIDs) the manager's view of
+// chat membership
+func withParticipants(m *Manager, members map[string][]string) {
+	m.isParticipant = func(chatID, userID string) bool {
+		for _, member := range members[chatID] {
+			if member == userID {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// frame builds an inbound frame with payload encoded as JSON
+func frame(t *testing.T, eventType string, payload interface{}) inboundFrame {
+	t.Helper()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("encoding payload: %v", err)
+	}
+	return inboundFrame{Type: eventType, Payload: raw}
+}
+
+// newTestClient registers a connection-less client whose frames collect in
+// its send channel
+func newTestClient(m *Manager, userID string) *Client {
+	c := &Client{
+		userID:          userID,
+		version:         ProtocolVersion,
+		send:            make(chan []byte, 16),
+		manager:         m,
+		typingSentAt:    make(map[string]time.Time),
+		activeChats:     make(map[string]bool),
+		chats:           make(map[string]bool),
+		recordingTimers: make(map[string]*time.Timer),
+		connectedAt:     time.Now(),
+	}
+	m.registerClient(c)
+	return c
+}
+
+// nextEvent returns the type of the next frame sent to c, or "" if none
+// arrives within wait
+func nextEvent(t *testing.T, c *Client, wait time.Duration) string {
+	t.Helper()
+	select {
+	case frame := <-c.send:
+		var event Event
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatalf("decoding frame: %v", err)
+		}
+		return event.Type
+	case <-time.After(wait):
+		return ""
+	}
+}
+
+func TestSubscribeRightAfterRegister(t *testing.T) {
+	m := newRoutingManager()
+	c := newTestClient(m, "user-1")
+
+	m.subscribe(c, "chat-1")
+	if !c.inChat("chat-1") {
+		t.Fatal("subscribe straight after registering was dropped")
+	}
+}
+
+func TestChatEventsOnlyReachSubscribers(t *testing.T) {
+	m := newRoutingManager()
+	member := newTestClient(m, "member")
+	outsider := newTestClient(m, "outsider")
+	m.SubscribeUsers("chat-1", []string{"member"})
+
+	m.BroadcastNewMessage(map[string]interface{}{"chatId": "chat-1", "content": "hi"})
+	m.BroadcastMessageRead(map[string]interface{}{"chatId": "chat-1", "messageIds": []string{"m1"}})
+	m.BroadcastTyping("chat-1", "someone", true)
+
+	for _, want := range []string{"new_message", "message_read", "typing_start"} {
+		if got := nextEvent(t, member, time.Second); got != want {
+			t.Errorf("member got %q, want %q", got, want)
+		}
+	}
+	if got := nextEvent(t, outsider, 100*time.Millisecond); got != "" {
+		t.Errorf("outsider received %q from a chat it isn't in", got)
+	}
+}
+
+func TestUnsubscribedClientStopsReceiving(t *testing.T) {
+	m := newRoutingManager()
+	c := newTestClient(m, "user-1")
+	m.SubscribeUsers("chat-1", []string{"user-1"})
+	m.UnsubscribeUsers("chat-1", []string{"user-1"})
+
+	m.BroadcastNewMessage(map[string]interface{}{"chatId": "chat-1", "content": "hi"})
+	if got := nextEvent(t, c, 100*time.Millisecond); got != "" {
+		t.Errorf("removed member received %q", got)
+	}
+}
+
+func TestConcurrentConnectionsPerUser(t *testing.T) {
+	m := newRoutingManager()
+	users := []string{"alice", "bob", "carol"}
+	const devices = 20
+
+	var wg sync.WaitGroup
+	clients := make(chan *Client, len(users)*devices)
+	for _, user := range users {
+		for i := 0; i < devices; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				clients <- newTestClient(m, user)
+			}()
+		}
+	}
+	wg.Wait()
+	close(clients)
+
+	for _, user := range users {
+		if !m.IsUserOnline(user) {
+			t.Errorf("%s is offline with %d connections", user, devices)
+		}
+	}
+	if got := m.GetConnectedUsers(); got != len(users)*devices {
+		t.Errorf("%d connections registered, want %d", got, len(users)*devices)
+	}
+
+	// Drop all but one of alice's connections, and everyone else's
+	var kept *Client
+	for c := range clients {
+		if c.userID == "alice" && kept == nil {
+			kept = c
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.unregister <- c
+		}()
+	}
+	wg.Wait()
+
+	waitFor(t, func() bool { return !m.IsUserOnline("bob") && !m.IsUserOnline("carol") })
+	if !m.IsUserOnline("alice") {
+		t.Error("alice went offline with a connection still open")
+	}
+
+	m.unregister <- kept
+	waitFor(t, func() bool { return !m.IsUserOnline("alice") })
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.clients) != 0 || len(m.userClients) != 0 {
+		t.Errorf("left %d clients and %d user entries behind", len(m.clients), len(m.userClients))
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSendToUserReachesEveryConnection(t *testing.T) {
+	m := newRoutingManager()
+	phone := newTestClient(m, "alice")
+	laptop := newTestClient(m, "alice")
+	other := newTestClient(m, "bob")
+
+	if !m.SendToUser("alice", Event{Type: "match", Payload: map[string]interface{}{"userId": "bob"}}) {
+		t.Fatal("SendToUser reported no delivery to a connected user")
+	}
+	for name, c := range map[string]*Client{"phone": phone, "laptop": laptop} {
+		if got := nextEvent(t, c, time.Second); got != "match" {
+			t.Errorf("%s got %q, want match", name, got)
+		}
+	}
+	if got := nextEvent(t, other, 100*time.Millisecond); got != "" {
+		t.Errorf("another user received %q", got)
+	}
+}
+
+func TestSendToUserAbsentUser(t *testing.T) {
+	m := newRoutingManager()
+	newTestClient(m, "alice")
+
+	if m.SendToUser("nobody", Event{Type: "match"}) {
+		t.Error("SendToUser reported delivery to a user with no connections")
+	}
+}
+
+func TestSendToUserFullBuffers(t *testing.T) {
+	m := newRoutingManager()
+	c := newTestClient(m, "alice")
+	for i := 0; i < cap(c.send); i++ {
+		c.send <- []byte("{}")
+	}
+
+	if m.SendToUser("alice", Event{Type: "match"}) {
+		t.Error("SendToUser reported delivery when every buffer was full")
+	}
+}
+
+func TestJoinAndLeaveChat(t *testing.T) {
+	m := newRoutingManager()
+	withParticipants(m, map[string][]string{"chat-1": {"alice"}})
+	phone := newTestClient(m, "alice")
+	laptop := newTestClient(m, "alice")
+
+	phone.handleJoinChat(frame(t, "join_chat", chatPayload{ChatID: "chat-1"}))
+	if got := nextEvent(t, phone, time.Second); got != "chat_joined" {
+		t.Fatalf("join ack = %q, want chat_joined", got)
+	}
+	if !m.IsViewingChat("alice", "chat-1") {
+		t.Error("joined chat isn't tracked as open")
+	}
+
+	// The other device closing the chat doesn't affect this one
+	laptop.handleLeaveChat(frame(t, "leave_chat", chatPayload{ChatID: "chat-1"}))
+	if got := nextEvent(t, laptop, time.Second); got != "chat_closed" {
+		t.Errorf("leave ack = %q, want chat_closed", got)
+	}
+	if !m.IsViewingChat("alice", "chat-1") {
+		t.Error("closing on one device closed the chat on another")
+	}
+
+	phone.handleLeaveChat(frame(t, "leave_chat", chatPayload{ChatID: "chat-1"}))
+	if got := nextEvent(t, phone, time.Second); got != "chat_closed" {
+		t.Errorf("leave ack = %q, want chat_closed", got)
+	}
+	if m.IsViewingChat("alice", "chat-1") {
+		t.Error("chat still tracked as open after leave_chat")
+	}
+}
+
+func TestJoinChatRequiresParticipant(t *testing.T) {
+	m := newRoutingManager()
+	withParticipants(m, map[string][]string{"chat-1": {"alice"}})
+	mallory := newTestClient(m, "mallory")
+
+	mallory.handleJoinChat(frame(t, "join_chat", chatPayload{ChatID: "chat-1"}))
+	if got := nextEvent(t, mallory, time.Second); got != "error" {
+		t.Errorf("non-participant got %q, want error", got)
+	}
+	if m.IsViewingChat("mallory", "chat-1") {
+		t.Error("non-participant's join was tracked")
+	}
+
+	// Malformed frames are ignored
+	mallory.handleJoinChat(inboundFrame{Type: "join_chat"})
+	mallory.handleJoinChat(frame(t, "join_chat", chatPayload{}))
+	if got := nextEvent(t, mallory, 100*time.Millisecond); got != "" {
+		t.Errorf("malformed join answered with %q", got)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int
+	}{
+		{"", MinProtocolVersion}, // older builds send nothing
+		{"abc", MinProtocolVersion},
+		{"-3", MinProtocolVersion},
+		{strconv.Itoa(MinProtocolVersion - 1), MinProtocolVersion},
+		{strconv.Itoa(MinProtocolVersion), MinProtocolVersion},
+		{strconv.Itoa(ProtocolVersion), ProtocolVersion},
+		{strconv.Itoa(ProtocolVersion + 5), ProtocolVersion},
+	}
+	for _, tt := range tests {
+		if got := negotiateVersion(tt.raw); got != tt.want {
+			t.Errorf("negotiateVersion(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// useAdapters installs adapters for eventType until the test ends
+func useAdapters(t *testing.T, eventType string, adapters ...payloadAdapter) {
+	t.Helper()
+	payloadAdapters[eventType] = adapters
+	t.Cleanup(func() { delete(payloadAdapters, eventType) })
+}
+
+// rename returns an adapter that moves payload[from] to payload[to]
+func rename(below int, from, to string) payloadAdapter {
+	return payloadAdapter{below: below, adapt: func(payload map[string]interface{}) map[string]interface{} {
+		out := make(map[string]interface{}, len(payload))
+		for k, v := range payload {
+			out[k] = v
+		}
+		out[to] = out[from]
+		delete(out, from)
+		return out
+	}}
+}
+
+func decodeEvent(t *testing.T, frame []byte) Event {
+	t.Helper()
+	var event Event
+	if err := json.Unmarshal(frame, &event); err != nil {
+		t.Fatalf("decoding %s: %v", frame, err)
+	}
+	return event
+}
+
+func TestEncodeForAppliesDowngradesNewestFirst(t *testing.T) {
+	// v3 renamed "b" to "c"; v2 had renamed "a" to "b"
+	useAdapters(t, "versioned", rename(2, "b", "a"), rename(3, "c", "b"))
+	event := Event{Type: "versioned", Payload: map[string]interface{}{"c": "value"}}
+
+	for version, key := range map[int]string{3: "c", 2: "b", 1: "a"} {
+		frame, err := event.encodeFor(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := decodeEvent(t, frame)
+		if got.Version != version || got.Type != "versioned" {
+			t.Errorf("v%d: encoded as %q v%d", version, got.Type, got.Version)
+		}
+		if len(got.Payload) != 1 || got.Payload[key] != "value" {
+			t.Errorf("v%d: payload %v, want only %q", version, got.Payload, key)
+		}
+	}
+	if event.Payload["c"] != "value" || len(event.Payload) != 1 {
+		t.Errorf("encoding modified the event's own payload: %v", event.Payload)
+	}
+
+	// Events without adapters go out unchanged
+	frame, _ := Event{Type: "plain", Payload: map[string]interface{}{"c": 1}}.encodeFor(1)
+	if got := decodeEvent(t, frame); got.Payload["c"] != 1.0 {
+		t.Errorf("unadapted payload = %v", got.Payload)
+	}
+}
+
+func TestSendToUserEncodesPerConnectionVersion(t *testing.T) {
+	useAdapters(t, "versioned", rename(ProtocolVersion+1, "new", "old"))
+	m := newRoutingManager()
+	current := newTestClient(m, "alice")
+	older := newTestClient(m, "alice")
+	m.mu.Lock()
+	current.version = ProtocolVersion + 1
+	m.mu.Unlock()
+
+	m.SendToUser("alice", Event{Type: "versioned", Payload: map[string]interface{}{"new": true}})
+	for c, key := range map[*Client]string{current: "new", older: "old"} {
+		select {
+		case frame := <-c.send:
+			if got := decodeEvent(t, frame); got.Payload[key] != true || got.Version != c.version {
+				t.Errorf("v%d client got %s, want %q", c.version, frame, key)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("v%d client got nothing", c.version)
+		}
+	}
+}
+
+// typingEvents drains c's queued frames and counts the typing events
+func typingEvents(t *testing.T, c *Client, wait time.Duration) (starts, ends int) {
+	t.Helper()
+	for {
+		switch nextEvent(t, c, wait) {
+		case "typing_start":
+			starts++
+		case "typing_end":
+			ends++
+		case "":
+			return starts, ends
+		}
+	}
+}
+
+func TestTypingStartIsDebounced(t *testing.T) {
+	m := newRoutingManager()
+	m.typingDebounce = 200 * time.Millisecond
+	typist := newTestClient(m, "alice")
+	partner := newTestClient(m, "bob")
+	m.SubscribeUsers("chat-1", []string{"alice", "bob"})
+	start := frame(t, "typing_start", chatPayload{ChatID: "chat-1"})
+
+	for i := 0; i < 5; i++ {
+		typist.handleTypingStart(start)
+	}
+	if starts, _ := typingEvents(t, partner, 100*time.Millisecond); starts != 1 {
+		t.Errorf("5 typing_start frames within the window broadcast %d times, want 1", starts)
+	}
+
+	// typing_end goes out at once and lets the next start through
+	typist.handleTypingEnd(frame(t, "typing_end", chatPayload{ChatID: "chat-1"}))
+	typist.handleTypingStart(start)
+	if starts, ends := typingEvents(t, partner, 100*time.Millisecond); starts != 1 || ends != 1 {
+		t.Errorf("after typing_end: %d starts, %d ends; want 1 of each", starts, ends)
+	}
+
+	// Once the window has passed, a start is broadcast again
+	time.Sleep(m.typingDebounce)
+	typist.handleTypingStart(start)
+	if starts, _ := typingEvents(t, partner, 100*time.Millisecond); starts != 1 {
+		t.Errorf("typing_start after the window broadcast %d times, want 1", starts)
+	}
+
+	// The window is per chat
+	m.SubscribeUsers("chat-2", []string{"alice", "bob"})
+	typist.handleTypingStart(frame(t, "typing_start", chatPayload{ChatID: "chat-2"}))
+	if starts, _ := typingEvents(t, partner, 100*time.Millisecond); starts != 1 {
+		t.Errorf("typing_start in another chat broadcast %d times, want 1", starts)
+	}
+}
+
+func TestTypingOnlyReachesOtherParticipants(t *testing.T) {
+	m := newRoutingManager()
+	typist := newTestClient(m, "alice")
+	typistPhone := newTestClient(m, "alice")
+	partner := newTestClient(m, "bob")
+	outsider := newTestClient(m, "carol")
+	m.SubscribeUsers("chat-1", []string{"alice", "bob"})
+
+	typist.handleTypingStart(frame(t, "typing_start", chatPayload{ChatID: "chat-1"}))
+	typist.handleTypingEnd(frame(t, "typing_end", chatPayload{ChatID: "chat-1"}))
+	if starts, ends := typingEvents(t, partner, 100*time.Millisecond); starts != 1 || ends != 1 {
+		t.Errorf("partner got %d starts, %d ends; want 1 of each", starts, ends)
+	}
+	for name, c := range map[string]*Client{"typist": typist, "typist's other device": typistPhone, "non-participant": outsider} {
+		if starts, ends := typingEvents(t, c, 50*time.Millisecond); starts+ends != 0 {
+			t.Errorf("%s got %d starts, %d ends; want none", name, starts, ends)
+		}
+	}
+
+	// Someone outside the chat can't make the members see them typing
+	outsider.handleTypingStart(frame(t, "typing_start", chatPayload{ChatID: "chat-1"}))
+	if starts, _ := typingEvents(t, partner, 100*time.Millisecond); starts != 0 {
+		t.Errorf("typing_start from a non-participant reached the chat %d times", starts)
+	}
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"coded/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Presence states carried by presence events and stored in users.status
+const (
+	presenceOnline  = "online"
+	presenceOffline = "offline"
+)
+
+// keyedMutex hands out one mutex per key, dropping each once nobody holds
+// or waits on it
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+// lock acquires key's mutex and returns the function that releases it
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// announcePresence records that userID's first connection opened or last
+// one closed. It does DB work, so run it off the Start loop. Announcements
+// for one user run one at a time, and each re-checks the user's connections
+// first: on a quick reconnect the offline write for the old connection is
+// skipped if the new one is already registered, and can't land after the
+// online write.
+func (m *Manager) announcePresence(userID, status string) {
+	unlock := m.presenceLocks.lock(userID)
+	defer unlock()
+
+	current := presenceOffline
+	if m.IsUserOnline(userID) {
+		current = presenceOnline
+	}
+	if status != current {
+		// A later announcement for the current state is queued behind us
+		return
+	}
+	m.writePresence(userID, status)
+}
+
+// persistPresence stores userID's status and tells everyone they share a
+// chat with
+func (m *Manager) persistPresence(userID, status string) {
+	userOID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	usersColl := database.Users
+	if _, err := usersColl.UpdateOne(ctx,
+		bson.M{"_id": userOID},
+		bson.M{"$set": bson.M{"status": status, "lastSeen": now}},
+	); err != nil {
+		log.Printf("❌ Failed to persist presence for user %s: %v", userID, err)
+	}
+
+	chatsColl := database.Chats
+	partners, err := chatsColl.Distinct(ctx, "participants", bson.M{"participants": userOID})
+	if err != nil {
+		log.Printf("❌ Failed to load chat partners for presence: %v", err)
+		return
+	}
+
+	event := Event{
+		Type: "presence",
+		Payload: map[string]interface{}{
+			"userId": userID,
+			"status": status,
+			"time":   now,
+		},
+	}
+	for _, p := range partners {
+		if id, ok := p.(primitive.ObjectID); ok && id != userOID {
+			m.BroadcastToUser(id.Hex(), event)
+		}
+	}
+}
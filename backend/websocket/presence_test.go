@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// presenceRecorder stands in for persistPresence
+type presenceRecorder struct {
+	mu      sync.Mutex
+	writes  []string
+	running atomic.Int32
+	overlap atomic.Bool
+}
+
+func (p *presenceRecorder) write(userID, status string) {
+	if p.running.Add(1) > 1 {
+		p.overlap.Store(true)
+	}
+	time.Sleep(5 * time.Millisecond)
+	p.mu.Lock()
+	p.writes = append(p.writes, status)
+	p.mu.Unlock()
+	p.running.Add(-1)
+}
+
+func newPresenceManager() (*Manager, *presenceRecorder) {
+	m := NewManager()
+	rec := &presenceRecorder{}
+	m.writePresence = rec.write
+	return m, rec
+}
+
+func connect(m *Manager, userID string) *Client {
+	c := &Client{userID: userID, manager: m}
+	m.mu.Lock()
+	if m.userClients[userID] == nil {
+		m.userClients[userID] = make(map[*Client]bool)
+	}
+	m.userClients[userID][c] = true
+	m.mu.Unlock()
+	return c
+}
+
+func TestAnnouncePresenceSkipsStaleOffline(t *testing.T) {
+	m, rec := newPresenceManager()
+
+	// The old connection's offline announcement runs only after the user
+	// has reconnected
+	connect(m, "user-1")
+	m.announcePresence("user-1", presenceOffline)
+	m.announcePresence("user-1", presenceOnline)
+
+	if len(rec.writes) != 1 || rec.writes[0] != presenceOnline {
+		t.Errorf("writes = %v, want just online", rec.writes)
+	}
+}
+
+func TestAnnouncePresenceSkipsStaleOnline(t *testing.T) {
+	m, rec := newPresenceManager()
+
+	// The user connected and left before the online announcement ran
+	m.announcePresence("user-1", presenceOnline)
+	m.announcePresence("user-1", presenceOffline)
+
+	if len(rec.writes) != 1 || rec.writes[0] != presenceOffline {
+		t.Errorf("writes = %v, want just offline", rec.writes)
+	}
+}
+
+func TestAnnouncePresenceSerializesPerUser(t *testing.T) {
+	m, rec := newPresenceManager()
+	connect(m, "user-1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.announcePresence("user-1", presenceOnline)
+		}()
+	}
+	wg.Wait()
+
+	if rec.overlap.Load() {
+		t.Error("presence writes for one user overlapped")
+	}
+	if len(m.presenceLocks.locks) != 0 {
+		t.Errorf("%d presence locks left behind", len(m.presenceLocks.locks))
+	}
+}
+
+func (p *presenceRecorder) statuses() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.writes...)
+}
+
+func TestPresenceWrittenOnFirstConnectAndLastDisconnect(t *testing.T) {
+	m, rec := newPresenceManager()
+	go m.Start()
+
+	phone := newTestClient(m, "user-1")
+	waitFor(t, func() bool { return len(rec.statuses()) == 1 })
+	laptop := newTestClient(m, "user-1")
+
+	// Closing one of two connections leaves the user online
+	m.unregister <- phone
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.statuses(); len(got) != 1 || got[0] != presenceOnline {
+		t.Fatalf("writes after closing one connection = %v, want just online", got)
+	}
+
+	m.unregister <- laptop
+	waitFor(t, func() bool { return len(rec.statuses()) == 2 })
+	if got := rec.statuses(); got[1] != presenceOffline {
+		t.Errorf("writes = %v, want online then offline", got)
+	}
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import "time"
+
+// handleRecordingStart tells the chat's other participants the user is
+// recording a voice message. If no recording_end (or fresh recording_start)
+// arrives within recordingTimeout, the server ends it on the client's behalf
+// so a dropped connection doesn't leave the indicator stuck.
+func (c *Client) handleRecordingStart(frame inboundFrame) {
+	var payload chatPayload
+	if !frame.decodePayload(&payload) || !c.inChat(payload.ChatID) {
+		return
+	}
+	chatID := payload.ChatID
+
+	c.manager.mu.Lock()
+	timer, active := c.recordingTimers[chatID]
+	if active {
+		timer.Stop()
+	}
+	// The callback reads expiry under the lock held here, so it sees the
+	// assignment even if the timer fires at once
+	var expiry *time.Timer
+	expiry = time.AfterFunc(c.manager.recordingTimeout, func() {
+		c.expireRecording(chatID, expiry)
+	})
+	c.recordingTimers[chatID] = expiry
+	c.manager.mu.Unlock()
+
+	// Repeated starts only extend the expiry
+	if !active {
+		c.manager.BroadcastRecording(chatID, c.userID, true)
+	}
+}
+
+// expireRecording ends the recording in chatID when timer fires, unless a
+// newer recording_start has replaced it. A timer that fired while a restart
+// was stopping it would otherwise delete its successor's entry and end the
+// new recording early.
+func (c *Client) expireRecording(chatID string, timer *time.Timer) {
+	c.manager.mu.Lock()
+	current := c.recordingTimers[chatID] == timer
+	if current {
+		delete(c.recordingTimers, chatID)
+	}
+	c.manager.mu.Unlock()
+
+	if current {
+		c.manager.BroadcastRecording(chatID, c.userID, false)
+	}
+}
+
+func (c *Client) handleRecordingEnd(frame inboundFrame) {
+	var payload chatPayload
+	if !frame.decodePayload(&payload) || !c.inChat(payload.ChatID) {
+		return
+	}
+
+	c.manager.mu.Lock()
+	timer, active := c.recordingTimers[payload.ChatID]
+	if active {
+		timer.Stop()
+		delete(c.recordingTimers, payload.ChatID)
+	}
+	c.manager.mu.Unlock()
+
+	if active {
+		c.manager.BroadcastRecording(payload.ChatID, c.userID, false)
+	}
+}
+
+// BroadcastRecording sends recording_start or recording_end to the other
+// participants subscribed to chatID, never back to userID
+func (m *Manager) BroadcastRecording(chatID, userID string, recording bool) {
+	eventType := "recording_end"
+	if recording {
+		eventType = "recording_start"
+	}
+	m.broadcast <- Event{
+		Type:          eventType,
+		ChatID:        chatID,
+		ExcludeUserID: userID,
+		Payload: map[string]interface{}{
+			"chatId":    chatID,
+			"userId":    userID,
+			"recording": recording,
+			"timestamp": time.Now().Unix(),
+		},
+	}
+}
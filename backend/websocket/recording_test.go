@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+// recordingClient returns a client of a manager whose broadcasts are
+// collected on the returned channel instead of being delivered
+func recordingClient(t *testing.T) (*Client, <-chan Event) {
+	t.Helper()
+	m := NewManager()
+	events := make(chan Event, 16)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case event := <-m.broadcast:
+				events <- event
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { close(done) })
+
+	return &Client{
+		userID:          "user-1",
+		manager:         m,
+		recordingTimers: make(map[string]*time.Timer),
+	}, events
+}
+
+func TestExpireRecordingIgnoresReplacedTimer(t *testing.T) {
+	c, events := recordingClient(t)
+	stale := time.NewTimer(time.Hour)
+	current := time.NewTimer(time.Hour)
+	defer stale.Stop()
+	defer current.Stop()
+	c.recordingTimers["chat-1"] = current
+
+	// The old timer fired while a restart was replacing it
+	c.expireRecording("chat-1", stale)
+	if c.recordingTimers["chat-1"] != current {
+		t.Fatal("stale timer removed its successor's entry")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("stale timer broadcast %s", event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.expireRecording("chat-1", current)
+	if _, ok := c.recordingTimers["chat-1"]; ok {
+		t.Error("current timer left its entry behind")
+	}
+	select {
+	case event := <-events:
+		if event.Type != "recording_end" || event.ChatID != "chat-1" {
+			t.Errorf("broadcast %s for %s, want recording_end for chat-1", event.Type, event.ChatID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no recording_end after the current timer fired")
+	}
+}
+
+func TestRecordingReachesOnlyOtherParticipants(t *testing.T) {
+	m := newRoutingManager()
+	recorder := newTestClient(m, "alice")
+	partner := newTestClient(m, "bob")
+	outsider := newTestClient(m, "carol")
+	m.SubscribeUsers("chat-1", []string{"alice", "bob"})
+	start := frame(t, "recording_start", chatPayload{ChatID: "chat-1"})
+	end := frame(t, "recording_end", chatPayload{ChatID: "chat-1"})
+
+	recorder.handleRecordingStart(start)
+	recorder.handleRecordingStart(start) // only extends the expiry
+	recorder.handleRecordingEnd(end)
+	recorder.handleRecordingEnd(end) // nothing left to end
+	for _, want := range []string{"recording_start", "recording_end", ""} {
+		if got := nextEvent(t, partner, 100*time.Millisecond); got != want {
+			t.Errorf("partner got %q, want %q", got, want)
+		}
+	}
+	for name, c := range map[string]*Client{"recorder": recorder, "non-participant": outsider} {
+		if got := nextEvent(t, c, 50*time.Millisecond); got != "" {
+			t.Errorf("%s received %q", name, got)
+		}
+	}
+
+	// A client outside the chat can't start a recording there
+	outsider.handleRecordingStart(start)
+	if got := nextEvent(t, partner, 100*time.Millisecond); got != "" {
+		t.Errorf("recording_start from a non-participant reached the chat as %q", got)
+	}
+}
+
+func TestRecordingExpiresWithoutEnd(t *testing.T) {
+	m := newRoutingManager()
+	m.recordingTimeout = 100 * time.Millisecond
+	recorder := newTestClient(m, "alice")
+	partner := newTestClient(m, "bob")
+	m.SubscribeUsers("chat-1", []string{"alice", "bob"})
+	start := frame(t, "recording_start", chatPayload{ChatID: "chat-1"})
+
+	recorder.handleRecordingStart(start)
+	if got := nextEvent(t, partner, time.Second); got != "recording_start" {
+		t.Fatalf("partner got %q, want recording_start", got)
+	}
+
+	// A fresh start pushes the expiry back
+	time.Sleep(60 * time.Millisecond)
+	recorder.handleRecordingStart(start)
+	if got := nextEvent(t, partner, 60*time.Millisecond); got != "" {
+		t.Fatalf("partner got %q before the extended expiry", got)
+	}
+	if got := nextEvent(t, partner, time.Second); got != "recording_end" {
+		t.Fatalf("partner got %q, want recording_end once the recording expired", got)
+	}
+	m.mu.Lock()
+	_, active := recorder.recordingTimers["chat-1"]
+	m.mu.Unlock()
+	if active {
+		t.Error("expired recording left its timer behind")
+	}
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"coded/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultSubprotocols is what the server speaks when WS_SUBPROTOCOLS is unset
+var defaultSubprotocols = []string{"coded.v1"}
+
+// tokenSubprotocolPrefix marks a Sec-WebSocket-Protocol entry that carries
+// the access token instead of naming a protocol. Browsers can't set headers
+// on a WebSocket, so this keeps the token out of the URL and access logs.
+// The token entry is never echoed back, and a browser fails any handshake
+// whose response doesn't name one of the entries it offered, so clients must
+// offer a supported protocol alongside it:
+//
+//	new WebSocket(url, ["coded.v1", "access_token." + token])
+const tokenSubprotocolPrefix = "access_token."
+
+// supportedSubprotocols lists the subprotocols the server accepts, in order
+// of preference
+func supportedSubprotocols() []string {
+	return config.List("WS_SUBPROTOCOLS", defaultSubprotocols)
+}
+
+// requestedSubprotocols returns the protocols the client offered, leaving out
+// any token entry
+func requestedSubprotocols(r *http.Request) []string {
+	var protocols []string
+	for _, p := range websocket.Subprotocols(r) {
+		if !strings.HasPrefix(p, tokenSubprotocolPrefix) {
+			protocols = append(protocols, p)
+		}
+	}
+	return protocols
+}
+
+// subprotocolToken returns the access token sent as a subprotocol entry, or
+// an empty string
+func subprotocolToken(r *http.Request) string {
+	for _, p := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(p, tokenSubprotocolPrefix) {
+			return strings.TrimPrefix(p, tokenSubprotocolPrefix)
+		}
+	}
+	return ""
+}
+
+// subprotocolAllowed reports whether the handshake may go ahead. Clients that
+// offer no protocol are always let through; with WS_STRICT_SUBPROTOCOL on, a
+// client offering only protocols the server doesn't speak is refused rather
+// than connected without one. A client sending its token as a subprotocol
+// must always offer a supported protocol too, since its browser would drop
+// the connection anyway.
+func subprotocolAllowed(r *http.Request, supported []string) bool {
+	requested := requestedSubprotocols(r)
+	sentToken := subprotocolToken(r) != ""
+	if !sentToken && (len(requested) == 0 || !config.Bool("WS_STRICT_SUBPROTOCOL", false)) {
+		return true
+	}
+	for _, p := range requested {
+		for _, s := range supported {
+			if p == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeConn completes the handshake, echoing the first of the client's
+// protocols the server speaks. A refused handshake gets a 400 naming the
+// supported protocols.
+func upgradeConn(w http.ResponseWriter, r *http.Request) (*websocket.Conn, bool) {
+	supported := supportedSubprotocols()
+	if !subprotocolAllowed(r, supported) {
+		log.Printf("❌ WebSocket connection rejected: unsupported subprotocol %v", requestedSubprotocols(r))
+		http.Error(w, "Unsupported subprotocol; offer one of: "+strings.Join(supported, ", "), http.StatusBadRequest)
+		return nil, false
+	}
+
+	up := upgrader
+	up.Subprotocols = supported
+	conn, err := up.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("❌ WebSocket upgrade failed: %v", err)
+		return nil, false
+	}
+	return conn, true
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSubprotocolAllowed(t *testing.T) {
+	supported := []string{"coded.v1"}
+	tests := []struct {
+		name    string
+		offered string
+		strict  bool
+		want    bool
+	}{
+		{"nothing offered", "", true, true},
+		{"supported", "coded.v1", true, true},
+		{"unknown, lenient", "chat.v9", false, true},
+		{"unknown, strict", "chat.v9", true, false},
+		{"token with protocol", "coded.v1, access_token.abc", false, true},
+		{"token alone, lenient", "access_token.abc", false, false},
+		{"token alone, strict", "access_token.abc", true, false},
+		{"token with unknown protocol", "chat.v9, access_token.abc", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.strict {
+				t.Setenv("WS_STRICT_SUBPROTOCOL", "true")
+			}
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.offered != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.offered)
+			}
+			if got := subprotocolAllowed(r, supported); got != tt.want {
+				t.Errorf("subprotocolAllowed(%q) = %v, want %v", tt.offered, got, tt.want)
+			}
+		})
+	}
+}
+
+// upgradeServer accepts connections with upgradeConn and closes them
+func upgradeServer(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := upgradeConn(w, r); ok {
+			conn.Close()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestUpgradeConnEchoesSupportedProtocol(t *testing.T) {
+	url := upgradeServer(t)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"chat.v9", "coded.v1", "access_token.abc"}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if got := conn.Subprotocol(); got != "coded.v1" {
+		t.Errorf("negotiated %q, want coded.v1", got)
+	}
+}
+
+func TestUpgradeConnRejectsUnsupportedProtocols(t *testing.T) {
+	url := upgradeServer(t)
+
+	for name, offered := range map[string][]string{
+		"token only":      {"access_token.abc"},
+		"unknown, strict": {"chat.v9"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("WS_STRICT_SUBPROTOCOL", "true")
+			dialer := websocket.Dialer{Subprotocols: offered}
+			_, resp, err := dialer.Dial(url, nil)
+			if err == nil {
+				t.Fatal("handshake succeeded, want rejection")
+			}
+			if resp == nil || resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("response = %v, want 400", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Keeps the session alive. Access tokens last 15 minutes; this renews them
+// with the refresh token through POST /api/refresh, both shortly before they
+// expire and when a request comes back 401, then retries that request once.
+// Include it before any page script that calls the API.
+(function () {
+  const API_BASE_URL = (window.location.origin.includes('5500')
+    ? 'https://www.instaping.org'
+    : window.location.origin) + '/api';
+  // Renew this long before the access token expires
+  const REFRESH_MARGIN_MS = 60 * 1000;
+
+  const nativeFetch = window.fetch.bind(window);
+  let refreshing = null;
+  let refreshTimer = null;
+
+  function tokenExpiry(token) {
+    try {
+      const payload = JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+      return payload.exp ? payload.exp * 1000 : 0;
+    } catch {
+      return 0;
+    }
+  }
+
+  function storeSession(data) {
+    if (data.token) localStorage.setItem('token', data.token);
+    if (data.refreshToken) localStorage.setItem('refreshToken', data.refreshToken);
+    scheduleRefresh();
+  }
+
+  function clearSession() {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+    clearTimeout(refreshTimer);
+  }
+
+  // One refresh at a time: the server rotates the refresh token, so a
+  // second concurrent call with the old one would be refused
+  function refreshSession() {
+    if (refreshing) return refreshing;
+
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (!refreshToken) return Promise.resolve(false);
+
+    refreshing = nativeFetch(`${API_BASE_URL}/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken })
+    })
+      .then(async res => {
+        if (res.status === 401) {
+          clearSession();
+          return false;
+        }
+        if (!res.ok) return false;
+        storeSession(await res.json());
+        return true;
+      })
+      .catch(err => {
+        console.error('Session refresh failed:', err);
+        return false;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+    return refreshing;
+  }
+
+  function scheduleRefresh() {
+    clearTimeout(refreshTimer);
+    const token = localStorage.getItem('token');
+    if (!token || !localStorage.getItem('refreshToken')) return;
+
+    const delay = tokenExpiry(token) - Date.now() - REFRESH_MARGIN_MS;
+    refreshTimer = setTimeout(refreshSession, Math.max(delay, 0));
+  }
+
+  function hasBearer(headers) {
+    return headers.has('Authorization') && headers.get('Authorization').startsWith('Bearer ');
+  }
+
+  // Pages read the token once on load; always send the current one, and
+  // renew and retry once on 401
+  window.fetch = async function (input, init = {}) {
+    const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+    if (!hasBearer(headers)) return nativeFetch(input, init);
+
+    const send = () => {
+      headers.set('Authorization', `Bearer ${localStorage.getItem('token')}`);
+      return nativeFetch(input, { ...init, headers });
+    };
+
+    const response = await send();
+    if (response.status !== 401 || !localStorage.getItem('refreshToken')) return response;
+    return (await refreshSession()) ? send() : response;
+  };
+
+  // Revokes the refresh token on the server and forgets the session
+  window.logoutSession = async function () {
+    const refreshToken = localStorage.getItem('refreshToken');
+    clearSession();
+    if (!refreshToken) return;
+    try {
+      await nativeFetch(`${API_BASE_URL}/logout`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refreshToken })
+      });
+    } catch (err) {
+      console.error('Logout failed:', err);
+    }
+  };
+
+  window.storeSession = storeSession;
+  window.refreshSession = refreshSession;
+
+  scheduleRefresh();
+})();